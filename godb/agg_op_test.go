@@ -192,8 +192,8 @@ func TestAggGbyCount(t *testing.T) {
 	agg := NewGroupedAggregator([]AggState{&sa}, gbyFields, hf)
 	iter, _ := agg.Iterator(tid)
 	fields := []FieldType{
-		{"name", "", StringType},
-		{"count", "", IntType},
+		{"name", "", StringType, 0, 0},
+		{"count", "", IntType, 0, 0},
 	}
 	outt1 := Tuple{TupleDesc{fields},
 		[]DBValue{
@@ -249,8 +249,8 @@ func TestAggGbySum(t *testing.T) {
 	iter, _ := agg.Iterator(tid)
 
 	fields := []FieldType{
-		{"name", "", StringType},
-		{"sum", "", IntType},
+		{"name", "", StringType, 0, 0},
+		{"sum", "", IntType, 0, 0},
 	}
 	outt1 := Tuple{TupleDesc{fields},
 		[]DBValue{
@@ -283,7 +283,7 @@ func TestAggFilterCount(t *testing.T) {
 		t.Fatalf(err.Error())
 	}
 
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{"age", "", IntType, 0, 0}
 	filt, err := NewFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
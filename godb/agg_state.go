@@ -57,27 +57,31 @@ func (a *CountAggState) Finalize() *Tuple {
 }
 
 func (a *CountAggState) GetTupleDesc() *TupleDesc {
-	ft := FieldType{a.alias, "", IntType}
+	ft := FieldType{a.alias, "", IntType, 0, 0}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
 	return &td
 }
 
-// Implements the aggregation state for SUM
+// Implements the aggregation state for SUM. The sum of FLOAT or DECIMAL
+// values has the same type as the values; the sum of INT values is an INT.
 type SumAggState struct {
-	sum int64
+	sum   int64
+	fsum  float64      // sum of FLOAT values
+	dsum  DecimalField // sum of DECIMAL values
 	alias string
 	expr  Expr
-
 }
 
 func (a *SumAggState) Copy() AggState {
-	return &SumAggState{a.sum,a.alias,a.expr}
+	return &SumAggState{a.sum, a.fsum, a.dsum, a.alias, a.expr}
 }
 
 func (a *SumAggState) Init(alias string, expr Expr) error {
 	a.sum = 0
+	a.fsum = 0
+	a.dsum = DecimalField{0, 0}
 	a.alias = alias
 	a.expr = expr
 	return nil
@@ -88,32 +92,51 @@ func (a *SumAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	intVal, ok := val.(IntField)
-	if !ok {
-		return
+	switch v := val.(type) {
+	case IntField:
+		a.sum += v.Value
+	case DecimalField:
+		if sum, err := decimalArith("+", a.dsum, v); err == nil {
+			a.dsum = sum
+		}
+	case FloatField:
+		a.fsum += v.Value
 	}
-	a.sum += intVal.Value
 }
 
 func (a *SumAggState) GetTupleDesc() *TupleDesc {
-	return &TupleDesc{[]FieldType{
-		{a.alias, "", IntType},
-	}}
+	ft := a.expr.GetExprType()
+	switch ft.Ftype {
+	case FloatType:
+		return &TupleDesc{[]FieldType{{a.alias, "", FloatType, 0, 0}}}
+	case DecimalType:
+		return &TupleDesc{[]FieldType{{a.alias, "", DecimalType, 0, ft.Scale}}}
+	}
+	return &TupleDesc{[]FieldType{{a.alias, "", IntType, 0, 0}}}
 }
 
 func (a *SumAggState) Finalize() *Tuple {
 	td := a.GetTupleDesc()
-	f := IntField{a.sum}
+	var f DBValue
+	switch td.Fields[0].Ftype {
+	case FloatType:
+		f = FloatField{a.fsum}
+	case DecimalType:
+		f, _ = a.dsum.rescale(td.Fields[0].Scale)
+	default:
+		f = IntField{a.sum}
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for AVG
+// Implements the aggregation state for AVG, which is a FLOAT regardless of the
+// type of the (numeric) values averaged.
 // Note that we always AddTuple() at least once before Finalize()
 // so no worries for divide-by-zero
 type AvgAggState struct {
-	sum   int64
+	sum   float64
 	count int64
 	alias string
 	expr  Expr
@@ -136,36 +159,37 @@ func (a *AvgAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	intVal, ok := val.(IntField)
+	v, ok := numericValue(val)
 	if !ok {
 		return
 	}
-	a.sum += intVal.Value
+	a.sum += v
 	a.count++
 }
 
 func (a *AvgAggState) GetTupleDesc() *TupleDesc {
-	// TODO: some code goes here
-	// return &TupleDesc{} // replace me
 	return &TupleDesc{[]FieldType{
-		{a.alias, "", IntType},
+		{a.alias, "", FloatType, 0, 0},
 	}}
 }
 
 func (a *AvgAggState) Finalize() *Tuple {
 	td := a.GetTupleDesc()
-	avg := a.sum / a.count
-	f := IntField{avg}
+	var avg float64
+	if a.count > 0 {
+		avg = a.sum / float64(a.count)
+	}
+	f := FloatField{avg}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for MAX
+// Implements the aggregation state for MAX, over values of any type
 // Note that we always AddTuple() at least once before Finalize()
 // so no worries for NaN max
 type MaxAggState struct {
-	max   int64
+	max   DBValue // nil until the first value is added
 	alias string
 	expr  Expr
 }
@@ -175,7 +199,7 @@ func (a *MaxAggState) Copy() AggState {
 }
 
 func (a *MaxAggState) Init(alias string, expr Expr) error {
-	a.max = -1 << 63 // smallest int64
+	a.max = nil
 	a.alias = alias
 	a.expr = expr
 	return nil
@@ -186,103 +210,71 @@ func (a *MaxAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	intVal, ok := val.(IntField)
-	if !ok {
-		return
-	}
-	if intVal.Value > a.max {
-		a.max = intVal.Value
+	if cmp, ok := compareValues(val, a.max); a.max == nil || (ok && cmp > 0) {
+		a.max = val
 	}
 }
 
 func (a *MaxAggState) GetTupleDesc() *TupleDesc {
-	// TODO: some code goes here
-	// return &TupleDesc{} // replace me
+	ft := a.expr.GetExprType()
 	return &TupleDesc{[]FieldType{
-		{a.alias, "", IntType},
+		{a.alias, "", ft.Ftype, ft.Precision, ft.Scale},
 	}}
 }
 
 func (a *MaxAggState) Finalize() *Tuple {
-	// TODO: some code goes here
-	// return &Tuple{} // replace me
 	td := a.GetTupleDesc()
-	f := IntField{a.max}
+	f := a.max
+	if f == nil {
+		f = zeroValue(td.Fields[0].Ftype)
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for MIN
+// Implements the aggregation state for MIN, over values of any type
 // Note that we always AddTuple() at least once before Finalize()
 // so no worries for NaN min
 type MinAggState struct {
-	// TODO: some code goes here
-	min   int64
-	minstring string
-	td TupleDesc
+	min   DBValue // nil until the first value is added
 	alias string
 	expr  Expr
 }
 
 func (a *MinAggState) Copy() AggState {
-	// TODO: some code goes here
-	// return nil // replace me
-	// return &MinAggState{a.min, a.alias, a.expr}
-	return &MinAggState{a.min, a.minstring, a.td, a.alias, a.expr}
+	return &MinAggState{a.min, a.alias, a.expr}
 }
 
 func (a *MinAggState) Init(alias string, expr Expr) error {
-	// TODO: some code goes here
-	// return fmt.Errorf("MinAggState.Init not implemented") // replace me
-	// a.min = 1<<63 - 1 // largest int64
+	a.min = nil
 	a.alias = alias
 	a.expr = expr
-	a.td = *a.GetTupleDesc()
-	if expr.GetExprType().Ftype == IntType {
-		a.min = 1<<63 - 1
-	} else if expr.GetExprType().Ftype == StringType {
-		a.minstring = string([]byte{127, 127, 127, 127, 127, 127, 127, 127, 127, 127})
-	}
 	return nil
 }
 
 func (a *MinAggState) AddTuple(t *Tuple) {
-	// TODO: some code goes here
 	val, err := a.expr.EvalExpr(t)
 	if err != nil {
 		return
 	}
-	switch v := val.(type) {
-	case IntField:
-		if v.Value < a.min {
-			a.min = v.Value
-		}
-	case StringField:
-		if v.Value < a.minstring {
-			a.minstring = v.Value
-		}
+	if cmp, ok := compareValues(val, a.min); a.min == nil || (ok && cmp < 0) {
+		a.min = val
 	}
 }
 
 func (a *MinAggState) GetTupleDesc() *TupleDesc {
-	// TODO: some code goes here
-	// return &TupleDesc{} // replace me
+	ft := a.expr.GetExprType()
 	return &TupleDesc{[]FieldType{
-		{a.alias, "", a.expr.GetExprType().Ftype},
+		{a.alias, "", ft.Ftype, ft.Precision, ft.Scale},
 	}}
-
 }
 
 func (a *MinAggState) Finalize() *Tuple {
-	// TODO: some code goes here
-	// return &Tuple{} // replace me
 	td := a.GetTupleDesc()
-	var f DBValue
-	if td.Fields[0].Ftype == IntType {
-		f = IntField{a.min}
-	} else if td.Fields[0].Ftype == StringType {
-		f = StringField{a.minstring}
+	f := a.min
+	if f == nil {
+		f = zeroValue(td.Fields[0].Ftype)
 	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
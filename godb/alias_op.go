@@ -0,0 +1,39 @@
+package godb
+
+// An AliasOp qualifies the fields of the tuples of its child with the alias
+// of a subquery or view in the FROM clause, so that they may be referred to
+// as alias.field, also once the subquery is joined with other tables.
+type AliasOp struct {
+	child Operator
+	alias string
+	desc  *TupleDesc
+}
+
+// Construct an alias operator that qualifies the fields of child with alias.
+func NewAliasOp(alias string, child Operator) *AliasOp {
+	desc := child.Descriptor().copy()
+	desc.setTableAlias(alias)
+	return &AliasOp{child, alias, desc}
+}
+
+// Return the descriptor of the child, with every field qualified by the alias.
+func (a *AliasOp) Descriptor() *TupleDesc {
+	return a.desc
+}
+
+// Return the tuples of the child, with the descriptor of the operator.
+func (a *AliasOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := a.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		t, err := childIter()
+		if t == nil || err != nil {
+			return nil, err
+		}
+		aliased := *t
+		aliased.Desc = *a.desc
+		return &aliased, nil
+	}, nil
+}
@@ -0,0 +1,417 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// A schema change made by ALTER TABLE: the columns of the new schema, where
+// each comes from in the old one, and the renamed columns.
+type schemaChange struct {
+	desc     TupleDesc
+	from     []int     // the position of each column in the old schema, or -1 for added columns
+	defaults []DBValue // the DEFAULT value of each column, or nil
+	notNull  []bool    // whether each added column is NOT NULL
+	renames  map[string]string
+}
+
+// sqlparser discards everything but the table name of an ALTER TABLE
+// statement, so ALTER TABLE is parsed here. The supported forms are
+//
+//	ALTER TABLE t ADD [COLUMN] name type [NOT NULL] [DEFAULT value]
+//	ALTER TABLE t DROP [COLUMN] name
+//	ALTER TABLE t RENAME [COLUMN] name TO new_name
+//
+// The table is rewritten into a new heap file with the new schema in
+// transaction tid, or in a transaction of its own if tid is nil, see
+// [Catalog.alterTable].
+func processAlterTable(c *Catalog, tid *TransactionID, query string) (QueryType, error) {
+	words := strings.Fields(query)
+	if len(words) < 4 || !strings.EqualFold(words[1], "table") {
+		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("malformed ALTER TABLE statement %s", query)}
+	}
+	t, err := c.GetTableInfo(strings.ToLower(words[2]))
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	if err := c.checkNotMaterialized(t.name, "alter"); err != nil {
+		return UnknownQueryType, err
+	}
+	if err := c.checkNotMaintainedFrom(t.name, "alter table"); err != nil {
+		return UnknownQueryType, err
+	}
+	action := strings.ToLower(words[3])
+	args := words[4:]
+	if len(args) > 0 && strings.EqualFold(args[0], "column") {
+		args = args[1:]
+	}
+
+	fields := t.desc.Fields
+	change := &schemaChange{renames: map[string]string{}}
+	for i, f := range fields {
+		change.desc.Fields = append(change.desc.Fields, FieldType{f.Fname, "", f.Ftype, f.Precision, f.Scale})
+		change.from = append(change.from, i)
+		change.defaults = append(change.defaults, t.defaultValue(i))
+		change.notNull = append(change.notNull, false)
+	}
+	switch action {
+	case "add":
+		if len(args) < 2 {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("expected a column definition in %s", query)}
+		}
+		col, err := parseColumnDefinition(afterWords(query, len(words)-len(args)))
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		name := strings.ToLower(col.Name.String())
+		if columnIndex(fields, name) >= 0 {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already has a column %s", t.name, name)}
+		}
+		ftype, err := columnType(col.Type)
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		var def DBValue
+		if col.Type.Default != nil {
+			if col.Type.Default.Type == sqlparser.ValArg {
+				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported default %s for column %s", string(col.Type.Default.Val), name)}
+			}
+			if def, err = parseValue(ftype.Ftype, string(col.Type.Default.Val)); err == nil {
+				def, err = castField(def, ftype)
+			}
+			if err != nil {
+				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("invalid default for column %s: %s", name, err.Error())}
+			}
+		}
+		ftype.Fname = name
+		change.desc.Fields = append(change.desc.Fields, ftype)
+		change.from = append(change.from, -1)
+		change.defaults = append(change.defaults, def)
+		change.notNull = append(change.notNull, bool(col.Type.NotNull))
+
+	case "drop":
+		if len(args) != 1 {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("expected a column name in %s", query)}
+		}
+		pos := columnIndex(fields, args[0])
+		if pos < 0 {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s has no column %s", t.name, args[0])}
+		}
+		if len(fields) == 1 {
+			return UnknownQueryType, GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop %s, the only column of table %s", args[0], t.name)}
+		}
+		change.desc.Fields = slices.Delete(change.desc.Fields, pos, pos+1)
+		change.from = slices.Delete(change.from, pos, pos+1)
+		change.defaults = slices.Delete(change.defaults, pos, pos+1)
+		change.notNull = slices.Delete(change.notNull, pos, pos+1)
+
+	case "rename":
+		if len(args) != 3 || !strings.EqualFold(args[1], "to") {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("expected RENAME [COLUMN] name TO new_name in %s", query)}
+		}
+		pos := columnIndex(fields, args[0])
+		if pos < 0 {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s has no column %s", t.name, args[0])}
+		}
+		name := strings.ToLower(args[2])
+		if other := columnIndex(fields, name); other >= 0 && other != pos {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already has a column %s", t.name, name)}
+		}
+		change.desc.Fields[pos].Fname = name
+		change.renames[fields[pos].Fname] = name
+
+	default:
+		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported ALTER TABLE action %s; only ADD, DROP and RENAME COLUMN are supported", strings.ToUpper(action))}
+	}
+
+	if err := c.alterTable(t, change, tid); err != nil {
+		return UnknownQueryType, err
+	}
+	return AlterTableQueryType, nil
+}
+
+// Return the text of s after its first n words.
+func afterWords(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeft(s, " \t\r\n")
+		end := strings.IndexAny(s, " \t\r\n")
+		if end < 0 {
+			return ""
+		}
+		s = s[end:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// Parse a column definition of CREATE TABLE.
+func parseColumnDefinition(def string) (*sqlparser.ColumnDefinition, error) {
+	stmt, err := sqlparser.Parse("create table t (" + def + ")")
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid column definition %s: %s", def, err.Error())}
+	}
+	ddl, ok := stmt.(*sqlparser.DDL)
+	if !ok || ddl.TableSpec == nil || len(ddl.TableSpec.Columns) != 1 || len(ddl.TableSpec.Indexes) != 0 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid column definition %s", def)}
+	}
+	col := ddl.TableSpec.Columns[0]
+	if ct := strings.ToLower(sqlparser.String(&col.Type)); strings.HasSuffix(ct, " primary key") || strings.Contains(ct, " unique") {
+		return nil, GoDBError{ParseError, fmt.Sprintf("only NOT NULL and DEFAULT may be declared on an added column, not %s", def)}
+	}
+	return col, nil
+}
+
+// Change the schema of t in transaction tid, or in a transaction of its own if
+// tid is nil.
+func (c *Catalog) alterTable(t *Table, change *schemaChange, tid *TransactionID) error {
+	if tid != nil {
+		return c.alterTableInTransaction(t, change, *tid)
+	}
+	own := NewTID()
+	if err := c.bufferPool.BeginTransaction(own); err != nil {
+		return err
+	}
+	if err := c.alterTableInTransaction(t, change, own); err != nil {
+		c.bufferPool.AbortTransaction(own)
+		return err
+	}
+	c.bufferPool.CommitTransaction(own)
+	return nil
+}
+
+// Change the schema of t in transaction tid. Its tuples are copied into a new
+// heap file with the new schema, which replaces the old one in the catalog at
+// once. When tid commits, the new file replaces the old one on disk; the old
+// file is closed once the transactions running then, whose plans may still
+// read it, have finished. If tid aborts, t is put back as it was. If the
+// change fails, e.g., because a constraint depends on a dropped column, t is
+// left as it was.
+//
+// All pages of t are first locked for writing, so a table that another
+// transaction is using cannot be altered.
+//
+// The constraints of t, and the foreign keys that reference it, follow the
+// columns they constrain, and CHECK expressions are rewritten to use the new
+// names of renamed columns.
+func (c *Catalog) alterTableInTransaction(t *Table, change *schemaChange, tid TransactionID) error {
+	old, ok := t.file.(*HeapFile)
+	if !ok {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("ALTER TABLE is only supported on heap files, not %s", t.name)}
+	}
+	to := make([]int, len(t.desc.Fields))
+	for i := range to {
+		to[i] = slices.Index(change.from, i)
+	}
+	dependsOnDropped := func(owner *Table, con *Constraint, columns []int) error {
+		for _, col := range columns {
+			if to[col] < 0 {
+				return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop column %s of %s, because %s of %s depends on it", t.desc.Fields[col].Fname, t.name, con.declaration(owner), owner.name)}
+			}
+		}
+		return nil
+	}
+	for _, other := range c.tableMap {
+		for _, con := range other.constraints {
+			if con.kind == ForeignKeyConstraint && con.ref.table == t.name {
+				if err := dependsOnDropped(other, con, con.ref.columns); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for pageNo := 0; pageNo < old.NumPages(); pageNo++ {
+		if _, err := c.bufferPool.GetPage(old, pageNo, tid, WritePerm); err != nil {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot alter %s: %s", t.name, err.Error())}
+		}
+	}
+
+	// the new file is named after the table until tid commits; the name is
+	// unique, since t may be altered again before then
+	path := c.tableNameToFile(t.name)
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".alter*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	hf, err := NewHeapFile(tmpPath, &change.desc, c.bufferPool)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	discard := func() {
+		c.bufferPool.discardPages(hf)
+		hf.file.Close()
+		os.Remove(tmpPath)
+	}
+
+	nt := &Table{t.id, t.name, change.desc, nil, nil, t.stats, hf}
+	nt.setDefaults(change.defaults)
+	for _, con := range t.constraints {
+		if con.kind == NotNullConstraint && to[con.columns[0]] < 0 {
+			continue
+		}
+		if con.kind != NotNullConstraint && con.kind != CheckConstraint {
+			if err := dependsOnDropped(t, con, con.columns); err != nil {
+				discard()
+				return err
+			}
+		}
+		ncon := &Constraint{kind: con.kind, name: con.name, check: renameCheckColumns(con.check, change.renames)}
+		for _, col := range con.columns {
+			ncon.columns = append(ncon.columns, to[col])
+		}
+		if con.ref != nil {
+			ref := *con.ref
+			ref.columns, ref.columnNames = slices.Clone(ref.columns), slices.Clone(ref.columnNames)
+			ncon.ref = &ref
+		}
+		switch con.kind {
+		case UniqueConstraint, PrimaryKeyConstraint:
+			ncon.index = &uniqueIndex{file: hf, columns: ncon.columns}
+		case CheckConstraint:
+			if ncon.preds, err = compileCheck(c, nt, ncon.check); err != nil {
+				discard()
+				return GoDBError{IllegalOperationError, fmt.Sprintf("cannot alter %s, because CHECK constraint %s would no longer be valid: %s", t.name, con.declaration(t), err.Error())}
+			}
+		}
+		nt.constraints = append(nt.constraints, ncon)
+	}
+	for i, notNull := range change.notNull {
+		if notNull {
+			nt.constraints = append(nt.constraints, &Constraint{kind: NotNullConstraint, columns: []int{i}})
+		}
+	}
+
+	if err := copyTuples(old, hf, change, tid); err != nil {
+		discard()
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot alter %s: %s", t.name, err.Error())}
+	}
+
+	// the foreign keys that reference t refer to its new columns
+	var undo []func()
+	for _, other := range c.tableMap {
+		cons := other.constraints
+		if other == t {
+			cons = nt.constraints
+		}
+		for _, con := range cons {
+			if con.kind == ForeignKeyConstraint && con.ref.table == t.name {
+				ref, columns, names := con.ref, con.ref.columns, con.ref.columnNames
+				ref.columns, ref.columnNames = make([]int, len(columns)), make([]string, len(names))
+				for i, col := range columns {
+					ref.columns[i] = to[col]
+					ref.columnNames[i] = change.desc.Fields[to[col]].Fname
+				}
+				undo = append(undo, func() { ref.columns, ref.columnNames = columns, names })
+			}
+		}
+	}
+	setColumns := func(from, to TupleDesc) {
+		for _, f := range from.Fields {
+			c.columnMap[f.Fname] = slices.DeleteFunc(c.columnMap[f.Fname], func(other *Table) bool { return other == t })
+		}
+		for _, f := range to.Fields {
+			c.columnMap[f.Fname] = append(c.columnMap[f.Fname], t)
+		}
+	}
+	setColumns(t.desc, nt.desc)
+	saved := *t
+	*t = *nt
+	c.schemaVersion++
+
+	c.bufferPool.atAbort(tid, func() {
+		c.schemaVersion++
+		setColumns(nt.desc, saved.desc)
+		*t = saved
+		for _, f := range undo {
+			f()
+		}
+		discard()
+	})
+	c.bufferPool.atCommit(tid, func() {
+		if os.Rename(tmpPath, path) == nil {
+			hf.FileName = path
+		}
+		c.bufferPool.afterRunning(func() {
+			c.bufferPool.discardPages(old)
+			old.file.Close()
+		})
+	})
+	return nil
+}
+
+// Copy the tuples of from into to in transaction tid, converting them to the
+// new schema of change. Tuples are read page by page rather than with
+// [HeapFile.Iterator], so that a page locked by another transaction is an
+// error rather than a wait.
+func copyTuples(from *HeapFile, to *HeapFile, change *schemaChange, tid TransactionID) error {
+	for pageNo := 0; pageNo < from.NumPages(); pageNo++ {
+		page, err := from.bufPool.GetPage(from, pageNo, tid, ReadPerm)
+		if err != nil {
+			return err
+		}
+		iter := page.(*heapPage).tupleIter()
+		for {
+			tup, err := iter()
+			if err != nil {
+				return err
+			}
+			if tup == nil {
+				break
+			}
+			fields := make([]DBValue, len(change.from))
+			for i, col := range change.from {
+				if col >= 0 {
+					fields[i] = tup.Fields[col]
+					continue
+				}
+				if change.defaults[i] == nil {
+					return GoDBError{IllegalOperationError, fmt.Sprintf("column %s has no default, so it may only be added to an empty table", change.desc.Fields[i].Fname)}
+				}
+				fields[i] = change.defaults[i]
+			}
+			if err := to.insertTuple(&Tuple{change.desc, fields, nil}, tid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rename the columns in the text of a CHECK expression, outside of quoted
+// strings, according to renames.
+func renameCheckColumns(text string, renames map[string]string) string {
+	if len(renames) == 0 || text == "" {
+		return text
+	}
+	var out strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case isWordByte(ch) && (i == 0 || !isWordByte(text[i-1])):
+			j := i
+			for j < len(text) && isWordByte(text[j]) {
+				j++
+			}
+			if name, ok := renames[strings.ToLower(text[i:j])]; ok {
+				out.WriteString(name)
+				i = j - 1
+				continue
+			}
+		}
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
@@ -0,0 +1,254 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAlterTable(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, name := range []string{"crew", "shift"} {
+		os.Remove(c.tableNameToFile(name))
+		defer os.Remove(c.tableNameToFile(name))
+	}
+	for _, sql := range []string{
+		"create table crew (id int primary key, name varchar(20) not null, age int check (age >= 18))",
+		"create table shift (day varchar(10), crew int references crew)",
+		"insert into crew values (1, 'ann', 30), (2, 'ben', 40), (3, 'cy', 50)",
+		"insert into shift values ('mon', 1), ('tue', 3)",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	for _, sql := range []string{
+		"alter table crew add column dept varchar(10) default 'ops'",
+		"alter table crew rename column age to years",
+		"alter table crew rename id to crew_id",
+		"alter table crew add rank int not null default 1",
+		"alter table crew drop column dept",
+	} {
+		qtype, _, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+		if qtype != AlterTableQueryType {
+			t.Errorf("%s: expected an ALTER TABLE query, got %v", sql, qtype)
+		}
+	}
+	table, err := c.GetTableInfo("crew")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := "crew(crew_id int, name string not null, years int, rank int not null default 1, primary key (crew_id), check (years >= 18))\n"
+	if table.String() != want {
+		t.Errorf("unexpected catalog entry\n%s\nexpected\n%s", table.String(), want)
+	}
+	if slices.Contains(c.findTablesWithColumn("age"), table) || !slices.Contains(c.findTablesWithColumn("years"), table) {
+		t.Errorf("expected the column map to follow renamed columns")
+	}
+
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select name from crew where years > 35 and rank = 1", 2},
+		{"select crew.name from crew join shift on crew.crew_id = shift.crew", 2},
+	} {
+		if _, n := countQueryResults(t, bp, c, q.sql); n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+	if err := execStatement(t, bp, c, "insert into crew values (4, 'dan', 20, 2)"); err != nil {
+		t.Errorf("inserting into the altered table: %s", err.Error())
+	}
+	expectConstraintViolation(t, execStatement(t, bp, c, "insert into crew values (5, 'eve', 10, 2)"), "CHECK")
+	expectConstraintViolation(t, execStatement(t, bp, c, "insert into crew values (1, 'eve', 20, 2)"), "PRIMARY KEY")
+	expectConstraintViolation(t, execStatement(t, bp, c, "insert into shift values ('wed', 9)"), "FOREIGN KEY")
+
+	// changes that fail leave the table as it was
+	for _, sql := range []string{
+		"alter table crew drop column crew_id",
+		"alter table crew drop column years",
+		"alter table crew add column salary int",
+		"alter table crew add column name int default 0",
+		"alter table crew rename column name to years",
+		"alter table crew add column code int unique",
+		"alter table crew modify column name varchar(30)",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error for %s", sql)
+		}
+	}
+	os.Remove(c.tableNameToFile("badge"))
+	defer os.Remove(c.tableNameToFile("badge"))
+	if err := execStatement(t, bp, c, "create table badge (id int, code int, constraint badge_code unique (code))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, _, err = Parse(c, "alter table badge drop column code")
+	if msg := "because constraint badge_code unique (code) of badge depends on it"; err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected dropping a constrained column to fail with %q, got %v", msg, err)
+	}
+	if table.String() != want {
+		t.Errorf("unexpected catalog entry after failed changes\n%s\nexpected\n%s", table.String(), want)
+	}
+	if leftover, _ := filepath.Glob(c.tableNameToFile("crew") + ".alter*"); len(leftover) != 0 {
+		t.Errorf("expected the file of a failed change to be removed, found %v", leftover)
+	}
+
+	// the rewritten file and the new schema are read back from disk
+	catFile := "alter_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp2, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	shift, err := c2.GetTableInfo("shift")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if want := "shift(day string, crew int, foreign key (crew) references crew (crew_id) on delete restrict)\n"; shift.String() != want {
+		t.Errorf("unexpected catalog entry\n%s\nexpected\n%s", shift.String(), want)
+	}
+	if _, n := countQueryResults(t, bp2, c2, "select name from crew where rank = 2 and years = 20"); n != 1 {
+		t.Errorf("expected 1 result after reloading the catalog, got %d", n)
+	}
+}
+
+// Count the results of plan in transaction tid.
+func countResultsIn(t *testing.T, plan Operator, tid TransactionID) int {
+	t.Helper()
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestAlterTableInTransaction(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	path := c.tableNameToFile("crew")
+	os.Remove(path)
+	defer os.Remove(path)
+	for _, sql := range []string{
+		"create table crew (id int, name varchar(20))",
+		"insert into crew values (1, 'ann'), (2, 'ben'), (3, 'cy')",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	table, err := c.GetTableInfo("crew")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := table.String()
+	byName, err := Prepare(c, "select name from crew where id > ?")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	byID, err := Prepare(c, "select id from crew where id > ?")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// aborting the transaction that alters a table puts it back
+	tid := BeginTransactionForTest(t, bp)
+	if _, _, err := ParseInTransaction(c, tid, "alter table crew add column age int default 7"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, plan, err := Parse(c, "select name from crew where age = 7")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := countResultsIn(t, plan, tid); n != 3 {
+		t.Errorf("expected 3 results in the altering transaction, got %d", n)
+	}
+	bp.AbortTransaction(tid)
+	if table.String() != want {
+		t.Errorf("unexpected catalog entry after an aborted change\n%s\nexpected\n%s", table.String(), want)
+	}
+	if leftover, _ := filepath.Glob(path + ".alter*"); len(leftover) != 0 {
+		t.Errorf("expected the file of an aborted change to be removed, found %v", leftover)
+	}
+	if _, n := countQueryResults(t, bp, c, "select name from crew where id > 1"); n != 2 {
+		t.Errorf("expected 2 results after aborting a change, got %d", n)
+	}
+
+	// a transaction running when the change commits may still read the old
+	// file, which is closed once it finishes
+	reader := BeginTransactionForTest(t, bp)
+	_, plan, err = Parse(c, "select name from crew")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	old := table.file.(*HeapFile)
+	tid = BeginTransactionForTest(t, bp)
+	if _, _, err := ParseInTransaction(c, tid, "alter table crew rename column name to who"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	bp.discardPages(old) // so that the reader reads the file itself
+	if n := countResultsIn(t, plan, reader); n != 3 {
+		t.Errorf("expected 3 results from the old file, got %d", n)
+	}
+	if _, err := old.file.Stat(); err != nil {
+		t.Errorf("expected the old file to be open while a transaction may read it")
+	}
+	bp.CommitTransaction(reader)
+	if _, err := old.file.Stat(); err == nil {
+		t.Errorf("expected the old file to be closed once no transaction may read it")
+	}
+
+	// prepared statements are planned again against the new file
+	if err := byName.Bind(1); err == nil {
+		t.Errorf("expected an error binding a statement that uses a renamed column")
+	}
+	if err := byID.Bind(1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = BeginTransactionForTest(t, bp)
+	if n := countResultsIn(t, byID.Plan(), tid); n != 2 {
+		t.Errorf("expected 2 results from a prepared statement after committing a change, got %d", n)
+	}
+	bp.CommitTransaction(tid)
+	if _, n := countQueryResults(t, bp, c, "select who from crew where id > 1"); n != 2 {
+		t.Errorf("expected 2 results after committing a change, got %d", n)
+	}
+}
+
+func TestRenameCheckColumns(t *testing.T) {
+	renames := map[string]string{"age": "years"}
+	got := renameCheckColumns("age >= 18 and name <> 'age' and age_limit > Age", renames)
+	if want := "years >= 18 and name <> 'age' and age_limit > years"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -7,6 +7,7 @@ package godb
 
 import (
 	"fmt"
+	"maps"
 	"sync"
 )
 
@@ -33,6 +34,25 @@ type BufferPool struct {
 	lock      sync.Mutex
 	pageLocks map[heapHash]*pageLock
 	running   map[TransactionID]bool
+
+	// functions to run when a transaction commits or aborts, e.g., to delete
+	// the file of a table it dropped
+	commitHooks map[TransactionID][]func()
+	abortHooks  map[TransactionID][]func()
+
+	// functions waiting for the transactions that were running when they
+	// were registered to finish, see [BufferPool.afterRunning]
+	waiting []*waitingHook
+
+	// the pages each running transaction read so far
+	pageCounts map[TransactionID]*PageCounts
+}
+
+// The number of pages a transaction read from disk, and the number it found
+// in the buffer pool.
+type PageCounts struct {
+	Reads int
+	Hits  int
 }
 
 // Create a new BufferPool with the specified number of pages
@@ -44,9 +64,76 @@ func NewBufferPool(numPages int) (*BufferPool, error) {
 		UsedPages: 0,
 		pageLocks: make(map[heapHash]*pageLock),
 		running:   make(map[TransactionID]bool),
+
+		commitHooks: make(map[TransactionID][]func()),
+		pageCounts:  make(map[TransactionID]*PageCounts),
+		abortHooks:  make(map[TransactionID][]func()),
 	}, nil
 }
 
+// Run f when tid commits, after its pages are flushed and its locks released.
+func (bp *BufferPool) atCommit(tid TransactionID, f func()) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	bp.commitHooks[tid] = append(bp.commitHooks[tid], f)
+}
+
+// Run f when tid aborts, after its locks are released.
+func (bp *BufferPool) atAbort(tid TransactionID, f func()) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	bp.abortHooks[tid] = append(bp.abortHooks[tid], f)
+}
+
+// A function to run once the transactions in tids have finished.
+type waitingHook struct {
+	tids map[TransactionID]bool
+	f    func()
+}
+
+// Run f once every transaction that is running now has committed or aborted,
+// e.g., to close a file that their plans may still read. f is run at once if
+// no transaction is running. bp.lock must not be held.
+func (bp *BufferPool) afterRunning(f func()) {
+	bp.lock.Lock()
+	if len(bp.running) == 0 {
+		bp.lock.Unlock()
+		f()
+		return
+	}
+	bp.waiting = append(bp.waiting, &waitingHook{maps.Clone(bp.running), f})
+	bp.lock.Unlock()
+}
+
+// Note that tid has finished, returning the waiting functions that no longer
+// wait for any transaction. They must be run without holding bp.lock.
+func (bp *BufferPool) takeWaiting(tid TransactionID) []func() {
+	var ready []func()
+	waiting := bp.waiting[:0]
+	for _, w := range bp.waiting {
+		delete(w.tids, tid)
+		if len(w.tids) == 0 {
+			ready = append(ready, w.f)
+		} else {
+			waiting = append(waiting, w)
+		}
+	}
+	bp.waiting = waiting
+	return ready
+}
+
+// Remove the hooks of tid, returning those to run given whether it
+// committed. They must be run without holding bp.lock.
+func (bp *BufferPool) takeHooks(tid TransactionID, committed bool) []func() {
+	hooks := bp.abortHooks[tid]
+	if committed {
+		hooks = bp.commitHooks[tid]
+	}
+	delete(bp.commitHooks, tid)
+	delete(bp.abortHooks, tid)
+	return hooks
+}
+
 func (bp *BufferPool) insertPage(hp *heapPage, file DBFile, pageNo int, tid TransactionID, perm RWPerm) error {
 	hash := heapHash{
 		File:   file,
@@ -91,10 +178,33 @@ func (bp *BufferPool) FlushAllPages() {
 	}
 }
 
+// Remove the pages of file from the buffer pool without flushing them, e.g.,
+// because the file is being replaced or deleted.
+func (bp *BufferPool) discardPages(file DBFile) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	for hash := range bp.pages {
+		if hash.File == file {
+			delete(bp.pages, hash)
+			delete(bp.pageLocks, hash)
+			bp.UsedPages = max(bp.UsedPages-1, 0)
+		}
+	}
+}
+
 // Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
 // of the pages tid has dirtied will be on disk so it is sufficient to just
 // release locks to abort. You do not need to implement this for lab 1.
 func (bp *BufferPool) AbortTransaction(tid TransactionID) {
+	var hooks, ready []func()
+	defer func() {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i]()
+		}
+		for _, f := range ready {
+			f()
+		}
+	}()
 	bp.lock.Lock()
 	defer bp.lock.Unlock()
 	for hash, page := range bp.pages {
@@ -128,6 +238,9 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 
 	// 释放事务锁
 	delete(bp.running, tid)
+	delete(bp.pageCounts, tid)
+	hooks = bp.takeHooks(tid, false)
+	ready = bp.takeWaiting(tid)
 }
 
 // Commit the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
@@ -136,6 +249,12 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 // that the system will not crash while doing this, allowing us to avoid using a
 // WAL. You do not need to implement this for lab 1.
 func (bp *BufferPool) CommitTransaction(tid TransactionID) {
+	var hooks, ready []func()
+	defer func() {
+		for _, f := range append(hooks, ready...) {
+			f()
+		}
+	}()
 	bp.lock.Lock()
 	defer bp.lock.Unlock()
 
@@ -166,6 +285,9 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) {
 
 	// 释放事务锁
 	delete(bp.running, tid)
+	delete(bp.pageCounts, tid)
+	hooks = bp.takeHooks(tid, true)
+	ready = bp.takeWaiting(tid)
 }
 
 // Begin a new transaction. You do not need to implement this for lab 1.
@@ -181,9 +303,21 @@ func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 		return fmt.Errorf("transaction %d is already running", tid)
 	}
 	bp.running[tid] = true
+	bp.pageCounts[tid] = &PageCounts{}
 	return nil
 }
 
+// Return the number of pages the running transaction tid has read from disk
+// and found in the buffer pool so far.
+func (bp *BufferPool) PageCounts(tid TransactionID) PageCounts {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	if counts, ok := bp.pageCounts[tid]; ok {
+		return *counts
+	}
+	return PageCounts{}
+}
+
 // Helper function to acquire a lock on a page
 func (bp *BufferPool) acquireLock(hash heapHash, tid TransactionID, perm RWPerm) error {
 	// fmt.Printf("acquireLock: File=%p, PageNo=%d, tid=%v\n", hash.File, hash.PageNo, tid)
@@ -264,7 +398,12 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 	bp.lock.Lock()
 	defer bp.lock.Unlock()
 
+	counts, ok := bp.pageCounts[tid]
+	if !ok {
+		counts = &PageCounts{}
+	}
 	if page, ok := bp.pages[hash]; ok {
+		counts.Hits++
 		return page, nil
 	} else {
 		// If not found in cache, read from disk
@@ -272,6 +411,7 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 		if err != nil {
 			return nil, err
 		}
+		counts.Reads++
 		if bp.UsedPages >= bp.NumPages {
 			// Evict a page
 			for h, p := range bp.pages {
@@ -44,9 +44,11 @@ func TestSetDirty(t *testing.T) {
 	_, t1, _, hf, bp, _ := makeTestVars(t)
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	for i := 0; i < 308; i++ {
+	// the three pages of the buffer pool hold 3 * slotsPerPage tuples
+	full := 3 * slotsPerPage(hf.Descriptor())
+	for i := 0; i < full+2; i++ {
 		err := hf.insertTuple(&t1, tid)
-		if err != nil && (i == 306 || i == 307) {
+		if err != nil && (i == full || i == full+1) {
 			return
 		} else if err != nil {
 			t.Fatalf("%v", err)
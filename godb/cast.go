@@ -0,0 +1,311 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+)
+
+// A coercion says whether, and when, values of one type may be converted to
+// another.
+type coercion int
+
+const (
+	noCoercion       coercion = iota // the types cannot be converted
+	explicitCoercion coercion = iota // only by CAST
+	implicitCoercion coercion = iota // also automatically, where an expression of the other type is expected
+)
+
+type typePair struct {
+	from, to DBType
+}
+
+// The conversions between different types. Any value may also be cast to and
+// from a string, see [coercionOf].
+//
+// Implicit conversions never lose information (except for the precision of
+// large numbers converted to FLOAT), so they are applied to function arguments
+// and to the operands of comparisons.
+var coercionRules = map[typePair]coercion{
+	{IntType, FloatType}:      implicitCoercion,
+	{IntType, DecimalType}:    implicitCoercion,
+	{DecimalType, FloatType}:  implicitCoercion,
+	{DateType, TimestampType}: implicitCoercion,
+	{FloatType, IntType}:      explicitCoercion,
+	{FloatType, DecimalType}:  explicitCoercion,
+	{DecimalType, IntType}:    explicitCoercion,
+	{TimestampType, DateType}: explicitCoercion,
+	{BoolType, IntType}:       explicitCoercion,
+	{IntType, BoolType}:       explicitCoercion,
+	{TimestampType, IntType}:  explicitCoercion, // seconds since the epoch
+	{IntType, TimestampType}:  explicitCoercion,
+}
+
+// Return how values of type from may be converted to type to.
+func coercionOf(from DBType, to DBType) coercion {
+	if from == to {
+		return implicitCoercion
+	}
+	if from == UnknownType || to == UnknownType {
+		return noCoercion
+	}
+	if from == StringType || to == StringType {
+		return explicitCoercion
+	}
+	return coercionRules[typePair{from, to}]
+}
+
+// Return the type that numbers of types a and b are both implicitly converted
+// to when they are combined, e.g., by arithmetic: INT, then DECIMAL, then
+// FLOAT. Returns false if either type is not numeric.
+func promoteNumeric(a DBType, b DBType) (DBType, bool) {
+	if !a.isNumeric() || !b.isNumeric() {
+		return UnknownType, false
+	}
+	if coercionOf(a, b) == implicitCoercion {
+		return b, true
+	}
+	return a, true
+}
+
+// CastExpr converts the value of expr to another type.
+type CastExpr struct {
+	expr Expr
+	to   FieldType // the type, and precision and scale, converted to
+}
+
+// Construct an expression converting the value of expr to type to. Returns a
+// TypeMismatchError if the conversion is not allowed, or, unless explicit is
+// set, if it is not allowed implicitly. Values converted to DECIMAL have the
+// scale given by [castTarget].
+func NewCastExpr(expr Expr, to DBType, explicit bool) (*CastExpr, error) {
+	return newCastExpr(expr, castTarget(expr.GetExprType(), to), explicit)
+}
+
+// Return the type that values of type from are converted to by a cast to
+// type to that gives no precision and scale, e.g., an implicit one. An INT
+// becomes a DECIMAL with no digits after the point, a DECIMAL keeps its
+// precision and scale, and other values have DecimalScale digits after the
+// point.
+func castTarget(from FieldType, to DBType) FieldType {
+	ft := FieldType{Ftype: to}
+	if to == DecimalType {
+		switch from.Ftype {
+		case IntType:
+		case DecimalType:
+			ft.Precision, ft.Scale = from.Precision, from.Scale
+		default:
+			ft.Scale = DecimalScale
+		}
+	}
+	return ft
+}
+
+// Construct an expression converting the value of expr to the type, and
+// precision and scale, of to, as [NewCastExpr] does.
+func newCastExpr(expr Expr, to FieldType, explicit bool) (*CastExpr, error) {
+	from := expr.GetExprType().Ftype
+	switch coercionOf(from, to.Ftype) {
+	case implicitCoercion:
+	case explicitCoercion:
+		if !explicit {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s has type %s, expected %s; use CAST(%s AS %s) to convert it", exprToStr(expr), from, to.Ftype, exprToStr(expr), to.Ftype)}
+		}
+	default:
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot cast %s of type %s to %s", exprToStr(expr), from, to.Ftype)}
+	}
+	return &CastExpr{expr, FieldType{"", "", to.Ftype, to.Precision, to.Scale}}, nil
+}
+
+func (ce *CastExpr) GetExprType() FieldType {
+	ft := ce.expr.GetExprType()
+	return FieldType{ft.Fname, ft.TableQualifier, ce.to.Ftype, ce.to.Precision, ce.to.Scale}
+}
+
+func (ce *CastExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	v, err := ce.expr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	v, err = castField(v, ce.to)
+	if err != nil {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s: %s", exprToStr(ce), err.(GoDBError).errString)}
+	}
+	return v, nil
+}
+
+// Convert v to the type of to, as [castValue] does, rounding a decimal to the
+// scale of to and checking that it fits its precision.
+func castField(v DBValue, to FieldType) (DBValue, error) {
+	v, err := castValue(v, to.Ftype)
+	if d, ok := v.(DecimalField); ok && err == nil {
+		return d.fit(to.Precision, to.Scale)
+	}
+	return v, err
+}
+
+// Convert v to type to. Conversions of numbers round to the nearest value of
+// the new type, and return an error if it is out of range. Decimals keep
+// their scale, and INTs become decimals of scale 0.
+func castValue(v DBValue, to DBType) (DBValue, error) {
+	if valueType(v) == to {
+		return v, nil
+	}
+	outOfRange := GoDBError{TypeMismatchError, fmt.Sprintf("value %s is out of range for type %s", valueString(v), to)}
+	switch to {
+	case StringType:
+		return parseValue(StringType, valueString(v))
+	case IntType:
+		switch v := v.(type) {
+		case StringField:
+			return parseValue(IntType, v.Value)
+		case FloatField:
+			f := math.Round(v.Value)
+			if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, outOfRange
+			}
+			return IntField{int64(f)}, nil
+		case DecimalField:
+			d, err := v.rescale(0)
+			return IntField{d.Value}, err
+		case BoolField:
+			if v.Value {
+				return IntField{1}, nil
+			}
+			return IntField{0}, nil
+		case TimestampField:
+			secs := v.Value / microsPerSecond
+			if v.Value%microsPerSecond < 0 {
+				secs--
+			}
+			return IntField{secs}, nil
+		}
+	case FloatType:
+		if s, ok := v.(StringField); ok {
+			return parseValue(FloatType, s.Value)
+		}
+		if f, ok := numericValue(v); ok {
+			return FloatField{f}, nil
+		}
+	case DecimalType:
+		switch v := v.(type) {
+		case StringField:
+			return parseValue(DecimalType, v.Value)
+		case IntField:
+			return DecimalField{v.Value, 0}, nil
+		case FloatField:
+			d := v.Value * float64(pow10[DecimalScale])
+			if math.IsNaN(d) || d < math.MinInt64 || d >= math.MaxInt64 {
+				return nil, outOfRange
+			}
+			return NewDecimalField(v.Value), nil
+		}
+	case BoolType:
+		switch v := v.(type) {
+		case StringField:
+			return parseValue(BoolType, v.Value)
+		case IntField:
+			return BoolField{v.Value != 0}, nil
+		}
+	case DateType:
+		switch v := v.(type) {
+		case StringField:
+			return parseValue(DateType, v.Value)
+		case TimestampField:
+			return NewDateField(v.Time()), nil
+		}
+	case TimestampType:
+		switch v := v.(type) {
+		case StringField:
+			return parseValue(TimestampType, v.Value)
+		case DateField:
+			return TimestampField{v.Value * microsPerDay}, nil
+		case IntField:
+			if v.Value > math.MaxInt64/microsPerSecond || v.Value < math.MinInt64/microsPerSecond {
+				return nil, outOfRange
+			}
+			return TimestampField{v.Value * microsPerSecond}, nil
+		}
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot cast %s of type %s to %s", valueString(v), valueType(v), to)}
+}
+
+// Convert e, a value inserted into column col, to the type of the column,
+// and a decimal to its precision and scale. A string constant is converted
+// to any type, and a numeric constant to a DECIMAL; other values only by
+// implicit conversions.
+func coerceInsertValue(e Expr, col FieldType) (Expr, error) {
+	if inferParamType(e, col.Ftype) {
+		return e, nil
+	}
+	from := e.GetExprType().Ftype
+	if from == col.Ftype && from != DecimalType {
+		return e, nil
+	}
+	to := FieldType{"", "", col.Ftype, col.Precision, col.Scale}
+	c, isConst := e.(*ConstExpr)
+	if isConst && c.val != nil && from.isNumeric() && col.Ftype == DecimalType {
+		// convert the digits of the constant, so that, e.g., 0.1 is exact
+		v, err := parseValue(DecimalType, valueString(c.val))
+		if err == nil {
+			v, err = castField(v, to)
+		}
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %s: %s", col.Fname, err.(GoDBError).errString)}
+		}
+		return &ConstExpr{v, col.Ftype}, nil
+	}
+	if isConst && from == StringType {
+		v, err := castField(c.val, to)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %s: %s", col.Fname, err.(GoDBError).errString)}
+		}
+		return &ConstExpr{v, col.Ftype}, nil
+	}
+	cast, err := newCastExpr(e, to, false)
+	if err != nil {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %s: %s", col.Fname, err.(GoDBError).errString)}
+	}
+	return cast, nil
+}
+
+// Make the operands of a comparison comparable. If their types differ, the
+// operand whose type can be implicitly converted to the other's is cast; a
+// string constant is instead converted to the type of the other operand, so
+// that, e.g., a date may be compared with '2024-01-01'.
+//
+// Returns a TypeMismatchError naming the operands if they cannot be compared.
+func coerceComparison(left Expr, right Expr) (Expr, Expr, error) {
+	lt, rt := left.GetExprType().Ftype, right.GetExprType().Ftype
+	if lt == UnknownType && inferParamType(left, rt) {
+		lt = rt
+	} else if rt == UnknownType && inferParamType(right, lt) {
+		rt = lt
+	}
+	if lt == rt || lt == UnknownType || rt == UnknownType {
+		return left, right, nil
+	}
+	mismatch := func(detail string) error {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("cannot compare %s of type %s with %s of type %s%s", exprToStr(left), lt, exprToStr(right), rt, detail)}
+	}
+	if c, ok := right.(*ConstExpr); ok && rt == StringType {
+		v, err := castValue(c.val, lt)
+		if err != nil {
+			return nil, nil, mismatch(": " + err.(GoDBError).errString)
+		}
+		return left, &ConstExpr{v, lt}, nil
+	}
+	if c, ok := left.(*ConstExpr); ok && lt == StringType {
+		v, err := castValue(c.val, rt)
+		if err != nil {
+			return nil, nil, mismatch(": " + err.(GoDBError).errString)
+		}
+		return &ConstExpr{v, rt}, right, nil
+	}
+	if coercionOf(lt, rt) == implicitCoercion {
+		return &CastExpr{left, castTarget(left.GetExprType(), rt)}, right, nil
+	}
+	if coercionOf(rt, lt) == implicitCoercion {
+		return left, &CastExpr{right, castTarget(right.GetExprType(), lt)}, nil
+	}
+	return nil, nil, mismatch("")
+}
@@ -0,0 +1,196 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCastValue(t *testing.T) {
+	for _, c := range []struct {
+		v    DBValue
+		to   DBType
+		want string
+	}{
+		{IntField{7}, FloatType, "7"},
+		{IntField{7}, DecimalType, "7"},
+		{IntField{-3}, StringType, "-3"},
+		{IntField{2}, BoolType, "true"},
+		{IntField{86400}, TimestampType, "1970-01-02 00:00:00"},
+		{FloatField{2.5}, IntType, "3"},
+		{FloatField{-2.5}, IntType, "-3"},
+		{FloatField{1.23456}, DecimalType, "1.2346"},
+		{DecimalField{-25000, 4}, IntType, "-3"},
+		{DecimalField{24999, 4}, IntType, "2"},
+		{DecimalField{15000, 4}, FloatType, "1.5"},
+		{BoolField{true}, IntType, "1"},
+		{StringField{" 42 "}, IntType, "42"},
+		{StringField{"2024-03-01"}, DateType, "2024-03-01"},
+		{StringField{"yes"}, BoolType, "true"},
+		{mustParseValue(t, DateType, "2024-03-01"), TimestampType, "2024-03-01 00:00:00"},
+		{mustParseValue(t, TimestampType, "1969-12-31 23:00:00"), DateType, "1969-12-31"},
+		{mustParseValue(t, TimestampType, "1969-12-31 23:59:59.5"), IntType, "-1"},
+	} {
+		v, err := castValue(c.v, c.to)
+		if err != nil {
+			t.Errorf("casting %s to %s: %s", valueString(c.v), c.to, err.Error())
+			continue
+		}
+		if valueType(v) != c.to || valueString(v) != c.want {
+			t.Errorf("casting %s to %s, expected %s, got %s of type %s", valueString(c.v), c.to, c.want, valueString(v), valueType(v))
+		}
+	}
+
+	for _, c := range []struct {
+		v  DBValue
+		to DBType
+	}{
+		{StringField{"abc"}, IntType},
+		{FloatField{1e300}, IntType},
+		{FloatField{1e300}, DecimalType},
+		{BoolField{true}, DateType},
+	} {
+		if _, err := castValue(c.v, c.to); err == nil {
+			t.Errorf("expected an error casting %s to %s", valueString(c.v), c.to)
+		}
+	}
+}
+
+func TestCoercionRules(t *testing.T) {
+	age := &FieldExpr{FieldType{"age", "t", IntType, 0, 0}}
+	name := &FieldExpr{FieldType{"name", "t", StringType, 0, 0}}
+	if _, err := NewCastExpr(age, FloatType, false); err != nil {
+		t.Errorf("int should implicitly convert to float: %s", err.Error())
+	}
+	if _, err := NewCastExpr(name, IntType, false); err == nil {
+		t.Errorf("string should not implicitly convert to int")
+	} else if !strings.Contains(err.Error(), "t.name") {
+		t.Errorf("expected error to name the expression, got %s", err.Error())
+	}
+	if _, err := NewCastExpr(name, IntType, true); err != nil {
+		t.Errorf("string should explicitly convert to int: %s", err.Error())
+	}
+	if _, err := NewCastExpr(&ConstExpr{BoolField{true}, BoolType}, DateType, true); err == nil {
+		t.Errorf("bool should not convert to date")
+	}
+
+	left, right, err := coerceComparison(age, &ConstExpr{FloatField{1.5}, FloatType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if left.GetExprType().Ftype != FloatType || right.GetExprType().Ftype != FloatType {
+		t.Errorf("expected int to be compared as float")
+	}
+	if _, _, err := coerceComparison(age, name); err == nil {
+		t.Errorf("expected an error comparing int and string")
+	}
+	_, right, err = coerceComparison(age, &ConstExpr{StringField{"30"}, StringType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if right.(*ConstExpr).val != (IntField{30}) {
+		t.Errorf("expected string constant to be converted to int")
+	}
+}
+
+func TestCastQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select cast(age as float) from t where cast(age as float) > 40.5", 6},
+		{"select name from t where age::string = '99'", 2},
+		{"select name from t where getsubstr(age::string, 0, 1) = '2'", 3},
+		{"select name from t where CAST(age AS decimal(10,2)) >= 43.5", 5},
+		{"select name from t where age > 43.5", 5},
+		{"select name from t where age::float::int = 25", 1},
+		{"select name from t where cast('2024-01-02' as date) > '2024-01-01'", 12},
+		{"select name from t where age::bool", 0},
+	} {
+		if strings.HasSuffix(q.sql, "::bool") {
+			if _, _, err := Parse(c, q.sql); err == nil {
+				t.Errorf("expected an error parsing %s", q.sql)
+			}
+			continue
+		}
+		_, n := countQueryResults(t, bp, c, q.sql)
+		if n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+
+	for _, q := range []struct {
+		sql  string
+		want string
+	}{
+		{"select name from t where age = 'abc'", "cannot compare t.age of type int with 'abc' of type string"},
+		{"select name from t where age = name", "cannot compare t.age of type int with t.name of type string"},
+		{"select sq(name) from t", "argument 1 of sq: t.name has type string, expected int"},
+		{"select cast(name as bool) from t where cast('x' as int) = 1", "CAST('x' AS int)"},
+		{"select cast(age as blob) from t", "unknown type blob"},
+	} {
+		_, _, err := Parse(c, q.sql)
+		if err == nil {
+			t.Errorf("expected an error parsing %s", q.sql)
+			continue
+		}
+		if !strings.Contains(err.Error(), q.want) {
+			t.Errorf("query %s: expected error containing %q, got %s", q.sql, q.want, err.Error())
+		}
+	}
+}
+
+func TestRewriteCasts(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+	}{
+		{"select cast(a as int) from t", "select cast_as(a , 'int') from t"},
+		{"select CAST( f(a, b) AS decimal(10, 2)) from t", "select cast_as( f(a, b) , 'decimal(10, 2)') from t"},
+		{"select t.a::float from t", "select cast_as(t.a, 'float') from t"},
+		{"select f(a)::text, 'x::y' from t", "select cast_as(f(a), 'text'), 'x::y' from t"},
+		{"select (a + 1)::float::int from t", "select cast_as(cast_as((a + 1), 'float'), 'int') from t"},
+		{"select '1'::int from t", "select cast_as('1', 'int') from t"},
+		{"select cast(a::int as string) from t", "select cast_as(cast_as(a, 'int') , 'string') from t"},
+	} {
+		out, err := rewriteCasts(c.in)
+		if err != nil {
+			t.Errorf("rewriting %s: %s", c.in, err.Error())
+		} else if out != c.out {
+			t.Errorf("rewriting %s, expected %s, got %s", c.in, c.out, out)
+		}
+	}
+}
+
+// test that numeric constants are converted to DECIMAL exactly when they are
+// inserted, but other FLOAT expressions need a CAST
+func TestInsertDecimalConstants(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("price"))
+	defer os.Remove(c.tableNameToFile("price"))
+	if _, _, err := Parse(c, "create table price (id int, amount decimal, rate float)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	countQueryResults(t, bp, c, "insert into price values (1, 12.345, 0.5), (2, 7, 1.5), (3, 0.1, 2.5)")
+	got := queryResults(t, bp, c, "select amount from price")
+	want := []string{fmt.Sprint([]DBValue{DecimalField{123450, 4}}), fmt.Sprint([]DBValue{DecimalField{70000, 4}}), fmt.Sprint([]DBValue{DecimalField{1000, 4}})}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected amounts %v, got %v", want, got)
+	}
+
+	if _, _, err := Parse(c, "insert into price select id, rate, rate from price"); err == nil || !strings.Contains(err.Error(), "use CAST") {
+		t.Errorf("expected inserting a FLOAT column into a DECIMAL one to need a CAST, got %v", err)
+	}
+	countQueryResults(t, bp, c, "insert into price select id, cast(rate as decimal), rate from price")
+	if _, n := countQueryResults(t, bp, c, "select id from price where amount = 1.5"); n != 1 {
+		t.Errorf("expected one amount of 1.5, got %d", n)
+	}
+}
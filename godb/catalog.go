@@ -14,6 +14,13 @@ type Table struct {
 	name string
 	desc TupleDesc
 
+	// the DEFAULT value of each column, or nil for columns without one; nil
+	// if no column has a default
+	defaults []DBValue
+
+	// the constraints on the tuples of the table
+	constraints []*Constraint
+
 	// statistics
 	stats *TableStats
 
@@ -26,6 +33,17 @@ type Catalog struct {
 	bufferPool *BufferPool
 	rootPath   string
 	filePath   string
+
+	// the views, by name
+	views map[string]*View
+
+	// the materialized views, by name; the result of each is stored in the
+	// table of the same name
+	matViews map[string]*MaterializedView
+
+	// incremented whenever a table is dropped or its schema changes, so that
+	// prepared statements know to plan again
+	schemaVersion int
 }
 
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
@@ -35,7 +53,7 @@ func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
 	}
 	f.WriteString(c.String())
 	f.Close()
-	return nil
+	return c.SaveStatsToFile(catalogFile, rootPath)
 }
 
 func (c *Catalog) dropTable(tableName string) error {
@@ -43,6 +61,7 @@ func (c *Catalog) dropTable(tableName string) error {
 	if !ok {
 		return GoDBError{NoSuchTableError, "couldn't find table to drop"}
 	}
+	c.schemaVersion++
 
 	delete(c.tableMap, tableName)
 	for cn, ts := range c.columnMap {
@@ -57,6 +76,60 @@ func (c *Catalog) dropTable(tableName string) error {
 	return nil
 }
 
+// Drop the table named tableName in transaction tid. The table is removed
+// from the catalog at once. When tid commits, the pages of its file are
+// evicted from the buffer pool and the file is deleted; if tid aborts, the
+// table is put back in the catalog.
+//
+// All pages of the table are first locked for writing, so a table that
+// another transaction is using cannot be dropped.
+func (c *Catalog) dropTableInTransaction(tableName string, tid TransactionID) error {
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	hf, ok := t.file.(*HeapFile)
+	if !ok {
+		return c.dropTable(tableName)
+	}
+	for pageNo := 0; pageNo < hf.NumPages(); pageNo++ {
+		if _, err := c.bufferPool.GetPage(hf, pageNo, tid, WritePerm); err != nil {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop table %s: %s", tableName, err.Error())}
+		}
+	}
+	if err := c.dropTable(tableName); err != nil {
+		return err
+	}
+	c.bufferPool.atAbort(tid, func() {
+		c.schemaVersion++
+		c.tableMap[tableName] = t
+		for _, f := range t.desc.Fields {
+			c.columnMap[f.Fname] = append(c.columnMap[f.Fname], t)
+		}
+	})
+	c.bufferPool.atCommit(tid, func() {
+		c.bufferPool.discardPages(hf)
+		hf.file.Close()
+		os.Remove(hf.FileName)
+	})
+	return nil
+}
+
+// Drop the table named tableName, and delete its file, in a transaction of
+// its own.
+func (c *Catalog) removeTable(tableName string) error {
+	tid := NewTID()
+	if err := c.bufferPool.BeginTransaction(tid); err != nil {
+		return err
+	}
+	if err := c.dropTableInTransaction(tableName, tid); err != nil {
+		c.bufferPool.AbortTransaction(tid)
+		return err
+	}
+	c.bufferPool.CommitTransaction(tid)
+	return nil
+}
+
 func ImportCatalogFromCSVs(
 	catalogFile string,
 	bp *BufferPool,
@@ -93,54 +166,102 @@ func (c *Catalog) parseCatalogFile() error {
 	}
 	scanner := bufio.NewScanner(f)
 
+	// foreign keys are added once all tables are loaded, since they may
+	// reference tables that come later in the file
+	var foreignKeys []tableConstraint
 	for scanner.Scan() {
 		// code to read each line
-		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+		line := scanner.Text()
+		if mv, isView := parseMaterializedViewDeclaration(line); isView {
+			c.matViews[mv.name] = mv
+			continue
+		}
+		if v, isView := parseViewDeclaration(line); isView {
+			c.views[v.name] = v
+			continue
+		}
+		open, close := strings.Index(line, "("), strings.LastIndex(line, ")")
+		if open < 0 || close < open {
+			return GoDBError{ParseError, fmt.Sprintf("expected parenthesized field list in catalog entry (%s)", line)}
 		}
-		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
+		tableName := strings.ToLower(strings.TrimSpace(line[:open]))
+		fields := splitTopLevel(line[open+1 : close])
 
 		var fieldArray []FieldType
+		var defaults []DBValue
+		var cons []*Constraint
 		for _, f := range fields {
 			f := strings.TrimSpace(f)
-			nameType := strings.Split(f, " ")
-			if len(nameType) < 2 || len(nameType) > 4 {
+			con, isConstraint, err := parseConstraintDeclaration(f, fieldArray)
+			if err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("%s (line %s)", err.(GoDBError).errString, line)}
+			}
+			if isConstraint {
+				cons = append(cons, con)
+				continue
+			}
+			nameType := strings.Fields(f)
+			if len(nameType) < 2 {
 				return GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
 			}
 
-			name := nameType[0]
-			fieldType := FieldType{name, "", IntType}
-			switch nameType[1] {
-			case "int":
-				fallthrough
-			case "integer":
-				fieldType.Ftype = IntType
-			case "string":
-				fallthrough
-			case "varchar":
-				fallthrough
-			case "text":
-				fieldType.Ftype = StringType
-			default:
-				return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+			name := strings.ToLower(nameType[0])
+			fieldType, err := castType(nameType[1])
+			if err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("%s (line %s)", err.(GoDBError).errString, line)}
 			}
+			fieldType.Fname = name
+			ftype := fieldType.Ftype
 			fieldArray = append(fieldArray, fieldType)
+
+			attrs := strings.ToLower(f)
+			var def DBValue
+			if pos := strings.Index(attrs, " default "); pos >= 0 {
+				attrs = attrs[:pos]
+				def, err = parseLiteral(ftype, strings.TrimSpace(f[pos+len(" default "):]))
+				if err != nil {
+					return GoDBError{ParseError, fmt.Sprintf("invalid default for %s (line %s): %s", name, line, err.Error())}
+				}
+			}
+			defaults = append(defaults, def)
+			if strings.Contains(attrs, " not null") {
+				cons = append(cons, &Constraint{kind: NotNullConstraint, columns: []int{len(fieldArray) - 1}})
+			}
 		}
 
-		_, err := c.addTable(tableName, TupleDesc{fieldArray})
-		if err != nil {
+		if _, err := c.addTable(tableName, TupleDesc{fieldArray}); err != nil {
 			return err
 		}
+		table := c.tableMap[tableName]
+		table.setDefaults(defaults)
+		for _, con := range cons {
+			if con.kind == ForeignKeyConstraint {
+				foreignKeys = append(foreignKeys, tableConstraint{table, con})
+				continue
+			}
+			if err := table.addConstraint(c, con); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fk := range foreignKeys {
+		if err := fk.table.addConstraint(c, fk.con); err != nil {
+			return err
+		}
+	}
+	for _, mv := range c.matViews {
+		mv.base = c.maintenanceBase(mv)
 	}
 	return nil
 }
 
+type tableConstraint struct {
+	table *Table
+	con   *Constraint
+}
+
 func NewCatalog(catalogFile string, bp *BufferPool, rootPath string) *Catalog {
-	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile}
+	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile, make(map[string]*View), make(map[string]*MaterializedView), 0}
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
@@ -148,6 +269,9 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 	if err := c.parseCatalogFile(); err != nil {
 		return nil, err
 	}
+	if err := c.loadStats(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -165,7 +289,7 @@ func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
 		return nil, err
 	}
 
-	t := &Table{len(c.tableMap), named, desc, nil, hf}
+	t := &Table{len(c.tableMap), named, desc, nil, nil, nil, hf}
 	c.tableMap[named] = t
 	for _, f := range desc.Fields {
 		mapList := c.columnMap[f.Fname]
@@ -178,11 +302,91 @@ func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
 	return hf, nil
 }
 
+// Compute the statistics of all tables of c, see [computeTableStats].
 func (c *Catalog) ComputeTableStats() error {
-	// Dummy implementation, do not worry about it.
+	names := make([]string, 0, len(c.tableMap))
+	for name := range c.tableMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return c.analyzeTables(names)
+}
+
+// Compute the statistics of the named tables, in a transaction of its own.
+// The statistics of the tables are replaced once all are computed.
+func (c *Catalog) analyzeTables(names []string) error {
+	tid := NewTID()
+	if err := c.bufferPool.BeginTransaction(tid); err != nil {
+		return err
+	}
+	stats := make(map[*Table]*TableStats)
+	for _, name := range names {
+		t, err := c.GetTableInfo(name)
+		if err != nil {
+			c.bufferPool.AbortTransaction(tid)
+			return err
+		}
+		hf, ok := t.file.(*HeapFile)
+		if !ok {
+			continue
+		}
+		if stats[t], err = computeTableStats(hf, tid); err != nil {
+			c.bufferPool.AbortTransaction(tid)
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot analyze %s: %s", name, err.Error())}
+		}
+	}
+	c.bufferPool.CommitTransaction(tid)
+	for t, ts := range stats {
+		t.stats = ts
+	}
 	return nil
 }
 
+// Update the statistics of t for the tuples inserted into and deleted from it
+// by tid, once tid commits. If the statistics are then stale, t is analyzed
+// again; if another transaction is using t, it is analyzed after a later
+// change instead.
+func (c *Catalog) recordChanges(t *Table, inserted []*Tuple, deleted []*Tuple, tid TransactionID) {
+	if len(inserted) == 0 && len(deleted) == 0 {
+		return
+	}
+	c.bufferPool.atCommit(tid, func() {
+		if t.stats == nil {
+			return
+		}
+		t.stats.applyChanges(inserted, deleted, t.file.NumPages())
+		if t.stats.stale() {
+			c.analyzeTables([]string{t.name})
+		}
+	})
+}
+
+// Compute table statistics for an ANALYZE statement, whose text after the
+// ANALYZE keyword is args. The supported form is
+//
+//	ANALYZE [table [, table ...]]
+//
+// which analyzes the named tables, or all tables if none is named.
+func processAnalyze(c *Catalog, args string) (QueryType, error) {
+	args = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(args), ";"))
+	if args == "" {
+		return AnalyzeQueryType, c.ComputeTableStats()
+	}
+	var names []string
+	for _, name := range strings.Split(args, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		valid := name != ""
+		for i := 0; i < len(name); i++ {
+			valid = valid && isWordByte(name[i])
+		}
+		if !valid {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("expected ANALYZE [table [, table ...]], got ANALYZE %s", args)}
+		}
+		names = append(names, name)
+	}
+	return AnalyzeQueryType, c.analyzeTables(names)
+}
+
 func (c *Catalog) tableNameToFile(tableName string) string {
 	return c.rootPath + "/" + tableName + ".dat"
 }
@@ -236,6 +440,26 @@ func (c *Catalog) findTablesWithColumn(named string) []*Table {
 	return c.columnMap[named]
 }
 
+// Set the DEFAULT values of the columns of t; defaults holds nil for the
+// columns without one.
+func (t *Table) setDefaults(defaults []DBValue) {
+	t.defaults = nil
+	for _, v := range defaults {
+		if v != nil {
+			t.defaults = defaults
+			break
+		}
+	}
+}
+
+// Return the DEFAULT value of the i-th column of t, or nil if it has none.
+func (t *Table) defaultValue(i int) DBValue {
+	if i >= len(t.defaults) {
+		return nil
+	}
+	return t.defaults[i]
+}
+
 func (c *Catalog) NumTables() int {
 	return len(c.tableMap)
 }
@@ -250,7 +474,20 @@ func (t *Table) String() string {
 		}
 		buf.WriteString(f.Fname)
 		buf.WriteByte(' ')
-		buf.WriteString(f.Ftype.String())
+		buf.WriteString(f.typeName())
+		if t.notNull(i) != nil {
+			buf.WriteString(" not null")
+		}
+		if v := t.defaultValue(i); v != nil {
+			buf.WriteString(" default ")
+			buf.WriteString(sqlLiteral(v))
+		}
+	}
+	for _, con := range t.constraints {
+		if con.kind != NotNullConstraint {
+			buf.WriteString(", ")
+			buf.WriteString(con.declaration(t))
+		}
 	}
 	buf.WriteString(")\n")
 	return buf.String()
@@ -266,9 +503,36 @@ func (c *Catalog) String() string {
 	for _, t := range keys {
 		buf.WriteString(c.tableMap[t].String())
 	}
+	for _, v := range c.viewNames() {
+		buf.WriteString(c.views[v].String())
+	}
+	for _, mv := range c.matViewNames() {
+		buf.WriteString(c.matViews[mv].String())
+	}
 	return buf.String()
 }
 
+// Describe the tables of c, followed by its views and its materialized
+// views, whose results are among the tables.
 func (c *Catalog) CatalogString() string {
-	return c.String()
+	var buf strings.Builder
+	keys := make([]string, 0, len(c.tableMap))
+	for k := range c.tableMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, t := range keys {
+		buf.WriteString(c.tableMap[t].String())
+	}
+	if len(c.views) > 0 {
+		buf.WriteString("\nViews:\n")
+		buf.WriteString(c.viewsString())
+	}
+	if len(c.matViews) > 0 {
+		buf.WriteString("\nMaterialized views:\n")
+		for _, name := range c.matViewNames() {
+			buf.WriteString(name + " as " + c.matViews[name].query + "\n")
+		}
+	}
+	return buf.String()
 }
@@ -0,0 +1,89 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDropTable(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	fileName := c.tableNameToFile("gone")
+	os.Remove(fileName)
+	defer os.Remove(fileName)
+	for _, sql := range []string{
+		"create table gone (a int, b varchar(10))",
+		"insert into gone values (1, 'x'), (2, 'y'), (3, 'z')",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	table, err := c.GetTableInfo("gone")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := table.file.(*HeapFile)
+
+	// a table that another transaction is reading cannot be dropped
+	tid := BeginTransactionForTest(t, bp)
+	if _, err := bp.GetPage(hf, 0, tid, ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := Parse(c, "drop table gone"); err == nil {
+		t.Errorf("expected an error dropping a table locked by another transaction")
+	}
+	bp.CommitTransaction(tid)
+
+	// aborting the transaction that drops a table puts it back
+	tid = BeginTransactionForTest(t, bp)
+	if qtype, _, err := ParseInTransaction(c, tid, "drop table gone"); err != nil || qtype != DropTableQueryType {
+		t.Fatalf("drop table gone: %v", err)
+	}
+	if _, err := c.GetTableInfo("gone"); err == nil {
+		t.Errorf("expected a dropped table to be removed from the catalog")
+	}
+	bp.AbortTransaction(tid)
+	if _, err := c.GetTableInfo("gone"); err != nil {
+		t.Errorf("expected an aborted drop to leave the table in the catalog: %s", err.Error())
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		t.Errorf("expected an aborted drop to leave the file of the table: %s", err.Error())
+	}
+	if _, n := countQueryResults(t, bp, c, "select a from gone where b > 'x'"); n != 2 {
+		t.Errorf("expected 2 results from the table after aborting its drop, got %d", n)
+	}
+
+	// committing it deletes the file and evicts the pages
+	if _, _, err := Parse(c, "drop table gone"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("expected the file of a dropped table to be deleted")
+	}
+	for hash := range bp.pages {
+		if hash.File == hf {
+			t.Errorf("expected the pages of a dropped table to be evicted")
+			break
+		}
+	}
+	for hash := range bp.pageLocks {
+		if hash.File == hf {
+			t.Errorf("expected the locks on a dropped table to be released")
+			break
+		}
+	}
+	if len(c.findTablesWithColumn("b")) != 0 {
+		t.Errorf("expected the columns of a dropped table to be removed from the catalog")
+	}
+
+	// a table created with the same name is empty
+	if err := execStatement(t, bp, c, "create table gone (a int, b varchar(10))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, n := countQueryResults(t, bp, c, "select a from gone"); n != 0 {
+		t.Errorf("expected a re-created table to be empty, got %d tuples", n)
+	}
+}
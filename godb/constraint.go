@@ -0,0 +1,688 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+type ConstraintKind int
+
+const (
+	NotNullConstraint    ConstraintKind = iota
+	UniqueConstraint     ConstraintKind = iota
+	PrimaryKeyConstraint ConstraintKind = iota
+	CheckConstraint      ConstraintKind = iota
+	ForeignKeyConstraint ConstraintKind = iota
+)
+
+// What deleting a tuple referenced by a foreign key does to the tuples that
+// reference it.
+type foreignKeyAction int
+
+const (
+	restrictOnDelete foreignKeyAction = iota // the delete fails
+	cascadeOnDelete  foreignKeyAction = iota // the referencing tuples are deleted too
+)
+
+// A Constraint restricts the tuples that may be stored in a table. Constraints
+// are declared in CREATE TABLE, recorded in the catalog, and checked by
+// [InsertOp] before it inserts any tuple.
+type Constraint struct {
+	kind    ConstraintKind
+	name    string // the name given in CONSTRAINT name ..., if any
+	columns []int  // the positions of the constrained columns, for NOT NULL, UNIQUE and PRIMARY KEY
+
+	// for CHECK constraints, the text of the expression, and the comparisons
+	// it was compiled into, all of which must hold
+	check string
+	preds []checkPredicate
+
+	// for UNIQUE and PRIMARY KEY constraints, the index used to find
+	// existing tuples with the same key
+	index *uniqueIndex
+
+	// for FOREIGN KEY constraints, the referenced table and columns
+	ref *foreignKey
+}
+
+// The referenced side of a FOREIGN KEY constraint: the columns of another
+// table (or the same one) that the constrained columns must match, which are
+// those of a UNIQUE or PRIMARY KEY constraint of that table.
+type foreignKey struct {
+	catalog     *Catalog
+	table       string
+	columnNames []string // the primary key of table if none are declared
+	columns     []int    // the positions of columnNames, set by [Table.addConstraint]
+	onDelete    foreignKeyAction
+}
+
+type checkPredicate struct {
+	left  Expr
+	op    BoolOp
+	right Expr
+}
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case NotNullConstraint:
+		return "NOT NULL"
+	case UniqueConstraint:
+		return "UNIQUE"
+	case PrimaryKeyConstraint:
+		return "PRIMARY KEY"
+	case CheckConstraint:
+		return "CHECK"
+	case ForeignKeyConstraint:
+		return "FOREIGN KEY"
+	}
+	return "unknown"
+}
+
+func (a foreignKeyAction) String() string {
+	if a == cascadeOnDelete {
+		return "cascade"
+	}
+	return "restrict"
+}
+
+// Return the names of the constrained columns of t, separated by commas.
+func (con *Constraint) columnNames(t *Table) string {
+	names := make([]string, len(con.columns))
+	for i, col := range con.columns {
+		names[i] = t.desc.Fields[col].Fname
+	}
+	return strings.Join(names, ", ")
+}
+
+// Format con as it is declared in CREATE TABLE, and recorded in the catalog.
+// NOT NULL constraints are declared with their column, see [Table.String].
+func (con *Constraint) declaration(t *Table) string {
+	decl := ""
+	if con.name != "" {
+		decl = "constraint " + con.name + " "
+	}
+	switch con.kind {
+	case UniqueConstraint:
+		return decl + "unique (" + con.columnNames(t) + ")"
+	case PrimaryKeyConstraint:
+		return decl + "primary key (" + con.columnNames(t) + ")"
+	case CheckConstraint:
+		return decl + "check (" + con.check + ")"
+	case ForeignKeyConstraint:
+		return fmt.Sprintf("%sforeign key (%s) references %s (%s) on delete %s", decl, con.columnNames(t), con.ref.table, strings.Join(con.ref.columnNames, ", "), con.ref.onDelete)
+	}
+	return decl + strings.ToLower(con.kind.String())
+}
+
+func (con *Constraint) violation(t *Table, detail string) error {
+	what := fmt.Sprintf("%s constraint on %s", con.kind, t.name)
+	if con.name != "" {
+		what = fmt.Sprintf("%s constraint %s on %s", con.kind, con.name, t.name)
+	}
+	return GoDBError{ConstraintViolationError, fmt.Sprintf("%s violates %s", detail, what)}
+}
+
+// Add a constraint to t, compiling its CHECK expression or creating its
+// index. Returns an error if t already has a primary key or the expression is
+// invalid.
+func (t *Table) addConstraint(c *Catalog, con *Constraint) error {
+	switch con.kind {
+	case PrimaryKeyConstraint:
+		for _, other := range t.constraints {
+			if other.kind == PrimaryKeyConstraint {
+				return GoDBError{ParseError, fmt.Sprintf("table %s has more than one primary key", t.name)}
+			}
+		}
+		fallthrough
+	case UniqueConstraint:
+		hf, ok := t.file.(*HeapFile)
+		if !ok {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("%s constraints are only supported on heap files", con.kind)}
+		}
+		con.index = &uniqueIndex{file: hf, columns: con.columns}
+	case CheckConstraint:
+		preds, err := compileCheck(c, t, con.check)
+		if err != nil {
+			return err
+		}
+		con.preds = preds
+	case ForeignKeyConstraint:
+		if err := t.resolveForeignKey(c, con); err != nil {
+			return err
+		}
+	}
+	t.constraints = append(t.constraints, con)
+	return nil
+}
+
+// Find the columns referenced by the FOREIGN KEY constraint con of t, and
+// check that they are the key of their table and have the same types as the
+// constrained columns. The referenced table must be in c, unless it is t.
+func (t *Table) resolveForeignKey(c *Catalog, con *Constraint) error {
+	ref := con.ref
+	parent := c.tableMap[ref.table]
+	if parent == nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("table %s referenced by a foreign key of %s does not exist", ref.table, t.name)}
+	}
+	if len(ref.columnNames) == 0 {
+		pk := parent.primaryKey()
+		if pk == nil {
+			return GoDBError{ParseError, fmt.Sprintf("table %s referenced by a foreign key of %s has no primary key", ref.table, t.name)}
+		}
+		ref.columnNames = strings.Split(pk.columnNames(parent), ", ")
+	}
+	if len(ref.columnNames) != len(con.columns) {
+		return GoDBError{ParseError, fmt.Sprintf("foreign key (%s) of %s references %d columns of %s", con.columnNames(t), t.name, len(ref.columnNames), ref.table)}
+	}
+	ref.columns = make([]int, len(ref.columnNames))
+	for i, name := range ref.columnNames {
+		pos := columnIndex(parent.desc.Fields, name)
+		if pos < 0 {
+			return GoDBError{ParseError, fmt.Sprintf("foreign key of %s refers to unknown column %s of %s", t.name, name, ref.table)}
+		}
+		if parent.desc.Fields[pos].Ftype != t.desc.Fields[con.columns[i]].Ftype {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("foreign key column %s of %s has type %s, but %s.%s has type %s", t.desc.Fields[con.columns[i]].Fname, t.name, t.desc.Fields[con.columns[i]].Ftype, ref.table, name, parent.desc.Fields[pos].Ftype)}
+		}
+		ref.columns[i] = pos
+	}
+	if parent.keyIndex(ref.columns) == nil {
+		return GoDBError{ParseError, fmt.Sprintf("no UNIQUE or PRIMARY KEY constraint on %s (%s) for the foreign key of %s", ref.table, strings.Join(ref.columnNames, ", "), t.name)}
+	}
+	ref.catalog = c
+	return nil
+}
+
+// Return the PRIMARY KEY constraint of t, or nil.
+func (t *Table) primaryKey() *Constraint {
+	for _, con := range t.constraints {
+		if con.kind == PrimaryKeyConstraint {
+			return con
+		}
+	}
+	return nil
+}
+
+// Return the index of the UNIQUE or PRIMARY KEY constraint of t on exactly
+// columns, in order, or nil.
+func (t *Table) keyIndex(columns []int) *uniqueIndex {
+	for _, con := range t.constraints {
+		if con.index != nil && slices.Equal(con.columns, columns) {
+			return con.index
+		}
+	}
+	return nil
+}
+
+// Return true if some FOREIGN KEY constraint of a table in c other than t
+// references t.
+func (c *Catalog) isReferenced(t *Table) bool {
+	for _, other := range c.tableMap {
+		for _, con := range other.constraints {
+			if other != t && con.kind == ForeignKeyConstraint && con.ref.table == t.name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return the constraint of t of kind NOT NULL on column col, or nil.
+func (t *Table) notNull(col int) *Constraint {
+	for _, con := range t.constraints {
+		if con.kind == NotNullConstraint && con.columns[0] == col {
+			return con
+		}
+	}
+	return nil
+}
+
+// Compile the CHECK expression text over the columns of t. It is parsed as
+// the WHERE clause of a query over t, so it has the same form: a conjunction
+// of comparisons.
+func compileCheck(c *Catalog, t *Table, text string) ([]checkPredicate, error) {
+	stmt, err := sqlparser.Parse(fmt.Sprintf("select * from %s where %s", t.name, text))
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid CHECK expression %s: %s", text, err.Error())}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || sel.Where == nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid CHECK expression %s", text)}
+	}
+	ts := []*LogicalTableNode{{t.name, "", &t.file, nil}}
+	pc := newParseContext(c)
+	filters, joins, sqs, err := parseWhere(pc, nil, ts, sel.Where.Expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(joins) > 0 || len(sqs) > 0 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("CHECK expression %s may only refer to the columns of %s", text, t.name)}
+	}
+	desc := t.file.Descriptor()
+	tableMap := map[string]*PlanNode{t.name: {&OperatorCard{Op: t.file}, desc}}
+	preds := make([]checkPredicate, len(filters))
+	for i, f := range filters {
+		left, _, err := f.fieldExpr.generateExpr(pc, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		right, _, err := f.constExpr.generateExpr(pc, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		left, right, err = coerceComparison(left, right)
+		if err != nil {
+			return nil, err
+		}
+		preds[i] = checkPredicate{left, f.predOp, right}
+	}
+	return preds, nil
+}
+
+// Check that the tuples of a single INSERT statement satisfy the constraints
+// of t, both against the tuples already in t and against each other. Returns
+// a ConstraintViolationError naming the first constraint that is violated.
+func (t *Table) checkInsert(tuples []*Tuple, tid TransactionID) error {
+	for _, con := range t.constraints {
+		var inserted map[any]bool
+		if con.index != nil {
+			inserted = make(map[any]bool)
+		}
+		var parent *uniqueIndex
+		if con.kind == ForeignKeyConstraint {
+			p, err := con.ref.catalog.GetTableInfo(con.ref.table)
+			if err != nil {
+				return err
+			}
+			parent = p.keyIndex(con.ref.columns)
+			if p == t {
+				// a tuple may reference another tuple inserted by the
+				// same statement
+				inserted = make(map[any]bool)
+				for _, tup := range tuples {
+					inserted[projectColumns(tup, con.ref.columns).tupleKey()] = true
+				}
+			}
+		}
+		for _, tup := range tuples {
+			switch con.kind {
+			case NotNullConstraint:
+				if tup.Fields[con.columns[0]] == nil {
+					return con.violation(t, fmt.Sprintf("missing value for column %s", con.columnNames(t)))
+				}
+			case CheckConstraint:
+				for _, p := range con.preds {
+					left, err := p.left.EvalExpr(tup)
+					if err != nil {
+						return err
+					}
+					right, err := p.right.EvalExpr(tup)
+					if err != nil {
+						return err
+					}
+					if !left.EvalPred(right, p.op) {
+						return con.violation(t, fmt.Sprintf("row (%s)", tupleValues(tup)))
+					}
+				}
+			case UniqueConstraint, PrimaryKeyConstraint:
+				key := con.index.key(tup)
+				exists, err := con.index.contains(key, tid)
+				if err != nil {
+					return err
+				}
+				if exists || inserted[key] {
+					return con.violation(t, fmt.Sprintf("duplicate key (%s)=(%s)", con.columnNames(t), tupleValues(con.index.project(tup))))
+				}
+				inserted[key] = true
+			case ForeignKeyConstraint:
+				ref := projectColumns(tup, con.columns)
+				if hasNil(ref) {
+					continue
+				}
+				key := ref.tupleKey()
+				exists, err := parent.contains(key, tid)
+				if err != nil {
+					return err
+				}
+				if !exists && !inserted[key] {
+					return con.violation(t, fmt.Sprintf("key (%s)=(%s) not present in %s", con.columnNames(t), tupleValues(ref), con.ref.table))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// A tuple of a table, to be deleted.
+type tableTuple struct {
+	table *Table
+	tup   *Tuple
+}
+
+// Return the tuples that deleting tuples from t deletes: tuples themselves,
+// followed by the tuples that reference them through a FOREIGN KEY constraint
+// with ON DELETE CASCADE, recursively. Returns a ConstraintViolationError if a
+// deleted tuple is referenced through a constraint with ON DELETE RESTRICT,
+// unless the referencing tuple is deleted as well.
+//
+// The tuples that reference each table are found by scanning it once, so all
+// tuples must be found before any is deleted.
+func (c *Catalog) cascadeDeletes(t *Table, tuples []*Tuple, tid TransactionID) ([]tableTuple, error) {
+	var deletes []tableTuple
+	deleted := make(map[*Table]map[RID]bool)
+	add := func(t *Table, tup *Tuple) {
+		if rid, ok := tup.Rid.(RID); ok {
+			if deleted[t] == nil {
+				deleted[t] = make(map[RID]bool)
+			}
+			if deleted[t][rid] {
+				return
+			}
+			deleted[t][rid] = true
+		}
+		deletes = append(deletes, tableTuple{t, tup})
+	}
+	for _, tup := range tuples {
+		add(t, tup)
+	}
+
+	referencing := make(map[*Constraint]map[any][]*Tuple)
+	for i := 0; i < len(deletes); i++ {
+		parent := deletes[i]
+		for _, child := range c.tableMap {
+			for _, con := range child.constraints {
+				if con.kind != ForeignKeyConstraint || con.ref.table != parent.table.name {
+					continue
+				}
+				refs, ok := referencing[con]
+				if !ok {
+					var err error
+					if refs, err = con.referencingTuples(child, tid); err != nil {
+						return nil, err
+					}
+					referencing[con] = refs
+				}
+				key := projectColumns(parent.tup, con.ref.columns)
+				for _, tup := range refs[key.tupleKey()] {
+					if rid, ok := tup.Rid.(RID); ok && deleted[child][rid] {
+						continue
+					}
+					if con.ref.onDelete == restrictOnDelete {
+						return nil, con.violation(child, fmt.Sprintf("deleting key (%s)=(%s) from %s", strings.Join(con.ref.columnNames, ", "), tupleValues(key), parent.table.name))
+					}
+					add(child, tup)
+				}
+			}
+		}
+	}
+	return deletes, nil
+}
+
+// Return the tuples of t, which has the FOREIGN KEY constraint con, by the
+// key of the referenced columns.
+func (con *Constraint) referencingTuples(t *Table, tid TransactionID) (map[any][]*Tuple, error) {
+	refs := make(map[any][]*Tuple)
+	iter, err := t.file.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			return refs, nil
+		}
+		ref := projectColumns(tup, con.columns)
+		if !hasNil(ref) {
+			key := ref.tupleKey()
+			refs[key] = append(refs[key], tup)
+		}
+	}
+}
+
+// Return the tuple of the given columns of t.
+func projectColumns(t *Tuple, columns []int) *Tuple {
+	fields := make([]FieldType, len(columns))
+	vals := make([]DBValue, len(columns))
+	for i, col := range columns {
+		fields[i] = t.Desc.Fields[col]
+		vals[i] = t.Fields[col]
+	}
+	return &Tuple{TupleDesc{fields}, vals, nil}
+}
+
+// Return true if some field of t has no value.
+func hasNil(t *Tuple) bool {
+	return slices.Contains(t.Fields, nil)
+}
+
+// Record a tuple inserted into t in the indexes of its constraints. The tuple's
+// Rid must be set.
+func (t *Table) recordInsert(tup *Tuple) {
+	for _, con := range t.constraints {
+		if con.index != nil {
+			con.index.add(tup)
+		}
+	}
+}
+
+// Format the values of a tuple, separated by commas.
+func tupleValues(t *Tuple) string {
+	vals := make([]string, len(t.Fields))
+	for i, v := range t.Fields {
+		vals[i] = valueString(v)
+	}
+	return strings.Join(vals, ", ")
+}
+
+// A uniqueIndex maps the values of the columns of a UNIQUE or PRIMARY KEY
+// constraint to the records that hold them, so that inserts need not scan the
+// table. It is built by scanning the table the first time it is used, and then
+// maintained by [InsertOp].
+//
+// Entries are not removed when tuples are deleted, or when the transaction
+// that inserted them aborts; instead, lookups check that the records still
+// hold the key. This keeps the index correct without hooking into commit and
+// abort, at the cost of keeping entries for deleted tuples.
+type uniqueIndex struct {
+	file    *HeapFile
+	columns []int
+	entries map[any][]RID // nil until the index is built
+}
+
+// Return the tuple of the indexed columns of t.
+func (idx *uniqueIndex) project(t *Tuple) *Tuple {
+	return projectColumns(t, idx.columns)
+}
+
+func (idx *uniqueIndex) key(t *Tuple) any {
+	return idx.project(t).tupleKey()
+}
+
+func (idx *uniqueIndex) build(tid TransactionID) error {
+	idx.entries = make(map[any][]RID)
+	iter, err := idx.file.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return err
+		}
+		if tup == nil {
+			return nil
+		}
+		idx.add(tup)
+	}
+}
+
+func (idx *uniqueIndex) add(t *Tuple) {
+	if idx.entries == nil {
+		// not built yet; the tuple will be found by the scan that builds it
+		return
+	}
+	if rid, ok := t.Rid.(RID); ok {
+		key := idx.key(t)
+		idx.entries[key] = append(idx.entries[key], rid)
+	}
+}
+
+// Return true if a tuple with the given key is in the table.
+func (idx *uniqueIndex) contains(key any, tid TransactionID) (bool, error) {
+	if idx.entries == nil {
+		if err := idx.build(tid); err != nil {
+			idx.entries = nil
+			return false, err
+		}
+	}
+	for _, rid := range idx.entries[key] {
+		tup, err := idx.file.tupleAt(rid, tid)
+		if err != nil {
+			return false, err
+		}
+		if tup != nil && idx.key(tup) == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// A CHECK clause of a CREATE TABLE statement, see [extractChecks].
+type checkClause struct {
+	name string
+	text string
+}
+
+// Return the position of the column named name among fields, or -1.
+func columnIndex(fields []FieldType, name string) int {
+	for i, f := range fields {
+		if strings.EqualFold(f.Fname, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Return the constraints declared in a CREATE TABLE statement over fields:
+// those of its column definitions and index definitions, and its CHECK and
+// FOREIGN KEY clauses, which sqlparser does not support and [extractChecks]
+// and [extractForeignKeys] remove from the statement before it is parsed.
+func declaredConstraints(spec *sqlparser.TableSpec, fields []FieldType, checks []checkClause, fks []foreignKeyClause) ([]*Constraint, error) {
+	var cons []*Constraint
+	for i, col := range spec.Columns {
+		if col.Type.NotNull {
+			cons = append(cons, &Constraint{kind: NotNullConstraint, columns: []int{i}})
+		}
+		// ColumnKeyOption's values are not exported, so look at how the
+		// column type is formatted
+		switch ct := strings.ToLower(sqlparser.String(&col.Type)); {
+		case strings.HasSuffix(ct, " primary key"):
+			cons = append(cons, &Constraint{kind: PrimaryKeyConstraint, columns: []int{i}})
+		case strings.HasSuffix(ct, " unique"), strings.HasSuffix(ct, " unique key"):
+			cons = append(cons, &Constraint{kind: UniqueConstraint, columns: []int{i}})
+		}
+	}
+	for _, idx := range spec.Indexes {
+		con := &Constraint{kind: UniqueConstraint}
+		switch {
+		case idx.Info.Primary:
+			con.kind = PrimaryKeyConstraint
+		case idx.Info.Unique:
+			con.name = idx.Info.Name.String()
+		default:
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported index %s; only UNIQUE and PRIMARY KEY are supported", sqlparser.String(idx))}
+		}
+		for _, col := range idx.Columns {
+			pos := columnIndex(fields, col.Column.String())
+			if pos < 0 {
+				return nil, GoDBError{ParseError, fmt.Sprintf("%s refers to unknown column %s", sqlparser.String(idx), col.Column.String())}
+			}
+			con.columns = append(con.columns, pos)
+		}
+		cons = append(cons, con)
+	}
+	for _, check := range checks {
+		cons = append(cons, &Constraint{kind: CheckConstraint, name: check.name, check: check.text})
+	}
+	for _, fk := range fks {
+		con, err := fk.constraint(fields)
+		if err != nil {
+			return nil, err
+		}
+		cons = append(cons, con)
+	}
+	return cons, nil
+}
+
+// Return the FOREIGN KEY constraint of fk on a table with the given fields.
+// The referenced columns are resolved when it is added to the table.
+func (fk foreignKeyClause) constraint(fields []FieldType) (*Constraint, error) {
+	con := &Constraint{kind: ForeignKeyConstraint, name: fk.name, ref: &foreignKey{table: fk.table, columnNames: fk.refColumns, onDelete: fk.onDelete}}
+	for _, name := range fk.columns {
+		pos := columnIndex(fields, name)
+		if pos < 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("foreign key refers to unknown column %s", name)}
+		}
+		con.columns = append(con.columns, pos)
+	}
+	return con, nil
+}
+
+// Parse a table constraint as formatted by [Constraint.declaration] in the
+// catalog. Returns false if decl is not a table constraint, but a column.
+func parseConstraintDeclaration(decl string, fields []FieldType) (*Constraint, bool, error) {
+	con := &Constraint{}
+	words := strings.Fields(decl)
+	if len(words) >= 3 && strings.EqualFold(words[0], "constraint") {
+		con.name = words[1]
+		decl = strings.TrimSpace(decl[strings.Index(decl, words[1])+len(words[1]):])
+	}
+	open, close := strings.Index(decl, "("), strings.LastIndex(decl, ")")
+	keyword := strings.ToLower(strings.Join(strings.Fields(decl[:max(open, 0)]), " "))
+	switch keyword {
+	case "primary key":
+		con.kind = PrimaryKeyConstraint
+	case "unique":
+		con.kind = UniqueConstraint
+	case "check":
+		con.kind = CheckConstraint
+	case "foreign key":
+		refs := strings.Index(strings.ToLower(decl), " references ")
+		if open < 0 || refs < open {
+			return nil, true, GoDBError{ParseError, fmt.Sprintf("malformed constraint %s", decl)}
+		}
+		fk, _, err := parseReferences(decl, refs+len(" references "))
+		if err != nil {
+			return nil, true, err
+		}
+		fk.name = con.name
+		fk.columns = strings.Split(decl[open+1:strings.Index(decl, ")")], ",")
+		for i := range fk.columns {
+			fk.columns[i] = strings.TrimSpace(fk.columns[i])
+		}
+		con, err = fk.constraint(fields)
+		return con, true, err
+	default:
+		return nil, false, nil
+	}
+	if open < 0 || close < open {
+		return nil, true, GoDBError{ParseError, fmt.Sprintf("malformed constraint %s", decl)}
+	}
+	if con.kind == CheckConstraint {
+		con.check = strings.TrimSpace(decl[open+1 : close])
+		return con, true, nil
+	}
+	for _, name := range strings.Split(decl[open+1:close], ",") {
+		pos := columnIndex(fields, strings.TrimSpace(name))
+		if pos < 0 {
+			return nil, true, GoDBError{ParseError, fmt.Sprintf("constraint %s refers to unknown column %s", decl, name)}
+		}
+		con.columns = append(con.columns, pos)
+	}
+	return con, true, nil
+}
@@ -0,0 +1,329 @@
+package godb
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Run a DDL statement, or an INSERT or other statement that returns a single
+// tuple, returning its error.
+func execStatement(t *testing.T, bp *BufferPool, c *Catalog, sql string) error {
+	t.Helper()
+	_, plan, err := Parse(c, sql)
+	if err != nil || plan == nil {
+		return err
+	}
+	tid := BeginTransactionForTest(t, bp)
+	iter, err := plan.Iterator(tid)
+	if err == nil {
+		_, err = iter()
+	}
+	if err != nil {
+		bp.AbortTransaction(tid)
+		return err
+	}
+	bp.CommitTransaction(tid)
+	return nil
+}
+
+func expectConstraintViolation(t *testing.T, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("expected a violation of %s", want)
+		return
+	}
+	if gerr, ok := err.(GoDBError); !ok || gerr.code != ConstraintViolationError || !strings.Contains(gerr.errString, want) {
+		t.Errorf("expected a violation of %s, got %s", want, err.Error())
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("emp"))
+	defer os.Remove(c.tableNameToFile("emp"))
+	if _, _, err := Parse(c, "create table emp (id int primary key, email varchar(20) unique, name varchar(20) not null, age int check (age >= 18), dept varchar(10) default 'none', constraint age_dept check (age < 70 and dept <> 'x'), unique key name_dept (name, dept))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, sql := range []string{
+		"insert into emp values (1, 'a@x', 'ann', 30, 'ops')",
+		"insert into emp values (2, 'b@x', 'ben', 40, 'ops'), (3, 'c@x', 'ann', 50, 'hr')",
+		"insert into emp (id, email, name, age) values (4, 'd@x', 'dan', 18)",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	for _, q := range []struct {
+		sql  string
+		want string
+	}{
+		{"insert into emp values (1, 'z@x', 'zed', 30, 'ops')", "duplicate key (id)=(1) violates PRIMARY KEY"},
+		{"insert into emp values (5, 'a@x', 'zed', 30, 'ops')", "duplicate key (email)=(a@x) violates UNIQUE"},
+		{"insert into emp values (5, 'e@x', 'ann', 30, 'ops')", "duplicate key (name, dept)=(ann, ops) violates UNIQUE constraint name_dept"},
+		{"insert into emp values (5, 'e@x', 'eve', 17, 'ops')", "row (5, e@x, eve, 17, ops) violates CHECK"},
+		{"insert into emp values (5, 'e@x', 'eve', 70, 'ops')", "CHECK constraint age_dept"},
+		{"insert into emp values (5, 'e@x', 'eve', 30, 'x')", "CHECK constraint age_dept"},
+		{"insert into emp values (5, 'e@x', 'eve', 30, 'ops'), (5, 'f@x', 'fay', 30, 'ops')", "duplicate key (id)=(5)"},
+		{"insert into emp (id, email, age) values (5, 'e@x', 30)", "missing value for column name violates NOT NULL"},
+	} {
+		expectConstraintViolation(t, execStatement(t, bp, c, q.sql), q.want)
+	}
+
+	// statements that violate a constraint insert nothing
+	_, n := countQueryResults(t, bp, c, "select id from emp")
+	if n != 4 {
+		t.Errorf("expected 4 tuples in emp, got %d", n)
+	}
+
+	// deleted keys may be inserted again
+	if err := execStatement(t, bp, c, "delete from emp where id = 4"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := execStatement(t, bp, c, "insert into emp values (4, 'd@x', 'dan', 20, 'ops')"); err != nil {
+		t.Errorf("reinserting a deleted key: %s", err.Error())
+	}
+
+	// constraints are saved with the catalog, and enforced after reloading it
+	catFile := "constraint_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c2.GetTableInfo("emp")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := "emp(id int, email string, name string not null, age int, dept string default 'none', primary key (id), unique (email), constraint name_dept unique (name, dept), check (age >= 18), constraint age_dept check (age < 70 and dept <> 'x'))\n"
+	if table.String() != want {
+		t.Errorf("unexpected catalog entry\n%s\nexpected\n%s", table.String(), want)
+	}
+	expectConstraintViolation(t, execStatement(t, bp, c2, "insert into emp values (2, 'z@x', 'zed', 30, 'ops')"), "PRIMARY KEY")
+	expectConstraintViolation(t, execStatement(t, bp, c2, "insert into emp values (9, 'z@x', 'zed', 10, 'ops')"), "CHECK")
+
+	for _, sql := range []string{
+		"create table bad1 (a int primary key, b int, primary key (b))",
+		"create table bad2 (a int, check (b > 0))",
+		"create table bad3 (a int, unique key u (b))",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error parsing %s", sql)
+		}
+	}
+}
+
+func TestExtractChecks(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+		checks  []checkClause
+	}{
+		{"create table t (a int check (a > 0), b int)", "create table t (a int , b int)", []checkClause{{"", "a > 0"}}},
+		{"create table t (a int, b int, constraint pos check (a > b))", "create table t (a int, b int )", []checkClause{{"pos", "a > b"}}},
+		{"create table t (check (a in ('(', 'b')), a int)", "create table t (  a int)", []checkClause{{"", "a in ('(', 'b')"}}},
+		{"select check from t", "select check from t", nil},
+	} {
+		out, checks, err := extractChecks(c.in)
+		if err != nil {
+			t.Errorf("extracting checks from %s: %s", c.in, err.Error())
+			continue
+		}
+		if out != c.out || len(checks) != len(c.checks) {
+			t.Errorf("extracting checks from %s, expected %q %v, got %q %v", c.in, c.out, c.checks, out, checks)
+			continue
+		}
+		for i := range checks {
+			if checks[i] != c.checks[i] {
+				t.Errorf("extracting checks from %s, expected %v, got %v", c.in, c.checks, checks)
+			}
+		}
+	}
+}
+
+// test the UNIQUE table constraints that are not named, or are named by a
+// CONSTRAINT clause, which sqlparser does not support
+func TestUnnamedUniqueConstraints(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+	}{
+		{"create table t (a int, b int, unique (a))", "create table t (a int, b int, unique key t_a_key (a))"},
+		{"create table t(a int, b int, UNIQUE KEY (a, `b`), unique index(b))", "create table t(a int, b int, unique key t_a_b_key (a, `b`), unique key t_b_key (b))"},
+		{"create table t (a int, unique (a), unique (a))", "create table t (a int, unique key t_a_key (a), unique key t_a_key1 (a))"},
+		{"create table t (a int unique, b int, constraint ub unique (b))", "create table t (a int unique, b int, unique key ub (b))"},
+		{"create table t (a int, unique key u (a), check (a <> 'unique (a)'))", "create table t (a int, unique key u (a), check (a <> 'unique (a)'))"},
+		{"select unique (a) from t", "select unique (a) from t"},
+	} {
+		if out := nameUniqueConstraints(c.in); out != c.out {
+			t.Errorf("naming the unique constraints of %s, expected %q, got %q", c.in, c.out, out)
+		}
+	}
+
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("acct"))
+	defer os.Remove(c.tableNameToFile("acct"))
+	if _, _, err := Parse(c, "create table acct (id int, email varchar(20), name varchar(20), unique (email), unique key (name, id))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c.GetTableInfo("acct")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := "acct(id int, email string, name string, constraint acct_email_key unique (email), constraint acct_name_id_key unique (name, id))\n"
+	if table.String() != want {
+		t.Errorf("unexpected catalog entry\n%s\nexpected\n%s", table.String(), want)
+	}
+	if err := execStatement(t, bp, c, "insert into acct values (1, 'a@x', 'ann')"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectConstraintViolation(t, execStatement(t, bp, c, "insert into acct values (2, 'a@x', 'ben')"), "UNIQUE")
+	if err := execStatement(t, bp, c, "insert into acct values (2, 'b@x', 'ann')"); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, name := range []string{"dept", "emp", "assign"} {
+		os.Remove(c.tableNameToFile(name))
+		defer os.Remove(c.tableNameToFile(name))
+	}
+	for _, sql := range []string{
+		"create table dept (id int primary key, name varchar(10))",
+		"create table emp (id int primary key, dept int references dept on delete cascade, boss int, constraint boss_fk foreign key (boss) references emp (id))",
+		"create table assign (task varchar(10), dept int, foreign key (dept) references dept (id) on delete restrict)",
+		"insert into dept values (1, 'ops'), (2, 'hr'), (3, 'it')",
+		"insert into emp values (1, 1, 1), (2, 1, 1), (3, 2, 3)",
+		"insert into assign values ('hire', 2)",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	for _, q := range []struct {
+		sql  string
+		want string
+	}{
+		{"insert into emp values (4, 9, 1)", "key (dept)=(9) not present in dept violates FOREIGN KEY constraint on emp"},
+		{"insert into emp values (4, 1, 7)", "FOREIGN KEY constraint boss_fk"},
+		{"insert into assign values ('fire', 4)", "key (dept)=(4) not present in dept"},
+		{"delete from dept where id = 2", "deleting key (id)=(2) from dept violates FOREIGN KEY constraint on assign"},
+		{"delete from emp where id = 1", "deleting key (id)=(1) from emp violates FOREIGN KEY constraint boss_fk"},
+	} {
+		expectConstraintViolation(t, execStatement(t, bp, c, q.sql), q.want)
+	}
+
+	// deleting a department deletes its employees; employees whose boss is
+	// deleted may be deleted by the same statement
+	for _, sql := range []string{
+		"delete from dept where id = 1",
+		"delete from dept where id = 3",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select id from dept", 1},
+		{"select id from emp", 1},
+		{"select id from emp where dept = 2", 1},
+	} {
+		if _, n := countQueryResults(t, bp, c, q.sql); n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+
+	if _, _, err := Parse(c, "drop table dept"); err == nil {
+		t.Errorf("expected an error dropping a referenced table")
+	}
+	for _, sql := range []string{
+		"create table bad4 (a int references nosuch)",
+		"create table bad5 (a varchar(10) references dept (name))",
+		"create table bad6 (a varchar(10) references dept)",
+		"create table bad7 (a int, foreign key (a, a) references dept (id))",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error parsing %s", sql)
+		}
+		os.Remove(c.tableNameToFile(sql[len("create table ") : len("create table ")+4]))
+	}
+
+	// foreign keys are saved with the catalog, including those that refer to
+	// tables that come later in it, and enforced after reloading it
+	catFile := "foreign_key_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for name, want := range map[string]string{
+		"emp":    "emp(id int, dept int, boss int, primary key (id), foreign key (dept) references dept (id) on delete cascade, constraint boss_fk foreign key (boss) references emp (id) on delete restrict)\n",
+		"assign": "assign(task string, dept int, foreign key (dept) references dept (id) on delete restrict)\n",
+	} {
+		table, err := c2.GetTableInfo(name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if table.String() != want {
+			t.Errorf("unexpected catalog entry\n%s\nexpected\n%s", table.String(), want)
+		}
+	}
+	expectConstraintViolation(t, execStatement(t, bp, c2, "insert into assign values ('fire', 1)"), "FOREIGN KEY")
+	expectConstraintViolation(t, execStatement(t, bp, c2, "delete from dept"), "FOREIGN KEY")
+}
+
+func TestExtractForeignKeys(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+		fks     []foreignKeyClause
+	}{
+		{"create table e (id int primary key, d int references dept(id) on delete cascade, b int)", "create table e (id int primary key, d int , b int)",
+			[]foreignKeyClause{{"", []string{"d"}, "dept", []string{"id"}, cascadeOnDelete}}},
+		{"create table e (a int, b decimal(10,2), constraint fk foreign key (a, b) references p (x, y) on delete no action)", "create table e (a int, b decimal(10,2) )",
+			[]foreignKeyClause{{"fk", []string{"a", "b"}, "p", []string{"x", "y"}, restrictOnDelete}}},
+		{"create table e (foreign key (a) references p, a int)", "create table e (  a int)",
+			[]foreignKeyClause{{"", []string{"a"}, "p", nil, restrictOnDelete}}},
+		{"select references from t", "select references from t", nil},
+	} {
+		out, fks, err := extractForeignKeys(c.in)
+		if err != nil {
+			t.Errorf("extracting foreign keys from %s: %s", c.in, err.Error())
+			continue
+		}
+		if out != c.out || !reflect.DeepEqual(fks, c.fks) {
+			t.Errorf("extracting foreign keys from %s, expected %q %v, got %q %v", c.in, c.out, c.fks, out, fks)
+		}
+	}
+	for _, in := range []string{
+		"create table e (a int references p on update cascade)",
+		"create table e (a int references p on delete set null)",
+		"create table e (references p)",
+	} {
+		if _, _, err := extractForeignKeys(in); err == nil {
+			t.Errorf("expected an error extracting foreign keys from %s", in)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package godb
+
+import (
+	"fmt"
+)
+
+// The maximum number of times the recursive part of a recursive CTE is
+// evaluated before [RecursiveCTE] gives up, to stop queries that never reach a
+// fixed point.
+const MaxRecursionDepth int = 1000
+
+// RecursiveCTE evaluates WITH RECURSIVE by iterating to a fixed point.
+//
+// The result starts with the tuples of base. In each iteration the working
+// table holds the tuples produced by the previous iteration, and step, which
+// reads the working table, is evaluated to produce the tuples of the next one.
+// Iteration stops once an iteration produces no tuples. Unless all is set,
+// tuples that are already in the result are discarded, so that recursion over
+// cyclic data terminates.
+type RecursiveCTE struct {
+	base    Operator
+	step    Operator
+	working *MemFile
+	all     bool
+}
+
+// Construct a recursive CTE. step must read its input from working, and must
+// produce tuples of the same types as base.
+func NewRecursiveCTE(base Operator, step Operator, working *MemFile, all bool) (*RecursiveCTE, error) {
+	if !base.Descriptor().compatible(step.Descriptor()) {
+		return nil, GoDBError{IncompatibleTypesError, fmt.Sprintf("recursive query has incompatible fields (%s) and (%s)", base.Descriptor().HeaderString(false), step.Descriptor().HeaderString(false))}
+	}
+	return &RecursiveCTE{base, step, working, all}, nil
+}
+
+// Return the TupleDesc of the result, which takes its field names from base.
+func (r *RecursiveCTE) Descriptor() *TupleDesc {
+	return r.base.Descriptor().copy()
+}
+
+// Recursive CTE implementation. Returns the tuples of each iteration as they
+// are produced, and evaluates the next iteration once they have all been
+// returned.
+func (r *RecursiveCTE) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	desc := r.Descriptor()
+	iter, err := r.base.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	r.working.pages = nil
+	var next []*Tuple // the working table of the next iteration
+	seen := make(map[any]bool)
+	depth := 0
+
+	return func() (*Tuple, error) {
+		for {
+			tup, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if tup == nil {
+				if len(next) == 0 {
+					return nil, nil
+				}
+				depth++
+				if depth > MaxRecursionDepth {
+					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("recursive query did not terminate after %d iterations", MaxRecursionDepth)}
+				}
+				r.working.pages = nil
+				for _, t := range next {
+					if err := r.working.insertTuple(t, tid); err != nil {
+						return nil, err
+					}
+				}
+				next = nil
+				iter, err = r.step.Iterator(tid)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			out := &Tuple{*desc, tup.Fields, nil}
+			if !r.all {
+				key := out.tupleKey()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			next = append(next, out)
+			return out, nil
+		}
+	}, nil
+}
@@ -0,0 +1,165 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+// Add a table emp(id, name, manager) to the parser test database, holding an
+// org chart in which ceo manages a and b, a manages c, c manages d, and b
+// manages e.
+func makeOrgChart(t *testing.T, bp *BufferPool, c *Catalog) {
+	t.Helper()
+	os.Remove(c.tableNameToFile("emp"))
+	desc := TupleDesc{[]FieldType{{"id", "", IntType, 0, 0}, {"name", "", StringType, 0, 0}, {"manager", "", IntType, 0, 0}}}
+	hf, err := c.addTable("emp", desc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	for _, e := range []struct {
+		id      int64
+		name    string
+		manager int64
+	}{{1, "ceo", 0}, {2, "a", 1}, {3, "b", 1}, {4, "c", 2}, {5, "d", 4}, {6, "e", 3}} {
+		tup := Tuple{desc, []DBValue{IntField{e.id}, StringField{e.name}, IntField{e.manager}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestCTE(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	makeOrgChart(t, bp, c)
+	defer os.Remove(c.tableNameToFile("emp"))
+
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"with old as (select name, age from t where age > 40) select name from old", 6},
+		{"with old as (select name, age from t where age > 40) select name from old union all select name from old where age > 50", 9},
+		{"with old(n, a) as (select name, age from t where age > 40), young as (select name from t where age < 30) select young.name from young join old on young.name = old.n", 2},
+		{"with old as (select name from t where age > 40) select name from t2 where name in (select name from old)", 8},
+		{"with recursive reports(id, name) as (select id, name from emp where id = 2 union all select emp.id, emp.name from emp join reports on emp.manager = reports.id) select name from reports", 3},
+		{"with recursive chain(id, manager) as (select id, manager from emp where name = 'd' union select emp.id, emp.manager from emp join chain on emp.id = chain.manager) select id from chain", 4},
+		{"with recursive nums(n) as (select age from t where name = 'ang' union all select n + 1 from nums where n < 30) select n from nums", 9},
+	}
+	for _, q := range queries {
+		_, cnt := countQueryResults(t, bp, c, q.sql)
+		if cnt != q.expected {
+			t.Errorf("query '%s' returned %d tuples, expected %d", q.sql, cnt, q.expected)
+		}
+	}
+
+	for _, sql := range []string{
+		"with old(n) as (select name, age from t) select n from old",
+		"with recursive forever(n) as (select age from t where name = 'ang' union all select n + 1 from forever) select n from forever",
+	} {
+		tid := BeginTransactionForTest(t, bp)
+		_, plan, err := Parse(c, sql)
+		if err == nil {
+			var iter func() (*Tuple, error)
+			iter, err = plan.Iterator(tid)
+			for err == nil {
+				var tup *Tuple
+				tup, err = iter()
+				if tup == nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			t.Errorf("expected error for query '%s'", sql)
+		}
+		bp.CommitTransaction(tid)
+	}
+}
+
+func TestRecursiveCTE(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+
+	working := &MemFile{desc: hf.Descriptor().copy()}
+	age := &FieldExpr{working.desc.Fields[1]}
+	// each iteration halves the ages in the working table
+	half := &FuncExpr{"/", []*Expr{new(Expr), new(Expr)}}
+	*half.args[0] = age
+	*half.args[1] = &ConstExpr{IntField{2}, IntType}
+	proj, err := NewProjectOp([]Expr{&FieldExpr{working.desc.Fields[0]}, half}, []string{"name", "age"}, false, working)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	positive, err := NewFilter(&ConstExpr{IntField{0}, IntType}, OpGt, age, proj)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, all := range []bool{true, false} {
+		rec, err := NewRecursiveCTE(hf, positive, working, all)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := rec.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		expected := t1.Fields[1].(IntField).Value
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if got := tup.Fields[1].(IntField).Value; got != expected {
+				t.Errorf("got age %d, expected %d", got, expected)
+			}
+			expected /= 2
+		}
+		if expected != 0 {
+			t.Errorf("recursion stopped early, next age would be %d", expected)
+		}
+	}
+}
+
+// test that the common table expressions and parameters of a statement
+// being parsed are not seen by another statement parsed against the same
+// catalog meanwhile
+func TestParseContextIsolation(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	pc := newParseContext(c)
+	pc.params = make(map[int][]*ConstExpr)
+	plan, err := parseQuery(pc, "select name from t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pc.ctes = map[string]*cteBinding{"old": {plan: plan}}
+	if _, err := parseQuery(pc, "select name from old"); err != nil {
+		t.Fatalf("expected the CTE to be in scope of its context, got %s", err.Error())
+	}
+
+	if _, _, err := Parse(c, "select name from old"); err == nil {
+		t.Errorf("expected the CTE of another statement not to be in scope")
+	}
+	ps, err := Prepare(c, "select name from t where age < ? and name <> ?")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ps.NumParams() != 2 || len(pc.params) != 0 {
+		t.Errorf("expected the parameters to be those of the prepared statement, got %d and %d", ps.NumParams(), len(pc.params))
+	}
+	if _, err := parseQuery(pc, "select name from old"); err != nil {
+		t.Errorf("expected the CTE to stay in scope of its context, got %s", err.Error())
+	}
+}
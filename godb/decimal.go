@@ -0,0 +1,158 @@
+package godb
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// The most digits a DECIMAL value may have, so that its Value fits in an int64.
+const maxDecimalPrecision = 18
+
+// pow10[n] is 10^n, for the scales of decimals.
+var pow10 = func() (p [maxDecimalPrecision + 1]int64) {
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+var errDecimalRange = GoDBError{TypeMismatchError, "decimal result is out of range"}
+
+// Return d with scale digits after the point, rounding half away from zero
+// if d has more. Returns an error if the value does not fit in an int64.
+func (d DecimalField) rescale(scale int) (DecimalField, error) {
+	if scale == d.Scale {
+		return d, nil
+	}
+	if scale < 0 || scale > maxDecimalPrecision {
+		return d, GoDBError{TypeMismatchError, fmt.Sprintf("unsupported decimal scale %d", scale)}
+	}
+	if scale < d.Scale {
+		return DecimalField{roundQuo(d.Value, pow10[d.Scale-scale]), scale}, nil
+	}
+	return decimalQuo(new(big.Int).Mul(big.NewInt(d.Value), big.NewInt(pow10[scale-d.Scale])), big.NewInt(1), scale)
+}
+
+// Return d with the scale of DECIMAL(precision, scale), or an error if it
+// has more than precision digits. A precision of 0 is not checked.
+func (d DecimalField) fit(precision int, scale int) (DecimalField, error) {
+	d, err := d.rescale(scale)
+	if err != nil {
+		return d, err
+	}
+	if precision > 0 && precision <= maxDecimalPrecision && (d.Value >= pow10[precision] || d.Value <= -pow10[precision]) {
+		return d, GoDBError{TypeMismatchError, fmt.Sprintf("value %s does not fit in DECIMAL(%d,%d)", valueString(d), precision, scale)}
+	}
+	return d, nil
+}
+
+// Return d without the trailing zeros of its digits after the point, so that
+// decimals are equal if and only if their normalized forms are ==.
+func (d DecimalField) normalize() DecimalField {
+	for d.Scale > 0 && d.Value%10 == 0 {
+		d = DecimalField{d.Value / 10, d.Scale - 1}
+	}
+	return d
+}
+
+// Compare two decimals, which may have different scales.
+func compareDecimals(d1 DecimalField, d2 DecimalField) int {
+	if d1.Scale == d2.Scale {
+		return cmpOrdered(d1.Value, d2.Value)
+	}
+	// compare the integer parts, and then the digits after the point at the
+	// larger scale, which have the sign of the number
+	i1, i2 := d1.Value/pow10[d1.Scale], d2.Value/pow10[d2.Scale]
+	if i1 != i2 {
+		return cmpOrdered(i1, i2)
+	}
+	scale := max(d1.Scale, d2.Scale)
+	f1 := d1.Value % pow10[d1.Scale] * pow10[scale-d1.Scale]
+	f2 := d2.Value % pow10[d2.Scale] * pow10[scale-d2.Scale]
+	return cmpOrdered(f1, f2)
+}
+
+// Return the scale of the result of the decimal function op on arguments of
+// scales s1 and s2: a product has the digits of both factors, up to
+// maxDecimalPrecision of them, a quotient at least DecimalScale digits, and
+// other results the digits of the argument that has more.
+func decimalResultScale(op string, s1 int, s2 int) int {
+	switch op {
+	case "*":
+		return min(s1+s2, maxDecimalPrecision)
+	case "/":
+		return max(s1, s2, DecimalScale)
+	}
+	return max(s1, s2)
+}
+
+// Apply the function op, which is +, -, *, /, imin or imax, to two decimals.
+// The result has the scale given by [decimalResultScale], rounding half away
+// from zero. Returns an error if it does not fit in an int64, or if it
+// divides by zero.
+func decimalArith(op string, d1 DecimalField, d2 DecimalField) (DecimalField, error) {
+	scale := decimalResultScale(op, d1.Scale, d2.Scale)
+	v1, v2 := big.NewInt(d1.Value), big.NewInt(d2.Value)
+	switch op {
+	case "*":
+		// the product has scale d1.Scale + d2.Scale
+		return decimalQuo(v1.Mul(v1, v2), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d1.Scale+d2.Scale-scale)), nil), scale)
+	case "/":
+		if d2.Value == 0 {
+			return DecimalField{}, errDivisionByZero
+		}
+		// the quotient of the values has scale d1.Scale - d2.Scale
+		shift := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d1.Scale+d2.Scale)), nil)
+		return decimalQuo(v1.Mul(v1, shift), v2, scale)
+	case "imin", "imax":
+		if (compareDecimals(d1, d2) < 0) != (op == "imin") {
+			d1 = d2
+		}
+		return d1.rescale(scale)
+	}
+	v1.Mul(v1, big.NewInt(pow10[scale-d1.Scale]))
+	v2.Mul(v2, big.NewInt(pow10[scale-d2.Scale]))
+	if op == "-" {
+		v2.Neg(v2)
+	}
+	return decimalQuo(v1.Add(v1, v2), big.NewInt(1), scale)
+}
+
+// Return the decimal of the given scale whose Value is n / d, rounded half
+// away from zero, or an error if it does not fit in an int64.
+func decimalQuo(n *big.Int, d *big.Int, scale int) (DecimalField, error) {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	// r has the sign of n, so the quotient is rounded away from zero by
+	// adding the sign of r over d
+	if twice := new(big.Int).Lsh(new(big.Int).Abs(r), 1); twice.Cmp(new(big.Int).Abs(d)) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign()*d.Sign())))
+	}
+	if !q.IsInt64() {
+		return DecimalField{}, errDecimalRange
+	}
+	return DecimalField{q.Int64(), scale}, nil
+}
+
+// Return n / d, for a positive d, rounded half away from zero.
+func roundQuo(n int64, d int64) int64 {
+	q, r := n/d, n%d
+	if r >= d-r {
+		q++
+	} else if -r >= d+r {
+		q--
+	}
+	return q
+}
+
+// Return the function applying the decimal function op to its two
+// arguments, for numericFuncs.
+func decimalFunc(op string) func([]any) any {
+	return func(args []any) any {
+		d, err := decimalArith(op, args[0].(DecimalField), args[1].(DecimalField))
+		if err != nil {
+			return err
+		}
+		return d
+	}
+}
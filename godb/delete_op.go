@@ -8,6 +8,12 @@ type DeleteOp struct {
 	// TODO: some code goes here
 	DeleteFile DBFile
 	Child      Operator
+
+	// the catalog and the catalog entry of DeleteFile, whose referencing
+	// foreign keys are applied and whose materialized views are maintained;
+	// nil if there are none
+	catalog *Catalog
+	table   *Table
 }
 
 // Construct a delete operator. The delete operator deletes the records in the
@@ -15,7 +21,15 @@ type DeleteOp struct {
 func NewDeleteOp(deleteFile DBFile, child Operator) *DeleteOp {
 	// TODO: some code goes here
 	// return nil // replace me
-	return &DeleteOp{deleteFile, child}
+	return &DeleteOp{deleteFile, child, nil, nil}
+}
+
+// Construct a delete operator that deletes the records in the child Operator
+// from table, applying the FOREIGN KEY constraints of the tables in c that
+// reference it, and maintaining the materialized views over the tables whose
+// tuples are deleted.
+func newTableDeleteOp(c *Catalog, table *Table, child Operator) *DeleteOp {
+	return &DeleteOp{table.file, child, c, table}
 }
 
 // The delete TupleDesc is a one column descriptor with an integer field named
@@ -23,16 +37,25 @@ func NewDeleteOp(deleteFile DBFile, child Operator) *DeleteOp {
 func (i *DeleteOp) Descriptor() *TupleDesc {
 	// TODO: some code goes here
 	// return &TupleDesc{} // replace me
-	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
+	return &TupleDesc{[]FieldType{{"count", "", IntType, 0, 0}}}
 }
 
 // Return an iterator that deletes all of the tuples from the child iterator
 // from the DBFile passed to the constructor and then returns a one-field tuple
 // with a "count" field indicating the number of tuples that were deleted.
 // Tuples should be deleted using the [DBFile.deleteTuple] method.
+//
+// If the operator applies foreign keys, all tuples are read from the child,
+// and the tuples that reference them found, before any is deleted, so that a
+// statement that violates an ON DELETE RESTRICT constraint deletes nothing.
+// Tuples deleted by ON DELETE CASCADE are deleted in the same transaction, but
+// are not included in the count.
 func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// TODO: some code goes here
 	// return nil, fmt.Errorf("DeleteOp.Iterator not implemented") // replace me
+	if dop.table != nil {
+		return dop.cascadingIterator(tid), nil
+	}
 	return func() (*Tuple, error) {
 		it, err := dop.Child.Iterator(tid)
 		if err != nil {
@@ -52,3 +75,51 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 		return &Tuple{Desc: *dop.Descriptor(), Fields: []DBValue{IntField{Value: int64(num)}}, Rid: 0}, nil
 	}, nil
 }
+
+func (dop *DeleteOp) cascadingIterator(tid TransactionID) func() (*Tuple, error) {
+	done := false
+	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		done = true
+		it, err := dop.Child.Iterator(tid)
+		if err != nil {
+			return nil, err
+		}
+		var tuples []*Tuple
+		for {
+			tp, err := it()
+			if err != nil {
+				return nil, err
+			}
+			if tp == nil {
+				break
+			}
+			tuples = append(tuples, tp)
+		}
+		deletes, err := dop.catalog.cascadeDeletes(dop.table, tuples, tid)
+		if err != nil {
+			return nil, err
+		}
+		var tables []*Table
+		deleted := make(map[*Table][]*Tuple)
+		for _, d := range deletes {
+			if err := d.table.file.deleteTuple(d.tup, tid); err != nil {
+				return nil, err
+			}
+			if deleted[d.table] == nil {
+				tables = append(tables, d.table)
+			}
+			deleted[d.table] = append(deleted[d.table], d.tup)
+		}
+		for _, t := range tables {
+			dop.catalog.recordChanges(t, nil, deleted[t], tid)
+			if err := dop.catalog.maintainViews(t, nil, deleted[t], tid); err != nil {
+				return nil, err
+			}
+		}
+		num := len(tuples)
+		return &Tuple{Desc: *dop.Descriptor(), Fields: []DBValue{IntField{Value: int64(num)}}, Rid: 0}, nil
+	}
+}
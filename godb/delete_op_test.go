@@ -22,7 +22,7 @@ func TestDelete(t *testing.T) {
 	insertTupleForTest(t, hf, &t2, tid)
 
 	bp.CommitTransaction(tid)
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{"age", "", IntType, 0, 0}
 	filt, err := NewFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
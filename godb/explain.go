@@ -0,0 +1,286 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// An ExplainNode describes an operator of a physical plan: what it computes,
+// what the planner estimated about it and the operators it reads from. A
+// tree of them is a plan in a form tools can read and compare, see
+// [ExplainPlan].
+type ExplainNode struct {
+	Operator    string           `json:"operator"`
+	Relation    string           `json:"relation,omitempty"`    // the file scanned, or the alias of a subquery
+	Condition   string           `json:"condition,omitempty"`   // the predicate of a join or filter
+	Expressions []string         `json:"expressions,omitempty"` // the expressions projected, aggregated or computed
+	Keys        []string         `json:"keys,omitempty"`        // the GROUP BY or PARTITION BY expressions
+	Order       []string         `json:"order,omitempty"`       // the ORDER BY expressions and directions
+	Output      []string         `json:"output"`                // the fields of the tuples returned
+	Cardinality int              `json:"cardinality"`
+	Cost        float64          `json:"cost,omitempty"`
+	Actual      *OperatorMetrics `json:"actual,omitempty"` // if the plan was analyzed
+	Children    []*ExplainNode   `json:"children,omitempty"`
+}
+
+// The formats EXPLAIN prints plans in.
+type ExplainFormat int
+
+const (
+	ExplainText ExplainFormat = iota
+	ExplainJSON
+	ExplainDOT
+)
+
+// The options of an EXPLAIN statement.
+type ExplainOptions struct {
+	Analyze bool
+	Format  ExplainFormat
+}
+
+// Build the tree of [ExplainNode] describing the plan rooted at o.
+func ExplainPlan(o Operator) *ExplainNode {
+	oc, ok := o.(*OperatorCard)
+	if !ok {
+		oc = &OperatorCard{Op: o}
+	}
+	n := &ExplainNode{Cardinality: oc.Cardinality, Cost: oc.Cost, Actual: oc.Metrics}
+	for _, f := range oc.Descriptor().Fields {
+		if f.TableQualifier != "" {
+			n.Output = append(n.Output, f.TableQualifier+"."+f.Fname)
+		} else {
+			n.Output = append(n.Output, f.Fname)
+		}
+	}
+	exprStrs := func(exprs []Expr) []string {
+		var strs []string
+		for _, e := range exprs {
+			strs = append(strs, exprToStr(e))
+		}
+		return strs
+	}
+	orderStrs := func(exprs []Expr, ascending []bool) []string {
+		var strs []string
+		for i, e := range exprs {
+			dir := " ASC"
+			if !ascending[i] {
+				dir = " DESC"
+			}
+			strs = append(strs, exprToStr(e)+dir)
+		}
+		return strs
+	}
+	var children []Operator
+	switch op := oc.Op.(type) {
+	case *EqualityJoin:
+		n.Operator = op.method.String()
+		n.Condition = op.condition()
+		children = []Operator{*op.left, *op.right}
+	case *ThetaJoin:
+		n.Operator = op.method()
+		n.Condition = op.condition()
+		children = []Operator{op.left, op.right}
+	case *Project:
+		n.Operator = "Project"
+		if op.distinct {
+			n.Operator = "Project Distinct"
+		}
+		n.Expressions = exprStrs(op.selectFields)
+		children = []Operator{op.child}
+	case *Filter:
+		n.Operator = "Filter"
+		n.Condition = fmt.Sprintf("%s %s %s", exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
+		children = []Operator{op.child}
+	case *HeapFile:
+		n.Operator = "Heap Scan"
+		n.Relation = op.BackingFile()
+	case *AliasOp:
+		n.Operator = "Subquery"
+		n.Relation = op.alias
+		children = []Operator{op.child}
+	case *SemiJoin:
+		n.Operator = "Semi Join"
+		if op.anti {
+			n.Operator = "Anti Join"
+		}
+		n.Condition = op.join.condition()
+		children = []Operator{*op.join.left, *op.join.right}
+	case *SubqueryFilter:
+		n.Operator = "Subquery Filter"
+		n.Condition = op.kind.String()
+		if op.kind == SubqueryScalar {
+			n.Condition = opToStr(op.op) + " " + n.Condition
+		}
+		if op.left != nil {
+			n.Condition = exprToStr(op.left) + " " + n.Condition
+		}
+		if op.outer != nil {
+			n.Condition += " (correlated)"
+		}
+		children = []Operator{op.child, op.subquery}
+	case *SetOp:
+		n.Operator = op.op.String()
+		if op.all {
+			n.Operator += " ALL"
+		}
+		children = []Operator{op.left, op.right}
+	case *WindowOp:
+		n.Operator = "Window"
+		for _, f := range op.funcs {
+			n.Expressions = append(n.Expressions, f.alias)
+		}
+		n.Keys = exprStrs(op.partitionBy)
+		n.Order = exprStrs(op.orderBy)
+		children = []Operator{op.child}
+	case *RecursiveCTE:
+		n.Operator = "Recursive CTE"
+		children = []Operator{op.base, op.step}
+	case *MemFile:
+		n.Operator = "Working Table Scan"
+	case *OrderBy:
+		n.Operator = "Order By"
+		n.Order = orderStrs(op.orderBy, op.ascending)
+		children = []Operator{op.child}
+	case *LimitOp:
+		n.Operator = "Limit"
+		n.Expressions = []string{exprToStr(op.limitTups)}
+		children = []Operator{op.child}
+	case *TopN:
+		n.Operator = "Top-N"
+		n.Expressions = []string{exprToStr(op.limitTups)}
+		n.Order = orderStrs(op.orderBy, op.ascending)
+		children = []Operator{op.child}
+	case *Aggregator:
+		n.Operator = "Aggregate"
+		for _, agg := range op.newAggState {
+			n.Expressions = append(n.Expressions, agg.GetTupleDesc().HeaderString(false))
+		}
+		n.Keys = exprStrs(op.groupByFields)
+		children = []Operator{op.child}
+	default:
+		n.Operator = reflect.TypeOf(op).String()
+	}
+	for _, child := range children {
+		n.Children = append(n.Children, ExplainPlan(child))
+	}
+	return n
+}
+
+// Return the plan as indented JSON.
+func (n *ExplainNode) JSON() (string, error) {
+	b, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Return the plan as a Graphviz DOT graph, with an edge from each operator
+// to each of its inputs.
+func (n *ExplainNode) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph plan {\n\tnode [shape=box];\n")
+	id := 0
+	var add func(n *ExplainNode) int
+	add = func(n *ExplainNode) int {
+		me := id
+		id++
+		label := []string{n.Operator}
+		for _, s := range []string{n.Relation, n.Condition} {
+			if s != "" {
+				label = append(label, s)
+			}
+		}
+		for _, list := range []struct {
+			name  string
+			items []string
+		}{{"", n.Expressions}, {"by ", n.Keys}, {"order by ", n.Order}} {
+			if len(list.items) > 0 {
+				label = append(label, list.name+strings.Join(list.items, ", "))
+			}
+		}
+		label = append(label, fmt.Sprintf("card: %d, cost: %.0f", n.Cardinality, n.Cost))
+		if m := n.Actual; m != nil {
+			label = append(label, fmt.Sprintf("actual rows: %d, loops: %d, time: %.3fms", m.Rows, m.Loops, float64(m.Time.Microseconds())/1000))
+		}
+		for i, l := range label {
+			label[i] = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(l)
+		}
+		fmt.Fprintf(&b, "\tn%d [label=\"%s\"];\n", me, strings.Join(label, `\n`))
+		for _, child := range n.Children {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", me, add(child))
+		}
+		return me
+	}
+	add(n)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Split an EXPLAIN statement of the form
+// "EXPLAIN [ANALYZE] [(option, ...)] query" into its options and the query
+// it explains. The options are ANALYZE [TRUE | FALSE] and
+// FORMAT TEXT | JSON | DOT. Returns false if stmt is not an EXPLAIN
+// statement.
+func ParseExplain(stmt string) (opts ExplainOptions, query string, ok bool, err error) {
+	n := matchKeyword(stmt, "explain")
+	if n == 0 {
+		return opts, "", false, nil
+	}
+	rest := strings.TrimSpace(stmt[n:])
+	if n := matchKeyword(rest, "analyze"); n > 0 {
+		opts.Analyze = true
+		rest = strings.TrimSpace(rest[n:])
+	}
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return opts, "", true, GoDBError{ParseError, fmt.Sprintf("expected ) after the options of %s", stmt)}
+		}
+		for _, opt := range strings.Split(rest[1:end], ",") {
+			words := strings.Fields(strings.ToLower(opt))
+			switch {
+			case len(words) == 1 && words[0] == "analyze":
+				opts.Analyze = true
+			case len(words) == 2 && words[0] == "analyze" && (words[1] == "true" || words[1] == "false"):
+				opts.Analyze = words[1] == "true"
+			case len(words) == 2 && words[0] == "format" && words[1] == "text":
+				opts.Format = ExplainText
+			case len(words) == 2 && words[0] == "format" && words[1] == "json":
+				opts.Format = ExplainJSON
+			case len(words) == 2 && words[0] == "format" && words[1] == "dot":
+				opts.Format = ExplainDOT
+			default:
+				return opts, "", true, GoDBError{ParseError, fmt.Sprintf("unknown EXPLAIN option %s", strings.TrimSpace(opt))}
+			}
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	if rest == "" {
+		return opts, "", true, GoDBError{ParseError, "EXPLAIN needs a query to explain"}
+	}
+	return opts, rest, true, nil
+}
+
+// Output the plan rooted at o with printf in the format of opts.
+func OutputExplain(printf func(format string, a ...any), o Operator, opts ExplainOptions) error {
+	switch opts.Format {
+	case ExplainJSON:
+		s, err := ExplainPlan(o).JSON()
+		if err != nil {
+			return err
+		}
+		printf("%s\n", s)
+	case ExplainDOT:
+		printf("%s", ExplainPlan(o).DOT())
+	default:
+		if opts.Analyze {
+			OutputAnalyzedPlan(printf, o, "")
+		} else {
+			OutputPhysicalPlan(printf, o, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EXPLAIN ANALYZE runs a query with every operator of its plan instrumented,
+// then prints the plan with what each operator actually did next to what the
+// planner estimated, so that bad estimates can be found.
+
+// The metrics of an operator collected while an analyzed plan runs. The time
+// and pages of an operator include those of its inputs.
+type OperatorMetrics struct {
+	Loops     int           `json:"loops"`      // the number of times the operator was started
+	Rows      int           `json:"rows"`       // the number of tuples it returned, over all loops
+	Time      time.Duration `json:"time_ns"`    // the time spent starting it and getting its tuples
+	PagesRead int           `json:"pages_read"` // the pages read from disk while it ran
+	PageHits  int           `json:"page_hits"`  // the pages found in the buffer pool while it ran
+
+	bp *BufferPool
+}
+
+// Run f, adding the time it takes and the pages tid reads to m.
+func (m *OperatorMetrics) measure(tid TransactionID, f func() error) error {
+	var before PageCounts
+	if m.bp != nil {
+		before = m.bp.PageCounts(tid)
+	}
+	start := time.Now()
+	err := f()
+	m.Time += time.Since(start)
+	if m.bp != nil {
+		after := m.bp.PageCounts(tid)
+		m.PagesRead += after.Reads - before.Reads
+		m.PageHits += after.Hits - before.Hits
+	}
+	return err
+}
+
+// Return the iterator of op, recording its metrics in m.
+func (m *OperatorMetrics) iterator(op Operator, tid TransactionID) (func() (*Tuple, error), error) {
+	var iter func() (*Tuple, error)
+	err := m.measure(tid, func() (err error) {
+		iter, err = op.Iterator(tid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.Loops++
+	return func() (*Tuple, error) {
+		var t *Tuple
+		err := m.measure(tid, func() (err error) {
+			t, err = iter()
+			return err
+		})
+		if t != nil {
+			m.Rows++
+		}
+		return t, err
+	}, nil
+}
+
+// Instrument the operators of the plan rooted at o to collect their metrics
+// when the plan runs, counting the pages read through bp, and reset the
+// metrics collected so far.
+func AnalyzePhysicalPlan(o Operator, bp *BufferPool) {
+	outputPlan(func(oc *OperatorCard, format string, a ...any) {
+		oc.Metrics = &OperatorMetrics{bp: bp}
+	}, o, "")
+}
+
+// Run the plan rooted at o to completion in transaction tid, discarding its
+// tuples, and return how many it returned. The operators of the plan collect
+// their metrics, see [OutputAnalyzedPlan].
+func ExplainAnalyze(o Operator, bp *BufferPool, tid TransactionID) (int, error) {
+	AnalyzePhysicalPlan(o, bp)
+	iter, err := o.Iterator(tid)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		t, err := iter()
+		if err != nil {
+			return n, err
+		}
+		if t == nil {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// Output the plan rooted at o like [OutputPhysicalPlan], followed on each
+// line by the metrics the operator collected: the rows it returned per loop,
+// to compare with its estimated cardinality, the number of loops, its time in
+// milliseconds and the pages it read from disk and found in the buffer pool.
+func OutputAnalyzedPlan(printf func(format string, a ...any), o Operator, indent string) {
+	outputPlan(func(oc *OperatorCard, format string, a ...any) {
+		line := strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")
+		m := oc.Metrics
+		if m == nil {
+			printf("%s, never executed\n", line)
+			return
+		}
+		rows := 0
+		if m.Loops > 0 {
+			rows = (m.Rows + m.Loops/2) / m.Loops
+		}
+		printf("%s, actual rows:%d, loops:%d, time:%.3fms, pages read:%d, hits:%d\n",
+			line, rows, m.Loops, float64(m.Time.Microseconds())/1000, m.PagesRead, m.PageHits)
+	}, o, indent)
+}
+
+func PrintAnalyzedPlan(o Operator, indent string) {
+	OutputAnalyzedPlan(func(s string, a ...any) { fmt.Printf(s, a...) }, o, indent)
+}
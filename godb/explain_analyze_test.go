@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplainAnalyze(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	sql := "select t.name from t join t2 on t.name = t2.name where t.age > 40"
+	_, want := countQueryResults(t, bp, c, sql)
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	n, err := ExplainAnalyze(plan, bp, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	if n != want {
+		t.Errorf("expected %d results, got %d", want, n)
+	}
+
+	root := plan.(*OperatorCard).Metrics
+	if root == nil || root.Loops != 1 || root.Rows != n {
+		t.Fatalf("expected the root to return %d rows in one loop, got %+v", n, root)
+	}
+	var out strings.Builder
+	OutputAnalyzedPlan(func(format string, a ...any) { fmt.Fprintf(&out, format, a...) }, plan, "")
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	scans := 0
+	for _, line := range lines {
+		if !strings.Contains(line, "card:") || !strings.Contains(line, "actual rows:") {
+			t.Errorf("expected estimated and actual rows side by side, got %q", line)
+		}
+		if strings.Contains(line, "Heap Scan") {
+			scans++
+			if strings.Contains(line, "pages read:0, hits:0") {
+				t.Errorf("expected a heap scan to read pages, got %q", line)
+			}
+		}
+	}
+	if scans != 2 {
+		t.Errorf("expected two heap scans, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[0], fmt.Sprintf("actual rows:%d, loops:1,", n)) {
+		t.Errorf("expected the root to report %d rows, got %q", n, lines[0])
+	}
+
+	// the plan runs uninstrumented until it is analyzed
+	_, plan, err = Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	out.Reset()
+	OutputAnalyzedPlan(func(format string, a ...any) { fmt.Fprintf(&out, format, a...) }, plan, "")
+	if !strings.Contains(out.String(), "never executed") {
+		t.Errorf("expected a plan that was not analyzed to say so, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,121 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExplain(t *testing.T) {
+	for _, c := range []struct {
+		stmt  string
+		opts  ExplainOptions
+		query string
+		ok    bool
+	}{
+		{"explain select * from t", ExplainOptions{}, "select * from t", true},
+		{"EXPLAIN ANALYZE select * from t", ExplainOptions{Analyze: true}, "select * from t", true},
+		{"explain (format json) select * from t", ExplainOptions{Format: ExplainJSON}, "select * from t", true},
+		{"explain (analyze, format dot) select * from t", ExplainOptions{Analyze: true, Format: ExplainDOT}, "select * from t", true},
+		{"explain analyze (analyze false, format text) select 1", ExplainOptions{}, "select 1", true},
+		{"explained select 1", ExplainOptions{}, "", false},
+		{"select 1", ExplainOptions{}, "", false},
+	} {
+		opts, query, ok, err := ParseExplain(c.stmt)
+		if err != nil || opts != c.opts || query != c.query || ok != c.ok {
+			t.Errorf("%s: expected %+v %q %v, got %+v %q %v %v", c.stmt, c.opts, c.query, c.ok, opts, query, ok, err)
+		}
+	}
+	for _, stmt := range []string{"explain", "explain (format xml) select 1", "explain (format json select 1"} {
+		if _, _, ok, err := ParseExplain(stmt); !ok || err == nil {
+			t.Errorf("expected an error for %s", stmt)
+		}
+	}
+}
+
+func TestExplainFormats(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	_, plan, err := Parse(c, "select t.name, t2.age from t join t2 on t.name = t2.name where t.age > 40 order by t2.age desc")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tree := ExplainPlan(plan)
+	nodes := 0
+	var ops []string
+	var walk func(n *ExplainNode)
+	walk = func(n *ExplainNode) {
+		nodes++
+		ops = append(ops, n.Operator)
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(tree)
+	if !reflect.DeepEqual(tree.Output, []string{"name", "age"}) {
+		t.Errorf("expected the plan to output name and age, got %v", tree.Output)
+	}
+	var join, filter, order *ExplainNode
+	var find func(n *ExplainNode)
+	find = func(n *ExplainNode) {
+		switch n.Operator {
+		case "Hash Join":
+			join = n
+		case "Filter":
+			filter = n
+		case "Order By":
+			order = n
+		}
+		for _, child := range n.Children {
+			find(child)
+		}
+	}
+	find(tree)
+	if join == nil || join.Condition != "t2.name == t.name" || len(join.Children) != 2 || join.Cost == 0 {
+		t.Errorf("expected a join on t2.name == t.name with a cost, got %+v", join)
+	}
+	if filter == nil || filter.Condition != "t.age > 40" || filter.Children[0].Operator != "Heap Scan" || filter.Children[0].Relation == "" {
+		t.Errorf("expected a filter t.age > 40 over a heap scan, got %+v", filter)
+	}
+	if order == nil || !reflect.DeepEqual(order.Order, []string{"age DESC"}) {
+		t.Errorf("expected an order by age DESC, got %+v", order)
+	}
+
+	// JSON reads back as the same tree
+	s, err := tree.JSON()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var decoded ExplainNode
+	if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(&decoded, tree) {
+		t.Errorf("expected the JSON plan to decode to the plan, got\n%s", s)
+	}
+
+	// DOT has a node per operator and an edge to each input
+	dot := tree.DOT()
+	if !strings.HasPrefix(dot, "digraph plan {") || strings.Count(dot, "[label=") != nodes || strings.Count(dot, "->") != nodes-1 {
+		t.Errorf("expected a graph of %d operators, got\n%s", nodes, dot)
+	}
+	if !strings.Contains(dot, `Hash Join\nt2.name == t.name\n`) {
+		t.Errorf("expected the label of the join to show its condition, got\n%s", dot)
+	}
+
+	var out strings.Builder
+	printf := func(format string, a ...any) { fmt.Fprintf(&out, format, a...) }
+	for _, format := range []ExplainFormat{ExplainText, ExplainJSON, ExplainDOT} {
+		out.Reset()
+		if err := OutputExplain(printf, plan, ExplainOptions{Format: format}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !strings.Contains(out.String(), "Join") {
+			t.Errorf("expected format %d to describe the join, got\n%s", format, out.String())
+		}
+	}
+}
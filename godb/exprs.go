@@ -2,6 +2,7 @@ package godb
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"time"
 )
@@ -41,32 +42,67 @@ type ConstExpr struct {
 }
 
 func (c *ConstExpr) GetExprType() FieldType {
-	return FieldType{"const", fmt.Sprintf("%v", c.val), c.constType}
+	ft := FieldType{"const", fmt.Sprintf("%v", c.val), c.constType, 0, 0}
+	if d, ok := c.val.(DecimalField); ok {
+		ft.Scale = d.Scale
+	}
+	return ft
 }
 
 func (c *ConstExpr) EvalExpr(_ *Tuple) (DBValue, error) {
 	return c.val, nil
 }
 
+// An outerBinding holds the tuple of the enclosing query that a correlated
+// subquery is currently being evaluated for. The operator that drives the
+// subquery sets tuple before iterating through it.
+type outerBinding struct {
+	desc  *TupleDesc
+	tuple *Tuple
+}
+
+// OuterRefExpr reads a field of the enclosing query's current tuple, rather
+// than of the tuple it is applied to.  It is used for the correlated
+// predicates of subqueries.
+type OuterRefExpr struct {
+	selectField FieldType
+	outer       *outerBinding
+}
+
+func (o *OuterRefExpr) EvalExpr(_ *Tuple) (DBValue, error) {
+	if o.outer == nil || o.outer.tuple == nil {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("outer reference %s evaluated outside of a subquery", o.selectField.Fname)}
+	}
+	return (&FieldExpr{o.selectField}).EvalExpr(o.outer.tuple)
+}
+
+func (o *OuterRefExpr) GetExprType() FieldType {
+	return o.selectField
+}
+
 type FuncExpr struct {
 	op   string
 	args []*Expr
 }
 
 func (f *FuncExpr) GetExprType() FieldType {
-	fType, exists := funcs[f.op]
+	fType, exists := lookupFunc(f.op, f.argTypes())
 	//todo return err
 	if !exists {
-		return FieldType{f.op, "", IntType}
+		return FieldType{f.op, "", IntType, 0, 0}
 	}
-	ft := FieldType{f.op, "", IntType}
+	ft := FieldType{f.op, "", IntType, 0, 0}
 	for _, fe := range f.args {
 		fieldExpr, ok := (*fe).(*FieldExpr)
 		if ok {
 			ft = fieldExpr.GetExprType()
 		}
 	}
-	return FieldType{ft.Fname, ft.TableQualifier, fType.outType}
+	scale := 0
+	if fType.outType == DecimalType && len(f.args) == 2 {
+		scale = decimalResultScale(f.op, (*f.args[0]).GetExprType().Scale, (*f.args[1]).GetExprType().Scale)
+	}
+	return FieldType{ft.Fname, ft.TableQualifier, fType.outType, 0, scale}
 }
 
 type FuncType struct {
@@ -93,6 +129,67 @@ var funcs = map[string]FuncType{
 	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
 }
 
+// Overloads of functions for FLOAT and DECIMAL arguments, by the type their
+// arguments are promoted to; see [lookupFunc]. DECIMAL arguments are passed
+// as [DecimalField]s, which may have different scales, and the result has
+// the scale given by [decimalResultScale].
+var numericFuncs = map[string]map[DBType]FuncType{
+	"+": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, addFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("+")},
+	},
+	"-": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, minusFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("-")},
+	},
+	"*": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, timesFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("*")},
+	},
+	"/": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, divFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("/")},
+	},
+	"imin": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, minFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("imin")},
+	},
+	"imax": {
+		FloatType:   {[]DBType{FloatType, FloatType}, FloatType, maxFloatFunc},
+		DecimalType: {[]DBType{DecimalType, DecimalType}, DecimalType, decimalFunc("imax")},
+	},
+}
+
+// Return the function called op for arguments of types argTypes: the overload
+// in numericFuncs for the type that numeric arguments are promoted to, see
+// [promoteNumeric], if there is one, and otherwise the function in funcs.
+func lookupFunc(op string, argTypes []DBType) (FuncType, bool) {
+	fType, ok := funcs[op]
+	overloads := numericFuncs[op]
+	if !ok || overloads == nil {
+		return fType, ok
+	}
+	t := IntType
+	for _, at := range argTypes {
+		if p, ok := promoteNumeric(t, at); ok {
+			t = p
+		}
+	}
+	if o, ok := overloads[t]; ok {
+		return o, true
+	}
+	return fType, true
+}
+
+// Return the types of the arguments of f.
+func (f *FuncExpr) argTypes() []DBType {
+	types := make([]DBType, len(f.args))
+	for i, arg := range f.args {
+		types[i] = (*arg).GetExprType().Ftype
+	}
+	return types
+}
+
 func ListOfFunctions() string {
 	fList := ""
 	for name, f := range funcs {
@@ -103,16 +200,16 @@ func ListOfFunctions() string {
 			if hasArg {
 				args = args + ","
 			}
-			switch a {
-			case IntType:
-				args = args + "int"
-			case StringType:
-				args = args + "string"
-			}
+			args = args + a.String()
 			hasArg = true
 		}
 		args = args + ")"
 		fList = fList + "\t" + name + args + "\n"
+		for _, t := range []DBType{FloatType, DecimalType} {
+			if o, ok := numericFuncs[name][t]; ok {
+				fList = fList + "\t" + name + "(" + t.String() + "," + t.String() + ") -> " + o.outType.String() + "\n"
+			}
+		}
 	}
 	return fList
 }
@@ -188,6 +285,37 @@ func addFunc(args []any) any {
 	return args[0].(int64) + args[1].(int64)
 }
 
+func addFloatFunc(args []any) any {
+	return args[0].(float64) + args[1].(float64)
+}
+
+func minusFloatFunc(args []any) any {
+	return args[0].(float64) - args[1].(float64)
+}
+
+func timesFloatFunc(args []any) any {
+	return args[0].(float64) * args[1].(float64)
+}
+
+func divFloatFunc(args []any) any {
+	if args[1].(float64) == 0 {
+		return errDivisionByZero
+	}
+	return args[0].(float64) / args[1].(float64)
+}
+
+func minFloatFunc(args []any) any {
+	return math.Min(args[0].(float64), args[1].(float64))
+}
+
+func maxFloatFunc(args []any) any {
+	return math.Max(args[0].(float64), args[1].(float64))
+}
+
+// The error a function returns, in place of its result, when it divides by
+// zero.
+var errDivisionByZero = GoDBError{IllegalOperationError, "division by zero"}
+
 func sqFunc(args []any) any {
 	return args[0].(int64) * args[0].(int64)
 }
@@ -210,7 +338,7 @@ func subStrFunc(args []any) any {
 }
 
 func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	fType, exists := funcs[f.op]
+	fType, exists := lookupFunc(f.op, f.argTypes())
 	if !exists {
 		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", f.op)}
 	}
@@ -220,13 +348,8 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 	argvals := make([]any, len(fType.argTypes))
 	for i, argType := range fType.argTypes {
 		arg := *f.args[i]
-		if arg.GetExprType().Ftype != argType {
-			typeName := "string"
-			switch argType {
-			case IntType:
-				typeName = "int"
-			}
-			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, typeName)}
+		if argFtype := arg.GetExprType().Ftype; argFtype != argType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("function %s expected arg %d of type %s, but %s has type %s", f.op, i+1, argType, exprToStr(arg), argFtype)}
 		}
 		val, err := arg.EvalExpr(t)
 		if err != nil {
@@ -237,14 +360,25 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 			argvals[i] = val.(IntField).Value
 		case StringType:
 			argvals[i] = val.(StringField).Value
+		case FloatType:
+			argvals[i] = val.(FloatField).Value
+		case DecimalType:
+			argvals[i] = val.(DecimalField)
 		}
 	}
 	result := fType.f(argvals)
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
 	switch fType.outType {
 	case IntType:
 		return IntField{result.(int64)}, nil
 	case StringType:
 		return StringField{result.(string)}, nil
+	case FloatType:
+		return FloatField{result.(float64)}, nil
+	case DecimalType:
+		return result.(DecimalField), nil
 	}
 	return nil, GoDBError{ParseError, "unknown result type in function"}
 }
@@ -0,0 +1,255 @@
+package godb
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// A tupleSorter sorts tuples by the values of key expressions. Tuples are
+// sorted in memory while they fit in maxTuples; otherwise every maxTuples
+// tuples are sorted into a run written to a [spillFile], and the runs are
+// merged, at most maxRuns at a time if maxRuns is more than 1, in as many
+// passes as that takes.
+type tupleSorter struct {
+	keys      []Expr
+	ascending []bool
+	maxTuples int
+	maxRuns   int
+}
+
+// A tuple being sorted, with the values of the sort keys for it.
+type sortEntry struct {
+	tuple *Tuple
+	key   []DBValue
+}
+
+// Evaluate the sort keys for t.
+func (s *tupleSorter) entry(t *Tuple) (sortEntry, error) {
+	key := make([]DBValue, len(s.keys))
+	for i, e := range s.keys {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return sortEntry{}, err
+		}
+		key[i] = v
+	}
+	return sortEntry{t, key}, nil
+}
+
+// Compare the sort keys of two tuples. Values that cannot be compared are
+// treated as equal, as by [OrderBy].
+func (s *tupleSorter) compare(a, b []DBValue) int {
+	for i := range a {
+		c, ok := compareValues(a[i], b[i])
+		if !ok || c == 0 {
+			continue
+		}
+		if !s.ascending[i] {
+			return -c
+		}
+		return c
+	}
+	return 0
+}
+
+// Return an iterator over the tuples of iter in order. Tuples with equal keys
+// are returned in the order iter returns them.
+func (s *tupleSorter) sort(iter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	var run []sortEntry
+	var runs []*spillFile
+	for {
+		t, err := iter()
+		if err != nil {
+			closeSpillFiles(runs)
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if s.maxTuples > 0 && len(run) == s.maxTuples {
+			f, err := s.writeRun(run)
+			if err != nil {
+				closeSpillFiles(runs)
+				return nil, err
+			}
+			runs = append(runs, f)
+			run = nil
+		}
+		e, err := s.entry(t)
+		if err != nil {
+			closeSpillFiles(runs)
+			return nil, err
+		}
+		run = append(run, e)
+	}
+	if len(runs) == 0 {
+		slices.SortStableFunc(run, func(a, b sortEntry) int { return s.compare(a.key, b.key) })
+		i := 0
+		return func() (*Tuple, error) {
+			if i == len(run) {
+				return nil, nil
+			}
+			i++
+			return run[i-1].tuple, nil
+		}, nil
+	}
+	// spill the last run too, so that only a page of each run is in memory
+	// while they are merged
+	if len(run) > 0 {
+		f, err := s.writeRun(run)
+		if err != nil {
+			closeSpillFiles(runs)
+			return nil, err
+		}
+		runs = append(runs, f)
+	}
+	for s.maxRuns > 1 && len(runs) > s.maxRuns {
+		// merge each maxRuns consecutive runs into one, which keeps the
+		// merge stable
+		var merged []*spillFile
+		for i := 0; i < len(runs); i += s.maxRuns {
+			group := runs[i:min(i+s.maxRuns, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			f, err := s.mergeRuns(group)
+			if err != nil {
+				closeSpillFiles(merged)
+				closeSpillFiles(runs[i:])
+				return nil, err
+			}
+			merged = append(merged, f)
+		}
+		runs = merged
+	}
+	return s.merge(runs)
+}
+
+// Merge runs into a new run, closing them.
+func (s *tupleSorter) mergeRuns(runs []*spillFile) (*spillFile, error) {
+	iter, err := s.merge(runs)
+	if err != nil {
+		return nil, err
+	}
+	var f *spillFile
+	for {
+		t, err := iter()
+		if err != nil {
+			closeSpillFiles([]*spillFile{f})
+			return nil, err
+		}
+		if t == nil {
+			return f, nil
+		}
+		if f == nil {
+			if f, err = newSpillFile(t); err != nil {
+				return nil, err
+			}
+		}
+		if err := f.add(t); err != nil {
+			f.close()
+			return nil, err
+		}
+	}
+}
+
+// Sort run and write it to a spill file.
+func (s *tupleSorter) writeRun(run []sortEntry) (*spillFile, error) {
+	slices.SortStableFunc(run, func(a, b sortEntry) int { return s.compare(a.key, b.key) })
+	f, err := newSpillFile(run[0].tuple)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range run {
+		if err := f.add(e.tuple); err != nil {
+			f.close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// The next tuple of each sorted run being merged, ordered by key, and then by
+// run, so that the merge is stable.
+type mergeHeap struct {
+	sorter *tupleSorter
+	heads  []*mergeHead
+}
+
+type mergeHead struct {
+	entry sortEntry
+	run   int
+	next  func() (*Tuple, error)
+	file  *spillFile
+}
+
+func (h *mergeHeap) Len() int { return len(h.heads) }
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.sorter.compare(h.heads[i].entry.key, h.heads[j].entry.key); c != 0 {
+		return c < 0
+	}
+	return h.heads[i].run < h.heads[j].run
+}
+func (h *mergeHeap) Swap(i, j int) { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+func (h *mergeHeap) Push(x any)    { h.heads = append(h.heads, x.(*mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	head := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return head
+}
+
+// Read the next tuple of the run of head into it, returning false if the run
+// is exhausted, in which case its file is closed.
+func (h *mergeHeap) advance(head *mergeHead) (bool, error) {
+	t, err := head.next()
+	if err != nil {
+		return false, err
+	}
+	if t == nil {
+		head.file.close()
+		return false, nil
+	}
+	head.entry, err = h.sorter.entry(t)
+	return err == nil, err
+}
+
+// Return an iterator over the tuples of the sorted runs in files, in order,
+// which closes each file once it has read all its tuples.
+func (s *tupleSorter) merge(files []*spillFile) (func() (*Tuple, error), error) {
+	h := &mergeHeap{sorter: s}
+	for i, f := range files {
+		next, err := f.iterator()
+		if err != nil {
+			closeSpillFiles(files)
+			return nil, err
+		}
+		head := &mergeHead{run: i, next: next, file: f}
+		ok, err := h.advance(head)
+		if err != nil {
+			closeSpillFiles(files)
+			return nil, err
+		}
+		if ok {
+			h.heads = append(h.heads, head)
+		}
+	}
+	heap.Init(h)
+	return func() (*Tuple, error) {
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		head := h.heads[0]
+		t := head.entry.tuple
+		ok, err := h.advance(head)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+		return t, nil
+	}, nil
+}
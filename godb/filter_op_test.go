@@ -19,7 +19,7 @@ func TestFilterInt(t *testing.T) {
 	insertTupleForTest(t, hf, &t1, tid)
 	insertTupleForTest(t, hf, &t2, tid)
 
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{"age", "", IntType, 0, 0}
 	filt, err := NewFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -50,7 +50,7 @@ func TestFilterString(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars(t)
 	insertTupleForTest(t, hf, &t1, tid)
 	insertTupleForTest(t, hf, &t2, tid)
-	var f FieldType = FieldType{"name", "", StringType}
+	var f FieldType = FieldType{"name", "", StringType, 0, 0}
 	filt, err := NewFilter(&ConstExpr{StringField{"sam"}, StringType}, OpEq, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -142,6 +142,12 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 					field = field[0:StringLength]
 				}
 				newFields = append(newFields, StringField{field})
+			default:
+				v, err := parseValue(f.Descriptor().Fields[fno].Ftype, field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to %s, tuple %d", field, f.Descriptor().Fields[fno].Ftype, cnt)}
+				}
+				newFields = append(newFields, v)
 			}
 		}
 		newT := Tuple{*f.Descriptor(), newFields, nil}
@@ -208,8 +214,12 @@ func (f *HeapFile) readPage(pageNo int) (Page, error) {
 // worry about concurrent transactions modifying the Page or HeapFile. We will
 // add support for concurrent modifications in lab 3.
 //
-// The page the tuple is inserted into should be marked as dirty.
+// The page the tuple is inserted into should be marked as dirty. Its
+// decimals are first rounded to the scales of their columns.
 func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
+	if err := f.Descriptor().fitDecimals(t); err != nil {
+		return err
+	}
 	for _, page := range f.HeapPages {
 		if page.UsedSlotsNum < page.SlotNum {
 			_, err := page.insertTuple(t)
@@ -267,6 +277,23 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 	return nil
 }
 
+// Return the tuple with record ID rid, or nil if there is none (e.g., because
+// it was deleted). The page is read through the buffer pool.
+func (f *HeapFile) tupleAt(rid RID, tid TransactionID) (*Tuple, error) {
+	if rid.PageNo < 0 || rid.PageNo >= f.NumPages() {
+		return nil, nil
+	}
+	page, err := f.bufPool.GetPage(f, rid.PageNo, tid, ReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	hp := page.(*heapPage)
+	if rid.SlotNo < 0 || rid.SlotNo >= hp.UsedSlotsNum || rid.SlotNo >= len(hp.Tuples) {
+		return nil, nil
+	}
+	return hp.Tuples[rid.SlotNo], nil
+}
+
 // Method to force the specified page back to the backing file at the
 // appropriate location. This will be called by BufferPool when it wants to
 // evict a page. The Page object should store information about its offset on
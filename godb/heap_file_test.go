@@ -109,6 +109,47 @@ func TestHeapFileDelete(t *testing.T) {
 	}
 }
 
+// Tuples keep their record ids when a page with deleted tuples is written to
+// disk and read back
+func TestHeapFileDeleteKeepsRids(t *testing.T) {
+	bp, hf := makeTestFile(t, 3)
+	_, t1, t2 := makeTupleTestVars()
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	if err := hf.insertTuple(&t1, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := hf.insertTuple(&t2, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := hf.deleteTuple(&t1, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	bp2, catalog, err := MakeTestDatabase(1, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := catalog.addTable("test", *hf.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	tup, err := hf2.(*HeapFile).tupleAt(t2.Rid.(RID), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil || !tup.equals(&t2) {
+		t.Fatalf("expected %v at record id %v after reading the page back, got %v", t2.Fields, t2.Rid, tup)
+	}
+	if tup, _ := hf2.(*HeapFile).tupleAt(t1.Rid.(RID), tid); tup != nil {
+		t.Fatalf("expected the deleted tuple's slot to stay empty, got %v", tup.Fields)
+	}
+}
+
 func testSerializeN(t *testing.T, n int) {
 	bp, hf := makeTestFile(t, max(1, n/50))
 	_, t1, t2 := makeTupleTestVars()
@@ -263,9 +304,11 @@ func TestHeapFileSetDirty(t *testing.T) {
 	}
 
 	_, t1, _, hf, bp, tid := makeTestVars(t)
-	for i := 0; i < 308; i++ {
+	// the three pages of the buffer pool hold 3 * slotsPerPage tuples
+	full := 3 * slotsPerPage(hf.Descriptor())
+	for i := 0; i < full+2; i++ {
 		err := hf.insertTuple(&t1, tid)
-		if err != nil && (i == 306 || i == 307) {
+		if err != nil && (i == full || i == full+1) {
 			return
 		} else if err != nil {
 			t.Fatalf("%v", err)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"unsafe"
 )
 
@@ -18,8 +19,9 @@ In GoDB all tuples are fixed length, which means that given a TupleDesc it is
 possible to figure out how many tuple "slots" fit on a given page.
 
 In addition, all pages are PageSize bytes.  They begin with a header with a 32
-bit integer with the number of slots (tuples), and a second 32 bit integer with
-the number of used slots.
+bit integer with the number of slots (tuples), a second 32 bit integer with
+the number of used slots, and a bitmap with a bit for each slot that is set if
+the slot holds a tuple.
 
 Each tuple occupies the same number of bytes.  You can use the go function
 unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
@@ -31,21 +33,23 @@ tuple is just the sum of the size in bytes of its fields.
 Once you have figured out how big a record is, you can determine the number of
 slots on on the page as:
 
-remPageSize = PageSize - 8 // bytes after header
-numSlots = remPageSize / bytesPerTuple //integer division will round down
+remPageSize = PageSize - 8 // bytes after the two integers of the header
+numSlots = remPageSize * 8 / (bytesPerTuple * 8 + 1) // a tuple and a bit of the bitmap
 
 To serialize a page to a buffer, you can then:
 
 write the number of slots as an int32
 write the number of used slots as an int32
+write the bitmap of the slots that hold tuples
 write the tuples themselves to the buffer
 
 You will follow the inverse process to read pages from a buffer.
 
 Note that to process deletions you will likely delete tuples at a specific
 position (slot) in the heap page.  This means that after a page is read from
-disk, tuples should retain the same slot number. Because GoDB will never evict a
-dirty page, it's OK if tuples are renumbered when they are written back to disk.
+disk, tuples should retain the same slot number. The used slots are the slots
+below the number of used slots; the slots of deleted tuples stay empty, so that
+the record ids of the other tuples do not change when the page is read back.
 
 */
 
@@ -65,16 +69,7 @@ type heapPage struct {
 func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (*heapPage, error) {
 	// TODO: some code goes here
 	// return &heapPage{}, fmt.Errorf("newHeapPage is not implemented") //replace me
-	size := 0
-	for i := 0; i < len(desc.Fields); i++ {
-		switch desc.Fields[i].Ftype {
-		case IntType:
-			size += int(unsafe.Sizeof(int64(0)))
-		case StringType:
-			size += StringLength
-		}
-	}
-	slotNum := (PageSize - 8) / size
+	slotNum := slotsPerPage(desc)
 	hp := &heapPage{
 		PageSize:     PageSize,
 		SlotNum:      slotNum,
@@ -92,6 +87,28 @@ func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (*heapPage, error) {
 	return hp, nil
 }
 
+// Return the number of tuples with the given desc that fit on a page, along
+// with the bitmap of the slots that hold them.
+func slotsPerPage(desc *TupleDesc) int {
+	return (PageSize - 8) * 8 / (bytesPerTuple(desc)*8 + 1)
+}
+
+// Return the number of bytes a tuple with the given desc takes on a page.
+func bytesPerTuple(desc *TupleDesc) int {
+	size := 0
+	for i := 0; i < len(desc.Fields); i++ {
+		switch desc.Fields[i].Ftype {
+		case IntType:
+			size += int(unsafe.Sizeof(int64(0)))
+		case StringType:
+			size += StringLength
+		default:
+			size += desc.Fields[i].Ftype.size()
+		}
+	}
+	return size
+}
+
 func (h *heapPage) getNumSlots() int {
 	return h.SlotNum
 }
@@ -169,6 +186,16 @@ func (h *heapPage) toBuffer() (*bytes.Buffer, error) {
 		return nil, err
 	}
 
+	// Write the bitmap of the slots that hold tuples, so that the slots of
+	// deleted tuples are read back empty
+	bitmap := make([]byte, (h.SlotNum+7)/8)
+	for i := 0; i < h.UsedSlotsNum; i++ {
+		if h.Tuples[i] != nil {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	buf.Write(bitmap)
+
 	// Write tuples
 	for i := 0; i < h.SlotNum; i++ {
 		if i < h.UsedSlotsNum && h.Tuples[i] != nil {
@@ -184,12 +211,7 @@ func (h *heapPage) toBuffer() (*bytes.Buffer, error) {
 			}
 			// Initialize each field with zero values
 			for j, field := range h.Desc.Fields {
-				switch field.Ftype {
-				case IntType:
-					emptyTuple.Fields[j] = IntField{Value: 0}
-				case StringType:
-					emptyTuple.Fields[j] = StringField{Value: ""}
-				}
+				emptyTuple.Fields[j] = zeroValue(field.Ftype)
 			}
 			err = emptyTuple.writeTo(buf)
 			if err != nil {
@@ -219,14 +241,22 @@ func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
 	// Initialize the heap page
 	h.SlotNum = int(slotNum)
 	h.UsedSlotsNum = int(usedSlotsNum)
-	h.Tuples = make([]*Tuple, h.SlotNum)
+	h.Tuples = make([]*Tuple, h.UsedSlotsNum, h.SlotNum)
+	bitmap := make([]byte, (h.SlotNum+7)/8)
+	_, err = io.ReadFull(buf, bitmap)
+	if err != nil {
+		return err
+	}
 
-	// Read tuples
+	// Read tuples, leaving the slots of deleted tuples empty
 	for i := 0; i < h.UsedSlotsNum; i++ {
 		tuple, err := readTupleFrom(buf, h.Desc)
 		if err != nil {
 			return err
 		}
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
 		h.Tuples[i] = tuple
 		tuple.Rid = RID{
 			PageNo: h.PageNo,
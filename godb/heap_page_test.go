@@ -11,7 +11,7 @@ func TestHeapPageInsert(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	var expectedSlots = (PageSize - 8) / (StringLength + int(unsafe.Sizeof(int64(0))))
+	var expectedSlots = (PageSize - 8) * 8 / ((StringLength+int(unsafe.Sizeof(int64(0))))*8 + 1)
 	if pg.getNumSlots() != expectedSlots {
 		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, pg.getNumSlots())
 	}
@@ -277,3 +277,45 @@ func TestHeapPageBufferLen(t *testing.T) {
 		t.Fatalf("HeapPage.toBuffer returns buffer of unexpected size;  NOTE:  This error may be OK, but many implementations that don't write full pages break.")
 	}
 }
+
+// Deleted tuples are not read back, the other tuples keep their slots, and
+// tuples may be inserted into a page that was read back
+func TestHeapPageSerializationAfterDelete(t *testing.T) {
+	td, t1, t2, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rid, _ := page.insertTuple(&t1)
+	rid2, _ := page.insertTuple(&t2)
+	page.deleteTuple(rid)
+
+	buf, _ := page.toBuffer()
+	page2, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := page2.initFromBuffer(buf); err != nil {
+		t.Fatalf("Error loading heap page from buffer.")
+	}
+	if page2.Tuples[0] != nil {
+		t.Errorf("expected the slot of the deleted tuple to be empty, got %v", page2.Tuples[0].Fields)
+	}
+	if tup := page2.Tuples[1]; tup == nil || !tup.equals(&t2) || tup.Rid != rid2 {
+		t.Errorf("expected %v to keep its record id %v", t2.Fields, rid2)
+	}
+	if _, err := page2.insertTuple(&t1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	count := 0
+	iter := page2.tupleIter()
+	for tup, _ := iter(); tup != nil; tup, _ = iter() {
+		if !tup.equals(&t1) && !tup.equals(&t2) {
+			t.Errorf("unexpected tuple %v read back", tup.Fields)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected 2 tuples after reading back the page and inserting, got %d", count)
+	}
+}
@@ -0,0 +1,415 @@
+package godb
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A Histogram summarizes the values of a column of a table, to estimate the
+// selectivity of predicates on the column.
+type Histogram interface {
+	// Estimate the fraction of the values v of the column for which
+	// "v op value" holds.
+	EstimateSelectivity(op BoolOp, value DBValue) float64
+
+	// Estimate the number of distinct values of the column.
+	DistinctValues() int
+
+	// Account for n more tuples with value in the column, or for -n fewer if
+	// n is negative, without rebuilding the histogram.
+	add(value DBValue, n int)
+}
+
+// The selectivities assumed for predicates on columns without statistics,
+// and for predicates the statistics of a column cannot estimate.
+const (
+	defaultEqSelectivity    = 0.1
+	defaultRangeSelectivity = 1.0 / 3
+	defaultLikeSelectivity  = 0.1
+)
+
+// Return the selectivity assumed for predicates with op on a column without
+// statistics.
+func defaultSelectivity(op BoolOp) float64 {
+	switch op {
+	case OpEq:
+		return defaultEqSelectivity
+	case OpNeq:
+		return 1 - defaultEqSelectivity
+	case OpLike:
+		return defaultLikeSelectivity
+	}
+	return defaultRangeSelectivity
+}
+
+// The number of most common values of a string column kept by a
+// [StringHistogram].
+const NumMCVs = 10
+
+// A bin of an equi-depth histogram: the number of values between lo and hi,
+// inclusive, and how many of them are distinct.
+type histogramBin[T cmp.Ordered] struct {
+	lo, hi   T
+	count    int
+	distinct int
+}
+
+// The bins of an equi-depth histogram, in order. Each bin holds about the
+// same number of values; runs of equal values are never split across bins,
+// so a value more common than a bin is in a bin of its own.
+type equiDepthBins[T cmp.Ordered] []histogramBin[T]
+
+// Build an equi-depth histogram of about nBins bins from the values,
+// which must be sorted.
+func newEquiDepthBins[T cmp.Ordered](sorted []T, nBins int) equiDepthBins[T] {
+	var bins equiDepthBins[T]
+	depth := (len(sorted) + nBins - 1) / nBins
+	for i := 0; i < len(sorted); {
+		bin := histogramBin[T]{lo: sorted[i], hi: sorted[i]}
+		for i < len(sorted) && bin.count < depth {
+			j := i
+			for j < len(sorted) && sorted[j] == sorted[i] {
+				j++
+			}
+			if bin.count > 0 && j-i >= depth {
+				break
+			}
+			bin.hi = sorted[i]
+			bin.count += j - i
+			bin.distinct++
+			i = j
+		}
+		bins = append(bins, bin)
+	}
+	return bins
+}
+
+// Return the index of the bin that may hold v, or -1 if there is none.
+func (bins equiDepthBins[T]) find(v T) int {
+	i := sort.Search(len(bins), func(i int) bool { return bins[i].hi >= v })
+	if i == len(bins) || bins[i].lo > v {
+		return -1
+	}
+	return i
+}
+
+// Estimate the number of values equal to v, assuming that the distinct
+// values of a bin are equally common.
+func (bins equiDepthBins[T]) countEqual(v T) float64 {
+	i := bins.find(v)
+	if i < 0 {
+		return 0
+	}
+	return float64(bins[i].count) / float64(bins[i].distinct)
+}
+
+// Estimate the number of values less than v, assuming that the values of a
+// bin are spread evenly between its bounds; fraction returns the fraction of
+// the range [lo, hi] of a bin that is below v.
+func (bins equiDepthBins[T]) countLess(v T, fraction func(v, lo, hi T) float64) float64 {
+	count := 0.0
+	for _, bin := range bins {
+		switch {
+		case bin.hi < v:
+			count += float64(bin.count)
+		case bin.lo < v:
+			count += float64(bin.count) * fraction(v, bin.lo, bin.hi)
+		}
+	}
+	return count
+}
+
+// Account for n more values v, or -n fewer. A value outside the bins widens
+// the nearest bin, as a new distinct value of it; the count of a bin never
+// drops below zero.
+func (bins *equiDepthBins[T]) add(v T, n int) {
+	b := *bins
+	i := sort.Search(len(b), func(i int) bool { return b[i].hi >= v })
+	switch {
+	case i < len(b) && b[i].lo <= v:
+	case n < 0:
+		return
+	case len(b) == 0:
+		*bins = append(b, histogramBin[T]{lo: v, hi: v, count: n, distinct: 1})
+		return
+	case i == len(b):
+		i--
+		b[i].hi = v
+		b[i].distinct++
+	default:
+		b[i].lo = v
+		b[i].distinct++
+	}
+	b[i].count = max(b[i].count+n, 0)
+}
+
+func (bins equiDepthBins[T]) distinct() int {
+	n := 0
+	for _, bin := range bins {
+		n += bin.distinct
+	}
+	return n
+}
+
+// Return the fraction of the values v of a column for which "v op value"
+// holds, given the number of values equal to value, the number less than it,
+// and the number of values of the column.
+func rangeSelectivity(op BoolOp, equal float64, less float64, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	var count float64
+	switch op {
+	case OpEq:
+		count = equal
+	case OpNeq:
+		count = float64(total) - equal
+	case OpLt:
+		count = less
+	case OpLe:
+		count = less + equal
+	case OpGt:
+		count = float64(total) - less - equal
+	case OpGe:
+		count = float64(total) - less
+	default:
+		return defaultSelectivity(op)
+	}
+	return min(max(count/float64(total), 0), 1)
+}
+
+// An IntHistogram is an equi-depth histogram of the values of a column whose
+// values are integers: INT columns, and DATE, TIMESTAMP and DECIMAL columns,
+// whose values are stored as integers.
+type IntHistogram struct {
+	bins  equiDepthBins[int64]
+	total int
+}
+
+// Build a histogram of about nBins bins of the values of a column.
+func NewIntHistogram(values []int64, nBins int) *IntHistogram {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return &IntHistogram{newEquiDepthBins(sorted, nBins), len(sorted)}
+}
+
+// Return the integer a value of an integer column is stored as, or false if
+// v is not such a value.
+func intHistogramValue(v DBValue) (int64, bool) {
+	switch v := v.(type) {
+	case IntField:
+		return v.Value, true
+	case DateField:
+		return v.Value, true
+	case TimestampField:
+		return v.Value, true
+	case DecimalField:
+		return v.Value, true
+	}
+	return 0, false
+}
+
+func (h *IntHistogram) EstimateSelectivity(op BoolOp, value DBValue) float64 {
+	v, ok := intHistogramValue(value)
+	if !ok {
+		return defaultSelectivity(op)
+	}
+	// the integers in a bin are spread over its hi - lo + 1 possible values
+	fraction := func(v, lo, hi int64) float64 {
+		return float64(v-lo) / float64(hi-lo+1)
+	}
+	return rangeSelectivity(op, h.bins.countEqual(v), h.bins.countLess(v, fraction), h.total)
+}
+
+func (h *IntHistogram) DistinctValues() int {
+	return h.bins.distinct()
+}
+
+func (h *IntHistogram) add(value DBValue, n int) {
+	if v, ok := intHistogramValue(value); ok {
+		h.bins.add(v, n)
+		h.total = max(h.total+n, 0)
+	}
+}
+
+// A StringHistogram summarizes the values of a string column: the most
+// common values are listed with their counts, and the other values are
+// summarized by an equi-depth histogram.
+type StringHistogram struct {
+	mcvs  map[string]int
+	bins  equiDepthBins[string]
+	total int
+}
+
+// Build a histogram of the values of a string column, listing at most nMCVs
+// of the values that occur more than once, and summarizing the others with
+// about nBins bins.
+func NewStringHistogram(values []string, nBins int, nMCVs int) *StringHistogram {
+	counts := make(map[string]int)
+	for _, v := range values {
+		counts[v]++
+	}
+	common := make([]string, 0, len(counts))
+	for v, n := range counts {
+		if n > 1 {
+			common = append(common, v)
+		}
+	}
+	slices.SortFunc(common, func(a, b string) int {
+		if c := cmp.Compare(counts[b], counts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	h := &StringHistogram{mcvs: make(map[string]int), total: len(values)}
+	for _, v := range common[:min(len(common), nMCVs)] {
+		h.mcvs[v] = counts[v]
+	}
+	var rest []string
+	for _, v := range values {
+		if _, ok := h.mcvs[v]; !ok {
+			rest = append(rest, v)
+		}
+	}
+	slices.Sort(rest)
+	h.bins = newEquiDepthBins(rest, nBins)
+	return h
+}
+
+func (h *StringHistogram) EstimateSelectivity(op BoolOp, value DBValue) float64 {
+	s, ok := value.(StringField)
+	if !ok || h.total == 0 {
+		return defaultSelectivity(op)
+	}
+	if op == OpLike {
+		return h.likeSelectivity(s.Value)
+	}
+	var equal, less float64
+	for v, n := range h.mcvs {
+		switch {
+		case v == s.Value:
+			equal += float64(n)
+		case v < s.Value:
+			less += float64(n)
+		}
+	}
+	equal += h.bins.countEqual(s.Value)
+	less += h.bins.countLess(s.Value, stringFraction)
+	return rangeSelectivity(op, equal, less, h.total)
+}
+
+// Estimate the fraction of values that match a LIKE pattern. The most common
+// values are matched exactly; the bounds of the bins serve as a sample of the
+// other values. If nothing matches, one distinct value of the other values is
+// assumed to.
+func (h *StringHistogram) likeSelectivity(pattern string) float64 {
+	if !strings.ContainsAny(pattern, "%_") {
+		return h.EstimateSelectivity(OpEq, StringField{pattern})
+	}
+	count, mcvCount := 0.0, 0
+	for v, n := range h.mcvs {
+		mcvCount += n
+		if likeMatch(v, pattern) {
+			count += float64(n)
+		}
+	}
+	if others := h.total - mcvCount; others > 0 {
+		sample, matches := 0, 0
+		for _, bin := range h.bins {
+			for _, v := range []string{bin.lo, bin.hi} {
+				sample++
+				if likeMatch(v, pattern) {
+					matches++
+				}
+			}
+		}
+		if matches > 0 {
+			count += float64(others) * float64(matches) / float64(sample)
+		} else if count == 0 {
+			count = float64(others) / float64(h.bins.distinct())
+		}
+	}
+	return min(count/float64(h.total), 1)
+}
+
+// Return the fraction of the range [lo, hi] of strings below v. Strings are
+// mapped to numbers by their first bytes after the prefix lo and hi share.
+func stringFraction(v, lo, hi string) float64 {
+	prefix := 0
+	for prefix < len(lo) && prefix < len(hi) && lo[prefix] == hi[prefix] {
+		prefix++
+	}
+	scalar := func(s string) float64 {
+		x, scale := 0.0, 1.0
+		for i := prefix; i < prefix+8; i++ {
+			scale /= 256
+			if i < len(s) {
+				x += float64(s[i]) * scale
+			}
+		}
+		return x
+	}
+	l, h := scalar(lo), scalar(hi)
+	if h <= l {
+		return 0.5
+	}
+	return min(max((scalar(v)-l)/(h-l), 0), 1)
+}
+
+func (h *StringHistogram) DistinctValues() int {
+	return len(h.mcvs) + h.bins.distinct()
+}
+
+func (h *StringHistogram) add(value DBValue, n int) {
+	s, ok := value.(StringField)
+	if !ok {
+		return
+	}
+	if count, ok := h.mcvs[s.Value]; ok {
+		h.mcvs[s.Value] = max(count+n, 0)
+	} else {
+		h.bins.add(s.Value, n)
+	}
+	h.total = max(h.total+n, 0)
+}
+
+// A distinctCount summarizes a column whose values are not ordered in a way
+// histograms can use, e.g., a FLOAT or BOOL column, by the number of times
+// each value occurs.
+type distinctCount struct {
+	counts map[any]int
+	total  int
+}
+
+func (d *distinctCount) EstimateSelectivity(op BoolOp, value DBValue) float64 {
+	if d.total == 0 {
+		return 0
+	}
+	equal := float64(d.counts[value]) / float64(d.total)
+	switch op {
+	case OpEq:
+		return equal
+	case OpNeq:
+		return 1 - equal
+	}
+	return defaultSelectivity(op)
+}
+
+func (d *distinctCount) DistinctValues() int {
+	return len(d.counts)
+}
+
+func (d *distinctCount) add(value DBValue, n int) {
+	count, ok := d.counts[value]
+	if !ok && n < 0 {
+		return
+	}
+	if count += n; count > 0 {
+		d.counts[value] = count
+	} else {
+		delete(d.counts, value)
+	}
+	d.total = max(d.total+n, 0)
+}
@@ -6,6 +6,11 @@ type InsertOp struct {
 	// TODO: some code goes here
 	insertFile DBFile
 	child      Operator
+	table      *Table // the catalog entry of insertFile, whose constraints are checked; nil if there is none
+
+	// the catalog of table, whose materialized views over table are
+	// maintained; nil if there is none
+	catalog *Catalog
 }
 
 // Construct an insert operator that inserts the records in the child Operator
@@ -13,14 +18,21 @@ type InsertOp struct {
 func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 	// TODO: some code goes here
 	// return nil
-	return &InsertOp{insertFile, child}
+	return &InsertOp{insertFile, child, nil, nil}
+}
+
+// Construct an insert operator that inserts the records in the child Operator
+// into table, after checking that they satisfy its constraints, and maintains
+// the materialized views of c over table.
+func newTableInsertOp(c *Catalog, table *Table, child Operator) *InsertOp {
+	return &InsertOp{table.file, child, table, c}
 }
 
 // The insert TupleDesc is a one column descriptor with an integer field named "count"
 func (i *InsertOp) Descriptor() *TupleDesc {
 	// TODO: some code goes here
 	// return nil
-	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
+	return &TupleDesc{[]FieldType{{"count", "", IntType, 0, 0}}}
 
 }
 
@@ -29,23 +41,55 @@ func (i *InsertOp) Descriptor() *TupleDesc {
 // one-field tuple with a "count" field indicating the number of tuples that
 // were inserted.  Tuples should be inserted using the [DBFile.insertTuple]
 // method.
+//
+// If the operator checks constraints, all tuples are read from the child and
+// checked before any is inserted, so that a statement that violates a
+// constraint inserts nothing.
 func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// TODO: some code goes here
+	done := false
 	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		done = true
 		it,err:= iop.child.Iterator(tid)
 		if err != nil {
 			return nil,err
 		}
-		num := 0
-		for tp, err := it(); err == nil; tp, err = it() {
-			if tp == nil{
+		var tuples []*Tuple
+		for {
+			tp, err := it()
+			if err != nil {
+				return nil, err
+			}
+			if tp == nil {
 				break
 			}
-
 			tp1 := tp.copy()
-			iop.insertFile.insertTuple(tp1, tid)
-			num++
+			tp1.Desc = *iop.insertFile.Descriptor()
+			tuples = append(tuples, tp1)
+		}
+		if iop.table != nil {
+			if err := iop.table.checkInsert(tuples, tid); err != nil {
+				return nil, err
+			}
+		}
+		for _, tp := range tuples {
+			if err := iop.insertFile.insertTuple(tp, tid); err != nil {
+				return nil, err
+			}
+			if iop.table != nil {
+				iop.table.recordInsert(tp)
+			}
+		}
+		if iop.catalog != nil {
+			iop.catalog.recordChanges(iop.table, tuples, nil, tid)
+			if err := iop.catalog.maintainViews(iop.table, tuples, nil, tid); err != nil {
+				return nil, err
+			}
 		}
+		num := len(tuples)
 		return &Tuple{Desc: *iop.Descriptor(), Fields: []DBValue{IntField{Value: int64(num)}}, Rid: 0}, nil
 	},nil
 
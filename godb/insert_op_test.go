@@ -59,3 +59,93 @@ func TestInsert(t *testing.T) {
 		t.Errorf("insert failed, expected 2 tuples, got %d", cnt)
 	}
 }
+
+func TestInsertStatements(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("staff"))
+	defer os.Remove(c.tableNameToFile("staff"))
+	if _, _, err := Parse(c, "create table staff (name varchar(20), age int default 18, dept varchar(10) default 'it''s', hired date default '2024-01-01')"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, q := range []struct {
+		sql   string
+		count int64
+	}{
+		{"insert into staff values ('ann', 31, 'ops', '2020-02-02')", 1},
+		{"insert into staff (dept, name) values ('hr', 'ben'), ('hr', 'cy')", 2},
+		{"insert into staff (name, age) select name, age from t where age > 50", 3},
+		{"insert into staff values ('dan', default, 'ops', default)", 1},
+	} {
+		_, plan, err := Parse(c, q.sql)
+		if err != nil {
+			t.Fatalf("query %s: %s", q.sql, err.Error())
+		}
+		tid := BeginTransactionForTest(t, bp)
+		iter, err := plan.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("query %s: %s", q.sql, err.Error())
+		}
+		if n := tup.Fields[0].(IntField).Value; n != q.count {
+			t.Errorf("query %s: expected %d inserted tuples, got %d", q.sql, q.count, n)
+		}
+		if tup, _ := iter(); tup != nil {
+			t.Errorf("query %s: expected a single result tuple", q.sql)
+		}
+		bp.CommitTransaction(tid)
+	}
+
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select name from staff", 7},
+		{"select name from staff where age = 18 and dept = 'hr'", 2},
+		{"select name from staff where dept = 'it''s' and age > 50", 3},
+		{"select name from staff where hired = '2024-01-01'", 6},
+	} {
+		_, n := countQueryResults(t, bp, c, q.sql)
+		if n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+
+	for _, sql := range []string{
+		"insert into staff (age) values (3)",
+		"insert into staff (name, name) values ('a', 'b')",
+		"insert into staff (name, salary) values ('a', 1)",
+		"insert into staff (name) values ('a', 1)",
+		"insert into staff (name, age) select name from t",
+		"insert into staff (name, age) select age, name from t",
+		"insert into t values ('a', 'b')",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error parsing %s", sql)
+		}
+	}
+
+	// defaults are saved with the catalog
+	catFile := "insert_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c2.GetTableInfo("staff")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if table.String() != "staff(name string, age int default 18, dept string default 'it''s', hired date default '2024-01-01')\n" {
+		t.Errorf("unexpected catalog entry %s", table.String())
+	}
+}
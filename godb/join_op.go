@@ -1,22 +1,177 @@
 package godb
 
+import (
+	"fmt"
+	"hash/maphash"
+	"strings"
+)
+
+// The algorithms an [EqualityJoin] can use.
+type JoinMethod int
+
+const (
+	// Buffer the right side, and compare each tuple of the left side to
+	// each buffered tuple.
+	NestedLoopJoin JoinMethod = iota
+	// Build a hash table of the right side, and look up each tuple of the
+	// left side in it. If the right side does not fit in the buffer, both
+	// sides are partitioned by the hash of their join keys into spill files,
+	// and each pair of partitions is joined in turn (a grace hash join).
+	HashJoin
+	// Sort both sides by their join keys, spilling sorted runs if they do not
+	// fit in the buffer, and merge them.
+	SortMergeJoin
+)
+
+func (m JoinMethod) String() string {
+	switch m {
+	case HashJoin:
+		return "Hash Join"
+	case SortMergeJoin:
+		return "Merge Join"
+	}
+	return "Nested Loop Join"
+}
+
 type EqualityJoin struct {
 	// Expressions that when applied to tuples from the left or right operators,
-	// respectively, return the value of the left or right side of the join
-	leftField, rightField Expr
+	// respectively, return the values of the key of the left or right side of
+	// the join, which are compared pairwise
+	leftFields, rightFields []Expr
 
 	left, right *Operator // Operators for the two inputs of the join
 
 	// The maximum number of records of intermediate state that the join should
 	// use (only required for optional exercise).
 	maxBufferSize int
+
+	method JoinMethod
 }
 
-// Constructor for a join of integer expressions.
+// Constructor for a join of the tuples of left and right for which leftField
+// is equal to rightField.
 //
-// Returns an error if either the left or right expression is not an integer.
+// The join is a [HashJoin], which spills both sides to temporary files if
+// the right side has more than maxBufferSize tuples. [EqualityJoin.SetMethod]
+// changes it to a [SortMergeJoin], which sorts both sides, spilling sorted
+// runs of maxBufferSize tuples, or to a [NestedLoopJoin]. The planner picks
+// the cheaper of a hash and a sort-merge join with [chooseJoinMethod].
 func NewJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin, error) {
-	return &EqualityJoin{leftField, rightField, &left, &right, maxBufferSize}, nil
+	return NewCompositeJoin(left, []Expr{leftField}, right, []Expr{rightField}, maxBufferSize)
+}
+
+// Constructor for a join on a key of several expressions, which joins the
+// tuples for which each of leftFields is equal to the corresponding one of
+// rightFields.
+//
+// Returns an error if there are not as many left as right expressions.
+func NewCompositeJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr, maxBufferSize int) (*EqualityJoin, error) {
+	if len(leftFields) == 0 || len(leftFields) != len(rightFields) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("cannot join a key of %d expressions with one of %d", len(leftFields), len(rightFields))}
+	}
+	return &EqualityJoin{leftFields, rightFields, &left, &right, maxBufferSize, HashJoin}, nil
+}
+
+// Return the join predicate, e.g., "t.a == u.a AND t.b == u.b".
+func (joinOp *EqualityJoin) condition() string {
+	conds := make([]string, len(joinOp.leftFields))
+	for i := range conds {
+		conds[i] = exprToStr(joinOp.leftFields[i]) + " == " + exprToStr(joinOp.rightFields[i])
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// Evaluate the expressions of a join key for t.
+func evalJoinKey(fields []Expr, t *Tuple) ([]DBValue, error) {
+	key := make([]DBValue, len(fields))
+	for i, f := range fields {
+		v, err := f.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// A key of several values, that can be compared with == and used as a map
+// key.
+type compositeKey struct {
+	value DBValue
+	rest  any // the compositeKey of the other values, if any
+}
+
+// Return a comparable value for key, which is == to that of another key of
+// the same length if and only if their values are pairwise equal. Decimals
+// are normalized, so that they are equal whatever their scales.
+func mapKey(key []DBValue) any {
+	if len(key) == 1 {
+		return keyValue(key[0])
+	}
+	var k any
+	for i := len(key) - 1; i >= 0; i-- {
+		k = compositeKey{keyValue(key[i]), k}
+	}
+	return k
+}
+
+// Return v, normalized if it is a decimal.
+func keyValue(v DBValue) DBValue {
+	if d, ok := v.(DecimalField); ok {
+		return d.normalize()
+	}
+	return v
+}
+
+// Compare two join keys value by value, returning false if values of them
+// cannot be compared.
+func compareKeys(a, b []DBValue) (int, bool) {
+	for i := range a {
+		c, ok := compareValues(a[i], b[i])
+		if !ok || c != 0 {
+			return c, ok
+		}
+	}
+	return 0, true
+}
+
+// Return the algorithm the join uses.
+func (joinOp *EqualityJoin) Method() JoinMethod {
+	return joinOp.method
+}
+
+// The memory, in bytes, a planned join may use to hold the tuples of its
+// sides. Sides with more tuples are spilled to temporary files.
+var JoinWorkMem = 4 << 20
+
+// Return the number of tuples of the widest of descs that fit in
+// [JoinWorkMem], the buffer size of a join of sides with those descriptors.
+func joinBufferSize(descs ...*TupleDesc) int {
+	width := 1
+	for _, desc := range descs {
+		width = max(width, bytesPerTuple(desc))
+	}
+	return max(JoinWorkMem/width, 1)
+}
+
+// Set the algorithm the join uses.
+func (joinOp *EqualityJoin) SetMethod(method JoinMethod) {
+	joinOp.method = method
+}
+
+// Return the number of tuples the join may hold in memory, or 0 if it is not
+// bounded.
+func (joinOp *EqualityJoin) bufferSize() int {
+	return max(joinOp.maxBufferSize, 0)
+}
+
+// Join a tuple of the left side with a tuple of the right side, labelling
+// the result with the join's descriptor, so that fields with the same name
+// from the two sides can be told apart by their table.
+func (joinOp *EqualityJoin) joined(desc *TupleDesc, left, right *Tuple) *Tuple {
+	t := joinTuples(left, right)
+	t.Desc = *desc
+	return t
 }
 
 // Return a TupleDesc for this join. The returned descriptor should contain the
@@ -26,26 +181,17 @@ func NewJoin(left Operator, leftField Expr, right Operator, rightField Expr, max
 func (hj *EqualityJoin) Descriptor() *TupleDesc {
 	// TODO: some code goes here
 	// return &TupleDesc{} // replace me
-	return (*hj.left).Descriptor()
+	return (*hj.left).Descriptor().merge((*hj.right).Descriptor())
 }
 
 // Join operator implementation. This function should iterate over the results
 // of the join. The join should be the result of joining joinOp.left and
-// joinOp.right, applying the joinOp.leftField and joinOp.rightField expressions
-// to the tuples of the left and right iterators respectively, and joining them
-// using an equality predicate.
-//
-// HINT: When implementing the simple nested loop join, you should keep in mind
-// that you only iterate through the left iterator once (outer loop) but iterate
-// through the right iterator once for every tuple in the left iterator (inner
-// loop).
+// joinOp.right, applying the joinOp.leftFields and joinOp.rightFields
+// expressions to the tuples of the left and right iterators respectively, and
+// joining them using an equality predicate.
 //
-// HINT: You can use [Tuple.joinTuples] to join two tuples.
-//
-// OPTIONAL EXERCISE: the operator implementation should not use more than
-// maxBufferSize records, and should pass the testBigJoin test without timing
-// out. To pass this test, you will need to use something other than a nested
-// loops join.
+// No more than maxBufferSize tuples of either side are held in memory by a
+// hash or merge join; the rest are spilled to temporary files.
 func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	leftIter, err := (*joinOp.left).Iterator(tid)
 	if err != nil {
@@ -55,7 +201,18 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 	if err != nil {
 		return nil, err
 	}
+	switch joinOp.method {
+	case HashJoin:
+		return joinOp.hashJoin(leftIter, rightIter, 0)
+	case SortMergeJoin:
+		return joinOp.mergeJoin(leftIter, rightIter)
+	}
+	return joinOp.nestedLoopJoin(leftIter, rightIter)
+}
 
+// Join by comparing each tuple of the left side to each tuple of the right
+// side, which is read into memory.
+func (joinOp *EqualityJoin) nestedLoopJoin(leftIter, rightIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
 	var leftTuple *Tuple
 	var rightTuples []*Tuple
 
@@ -72,6 +229,7 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 	}
 
 	curRightIndex := 0
+	desc := joinOp.Descriptor()
 
 	return func() (*Tuple, error) {
 		for {
@@ -94,19 +252,17 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 				curRightIndex++
 
 				// Evaluate join condition
-				leftValue, err := joinOp.leftField.EvalExpr(leftTuple)
+				leftKey, err := evalJoinKey(joinOp.leftFields, leftTuple)
 				if err != nil {
 					return nil, err
 				}
-				rightValue, err := joinOp.rightField.EvalExpr(rightTuple)
+				rightKey, err := evalJoinKey(joinOp.rightFields, rightTuple)
 				if err != nil {
 					return nil, err
 				}
 
-				if leftValue == rightValue {
-					// Join the tuples and return the result
-					joinedTuple := joinTuples(leftTuple, rightTuple)
-					return joinedTuple, nil
+				if mapKey(leftKey) == mapKey(rightKey) {
+					return joinOp.joined(desc, leftTuple, rightTuple), nil
 				}
 			}
 
@@ -115,3 +271,344 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 		}
 	}, nil
 }
+
+// The number of partitions a grace hash join splits its inputs into, and the
+// number of times it may split a partition that still does not fit in the
+// buffer, e.g., because many of its tuples have the same key. Beyond that,
+// the right side of a partition is joined a buffer at a time.
+const (
+	hashJoinPartitions = 16
+	maxHashJoinDepth   = 3
+)
+
+// Read tuples from iter into a hash table on the right join key, until the
+// buffer is full. Returns the tuples read, in order, and whether iter has more
+// tuples, in which case the last tuple read is not in the table.
+func (joinOp *EqualityJoin) build(iter func() (*Tuple, error)) (map[any][]*Tuple, []*Tuple, bool, error) {
+	table := make(map[any][]*Tuple)
+	var tuples []*Tuple
+	for {
+		t, err := iter()
+		if err != nil || t == nil {
+			return table, tuples, false, err
+		}
+		tuples = append(tuples, t)
+		if size := joinOp.bufferSize(); size > 0 && len(tuples) > size {
+			return table, tuples, true, nil
+		}
+		key, err := evalJoinKey(joinOp.rightFields, t)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		k := mapKey(key)
+		table[k] = append(table[k], t)
+	}
+}
+
+// Join each tuple of the left side with the tuples of table with the same
+// key, in the order they were added to it.
+func (joinOp *EqualityJoin) probe(leftIter func() (*Tuple, error), table map[any][]*Tuple) func() (*Tuple, error) {
+	desc := joinOp.Descriptor()
+	var leftTuple *Tuple
+	var matches []*Tuple
+	return func() (*Tuple, error) {
+		for len(matches) == 0 {
+			var err error
+			leftTuple, err = leftIter()
+			if err != nil || leftTuple == nil {
+				return nil, err
+			}
+			key, err := evalJoinKey(joinOp.leftFields, leftTuple)
+			if err != nil {
+				return nil, err
+			}
+			matches = table[mapKey(key)]
+		}
+		rightTuple := matches[0]
+		matches = matches[1:]
+		return joinOp.joined(desc, leftTuple, rightTuple), nil
+	}
+}
+
+// Hash join the tuples of leftIter and rightIter, partitioning them if the
+// right side does not fit in the buffer; depth is the number of times they
+// have been partitioned already.
+func (joinOp *EqualityJoin) hashJoin(leftIter, rightIter func() (*Tuple, error), depth int) (func() (*Tuple, error), error) {
+	table, tuples, more, err := joinOp.build(rightIter)
+	if err != nil {
+		return nil, err
+	}
+	if !more {
+		return joinOp.probe(leftIter, table), nil
+	}
+	rightIter = prependTuples(tuples, rightIter)
+	if depth == maxHashJoinDepth {
+		return joinOp.chunkedHashJoin(leftIter, rightIter)
+	}
+
+	seed := maphash.MakeSeed()
+	partition := func(iter func() (*Tuple, error), fields []Expr) ([]*spillFile, error) {
+		parts := make([]*spillFile, hashJoinPartitions)
+		for {
+			t, err := iter()
+			if err != nil {
+				closeSpillFiles(parts)
+				return nil, err
+			}
+			if t == nil {
+				return parts, nil
+			}
+			key, err := evalJoinKey(fields, t)
+			if err != nil {
+				closeSpillFiles(parts)
+				return nil, err
+			}
+			i := hashKey(seed, key) % hashJoinPartitions
+			if parts[i] == nil {
+				if parts[i], err = newSpillFile(t); err != nil {
+					closeSpillFiles(parts)
+					return nil, err
+				}
+			}
+			if err := parts[i].add(t); err != nil {
+				closeSpillFiles(parts)
+				return nil, err
+			}
+		}
+	}
+	rightParts, err := partition(rightIter, joinOp.rightFields)
+	if err != nil {
+		return nil, err
+	}
+	leftParts, err := partition(leftIter, joinOp.leftFields)
+	if err != nil {
+		closeSpillFiles(rightParts)
+		return nil, err
+	}
+
+	// join the pairs of partitions in turn
+	i := -1
+	var iter func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		for {
+			if iter != nil {
+				t, err := iter()
+				if err != nil || t != nil {
+					return t, err
+				}
+				leftParts[i].close()
+				rightParts[i].close()
+				iter = nil
+			}
+			for i++; i < hashJoinPartitions && (leftParts[i] == nil || rightParts[i] == nil); i++ {
+				closeSpillFiles([]*spillFile{leftParts[i], rightParts[i]})
+			}
+			if i >= hashJoinPartitions {
+				return nil, nil
+			}
+			left, err := leftParts[i].iterator()
+			if err != nil {
+				return nil, err
+			}
+			right, err := rightParts[i].iterator()
+			if err != nil {
+				return nil, err
+			}
+			if iter, err = joinOp.hashJoin(left, right, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}, nil
+}
+
+// Hash join the tuples of leftIter and rightIter by building a hash table of
+// a buffer of tuples of the right side at a time, and probing it with all the
+// tuples of the left side, which are spilled so they can be read once per
+// buffer.
+func (joinOp *EqualityJoin) chunkedHashJoin(leftIter, rightIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	var left *spillFile
+	for {
+		t, err := leftIter()
+		if err != nil {
+			closeSpillFiles([]*spillFile{left})
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if left == nil {
+			if left, err = newSpillFile(t); err != nil {
+				return nil, err
+			}
+		}
+		if err := left.add(t); err != nil {
+			left.close()
+			return nil, err
+		}
+	}
+	if left == nil {
+		return func() (*Tuple, error) { return nil, nil }, nil
+	}
+
+	var iter func() (*Tuple, error)
+	more := true
+	return func() (*Tuple, error) {
+		for {
+			if iter != nil {
+				t, err := iter()
+				if err != nil || t != nil {
+					return t, err
+				}
+				iter = nil
+			}
+			if !more {
+				left.close()
+				return nil, nil
+			}
+			var table map[any][]*Tuple
+			var tuples []*Tuple
+			var err error
+			if table, tuples, more, err = joinOp.build(rightIter); err != nil {
+				return nil, err
+			}
+			if more {
+				// the last tuple read starts the next buffer
+				rightIter = prependTuples(tuples[len(tuples)-1:], rightIter)
+			}
+			leftIter, err := left.iterator()
+			if err != nil {
+				return nil, err
+			}
+			iter = joinOp.probe(leftIter, table)
+		}
+	}, nil
+}
+
+// Sort the tuples of leftIter and rightIter by their join keys and merge
+// them, joining each tuple of the left side with the group of tuples of the
+// right side with the same key. The group is spilled if it does not fit in
+// the buffer.
+func (joinOp *EqualityJoin) mergeJoin(leftIter, rightIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	sortBy := func(iter func() (*Tuple, error), fields []Expr) (func() (*Tuple, error), error) {
+		ascending := make([]bool, len(fields))
+		for i := range ascending {
+			ascending[i] = true
+		}
+		sorter := &tupleSorter{keys: fields, ascending: ascending, maxTuples: joinOp.bufferSize()}
+		return sorter.sort(iter)
+	}
+	leftIter, err := sortBy(leftIter, joinOp.leftFields)
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err = sortBy(rightIter, joinOp.rightFields)
+	if err != nil {
+		return nil, err
+	}
+
+	next := func(iter func() (*Tuple, error), fields []Expr) (*Tuple, []DBValue, error) {
+		t, err := iter()
+		if err != nil || t == nil {
+			return nil, nil, err
+		}
+		key, err := evalJoinKey(fields, t)
+		return t, key, err
+	}
+	leftTuple, leftKey, err := next(leftIter, joinOp.leftFields)
+	if err != nil {
+		return nil, err
+	}
+	rightTuple, rightKey, err := next(rightIter, joinOp.rightFields)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := joinOp.Descriptor()
+	group := &tupleBuffer{maxTuples: joinOp.bufferSize()}
+	var groupKey []DBValue
+	var groupIter func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		for {
+			if groupIter != nil {
+				t, err := groupIter()
+				if err != nil {
+					return nil, err
+				}
+				if t != nil {
+					key, err := evalJoinKey(joinOp.rightFields, t)
+					if err != nil {
+						return nil, err
+					}
+					// keys that sort equally may still differ, e.g., an
+					// int and a float
+					if mapKey(key) == mapKey(leftKey) {
+						return joinOp.joined(desc, leftTuple, t), nil
+					}
+					continue
+				}
+				groupIter = nil
+				if leftTuple, leftKey, err = next(leftIter, joinOp.leftFields); err != nil {
+					return nil, err
+				}
+				if leftTuple != nil {
+					if c, ok := compareKeys(leftKey, groupKey); ok && c == 0 {
+						if groupIter, err = group.iterator(); err != nil {
+							return nil, err
+						}
+						continue
+					}
+				}
+				group.close()
+			}
+			if leftTuple == nil || rightTuple == nil {
+				return nil, nil
+			}
+			var err error
+			c, ok := compareKeys(leftKey, rightKey)
+			switch {
+			case !ok || c < 0:
+				leftTuple, leftKey, err = next(leftIter, joinOp.leftFields)
+			case c > 0:
+				rightTuple, rightKey, err = next(rightIter, joinOp.rightFields)
+			default:
+				// read the group of right tuples with this key
+				groupKey = rightKey
+				for rightTuple != nil {
+					if c, ok := compareKeys(rightKey, groupKey); !ok || c != 0 {
+						break
+					}
+					if err := group.add(rightTuple); err != nil {
+						return nil, err
+					}
+					if rightTuple, rightKey, err = next(rightIter, joinOp.rightFields); err != nil {
+						return nil, err
+					}
+				}
+				groupIter, err = group.iterator()
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}, nil
+}
+
+// Return an iterator over tuples, followed by the tuples of iter.
+func prependTuples(tuples []*Tuple, iter func() (*Tuple, error)) func() (*Tuple, error) {
+	first := sliceIterator(tuples)
+	return func() (*Tuple, error) {
+		if t, err := first(); t != nil || err != nil {
+			return t, err
+		}
+		return iter()
+	}
+}
+
+// Close the spill files of files that are not nil.
+func closeSpillFiles(files []*spillFile) {
+	for _, f := range files {
+		if f != nil {
+			f.close()
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package godb
 
 import (
-	// "fmt"
+	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"testing"
 	// "time"
 )
@@ -307,3 +309,66 @@ func TestJoinTupleNil(t *testing.T) {
 		t.Fatalf("Unexpected output of joinTuple with nil")
 	}
 }
+
+// Return the results of joining left and right on their field n with method,
+// buffering at most bufferSize tuples, as sorted strings.
+func joinResultsForTest(t *testing.T, left, right Operator, method JoinMethod, bufferSize int) []string {
+	t.Helper()
+	leftField := FieldExpr{left.Descriptor().Fields[1]}
+	rightField := FieldExpr{right.Descriptor().Fields[1]}
+	join, err := NewJoin(left, &leftField, right, &rightField, bufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	join.SetMethod(method)
+	iter, err := join.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var results []string
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("%s: %s", method, err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		results = append(results, fmt.Sprint(tup.Fields))
+	}
+	sort.Strings(results)
+	return results
+}
+
+func TestJoinMethods(t *testing.T) {
+	makeFile := func(table string, n int, key func(i int) int64) *MemFile {
+		desc := TupleDesc{Fields: []FieldType{
+			{Fname: "name", TableQualifier: table, Ftype: StringType},
+			{Fname: "n", TableQualifier: table, Ftype: IntType},
+		}}
+		file := &MemFile{desc: &desc}
+		for i := 0; i < n; i++ {
+			file.insertTuple(&Tuple{Desc: desc, Fields: []DBValue{StringField{fmt.Sprintf("%s%d", table, i)}, IntField{key(i)}}}, 0)
+		}
+		return file
+	}
+	for _, test := range []struct {
+		name        string
+		left, right *MemFile
+	}{
+		{"duplicate keys", makeFile("l", 300, func(i int) int64 { return int64(i % 13) }), makeFile("r", 200, func(i int) int64 { return int64(i % 9) })},
+		{"one key", makeFile("l", 30, func(i int) int64 { return 1 }), makeFile("r", 50, func(i int) int64 { return 1 })},
+		{"no matches", makeFile("l", 40, func(i int) int64 { return int64(i) }), makeFile("r", 40, func(i int) int64 { return int64(-i - 1) })},
+	} {
+		want := joinResultsForTest(t, test.left, test.right, NestedLoopJoin, 0)
+		for _, method := range []JoinMethod{HashJoin, SortMergeJoin} {
+			// a buffer of 10 tuples makes both methods spill
+			for _, bufferSize := range []int{0, 10} {
+				got := joinResultsForTest(t, test.left, test.right, method, bufferSize)
+				if !slices.Equal(got, want) {
+					t.Errorf("%s, %s with a buffer of %d: expected %d results, got %d", test.name, method, bufferSize, len(want), len(got))
+				}
+			}
+		}
+	}
+}
@@ -1,24 +1,96 @@
 package godb
 
+import (
+	"math"
+	"slices"
+)
+
 // Estimate the cost of a join j given the cardinalities (card1, card2) and
 // estimated costs (cost1, cost2) of the left and right sides of the join,
 // respectively.
 //
-// The cost of the join should be calculated based on the join algorithm (or
-// algorithms) that you implemented for Lab 2. It should be a function of the
-// amount of data that must be read over the course of the query, as well as the
-// number of CPU opertions performed by your join. Assume that the cost of a
-// single predicate application is roughly 1.
+// The cost is that of reading both sides, and of joining them with the
+// cheapest method for a buffer that holds either side, see
+// [chooseJoinMethod].
 func EstimateJoinCost(card1 int, card2 int, cost1 float64, cost2 float64) float64 {
-	// Dummy implementation. Do not worry about this.
-	return -1.0
+	return estimateJoinCost(card1, card2, cost1, cost2, 0)
+}
+
+// Estimate the cost of a join as [EstimateJoinCost] does, for a buffer of
+// bufferSize tuples, or an unbounded one if bufferSize is not positive.
+func estimateJoinCost(card1 int, card2 int, cost1 float64, cost2 float64, bufferSize int) float64 {
+	_, cost := chooseJoinMethod(card1, card2, bufferSize)
+	return cost1 + cost2 + cost
+}
+
+// The cost of writing a tuple to a spill file and reading it back, relative
+// to that of one predicate application or hash table operation.
+const spillCost = 20
+
+// Return the cheaper of a hash join and a sort-merge join of a left side of
+// card1 tuples with a right side of card2 tuples, with a buffer of
+// bufferSize tuples (or an unbounded one if bufferSize is not positive), and
+// the cost of the join, not counting that of reading its sides.
+//
+// A hash join inserts each tuple of the right side in a hash table, and looks
+// up each tuple of the left side in it; if the right side does not fit in the
+// buffer, both sides are also spilled once. A sort-merge join sorts both
+// sides, spilling those that do not fit in the buffer, and then reads them
+// once each.
+func chooseJoinMethod(card1, card2, bufferSize int) (JoinMethod, float64) {
+	fits := func(card int) bool {
+		return bufferSize <= 0 || card <= bufferSize
+	}
+	sortCost := func(card int) float64 {
+		cost := float64(card) * math.Log2(float64(max(card, 1)))
+		if !fits(card) {
+			cost += float64(card) * spillCost
+		}
+		return cost
+	}
+
+	hashCost := float64(card1) + 2*float64(card2)
+	if !fits(card2) {
+		hashCost += float64(card1+card2) * spillCost
+	}
+	mergeCost := sortCost(card1) + sortCost(card2) + float64(card1+card2)
+	if mergeCost < hashCost {
+		return SortMergeJoin, mergeCost
+	}
+	return HashJoin, hashCost
+}
+
+// Estimate the cost of a theta join of a left side of card1 tuples with a
+// right side of card2 tuples, with a buffer of bufferSize tuples (or an
+// unbounded one if bufferSize is not positive), not counting that of reading
+// its sides. Each tuple of the left side is compared with each tuple of the
+// right side, or, for a band join, looks up its range in each sorted buffer
+// and is compared with the fraction of the tuples of the right side in it;
+// if the right side takes more than one buffer, the left side is spilled and
+// read back once per buffer.
+func thetaJoinCost(card1, card2, bufferSize int, band bool) float64 {
+	buffers, size := 1, card2
+	if bufferSize > 0 && card2 > bufferSize {
+		buffers, size = (card2+bufferSize-1)/bufferSize, bufferSize
+	}
+	cost := float64(card2) + float64(card1)*float64(card2)
+	if band {
+		log := math.Log2(float64(max(size, 1)))
+		cost = float64(card2)*log + float64(card1*buffers)*log + float64(card1)*float64(card2)*defaultRangeSelectivity
+	}
+	if buffers > 1 {
+		cost += float64(card1*buffers) * spillCost
+	}
+	return cost
 }
 
 // Estimate the cardinality of the result of a join between two tables, given
 // the join operator, primary key information, and table statistics.
+//
+// Without statistics about the join fields, one of them is assumed to be a
+// key, so that each tuple of the larger side matches one tuple of the other.
 func EstimateJoinCardinality(t1card int, t2card int) int {
-	// Dummy implementation. Do not worry about this.
-	return -1
+	return max(t1card, t2card)
 }
 
 type TableInfo struct {
@@ -27,6 +99,27 @@ type TableInfo struct {
 	sel   float64 // Selectivity of the filters on the table
 }
 
+// Return the statistics of the table, or [DummyStats] if it has none.
+func (t *TableInfo) tableStats() Stats {
+	if t.stats == nil {
+		return &DummyStats{}
+	}
+	return t.stats
+}
+
+// The estimated cost of scanning the table and its cardinality after its
+// filters are applied.
+func (t *TableInfo) costAndCard() (float64, int) {
+	stats := t.tableStats()
+	return stats.EstimateScanCost(), stats.EstimateCardinality(t.sel)
+}
+
+// Statistics that can estimate the number of distinct values of a field, such
+// as [TableStats].
+type distinctStats interface {
+	DistinctValues(field string) (int, bool)
+}
+
 // A JoinNode represents a join between two tables.
 type JoinNode struct {
 	leftTable TableInfo
@@ -34,19 +127,194 @@ type JoinNode struct {
 
 	rightTable TableInfo
 	rightField string
+
+	// The comparisons between the two tables the join applies, equalities
+	// first, the first of which compares leftField with rightField; nil for
+	// a single equality.
+	ops []BoolOp
+}
+
+// Return the join with its sides exchanged.
+func (j *JoinNode) swap() *JoinNode {
+	var ops []BoolOp
+	for _, op := range j.ops {
+		ops = append(ops, op.flip())
+	}
+	return &JoinNode{j.rightTable, j.rightField, j.leftTable, j.leftField, ops}
+}
+
+// Return true if the join compares the join fields for equality, so that it
+// is applied by an [EqualityJoin]; otherwise it is applied by a [ThetaJoin].
+func (j *JoinNode) equi() bool {
+	return len(j.ops) == 0 || j.ops[0] == OpEq
+}
+
+// Return the selectivity assumed for the comparisons of the join other than
+// an equality of the join fields.
+func (j *JoinNode) otherSelectivity() float64 {
+	sel := 1.0
+	for i, op := range j.ops {
+		if i > 0 || op != OpEq {
+			sel *= defaultSelectivity(op)
+		}
+	}
+	return sel
+}
+
+// Estimate the cost of the join given the cardinalities and costs of its
+// sides, and the number of tuples its buffer holds, as [EstimateJoinCost]
+// does for an equality join.
+func (j *JoinNode) estimateCost(card1, card2 int, cost1, cost2 float64, bufferSize int) float64 {
+	if j.equi() {
+		return estimateJoinCost(card1, card2, cost1, cost2, bufferSize)
+	}
+	band := slices.ContainsFunc(j.ops, func(op BoolOp) bool { return op != OpNeq && op != OpLike })
+	return cost1 + cost2 + thetaJoinCost(card1, card2, bufferSize, band)
+}
+
+// Return the number of tuples of the sides of the join that fit in
+// [JoinWorkMem], taking them to be as wide as those of the wider of its
+// tables, or 0 if the statistics of neither table describe its tuples.
+func (j *JoinNode) bufferSize() int {
+	var descs []*TupleDesc
+	for _, t := range []*TableInfo{&j.leftTable, &j.rightTable} {
+		if stats, ok := t.stats.(*TableStats); ok && stats.tupleDesc != nil {
+			descs = append(descs, stats.tupleDesc)
+		}
+	}
+	if len(descs) == 0 {
+		return 0
+	}
+	return joinBufferSize(descs...)
+}
+
+// Estimate the fraction of the pairs of tuples of the sides of the join, of
+// cardinalities card1 and card2, that satisfy it: one over the larger number
+// of distinct values of the join fields, as each value of the side with fewer
+// values is assumed to be among the values of the other. Returns false if
+// neither table has statistics about its join field.
+func (j *JoinNode) selectivity(card1, card2 int) (float64, bool) {
+	distinct := 0
+	for _, side := range []struct {
+		table *TableInfo
+		field string
+		card  int
+	}{{&j.leftTable, j.leftField, card1}, {&j.rightTable, j.rightField, card2}} {
+		if stats, ok := side.table.stats.(distinctStats); ok {
+			if n, ok := stats.DistinctValues(side.field); ok {
+				distinct = max(distinct, min(n, side.card))
+			}
+		}
+	}
+	if distinct == 0 {
+		return 0, false
+	}
+	return 1 / float64(distinct), true
+}
+
+// Estimate the cardinality of the join of sides of cardinalities card1 and
+// card2, from the distinct values of the join fields if they are known.
+func (j *JoinNode) estimateCardinality(card1, card2 int) int {
+	if !j.equi() {
+		return int(float64(card1)*float64(card2)*j.otherSelectivity() + 0.5)
+	}
+	card := EstimateJoinCardinality(card1, card2)
+	if sel, ok := j.selectivity(card1, card2); ok {
+		card = int(float64(card1)*float64(card2)*sel + 0.5)
+	}
+	return int(float64(card)*j.otherSelectivity() + 0.5)
+}
+
+// Estimate the cardinality of the result of card tuples once the join, both
+// of whose tables are already joined, is applied to it as a filter.
+func (j *JoinNode) estimateFilterCardinality(card int) int {
+	sel := 1.0
+	if j.equi() {
+		var ok bool
+		if sel, ok = j.selectivity(card, card); !ok {
+			sel = defaultEqSelectivity
+		}
+	}
+	return int(float64(card)*sel*j.otherSelectivity() + 0.5)
+}
+
+// A linear plan for a subset of the joins of a query: the joins in the
+// order they are applied, the tables they join, and the estimated cost and
+// cardinality of the result.
+type joinPlan struct {
+	order  []*JoinNode
+	tables map[string]bool
+	cost   float64
+	card   int
+}
+
+// Return the plan that applies j to the result of p, or nil if j is not
+// connected to the tables of p. The side of j whose table is already joined
+// is the result of p. A join both of whose tables are already joined is
+// applied as a filter.
+func (p *joinPlan) extend(j *JoinNode) *joinPlan {
+	next := &joinPlan{order: append(p.order[:len(p.order):len(p.order)], j), tables: make(map[string]bool)}
+	for t := range p.tables {
+		next.tables[t] = true
+	}
+	next.tables[j.leftTable.name] = true
+	next.tables[j.rightTable.name] = true
+
+	leftIn, rightIn := p.tables[j.leftTable.name], p.tables[j.rightTable.name]
+	switch {
+	case len(p.tables) == 0:
+		leftCost, leftCard := j.leftTable.costAndCard()
+		rightCost, rightCard := j.rightTable.costAndCard()
+		next.cost = j.estimateCost(leftCard, rightCard, leftCost, rightCost, j.bufferSize())
+		next.card = j.estimateCardinality(leftCard, rightCard)
+	case leftIn && rightIn:
+		next.cost = p.cost + float64(p.card)
+		next.card = j.estimateFilterCardinality(p.card)
+	case leftIn:
+		cost, card := j.rightTable.costAndCard()
+		next.cost = j.estimateCost(p.card, card, p.cost, cost, j.bufferSize())
+		next.card = j.estimateCardinality(p.card, card)
+	case rightIn:
+		cost, card := j.leftTable.costAndCard()
+		next.cost = j.estimateCost(card, p.card, cost, p.cost, j.bufferSize())
+		next.card = j.estimateCardinality(card, p.card)
+	default:
+		return nil
+	}
+	return next
 }
 
 // Given a list of joins, table statistics, and selectivities, return the best
 // order in which to join the tables.
 //
-// selectivity is a map from table aliases to the selectivity of the filters on
-// that table. Note that LogicalJoinNodes contain LogicalSelectNodes that define
-// tables to join. Inside a LogicalSelectNode, there is both a table name
-// (table) and an alias. We may apply different filters to the same base table
-// but with different aliases, so the selectivity map contains selectivities for
-// a particular alias, not for a base table.
+// The order is chosen by dynamic programming over the subsets of the joins,
+// as in Selinger et al.: the cheapest linear plan of a set of joins is the
+// cheapest plan of one of its subsets with one join fewer, followed by that
+// join, whose other side is a table. Each join is considered both ways
+// round, as the cost of a join depends on which side is read into memory.
+// Cross products are never considered, so if the joins do not connect all
+// their tables, they are returned as they are.
 func OrderJoins(joins []*JoinNode) ([]*JoinNode, error) {
-	// Dummy implementation. Do not worry about this.
-	return joins, nil
+	if len(joins) == 0 {
+		return joins, nil
+	}
+	best := make([]*joinPlan, 1<<len(joins))
+	best[0] = &joinPlan{tables: make(map[string]bool)}
+	for set := 1; set < len(best); set++ {
+		for i, j := range joins {
+			if set&(1<<i) == 0 || best[set&^(1<<i)] == nil {
+				continue
+			}
+			prev := best[set&^(1<<i)]
+			for _, j := range []*JoinNode{j, j.swap()} {
+				if p := prev.extend(j); p != nil && (best[set] == nil || p.cost < best[set].cost) {
+					best[set] = p
+				}
+			}
+		}
+	}
+	if best[len(best)-1] == nil {
+		return joins, nil
+	}
+	return best[len(best)-1].order, nil
 }
-
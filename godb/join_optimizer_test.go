@@ -0,0 +1,160 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Return the statistics of a table of tups tuples on pages pages, whose id
+// field has distinct values.
+func makeJoinTestStats(pages, tups, distinct int) *TableStats {
+	values := make([]int64, tups)
+	for i := range values {
+		values[i] = int64(i % distinct)
+	}
+	return &TableStats{basePages: pages, baseTups: tups, histograms: map[string]Histogram{"id": NewIntHistogram(values, NumHistBins)}}
+}
+
+func TestOrderJoins(t *testing.T) {
+	big := TableInfo{"big", makeJoinTestStats(100, 10000, 10000), 1}
+	medium := TableInfo{"medium", makeJoinTestStats(10, 1000, 1000), 1}
+	small := TableInfo{"small", makeJoinTestStats(1, 10, 10), 1}
+	joins := []*JoinNode{
+		{big, "id", medium, "id", nil},
+		{medium, "id", small, "id", nil},
+	}
+	order, err := OrderJoins(joins)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(order) != 2 {
+		t.Fatalf("expected 2 joins, got %d", len(order))
+	}
+	// the small result of joining medium and small is joined with big
+	tables := func(j *JoinNode) string {
+		return fmt.Sprintf("%s,%s", j.leftTable.name, j.rightTable.name)
+	}
+	if first := tables(order[0]); first != "medium,small" && first != "small,medium" {
+		t.Errorf("expected medium and small to be joined first, got %s", first)
+	}
+	// the larger side of each join is the left side, which is not buffered
+	if order[0].leftTable.name != "medium" || order[1].leftTable.name != "big" {
+		t.Errorf("expected the larger sides on the left, got %s then %s", tables(order[0]), tables(order[1]))
+	}
+
+	// a filter on big makes it the smallest table
+	big.sel = 0.0001
+	order, err = OrderJoins([]*JoinNode{{big, "id", medium, "id", nil}, {medium, "id", small, "id", nil}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if first := tables(order[0]); first != "medium,big" && first != "big,medium" {
+		t.Errorf("expected big and medium to be joined first, got %s", first)
+	}
+
+	// joins that do not connect their tables are left alone
+	other := TableInfo{"other", makeJoinTestStats(1, 10, 10), 1}
+	joins = []*JoinNode{{big, "id", medium, "id", nil}, {small, "id", other, "id", nil}}
+	if order, err := OrderJoins(joins); err != nil || order[0] != joins[0] || order[1] != joins[1] {
+		t.Errorf("expected disconnected joins to be returned unchanged")
+	}
+
+	keyJoin := &JoinNode{medium, "id", small, "id", nil}
+	if card := keyJoin.estimateCardinality(1000, 10); card != 10 {
+		t.Errorf("expected a key join of 1000 and 10 tuples to produce 10, got %d", card)
+	}
+	if card := EstimateJoinCardinality(10, 1000); card != 1000 {
+		t.Errorf("expected a join of 10 and 1000 tuples without statistics to produce 1000, got %d", card)
+	}
+	if EstimateJoinCost(10, 1000, 100, 200) <= EstimateJoinCost(1000, 10, 200, 100) {
+		t.Errorf("expected buffering the smaller side of a join to be cheaper")
+	}
+}
+
+func TestExplainJoinCosts(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	op, n := countQueryResults(t, bp, c, "select t.name from t join t2 on t.name = t2.name where t.age > 40")
+	if n != 8 {
+		t.Errorf("expected 8 results, got %d", n)
+	}
+	var plan strings.Builder
+	OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&plan, format, a...) }, op, "")
+	for _, line := range []string{
+		"\tHash Join, t2.name == t.name, card:7, cost:2036\n",
+		"\t\tHeap Scan .//t2.dat, card:12, cost:1000\n",
+		"\t\tFilter t.age > 40, card:6, cost:1012\n",
+	} {
+		if !strings.Contains(plan.String(), line) {
+			t.Errorf("expected the plan to contain %q, got\n%s", line, plan.String())
+		}
+	}
+
+	// a join between tables that are already joined is applied as a filter
+	op, n = countQueryResults(t, bp, c, "select * from t a, t b, t2 c where a.name = b.name and b.name = c.name and c.name = a.name")
+	if n != 24 {
+		t.Errorf("expected 24 results, got %d", n)
+	}
+	if _, ok := op.(*OperatorCard).Op.(*Filter); !ok {
+		t.Errorf("expected the last join of a cycle to be a filter, got %T", op.(*OperatorCard).Op)
+	}
+}
+
+func TestChooseJoinMethod(t *testing.T) {
+	for _, test := range []struct {
+		card1, card2, bufferSize int
+		method                   JoinMethod
+	}{
+		{100, 1000, 0, HashJoin},
+		{1000, 100, 1000, HashJoin},
+		{10000, 10000, 1000, HashJoin},
+		// a hash join would spill both sides, a merge join only the right
+		{1000, 1001, 1000, SortMergeJoin},
+	} {
+		if method, _ := chooseJoinMethod(test.card1, test.card2, test.bufferSize); method != test.method {
+			t.Errorf("expected a %s of %d and %d tuples with a buffer of %d, got a %s", test.method, test.card1, test.card2, test.bufferSize, method)
+		}
+	}
+}
+
+func TestJoinWorkMem(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []string{
+		"select t.name, t2.age from t join t2 on t.name = t2.name order by t.name, t2.age",
+		"select t.name, t2.age from t join t2 on t.age < t2.age order by t.name, t2.age",
+		"select name from t where name in (select name from t2) order by name",
+	}
+	var want [][]string
+	for _, sql := range queries {
+		want = append(want, queryResults(t, bp, c, sql))
+	}
+	joinSQL := "select * from t, t2 where t.name = t2.name"
+	op, _ := countQueryResults(t, bp, c, joinSQL)
+	cost := op.(*OperatorCard).Cost
+
+	defer func(old int) { JoinWorkMem = old }(JoinWorkMem)
+	JoinWorkMem = 1
+	op, _ = countQueryResults(t, bp, c, joinSQL)
+	join, ok := op.(*OperatorCard).Op.(*EqualityJoin)
+	if !ok {
+		t.Fatalf("expected an equality join, got %T", op.(*OperatorCard).Op)
+	}
+	if join.bufferSize() != 1 {
+		t.Errorf("expected a join buffer of 1 tuple, got %d", join.bufferSize())
+	}
+	if op.(*OperatorCard).Cost <= cost {
+		t.Errorf("expected a join that spills to cost more than %f, got %f", cost, op.(*OperatorCard).Cost)
+	}
+	for i, sql := range queries {
+		if got := queryResults(t, bp, c, sql); !slices.Equal(got, want[i]) {
+			t.Errorf("%s: expected %v, got %v", sql, want[i], got)
+		}
+	}
+}
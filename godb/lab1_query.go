@@ -27,6 +27,7 @@ file that you should call LoadFromCSV on.
 func computeFieldSum(bp *BufferPool, fileName string, td TupleDesc, sumField string) (int, error) {
 	// return 0, fmt.Errorf("computeFieldSum not implemented") // replace me
 	fname := "./test1.dat"
+	os.Remove(fname)
 	hp , err := NewHeapFile(fname,&td,bp)
 	if err != nil {
 		return 0, err
@@ -14,8 +14,8 @@ func TestLab1Query(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to initialize test database")
 	}
-	f1 := FieldType{"name", "", StringType}
-	f2 := FieldType{"age", "", IntType}
+	f1 := FieldType{"name", "", StringType, 0, 0}
+	f2 := FieldType{"age", "", IntType, 0, 0}
 	td := TupleDesc{[]FieldType{f1, f2}}
 	sum, err := computeFieldSum(bp, "lab1_test.csv", td, "age")
 	if err != nil {
@@ -0,0 +1,477 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A MaterializedView is a view whose result is stored in a table of the
+// catalog with the same name, which queries read like any other table.
+// REFRESH MATERIALIZED VIEW recomputes the table from the query of the view.
+//
+// Views over a single table that only filter, project and aggregate its
+// tuples are also maintained incrementally: the transaction that inserts
+// into or deletes from the table updates the stored result of the view, see
+// [Catalog.maintainViews]. Other views are only brought up to date by
+// REFRESH MATERIALIZED VIEW.
+type MaterializedView struct {
+	View
+
+	// the table the view is maintained from, or "" if the view is not
+	// maintained incrementally
+	base string
+}
+
+// CREATE, REFRESH and DROP MATERIALIZED VIEW are parsed here. The supported
+// forms are
+//
+//	CREATE MATERIALIZED VIEW name AS query
+//	REFRESH MATERIALIZED VIEW name
+//	DROP MATERIALIZED VIEW [IF EXISTS] name
+//
+// Creating and refreshing a view compute its result in a transaction of
+// their own. Returns false if query is none of them.
+func processMaterializedViewStatement(c *Catalog, query string) (QueryType, bool, error) {
+	if n := matchKeywords(query, []string{"create", "materialized", "view"}); n > 0 {
+		v, op, err := parseViewDefinition(c, query, n)
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		desc, err := materializedDesc(v.name, op.Descriptor())
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		if _, err := c.addTable(v.name, *desc); err != nil {
+			return UnknownQueryType, true, err
+		}
+		mv := &MaterializedView{View: *v}
+		c.matViews[v.name] = mv
+		if err := c.refreshInTransaction(mv); err != nil {
+			delete(c.matViews, v.name)
+			c.removeTable(v.name)
+			return UnknownQueryType, true, err
+		}
+		mv.base = c.maintenanceBase(mv)
+		return CreateViewQueryType, true, nil
+	}
+	if n := matchKeywords(query, []string{"refresh", "materialized", "view"}); n > 0 {
+		words := strings.Fields(query[n:])
+		if len(words) != 1 {
+			return UnknownQueryType, true, GoDBError{ParseError, fmt.Sprintf("expected REFRESH MATERIALIZED VIEW name, got %s", query)}
+		}
+		mv := c.matViews[strings.ToLower(words[0])]
+		if mv == nil {
+			return UnknownQueryType, true, GoDBError{NoSuchTableError, fmt.Sprintf("no materialized view '%s' found", words[0])}
+		}
+		if err := c.refreshInTransaction(mv); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return RefreshViewQueryType, true, nil
+	}
+	if n := matchKeywords(query, []string{"drop", "materialized", "view"}); n > 0 {
+		name, ifExists, err := parseDropView(query, n)
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		if c.matViews[name] == nil {
+			if ifExists {
+				return DropViewQueryType, true, nil
+			}
+			return UnknownQueryType, true, GoDBError{NoSuchTableError, fmt.Sprintf("no materialized view '%s' found", name)}
+		}
+		if err := c.checkNotMaintainedFrom(name, "drop"); err != nil {
+			return UnknownQueryType, true, err
+		}
+		if err := c.removeTable(name); err != nil {
+			return UnknownQueryType, true, err
+		}
+		delete(c.matViews, name)
+		return DropViewQueryType, true, nil
+	}
+	return UnknownQueryType, false, nil
+}
+
+// Return the schema of the table that stores the result of view name, whose
+// query produces tuples described by desc. Its columns must have distinct
+// names that may be used in queries.
+func materializedDesc(name string, desc *TupleDesc) (*TupleDesc, error) {
+	out := &TupleDesc{}
+	for _, f := range desc.Fields {
+		fname := strings.ToLower(f.Fname)
+		valid := fname != ""
+		for i := 0; i < len(fname); i++ {
+			valid = valid && isWordByte(fname[i])
+		}
+		if !valid || columnIndex(out.Fields, fname) >= 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("cannot materialize view %s: column %s needs a distinct name, given with AS", name, f.Fname)}
+		}
+		out.Fields = append(out.Fields, FieldType{fname, "", f.Ftype, f.Precision, f.Scale})
+	}
+	return out, nil
+}
+
+// Return an error if a materialized view is maintained from the table named
+// name, which would be changed by action.
+func (c *Catalog) checkNotMaintainedFrom(name string, action string) error {
+	for _, vname := range c.matViewNames() {
+		if c.matViews[vname].base == name {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s %s, because materialized view %s is maintained from it", action, name, vname)}
+		}
+	}
+	return nil
+}
+
+// Return an error if name is a materialized view, whose table may not be
+// changed by action but only by refreshing the view.
+func (c *Catalog) checkNotMaterialized(name string, action string) error {
+	if c.matViews[name] != nil {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s materialized view %s", action, name)}
+	}
+	return nil
+}
+
+// Recompute the result of mv in a transaction of its own.
+func (c *Catalog) refreshInTransaction(mv *MaterializedView) error {
+	tid := NewTID()
+	if err := c.bufferPool.BeginTransaction(tid); err != nil {
+		return err
+	}
+	if err := c.refreshMaterializedView(mv, tid); err != nil {
+		c.bufferPool.AbortTransaction(tid)
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot refresh materialized view %s: %s", mv.name, err.Error())}
+	}
+	c.bufferPool.CommitTransaction(tid)
+	return nil
+}
+
+// Replace the stored result of mv with the result of its query, in
+// transaction tid.
+func (c *Catalog) refreshMaterializedView(mv *MaterializedView, tid TransactionID) error {
+	t, err := c.GetTableInfo(mv.name)
+	if err != nil {
+		return err
+	}
+	pc := newParseContext(c)
+	plan, err := viewPlan(pc, &mv.View)
+	if err != nil {
+		return err
+	}
+	op, err := makePhysicalPlan(pc, plan)
+	if err != nil {
+		return err
+	}
+	rows, err := collectTuples(op, t.file.Descriptor(), tid)
+	if err != nil {
+		return err
+	}
+	stored, err := collectTuples(t.file, t.file.Descriptor(), tid)
+	if err != nil {
+		return err
+	}
+	return c.changeViewTable(t, stored, rows, tid)
+}
+
+// Return the tuples of op, described by desc.
+func collectTuples(op Operator, desc *TupleDesc, tid TransactionID) ([]*Tuple, error) {
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var tuples []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			return tuples, nil
+		}
+		tup = tup.copy()
+		tup.Desc = *desc
+		tuples = append(tuples, tup)
+	}
+}
+
+// Delete the stored tuples deleted from the table t of a materialized view,
+// and insert inserted, in transaction tid; then maintain the views over t in
+// turn.
+func (c *Catalog) changeViewTable(t *Table, deleted []*Tuple, inserted []*Tuple, tid TransactionID) error {
+	for _, tup := range deleted {
+		if err := t.file.deleteTuple(tup, tid); err != nil {
+			return err
+		}
+	}
+	for _, tup := range inserted {
+		if err := t.file.insertTuple(tup, tid); err != nil {
+			return err
+		}
+		t.recordInsert(tup)
+	}
+	c.recordChanges(t, inserted, deleted, tid)
+	return c.maintainViews(t, inserted, deleted, tid)
+}
+
+// The physical plan of the query of a maintained view, reading the tuples of
+// its base table from working rather than from the table.
+type viewDelta struct {
+	op      Operator
+	working *MemFile
+
+	// whether the query aggregates, and the group by expressions if so
+	aggregate bool
+	groupBy   []Expr
+}
+
+// Plan the query of mv over a working table standing for its base table.
+// Returns nil if the query does more than filter, project and aggregate the
+// tuples of a single table, so the view cannot be maintained incrementally.
+func (c *Catalog) planViewDelta(mv *MaterializedView) (*viewDelta, string, error) {
+	pc := newParseContext(c)
+	plan, err := viewPlan(pc, &mv.View)
+	if err != nil {
+		return nil, "", err
+	}
+	if plan.setOp != nil || plan.recursive != nil || len(plan.tables) != 1 || len(plan.subqueries) != 0 {
+		return nil, "", nil
+	}
+	base, err := c.GetTableInfo(plan.tables[0].tableName)
+	if err != nil {
+		return nil, "", nil
+	}
+	d := &viewDelta{working: &MemFile{desc: base.desc.copy()}}
+	var working DBFile = d.working
+	plan, err = viewPlanWith(pc, &mv.View, map[string]*cteBinding{base.name: {working: &working}})
+	if err != nil {
+		return nil, "", err
+	}
+	op, err := makePhysicalPlan(pc, plan)
+	if err != nil {
+		return nil, "", err
+	}
+	d.op = op
+	if !d.maintainable(op, false) {
+		return nil, "", nil
+	}
+	return d, base.name, nil
+}
+
+// Return whether op only filters, projects and aggregates the tuples of the
+// working table. Projections that feed an aggregate are not allowed, so that
+// the group by expressions apply to the tuples of the base table.
+func (d *viewDelta) maintainable(op Operator, belowAggregate bool) bool {
+	switch o := op.(type) {
+	case *OperatorCard:
+		return d.maintainable(o.Op, belowAggregate)
+	case *Project:
+		return !o.distinct && !belowAggregate && d.maintainable(o.child, false)
+	case *Filter:
+		return d.maintainable(o.child, belowAggregate)
+	case *Aggregator:
+		if d.aggregate {
+			return false
+		}
+		d.aggregate, d.groupBy = true, o.groupByFields
+		return d.maintainable(o.child, true)
+	case *MemFile:
+		return o == d.working
+	}
+	return false
+}
+
+// Return the rows the query of the view produces from tuples, a subset of
+// its base table, described by desc.
+func (d *viewDelta) run(tuples []*Tuple, desc *TupleDesc, tid TransactionID) ([]*Tuple, error) {
+	d.working.pages = nil
+	for _, tup := range tuples {
+		d.working.insertTuple(&Tuple{*d.working.desc, tup.Fields, nil}, tid)
+	}
+	return collectTuples(d.op, desc, tid)
+}
+
+// Return the name of the table mv is maintained from, or "" if it cannot be
+// maintained incrementally.
+func (c *Catalog) maintenanceBase(mv *MaterializedView) string {
+	d, base, err := c.planViewDelta(mv)
+	if err != nil || d == nil {
+		return ""
+	}
+	return base
+}
+
+// Update the materialized views maintained from t, in transaction tid, after
+// inserted were inserted into t and deleted were deleted from it.
+//
+// The rows of a view that filters and projects t are those its query
+// produces from the changed tuples: the rows of deleted are removed from the
+// view, and the rows of inserted added. For a view that aggregates t, the
+// groups of the changed tuples are recomputed from all tuples of t in those
+// groups, before and after the change. If the rows to remove are not all
+// found among the stored ones, say, because floating point sums were added up
+// in another order, the view is refreshed instead.
+func (c *Catalog) maintainViews(t *Table, inserted []*Tuple, deleted []*Tuple, tid TransactionID) error {
+	if len(inserted) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	for _, name := range c.matViewNames() {
+		mv := c.matViews[name]
+		if mv.base != t.name {
+			continue
+		}
+		if err := c.maintainView(mv, t, inserted, deleted, tid); err != nil {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot maintain materialized view %s: %s", name, err.Error())}
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) maintainView(mv *MaterializedView, base *Table, inserted []*Tuple, deleted []*Tuple, tid TransactionID) error {
+	t, err := c.GetTableInfo(mv.name)
+	if err != nil {
+		return err
+	}
+	d, _, err := c.planViewDelta(mv)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return GoDBError{IllegalOperationError, "its query can no longer be maintained incrementally"}
+	}
+	before, after := deleted, inserted
+	if d.aggregate {
+		if before, after, err = d.groupTuples(base, inserted, deleted, tid); err != nil {
+			return err
+		}
+	}
+	desc := t.file.Descriptor()
+	oldRows, err := d.run(before, desc, tid)
+	if err != nil {
+		return err
+	}
+	newRows, err := d.run(after, desc, tid)
+	if err != nil {
+		return err
+	}
+	stored, ok, err := findStoredRows(t, oldRows, tid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.refreshMaterializedView(mv, tid)
+	}
+	return c.changeViewTable(t, stored, newRows, tid)
+}
+
+// Return the tuples of base in the groups of the changed tuples, as they
+// were before and as they are after the change.
+func (d *viewDelta) groupTuples(base *Table, inserted []*Tuple, deleted []*Tuple, tid TransactionID) ([]*Tuple, []*Tuple, error) {
+	groupKey := func(tup *Tuple) (any, error) {
+		if len(d.groupBy) == 0 {
+			return DefaultGroup, nil
+		}
+		key := &Tuple{}
+		for _, e := range d.groupBy {
+			v, err := e.EvalExpr(tup)
+			if err != nil {
+				return nil, err
+			}
+			key.Desc.Fields = append(key.Desc.Fields, e.GetExprType())
+			key.Fields = append(key.Fields, v)
+		}
+		return key.tupleKey(), nil
+	}
+	groups := make(map[any]bool)
+	isInserted := make(map[any]bool)
+	for _, changed := range [][]*Tuple{inserted, deleted} {
+		for _, tup := range changed {
+			key, err := groupKey(tup)
+			if err != nil {
+				return nil, nil, err
+			}
+			groups[key] = true
+		}
+	}
+	for _, tup := range inserted {
+		isInserted[tup.Rid] = true
+	}
+
+	var before, after []*Tuple
+	iter, err := base.file.Iterator(tid)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, nil, err
+		}
+		if tup == nil {
+			break
+		}
+		key, err := groupKey(tup)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !groups[key] {
+			continue
+		}
+		after = append(after, tup)
+		if !isInserted[tup.Rid] {
+			before = append(before, tup)
+		}
+	}
+	return append(before, deleted...), after, nil
+}
+
+// Find a stored tuple of t equal to each of rows. Returns false if some row
+// has no match.
+func findStoredRows(t *Table, rows []*Tuple, tid TransactionID) ([]*Tuple, bool, error) {
+	if len(rows) == 0 {
+		return nil, true, nil
+	}
+	stored, err := collectTuples(t.file, t.file.Descriptor(), tid)
+	if err != nil {
+		return nil, false, err
+	}
+	byKey := make(map[any][]*Tuple)
+	for _, tup := range stored {
+		byKey[tup.tupleKey()] = append(byKey[tup.tupleKey()], tup)
+	}
+	var found []*Tuple
+	for _, row := range rows {
+		key := row.tupleKey()
+		matches := byKey[key]
+		if len(matches) == 0 {
+			return nil, false, nil
+		}
+		found = append(found, matches[0])
+		byKey[key] = matches[1:]
+	}
+	return found, true, nil
+}
+
+// Format mv as it is recorded in the catalog, after the table that stores its
+// result.
+func (mv *MaterializedView) String() string {
+	return fmt.Sprintf("materialized view %s as %s\n", mv.name, mv.query)
+}
+
+// Parse a materialized view as formatted by [MaterializedView.String] in the
+// catalog. Returns false if line is not a materialized view.
+func parseMaterializedViewDeclaration(line string) (*MaterializedView, bool) {
+	words := strings.Fields(line)
+	if len(words) < 5 || !strings.EqualFold(words[0], "materialized") || !strings.EqualFold(words[1], "view") || !strings.EqualFold(words[3], "as") {
+		return nil, false
+	}
+	return &MaterializedView{View: View{name: strings.ToLower(words[2]), query: afterWords(line, 4)}}, true
+}
+
+// Return the names of the materialized views of c, in order.
+func (c *Catalog) matViewNames() []string {
+	names := make([]string, 0, len(c.matViews))
+	for name := range c.matViews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,148 @@
+package godb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMaterializedViews(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	names := []string{"older", "byname", "young", "pairs", "total"}
+	for _, name := range names {
+		os.Remove(c.tableNameToFile(name))
+		defer os.Remove(c.tableNameToFile(name))
+	}
+	for _, sql := range []string{
+		"create materialized view older as select name, age + 1 as later from t where age > 40",
+		"create materialized view byname as select name, count(*) as n, max(age) as oldest from t group by name",
+		"create materialized view young as select name from older where later < 60",
+		"create materialized view pairs as select t.name from t join t2 on t.name = t2.name",
+		"create materialized view total as select count(*) as n, sum(age) as s from t",
+	} {
+		qtype, _, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+		if qtype != CreateViewQueryType {
+			t.Errorf("%s: expected a CREATE VIEW query, got %v", sql, qtype)
+		}
+	}
+	for name, base := range map[string]string{"older": "t", "byname": "t", "young": "older", "pairs": "", "total": "t"} {
+		if c.matViews[name].base != base {
+			t.Errorf("expected view %s to be maintained from %q, got %q", name, base, c.matViews[name].base)
+		}
+	}
+
+	expect := func(sql string, count int) {
+		t.Helper()
+		if _, n := countQueryResults(t, bp, c, sql); n != count {
+			t.Errorf("query %s: expected %d results, got %d", sql, count, n)
+		}
+	}
+	expect("select name from older", 6)
+	expect("select name from byname where n = 2", 2)
+	expect("select name from young", 3)
+	expect("select name from pairs", 16)
+	expect("select n from total where n = 12 and s = 573", 1)
+
+	// inserts and deletes on t are applied to the views maintained from it
+	for _, sql := range []string{
+		"insert into t values ('zed', 55), ('sam', 70), ('amy', 10)",
+		"delete from t where name = 'riza'",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	expect("select name from older", 7)
+	expect("select name from older where name = 'zed' and later = 56", 1)
+	expect("select name from byname where name = 'sam' and n = 3 and oldest = 99", 1)
+	expect("select name from byname where name = 'riza'", 0)
+	expect("select name from byname where name = 'amy' and n = 1", 1)
+	expect("select name from young", 3)
+	expect("select n from total where n = 13 and s = 643", 1)
+	// until it is refreshed, a view that joins is out of date
+	expect("select name from pairs", 16)
+
+	// changes of an aborted transaction are rolled back with the views
+	tid := BeginTransactionForTest(t, bp)
+	_, op, err := Parse(c, "delete from t where age > 40")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.AbortTransaction(tid)
+	expect("select name from older", 7)
+
+	qtype, _, err := Parse(c, "refresh materialized view pairs")
+	if err != nil || qtype != RefreshViewQueryType {
+		t.Fatalf("expected REFRESH MATERIALIZED VIEW to succeed, got %v %v", qtype, err)
+	}
+	expect("select name from pairs", 14)
+
+	for _, sql := range []string{
+		"insert into older values ('x', 1)",
+		"delete from byname",
+		"drop table older",
+		"drop table t",
+		"alter table t add column x int default 0",
+		"drop materialized view older",
+		"refresh materialized view nosuch",
+		"create materialized view bad as select name, name from t",
+		"create materialized view older as select name from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error for %s", sql)
+		} else if sql == "insert into older values ('x', 1)" && !strings.Contains(err.Error(), "materialized view") {
+			t.Errorf("unexpected error for %s: %s", sql, err.Error())
+		}
+	}
+
+	// the definitions are saved with the catalog, and the results with the
+	// tables
+	catFile := "matview_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp2, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.matViews["byname"] == nil || c2.matViews["byname"].base != "t" {
+		t.Fatalf("expected view byname to be maintained after reloading the catalog")
+	}
+	if s := c2.CatalogString(); !strings.Contains(s, "Materialized views:\n") || !strings.Contains(s, "older as select name, age + 1 as later from t where age > 40\n") {
+		t.Errorf("unexpected catalog description\n%s", s)
+	}
+	if _, n := countQueryResults(t, bp2, c2, "select name from pairs"); n != 14 {
+		t.Errorf("expected 14 results from a view after reloading the catalog, got %d", n)
+	}
+
+	for _, sql := range []string{"drop materialized view young", "drop materialized view if exists nosuch"} {
+		if qtype, _, err := Parse(c, sql); err != nil || qtype != DropViewQueryType {
+			t.Fatalf("%s: expected DROP MATERIALIZED VIEW to succeed, got %v %v", sql, qtype, err)
+		}
+	}
+	if _, err := c.GetTableInfo("young"); err == nil {
+		t.Errorf("expected the table of a dropped materialized view to be removed")
+	}
+	if _, _, err := Parse(c, "drop materialized view older"); err != nil {
+		t.Errorf("expected a view no other view is maintained from to be dropped, got %s", err.Error())
+	}
+}
@@ -0,0 +1,596 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// The logical optimizer rewrites the plan of a query produced by the parser
+// into an equivalent plan that is cheaper to execute, before
+// [makePhysicalPlan] maps it to operators. It applies a fixed sequence of
+// rewrite rules, each to every plan nested in the query, outermost first.
+
+// Whether the rewrite rules of the logical optimizer are applied.
+var EnableLogicalOptimization = true
+
+// A rewriteRule rewrites plan in place. Rules may replace the fields of plan
+// and the elements of its slices, but not modify the nodes those hold, which
+// may be shared with other plans; see [clonePlan].
+type rewriteRule func(c *parseContext, plan *LogicalPlan) error
+
+// The rules applied by [optimizePlan], in order. Constants are folded first
+// so that the other rules see literal limits and comparisons; predicates and
+// limits are pushed into subqueries before the columns the subqueries must
+// produce are determined.
+var rewriteRules = []struct {
+	name string
+	rule rewriteRule
+}{
+	{"constant folding", foldConstants},
+	{"redundant distinct elimination", eliminateDistinct},
+	{"predicate pushdown", pushDownPredicates},
+	{"limit pushdown", pushDownLimit},
+	{"projection pushdown", pushDownProjections},
+}
+
+// Return an optimized copy of plan. The plan itself is left unchanged.
+func optimizePlan(c *parseContext, plan *LogicalPlan) (*LogicalPlan, error) {
+	if !EnableLogicalOptimization {
+		return plan, nil
+	}
+	plan = clonePlan(plan)
+	for _, r := range rewriteRules {
+		if err := forEachPlan(plan, func(p *LogicalPlan) error { return r.rule(c, p) }); err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("%s: %s", r.name, err.Error())}
+		}
+	}
+	return plan, nil
+}
+
+// Apply f to plan and then to the plans nested in it: its subqueries, the
+// inputs of its set operation and the subqueries of its WHERE clause. The
+// plans of recursive common table expressions are not visited, as their step
+// must read the working table as it is.
+func forEachPlan(plan *LogicalPlan, f func(*LogicalPlan) error) error {
+	if plan == nil || plan.recursive != nil {
+		return nil
+	}
+	if err := f(plan); err != nil {
+		return err
+	}
+	var nested []*LogicalPlan
+	nested = append(nested, plan.subqueries...)
+	if plan.setOp != nil {
+		nested = append(nested, plan.setOp.left, plan.setOp.right)
+	}
+	for _, sq := range plan.subqueryFilters {
+		nested = append(nested, sq.subplan)
+	}
+	for _, p := range nested {
+		if err := forEachPlan(p, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return a copy of plan, and of the plans nested in it, whose slices can be
+// changed without changing plan. The nodes the slices hold are shared: plans
+// of common table expressions are copied this way for each reference, so
+// their nodes must not be modified.
+func clonePlan(plan *LogicalPlan) *LogicalPlan {
+	if plan == nil || plan.recursive != nil {
+		return plan
+	}
+	p := *plan
+	p.filters = slices.Clone(plan.filters)
+	p.joins = slices.Clone(plan.joins)
+	p.selects = slices.Clone(plan.selects)
+	p.aggs = slices.Clone(plan.aggs)
+	p.windows = slices.Clone(plan.windows)
+	p.tables = slices.Clone(plan.tables)
+	p.groupByFields = slices.Clone(plan.groupByFields)
+	p.orderByFields = slices.Clone(plan.orderByFields)
+	p.subqueries = make([]*LogicalPlan, len(plan.subqueries))
+	for i, sub := range plan.subqueries {
+		p.subqueries[i] = clonePlan(sub)
+	}
+	p.subqueryFilters = make([]*LogicalSubqueryNode, len(plan.subqueryFilters))
+	for i, sq := range plan.subqueryFilters {
+		sqCopy := *sq
+		sqCopy.subplan = clonePlan(sq.subplan)
+		p.subqueryFilters[i] = &sqCopy
+	}
+	if plan.setOp != nil {
+		setOp := *plan.setOp
+		setOp.left, setOp.right = clonePlan(plan.setOp.left), clonePlan(plan.setOp.right)
+		p.setOp = &setOp
+	}
+	return &p
+}
+
+// Call f on each expression node of plan, and on their arguments: the
+// expressions of its select list, aggregates and window functions, WHERE
+// clause, joins, GROUP BY, ORDER BY and LIMIT, except for the filters for
+// which skip returns true. The plans of subqueries are not visited.
+func (plan *LogicalPlan) forEachExpr(skip func(*LogicalFilterNode) bool, f func(*LogicalSelectNode)) {
+	var visit func(n *LogicalSelectNode)
+	visit = func(n *LogicalSelectNode) {
+		if n == nil {
+			return
+		}
+		f(n)
+		for _, arg := range n.args {
+			visit(arg)
+		}
+		if n.window != nil {
+			for _, e := range n.window.partitionBy {
+				visit(e)
+			}
+			for _, o := range n.window.orderBy {
+				visit(o.expr)
+			}
+		}
+	}
+	for _, list := range [][]*LogicalSelectNode{plan.selects, plan.aggs, plan.windows} {
+		for _, n := range list {
+			visit(n)
+		}
+	}
+	for _, flt := range plan.filters {
+		if skip == nil || !skip(flt) {
+			visit(&flt.fieldExpr)
+			visit(&flt.constExpr)
+		}
+	}
+	for _, j := range plan.joins {
+		visit(j.left)
+		visit(j.right)
+	}
+	for _, sq := range plan.subqueryFilters {
+		visit(sq.expr)
+	}
+	for _, g := range plan.groupByFields {
+		visit(g.expr)
+	}
+	for _, o := range plan.orderByFields {
+		visit(o.expr)
+	}
+	visit(plan.limit)
+}
+
+// Return n with its subexpressions replaced by replace, which returns nil to
+// rewrite the arguments of a subexpression instead, or false if it fails.
+// Only the nodes that change are copied. Aggregates and window functions are
+// left alone, since the plan refers to them from its aggs and windows as
+// well as from its select list.
+func rewriteExpr(n *LogicalSelectNode, replace func(*LogicalSelectNode) (*LogicalSelectNode, bool)) (*LogicalSelectNode, bool) {
+	if n.exprType == ExprAggr || n.exprType == ExprWindow {
+		return n, true
+	}
+	if r, ok := replace(n); !ok || r != nil {
+		return r, ok
+	}
+	var args []*LogicalSelectNode
+	for i, arg := range n.args {
+		r, ok := rewriteExpr(arg, replace)
+		if !ok {
+			return nil, false
+		}
+		if r != arg && args == nil {
+			args = slices.Clone(n.args)
+		}
+		if args != nil {
+			args[i] = r
+		}
+	}
+	if args == nil {
+		return n, true
+	}
+	copied := *n
+	copied.args = args
+	copied.cachedField = nil
+	return &copied, true
+}
+
+// Functions whose result differs between calls with the same arguments,
+// which are not folded.
+var volatileFuncs = map[string]bool{"rand": true, "epoch": true}
+
+// Fold the calls of functions whose arguments are all constants into the
+// constant they evaluate to, e.g., "age > 10 * 3" into "age > 30". Calls
+// that fail, such as divisions by zero, are left to fail when the query runs.
+func foldConstants(c *parseContext, plan *LogicalPlan) error {
+	fold := func(n *LogicalSelectNode) *LogicalSelectNode {
+		folded, _ := rewriteExpr(n, func(n *LogicalSelectNode) (*LogicalSelectNode, bool) {
+			if n.exprType != ExprFunc {
+				return nil, true
+			}
+			return foldCall(c, n), true
+		})
+		return folded
+	}
+	for i, n := range plan.selects {
+		plan.selects[i] = fold(n)
+	}
+	for i, f := range plan.filters {
+		plan.filters[i] = &LogicalFilterNode{*fold(&f.fieldExpr), *fold(&f.constExpr), f.predOp}
+	}
+	for i, j := range plan.joins {
+		plan.joins[i] = &LogicalJoinNode{fold(j.left), fold(j.right), j.predOp}
+	}
+	for i, g := range plan.groupByFields {
+		plan.groupByFields[i] = &GroupBy{fold(g.expr)}
+	}
+	for i, o := range plan.orderByFields {
+		plan.orderByFields[i] = &OrderByNode{fold(o.expr), o.ascending}
+	}
+	if plan.limit != nil {
+		plan.limit = fold(plan.limit)
+	}
+	return nil
+}
+
+// Return the constant the call n evaluates to, or nil if its arguments are
+// not all constants, after folding them, or it cannot be evaluated.
+func foldCall(c *parseContext, n *LogicalSelectNode) *LogicalSelectNode {
+	fType, ok := funcs[*n.funcOp]
+	if !ok || volatileFuncs[*n.funcOp] || len(n.args) != len(fType.argTypes) {
+		return nil
+	}
+	call := *n
+	call.args = make([]*LogicalSelectNode, len(n.args))
+	for i, arg := range n.args {
+		if arg.exprType == ExprFunc {
+			arg = foldCall(c, arg)
+		}
+		if arg == nil || arg.exprType != ExprConst || arg.param > 0 {
+			return nil
+		}
+		call.args[i] = arg
+	}
+	expr, name, err := call.generateExpr(c, nil, nil)
+	if err != nil {
+		return nil
+	}
+	if (*n.funcOp == "/" || *n.funcOp == "mod") && call.args[1].value == "0" {
+		return nil
+	}
+	v, err := expr.EvalExpr(nil)
+	if err != nil {
+		return nil
+	}
+	// the folded constant keeps the name of the call in the select list
+	switch v := v.(type) {
+	case IntField:
+		folded := NewTypedConstSelectNode(strconv.FormatInt(v.Value, 10), IntType, name)
+		return &folded
+	case StringField:
+		folded := NewTypedConstSelectNode(v.Value, StringType, name)
+		return &folded
+	}
+	return nil
+}
+
+// Return the name a select list expression gives the column it produces, or
+// "" if it does not name it.
+func (n *LogicalSelectNode) outputName() string {
+	if n.alias != "" {
+		return n.alias
+	}
+	if n.exprType == ExprField {
+		return n.field
+	}
+	return ""
+}
+
+// Report whether the expressions a and b are the same column reference.
+func sameColumn(a, b *LogicalSelectNode) bool {
+	return a.exprType == ExprField && b.exprType == ExprField && a.field == b.field &&
+		(a.table == b.table || a.table == "" || b.table == "")
+}
+
+// Drop the DISTINCT of a query whose rows are distinct anyway: the query
+// aggregates without grouping, so it has one row; it selects all its GROUP
+// BY columns, one row per group; or it reads a single table and selects all
+// the columns of a PRIMARY KEY or UNIQUE constraint of it.
+func eliminateDistinct(c *parseContext, plan *LogicalPlan) error {
+	if !plan.distinct || plan.setOp != nil {
+		return nil
+	}
+	selected := func(col *LogicalSelectNode) bool {
+		return slices.ContainsFunc(plan.selects, func(s *LogicalSelectNode) bool { return sameColumn(s, col) })
+	}
+	switch {
+	case len(plan.aggs) > 0 && len(plan.groupByFields) == 0:
+		plan.distinct = false
+	case len(plan.groupByFields) > 0 && len(plan.aggs) > 0:
+		// a GROUP BY without aggregates is not planned, so only one with
+		// them makes the groups distinct
+		if !slices.ContainsFunc(plan.groupByFields, func(g *GroupBy) bool { return !selected(g.expr) }) {
+			plan.distinct = false
+		}
+	case len(plan.tables) == 1 && len(plan.subqueries) == 0 && len(plan.aggs) == 0:
+		t, err := c.GetTableInfo(plan.tables[0].tableName)
+		if err != nil {
+			// e.g., the working table of a recursive common table expression
+			return nil
+		}
+		for _, con := range t.constraints {
+			if con.kind != PrimaryKeyConstraint && con.kind != UniqueConstraint {
+				continue
+			}
+			unique := true
+			for _, col := range con.columns {
+				ref := NewFieldSelectNode("", t.desc.Fields[col].Fname, "")
+				unique = unique && selected(&ref)
+			}
+			if unique {
+				plan.distinct = false
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Return the tables and subqueries of plan that the filter f references.
+func (plan *LogicalPlan) filterTables(c *parseContext, f *LogicalFilterNode) ([]string, error) {
+	tables, err := f.fieldExpr.getTables(c, plan.subqueries, plan.tables)
+	if err != nil {
+		return nil, err
+	}
+	more, err := f.constExpr.getTables(c, plan.subqueries, plan.tables)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range more {
+		if !slices.Contains(tables, t) {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+// Return the expression of the select list of plan that produces its column
+// name, to be evaluated over the tables of plan, or false if there is none,
+// or it is an aggregate or window function.
+func (plan *LogicalPlan) columnExpr(name string) (*LogicalSelectNode, bool) {
+	for _, s := range plan.selects {
+		if s.exprType != ExprStar && s.outputName() == name {
+			if s.exprType != ExprField && s.exprType != ExprFunc && s.exprType != ExprConst {
+				return nil, false
+			}
+			expr := *s
+			expr.alias = ""
+			expr.cachedField = nil
+			return &expr, true
+		}
+	}
+	for _, s := range plan.selects {
+		if s.exprType == ExprStar {
+			// a column of the tables the star expands to
+			expr := NewFieldSelectNode(s.table, name, "")
+			return &expr, true
+		}
+	}
+	return nil, false
+}
+
+// Move the filters of plan that only reference the columns of one of its
+// subqueries into the subquery, so that they apply to the tables it reads
+// rather than to its result. Filters are not moved into subqueries that
+// aggregate, compute window functions, limit their rows or combine them with
+// a set operation, as the filter would then see different rows.
+func pushDownPredicates(c *parseContext, plan *LogicalPlan) error {
+	var kept []*LogicalFilterNode
+	for _, f := range plan.filters {
+		if !plan.pushDownFilter(c, f) {
+			kept = append(kept, f)
+		}
+	}
+	plan.filters = kept
+	return nil
+}
+
+// Move the filter f of plan into the subquery whose columns it references,
+// returning false if it cannot be moved.
+func (plan *LogicalPlan) pushDownFilter(c *parseContext, f *LogicalFilterNode) bool {
+	tables, err := plan.filterTables(c, f)
+	if err != nil || len(tables) != 1 {
+		return false
+	}
+	i := slices.IndexFunc(plan.subqueries, func(sub *LogicalPlan) bool { return sub.alias == tables[0] })
+	if i < 0 {
+		return false
+	}
+	sub := plan.subqueries[i]
+	if sub.setOp != nil || sub.recursive != nil || sub.limit != nil || len(sub.aggs) > 0 || len(sub.groupByFields) > 0 || len(sub.windows) > 0 {
+		return false
+	}
+	replace := func(n *LogicalSelectNode) (*LogicalSelectNode, bool) {
+		switch n.exprType {
+		case ExprField:
+			return sub.columnExpr(n.field)
+		case ExprOuterRef, ExprStar:
+			return nil, false
+		}
+		return nil, true
+	}
+	left, ok := rewriteExpr(&f.fieldExpr, replace)
+	if !ok {
+		return false
+	}
+	right, ok := rewriteExpr(&f.constExpr, replace)
+	if !ok {
+		return false
+	}
+	pushed := &LogicalFilterNode{*left, *right, f.predOp}
+	// the columns must be those of tables of the subquery, unambiguously
+	subTables, err := sub.filterTables(c, pushed)
+	if err != nil || slices.Contains(subTables, "") {
+		return false
+	}
+	sub.filters = append(slices.Clip(sub.filters), pushed)
+	return true
+}
+
+// Return the number of rows of the LIMIT of plan, or false if it has none or
+// it is not a constant.
+func (plan *LogicalPlan) limitValue() (int, bool) {
+	if plan.limit == nil || plan.limit.exprType != ExprConst || plan.limit.param > 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(plan.limit.value)
+	return n, err == nil
+}
+
+// Copy the LIMIT of plan into the plans whose rows it limits, so that they
+// stop early: into both inputs of a UNION ALL, and into the only subquery of
+// plan if plan passes its rows through one for one. The LIMIT of plan is
+// kept. Limits that apply after an ORDER BY are not moved.
+func pushDownLimit(c *parseContext, plan *LogicalPlan) error {
+	n, ok := plan.limitValue()
+	if !ok || len(plan.orderByFields) > 0 {
+		return nil
+	}
+	var inputs []*LogicalPlan
+	switch {
+	case plan.setOp != nil:
+		if plan.setOp.op == UnionSetOp && plan.setOp.all {
+			inputs = []*LogicalPlan{plan.setOp.left, plan.setOp.right}
+		}
+	case len(plan.tables) == 0 && len(plan.subqueries) == 1:
+		if len(plan.filters) == 0 && len(plan.joins) == 0 && len(plan.subqueryFilters) == 0 && len(plan.aggs) == 0 &&
+			len(plan.groupByFields) == 0 && len(plan.windows) == 0 && !plan.distinct {
+			inputs = plan.subqueries
+		}
+	}
+	for _, input := range inputs {
+		if input.recursive != nil {
+			continue
+		}
+		if m, ok := input.limitValue(); ok && m <= n || input.limit != nil && !ok {
+			continue
+		}
+		input.limit = plan.limit
+	}
+	return nil
+}
+
+// A column referenced by an expression of a plan: its table, or "" if it is
+// not qualified, and its name.
+type columnRef struct {
+	table, field string
+}
+
+// The columns the expressions of a plan reference.
+type columnRefs struct {
+	refs []columnRef
+	all  map[string]bool // the tables all of whose columns are referenced by a star, "" for all tables
+}
+
+// Return the columns referenced by the expressions of plan, except for the
+// filters for which skip returns true, and by the outer references of its
+// correlated subqueries.
+func (plan *LogicalPlan) columnRefs(skip func(*LogicalFilterNode) bool) *columnRefs {
+	refs := &columnRefs{all: make(map[string]bool)}
+	plan.forEachExpr(skip, func(n *LogicalSelectNode) {
+		switch {
+		case n.exprType == ExprStar:
+			refs.all[n.table] = true
+		case n.exprType == ExprField && n.field != "*":
+			// the * of COUNT(*) needs no column in particular
+			refs.refs = append(refs.refs, columnRef{n.table, n.field})
+		}
+	})
+	for _, sq := range plan.subqueryFilters {
+		forEachPlan(sq.subplan, func(p *LogicalPlan) error {
+			p.forEachExpr(nil, func(n *LogicalSelectNode) {
+				if n.exprType == ExprOuterRef {
+					refs.refs = append(refs.refs, columnRef{n.table, n.field})
+				}
+			})
+			return nil
+		})
+	}
+	return refs
+}
+
+// Report whether the column field of the table or subquery named table is
+// referenced.
+func (refs *columnRefs) references(table string, field string) bool {
+	return refs.all[""] || refs.all[table] || slices.ContainsFunc(refs.refs, func(r columnRef) bool {
+		return r.field == field && (r.table == table || r.table == "")
+	})
+}
+
+// Narrow what plan reads to the columns it uses: drop the columns of its
+// subqueries it does not reference, and, if plan joins, have each of its
+// tables produce only the columns referenced above the filters on the table
+// alone, so that the joins build smaller tuples.
+func pushDownProjections(c *parseContext, plan *LogicalPlan) error {
+	if plan.setOp != nil {
+		// the inputs of a set operation are matched by position
+		return nil
+	}
+	refs := plan.columnRefs(nil)
+	for _, sub := range plan.subqueries {
+		if sub.distinct || sub.setOp != nil || sub.recursive != nil {
+			continue
+		}
+		// the ORDER BY of the subquery refers to its columns by their names or
+		// by the columns they are computed from
+		ordered := (&LogicalPlan{orderByFields: sub.orderByFields}).columnRefs(nil)
+		orders := func(field string) bool {
+			return slices.ContainsFunc(ordered.refs, func(r columnRef) bool { return r.field == field })
+		}
+		var kept []*LogicalSelectNode
+		for _, s := range sub.selects {
+			name := s.outputName()
+			used := s.exprType == ExprStar || name == "" || refs.references(sub.alias, name) || orders(name)
+			(&LogicalPlan{selects: []*LogicalSelectNode{s}}).forEachExpr(nil, func(n *LogicalSelectNode) {
+				used = used || n.exprType == ExprField && orders(n.field)
+			})
+			if used {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == 0 {
+			kept = sub.selects[:1]
+		}
+		sub.selects = kept
+	}
+
+	if len(plan.tables)+len(plan.subqueries) < 2 {
+		return nil
+	}
+	for i, t := range plan.tables {
+		name := t.tableName
+		if t.alias != "" {
+			name = t.alias
+		}
+		tableRefs := plan.columnRefs(func(f *LogicalFilterNode) bool {
+			tables, err := plan.filterTables(c, f)
+			return err == nil && len(tables) == 1 && tables[0] == name
+		})
+		fields := (*t.file).Descriptor().Fields
+		var columns []string
+		for _, f := range fields {
+			if tableRefs.references(name, f.Fname) {
+				columns = append(columns, f.Fname)
+			}
+		}
+		if len(columns) == len(fields) {
+			continue
+		}
+		if len(columns) == 0 {
+			columns = []string{fields[0].Fname}
+		}
+		pruned := *t
+		pruned.columns = columns
+		plan.tables[i] = &pruned
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+// Parse query against the parser test database into a logical plan, without
+// optimizing it.
+func parseLogicalPlan(t *testing.T, c *Catalog, query string) *LogicalPlan {
+	t.Helper()
+	plan, err := parseQuery(newParseContext(c), query)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", query, err.Error())
+	}
+	return plan
+}
+
+// Run query and return its result tuples, formatted, in order.
+func queryResults(t *testing.T, bp *BufferPool, c *Catalog, query string) []string {
+	t.Helper()
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, query)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", query, err.Error())
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf("failed to run, q=%s, %s", query, err.Error())
+	}
+	var results []string
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("failed to run, q=%s, %s", query, err.Error())
+		}
+		if tup == nil {
+			return results
+		}
+		results = append(results, fmt.Sprint(tup.Fields))
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan := parseLogicalPlan(t, c, "select 1 + 2 as three, name, rand() from t where age > 10 * 2 and age < 7 / 0 limit 2 + 3")
+	if err := foldConstants(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if s := plan.selects[0]; s.exprType != ExprConst || s.value != "3" || s.outputName() != "three" {
+		t.Errorf("expected 1 + 2 to fold to 3 named three, got %v %q named %q", s.exprType, s.value, s.outputName())
+	}
+	if plan.selects[2].exprType != ExprFunc {
+		t.Errorf("expected rand() not to be folded")
+	}
+	if f := plan.filters[0].constExpr; f.exprType != ExprConst || f.value != "20" {
+		t.Errorf("expected 10 * 2 to fold to 20, got %v %q", f.exprType, f.value)
+	}
+	if plan.filters[1].constExpr.exprType != ExprFunc {
+		t.Errorf("expected a division by zero not to be folded")
+	}
+	if n, ok := plan.limitValue(); !ok || n != 5 {
+		t.Errorf("expected the limit to fold to 5, got %d", n)
+	}
+}
+
+func TestEliminateDistinct(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("keyed"))
+	defer os.Remove(c.tableNameToFile("keyed"))
+	if _, _, err := Parse(c, "create table keyed (id int primary key, name varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, q := range []struct {
+		sql      string
+		distinct bool
+	}{
+		{"select distinct count(*) from t", false},
+		{"select distinct age, count(*) from t group by age", false},
+		{"select distinct count(*) from t group by age", true},
+		{"select distinct name from t group by name", true},
+		{"select distinct id, name from keyed", false},
+		{"select distinct name from keyed", true},
+		{"select distinct name from t", true},
+		{"select distinct k.id from keyed k join t on k.name = t.name", true},
+	} {
+		plan := parseLogicalPlan(t, c, q.sql)
+		if err := eliminateDistinct(newParseContext(c), plan); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if plan.distinct != q.distinct {
+			t.Errorf("%s: expected distinct to be %v", q.sql, q.distinct)
+		}
+	}
+}
+
+func TestPushDownPredicates(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan := parseLogicalPlan(t, c, "select s.n from (select name n, age + 1 a from t) s join t2 on s.n = t2.name where s.a > 30 and t2.age > 30")
+	if err := pushDownPredicates(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(plan.filters) != 1 || len(plan.subqueries[0].filters) != 1 {
+		t.Fatalf("expected one filter to move into the subquery, got %d and %d", len(plan.filters), len(plan.subqueries[0].filters))
+	}
+	if f := plan.subqueries[0].filters[0]; f.fieldExpr.exprType != ExprFunc || f.fieldExpr.args[0].field != "age" {
+		t.Errorf("expected the filter to apply to age + 1, got %v", f.fieldExpr.exprType)
+	}
+
+	for _, sql := range []string{
+		"select s.age from (select age, count(*) n from t group by age) s where s.n > 1",
+		"select s.age from (select age from t limit 3) s where s.age > 1",
+		"select s.name from (select name from t union all select name from t2) s where s.name = 'sam'",
+	} {
+		plan := parseLogicalPlan(t, c, sql)
+		if err := pushDownPredicates(newParseContext(c), plan); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(plan.filters) != 1 {
+			t.Errorf("%s: expected the filter to stay", sql)
+		}
+	}
+}
+
+func TestPushDownLimit(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan := parseLogicalPlan(t, c, "select name from t union all (select name from t2 limit 1) limit 3")
+	if err := pushDownLimit(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, want := range []int{3, 1} {
+		side := []*LogicalPlan{plan.setOp.left, plan.setOp.right}[i]
+		if n, ok := side.limitValue(); !ok || n != want {
+			t.Errorf("expected a limit of %d on input %d of the union, got %d", want, i, n)
+		}
+	}
+
+	plan = parseLogicalPlan(t, c, "select s.name from (select name from t) s limit 2")
+	if err := pushDownLimit(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n, ok := plan.subqueries[0].limitValue(); !ok || n != 2 {
+		t.Errorf("expected the limit to move into the subquery")
+	}
+
+	for _, sql := range []string{
+		"select name from t union select name from t2 limit 3",
+		"select name from t union all select name from t2 order by name limit 3",
+		"select s.name from (select name from t) s where s.name > 'a' limit 2",
+		"select distinct s.name from (select name from t) s limit 2",
+	} {
+		plan := parseLogicalPlan(t, c, sql)
+		if err := pushDownLimit(newParseContext(c), plan); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if forEachPlan(plan, func(p *LogicalPlan) error {
+			if p != plan && p.limit != nil {
+				return fmt.Errorf("limit")
+			}
+			return nil
+		}) != nil {
+			t.Errorf("%s: expected the limit not to move", sql)
+		}
+	}
+}
+
+func TestPushDownProjections(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan := parseLogicalPlan(t, c, "select t.name from t join t2 on t.name = t2.name where t.age > 40")
+	if err := pushDownProjections(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, table := range plan.tables {
+		if !slices.Equal(table.columns, []string{"name"}) {
+			t.Errorf("expected %s to be pruned to its name, got %v", table.tableName, table.columns)
+		}
+	}
+
+	plan = parseLogicalPlan(t, c, "select s.n from (select name n, age a from t order by n) s")
+	if err := pushDownProjections(newParseContext(c), plan); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if sub := plan.subqueries[0]; len(sub.selects) != 1 || sub.selects[0].outputName() != "n" {
+		t.Errorf("expected the subquery to be pruned to n, got %d columns", len(sub.selects))
+	}
+
+	for _, sql := range []string{
+		"select * from t join t2 on t.name = t2.name",
+		"select t2.name from t join t2 on t.name = t2.name where exists (select name from t2 x where x.age = t.age)",
+		"select count(*) from t join t2 on t.name = t2.name where t.age = t2.age",
+	} {
+		plan := parseLogicalPlan(t, c, sql)
+		if err := pushDownProjections(newParseContext(c), plan); err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, table := range plan.tables {
+			if table.columns != nil && table.tableName == "t" {
+				t.Errorf("%s: expected all columns of t to be kept, got %v", sql, table.columns)
+			}
+		}
+	}
+}
+
+func TestOptimizedQueryResults(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	defer func() { EnableLogicalOptimization = true }()
+	for _, sql := range []string{
+		"select t.name, t2.age from t join t2 on t.name = t2.name where t.age > 40 order by t.name, t2.age",
+		"select s.n, s.a from (select name n, age + 1 a from t) s where s.a > 30 and s.n <> 'sam' order by s.n, s.a",
+		"select s.n from (select t.name n, t2.age a from t join t2 on t.name = t2.name) s where s.a < 50 order by s.n",
+		"select count(*) from (select name, age from t union all select name, age from t2 limit 5) s",
+		"select s.name from (select name, age from t) s limit 4",
+		"select s.n from (select name n, age a from t order by n limit 5) s",
+		"select distinct count(*), max(age) from t where age > 1 + 2",
+		"select distinct name from t group by name order by name",
+		"select name from t where age in (select age + 0 from t2 where name = 'sam') order by name",
+		"select t.name from t join t2 on t.name = t2.name where exists (select name from t2 x where x.age = t.age) order by t.name",
+		"with w as (select name, age from t) select a.name from w a join w b on a.name = b.name where a.age > 30 order by a.name",
+	} {
+		EnableLogicalOptimization = false
+		want := queryResults(t, bp, c, sql)
+		EnableLogicalOptimization = true
+		got := queryResults(t, bp, c, sql)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", sql, want, got)
+		}
+	}
+}
@@ -1,10 +1,5 @@
 package godb
 
-import (
-	// "fmt"
-	"sort"
-)
-
 type OrderBy struct {
 	orderBy []Expr // OrderBy should include these two fields (used by parser)
 	child   Operator
@@ -38,98 +33,30 @@ func (o *OrderBy) Descriptor() *TupleDesc {
 	return o.child.Descriptor()
 }
 
+// The memory, in bytes, an [OrderBy] may use to sort the tuples of its child.
+// Children with more tuples are sorted with an external merge sort.
+var SortWorkMem = 4 << 20
+
 // Return a function that iterates through the results of the child iterator in
 // ascending/descending order, as specified in the constructor.  This sort is
-// "blocking" -- it should first construct an in-memory sorted list of results
-// to return, and then iterate through them one by one on each subsequent
-// invocation of the iterator function.
+// "blocking" -- it reads all the results of the child before returning the
+// first one. Results with equal values of the ORDER BY expressions are
+// returned in the order of the child.
 //
-// Although you are free to implement your own sorting logic, you may wish to
-// leverage the go sort package and the [sort.Sort] method for this purpose. To
-// use this you will need to implement three methods: Len, Swap, and Less that
-// the sort algorithm will invoke to produce a sorted list. See the first
-// example, example of SortMultiKeys, and documentation at:
-// https://pkg.go.dev/sort
+// The results are sorted in memory if they fit in [SortWorkMem]; otherwise
+// runs of as many results as fit are sorted and written to temporary files,
+// and the runs are merged, as many at a time as there are pages in
+// [SortWorkMem].
 func (o *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	// TODO: some code goes here
-	// return nil, fmt.Errorf("OrderBy.Iterator not implemented") // replace me
-	tuples := []*Tuple{}
-	it ,err := o.child.Iterator(tid)
-	if err != nil{
-		return nil,err
-	}
-	for t,err:= it();t != nil && err == nil;t,err = it(){
-		tuples = append(tuples,t)
-	}
-	if err != nil{
-		return nil,err
+	iter, err := o.child.Iterator(tid)
+	if err != nil {
+		return nil, err
 	}
-	obp := &orderByProcessor{
-		orderBy: o.orderBy,
-		tuples: tuples,
+	sorter := &tupleSorter{
+		keys:      o.orderBy,
 		ascending: o.ascending,
-		currentIdx: 0,
-	}
-	obp.sortTuples()
-	return obp.iterateFunc(),nil
-}
-
-func (obp *orderByProcessor) sortTuples(){
-	sort.Sort(obp)
-}
-
-func (obp *orderByProcessor) iterateFunc() func() (*Tuple, error){
-	return func() (*Tuple, error){
-		if obp.currentIdx >= len(obp.tuples){
-			return nil,nil
-		}
-		tuple := obp.tuples[obp.currentIdx]
-		obp.currentIdx += 1
-		return tuple,nil
+		maxTuples: max(SortWorkMem/max(bytesPerTuple(o.child.Descriptor()), 1), 1),
+		maxRuns:   max(SortWorkMem/PageSize, 2),
 	}
+	return sorter.sort(iter)
 }
-
-type orderByProcessor struct {
-	orderBy    []Expr
-	tuples     []*Tuple
-	ascending  []bool
-	currentIdx int
-}
-
-func (obp *orderByProcessor) Len() int {
-	return len(obp.tuples)
-}
-
-func (obp *orderByProcessor) Swap(i, j int) {
-	obp.tuples[i], obp.tuples[j] = obp.tuples[j], obp.tuples[i]
-}
-
-func (obp *orderByProcessor) Less(i, j int) bool {
-	for idx, expr := range obp.orderBy {
-		valI, err := expr.EvalExpr(obp.tuples[i])
-		if err != nil {
-			continue
-		}
-		valJ, err := expr.EvalExpr(obp.tuples[j])
-		if err != nil {
-			continue
-		}
-		var cmp int64
-		switch vI := valI.(type) {
-		case IntField:
-			vJ := valJ.(IntField)
-			cmp = compareIntFields(vI, vJ)
-		case StringField:
-			vJ := valJ.(StringField)
-			cmp = compareStringFields(vI, vJ)
-		default:
-			continue
-		}
-		if cmp < 0 {
-			return obp.ascending[idx]
-		} else if cmp > 0 {
-			return !obp.ascending[idx]
-		}
-	}
-	return false
-}
\ No newline at end of file
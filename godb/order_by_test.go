@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"fmt"
 	"os"
 	"testing"
 )
@@ -232,3 +233,67 @@ func TestOrderByFieldsOrder(t *testing.T) {
 		t.Fatalf("Unexpected descriptor of ordered tuple")
 	}
 }
+
+// test that an order by whose child does not fit in SortWorkMem sorts it in
+// runs that take several passes to merge, with the same result as in memory
+func TestExternalOrderBy(t *testing.T) {
+	desc := TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "key", Ftype: IntType},
+		{Fname: "seq", Ftype: IntType},
+	}}
+	file := &MemFile{desc: &desc}
+	for i := 0; i < 500; i++ {
+		file.insertTuple(&Tuple{Desc: desc, Fields: []DBValue{StringField{fmt.Sprintf("n%d", i%7)}, IntField{int64(i * 37 % 11)}, IntField{int64(i)}}}, 0)
+	}
+	keys := []Expr{&FieldExpr{desc.Fields[0]}, &FieldExpr{desc.Fields[1]}}
+	ascending := []bool{true, false}
+
+	sorted := func(workMem int) []*Tuple {
+		defer func(old int) { SortWorkMem = old }(SortWorkMem)
+		SortWorkMem = workMem
+		oby, err := NewOrderBy(keys, file, ascending)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := oby.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var tuples []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return tuples
+			}
+			tuples = append(tuples, tup)
+		}
+	}
+
+	want := sorted(1 << 30)
+	if len(want) != 500 {
+		t.Fatalf("expected 500 tuples, got %d", len(want))
+	}
+	for i := 1; i < len(want); i++ {
+		a, b := want[i-1].Fields, want[i].Fields
+		if a[0].(StringField).Value > b[0].(StringField).Value ||
+			a[0] == b[0] && (a[1].(IntField).Value < b[1].(IntField).Value ||
+				a[1] == b[1] && a[2].(IntField).Value > b[2].(IntField).Value) {
+			t.Fatalf("tuples %d and %d are out of order: %v, %v", i-1, i, a, b)
+		}
+	}
+
+	// runs of 10 tuples, merged two at a time
+	got := sorted(10 * bytesPerTuple(&desc))
+	if len(got) != len(want) {
+		t.Fatalf("expected %d tuples, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !got[i].equals(want[i]) {
+			t.Fatalf("tuple %d: expected %v, got %v", i, want[i].Fields, got[i].Fields)
+		}
+	}
+}
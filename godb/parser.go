@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -10,6 +11,9 @@ import (
 	"github.com/xwb1989/sqlparser"
 )
 
+// A LogicalFilterNode is a predicate fieldExpr predOp constExpr. Despite their
+// names, both sides may be arbitrary expressions over any of the tables of the
+// query.
 type LogicalFilterNode struct {
 	fieldExpr LogicalSelectNode
 	constExpr LogicalSelectNode
@@ -24,11 +28,13 @@ type LogicalJoinNode struct {
 type SelectExprType int
 
 const (
-	ExprField SelectExprType = iota
-	ExprConst SelectExprType = iota
-	ExprFunc  SelectExprType = iota
-	ExprStar  SelectExprType = iota
-	ExprAggr  SelectExprType = iota
+	ExprField    SelectExprType = iota
+	ExprConst    SelectExprType = iota
+	ExprFunc     SelectExprType = iota
+	ExprStar     SelectExprType = iota
+	ExprAggr     SelectExprType = iota
+	ExprOuterRef SelectExprType = iota //a field of the enclosing query, referenced from a correlated subquery
+	ExprWindow   SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -38,8 +44,20 @@ type LogicalSelectNode struct {
 	funcOp      *string //may be nil, if no aggregate
 	alias       string
 	value       string
+	constType   *DBType              //for constants whose type is given by the literal, e.g., floats and booleans; nil if it is inferred from value
+	param       int                  //for parameters of prepared statements, the position of the parameter, starting at 1
 	args        []*LogicalSelectNode //for functions other than aggregates
 	cachedField *FieldType
+	outer       *outerBinding      //for outer references, the binding of the enclosing query's tuple
+	window      *LogicalWindowNode //for window functions, the OVER clause
+}
+
+// A LogicalWindowNode is the OVER clause of a window function.
+type LogicalWindowNode struct {
+	partitionBy []*LogicalSelectNode
+	orderBy     []*OrderByNode
+	frame       *WindowFrame //nil for the default frame
+	spec        string       //the partition and order clauses, to group functions over the same window
 }
 
 func NewFieldSelectNode(table string, field string, alias string) LogicalSelectNode {
@@ -59,6 +77,18 @@ func NewConstSelectNode(value string, alias string) LogicalSelectNode {
 	return lsn
 }
 
+func NewTypedConstSelectNode(value string, constType DBType, alias string) LogicalSelectNode {
+	lsn := NewConstSelectNode(value, alias)
+	lsn.constType = &constType
+	return lsn
+}
+
+func NewParamSelectNode(param int, alias string) LogicalSelectNode {
+	lsn := NewConstSelectNode(fmt.Sprintf("$%d", param), alias)
+	lsn.param = param
+	return lsn
+}
+
 func NewStarSelectNode(table string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprStar
@@ -86,6 +116,25 @@ func NewFuncSelectNode(op string, args []*LogicalSelectNode, alias string) Logic
 	return lsn
 }
 
+func NewWindowSelectNode(op string, args []*LogicalSelectNode, window *LogicalWindowNode, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprWindow
+	lsn.funcOp = &op
+	lsn.alias = alias
+	lsn.args = args
+	lsn.window = window
+	return lsn
+}
+
+func NewOuterRefSelectNode(table string, field string, outer *outerBinding) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprOuterRef
+	lsn.table = table
+	lsn.field = field
+	lsn.outer = outer
+	return lsn
+}
+
 func (t SelectExprType) String() string {
 	switch t {
 	case ExprField:
@@ -98,6 +147,10 @@ func (t SelectExprType) String() string {
 		return "ExprStar"
 	case ExprAggr:
 		return "ExprAggr"
+	case ExprOuterRef:
+		return "ExprOuterRef"
+	case ExprWindow:
+		return "ExprWindow"
 	default:
 		return "Unknown"
 	}
@@ -147,7 +200,7 @@ func (s *LogicalSelectNode) String() string {
 	}
 }
 
-func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, error) {
+func checkNameInTablesOrSubqueries(table string, field string, c *parseContext, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, error) {
 	if table == "" && subqueries != nil {
 		for _, q := range subqueries {
 			qFs := q.getSubplanFields(c)
@@ -181,11 +234,11 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 //
 // If catalog is non null, will try to resolve table name from catalog
 // otherwise, will not.
-func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
-	if lsn.exprType == ExprConst {
+func (lsn *LogicalSelectNode) getTableField(c *parseContext, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
+	if lsn.exprType == ExprConst || lsn.exprType == ExprOuterRef {
 		return "", "", nil
 	}
-	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
+	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr || lsn.exprType == ExprWindow {
 		tabName := ""
 		fieldName := ""
 		for _, subLsn := range lsn.args {
@@ -221,10 +274,55 @@ func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPla
 	return tabName, field, nil
 }
 
+// Returns the tables of all the fields this expression references, without
+// duplicates. Fields whose table cannot be resolved from the catalog are
+// returned as "".
+func (lsn *LogicalSelectNode) getTables(c *parseContext, subqueries []*LogicalPlan, ts []*LogicalTableNode) ([]string, error) {
+	switch lsn.exprType {
+	case ExprConst, ExprOuterRef:
+		return nil, nil
+	case ExprFunc, ExprAggr, ExprWindow:
+		var tables []string
+		for _, arg := range lsn.args {
+			argTables, err := arg.getTables(c, subqueries, ts)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range argTables {
+				if !slices.Contains(tables, t) {
+					tables = append(tables, t)
+				}
+			}
+		}
+		return tables, nil
+	}
+	table, _, err := lsn.getTableField(c, subqueries, ts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{table}, nil
+}
+
+// Return the field references in this expression.
+func (lsn *LogicalSelectNode) fieldRefs() []*LogicalSelectNode {
+	switch lsn.exprType {
+	case ExprField:
+		return []*LogicalSelectNode{lsn}
+	case ExprFunc, ExprAggr, ExprWindow:
+		var refs []*LogicalSelectNode
+		for _, arg := range lsn.args {
+			refs = append(refs, arg.fieldRefs()...)
+		}
+		return refs
+	}
+	return nil
+}
+
 type LogicalTableNode struct {
 	tableName string
 	alias     string
 	file      *DBFile
+	columns   []string //the columns of the table the query uses, if the optimizer pruned the others; nil for all columns
 }
 
 type GroupBy struct {
@@ -236,99 +334,376 @@ type OrderByNode struct {
 	ascending bool
 }
 
+// A LogicalSubqueryNode is a predicate in a WHERE clause over the result of a
+// subquery.
+//
+// If semiJoin is set, the subquery has been decorrelated: the predicate is
+// evaluated as a semi (or anti) join of the enclosing query with subplan on
+// expr = the first column of subplan. Otherwise subplan is evaluated by nested
+// iteration, and outer is the binding its outer references read from (nil if
+// the subquery is not correlated).
+type LogicalSubqueryNode struct {
+	kind     SubqueryKind
+	expr     *LogicalSelectNode //nil for EXISTS that is not decorrelated
+	predOp   BoolOp
+	subplan  *LogicalPlan
+	semiJoin bool
+	outer    *outerBinding
+}
+
 type LogicalPlan struct {
-	filters       []*LogicalFilterNode
-	joins         []*LogicalJoinNode
-	selects       []*LogicalSelectNode
-	aggs          []*LogicalSelectNode
-	tables        []*LogicalTableNode
-	subqueries    []*LogicalPlan
-	groupByFields []*GroupBy
-	orderByFields []*OrderByNode
-	limit         *LogicalSelectNode
-	distinct      bool
-	alias         string
-}
-
-func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
+	filters         []*LogicalFilterNode
+	subqueryFilters []*LogicalSubqueryNode
+	joins           []*LogicalJoinNode
+	selects         []*LogicalSelectNode
+	aggs            []*LogicalSelectNode
+	windows         []*LogicalSelectNode
+	tables          []*LogicalTableNode
+	subqueries      []*LogicalPlan
+	groupByFields   []*GroupBy
+	orderByFields   []*OrderByNode
+	limit           *LogicalSelectNode
+	distinct        bool
+	alias           string
+	setOp           *LogicalSetOpNode
+	recursive       *LogicalRecursiveNode
+}
+
+// A LogicalSetOpNode combines the results of two plans with UNION, INTERSECT
+// or EXCEPT. The ORDER BY and LIMIT of the plan that holds it apply to the
+// combined result.
+type LogicalSetOpNode struct {
+	op          SetOpType
+	all         bool
+	left, right *LogicalPlan
+}
+
+func (p *LogicalPlan) getSubplanFields(c *parseContext) []*FieldType {
+	if p.setOp != nil || p.recursive != nil {
+		// the fields of a set operation or recursive CTE are named after its
+		// left input or base case
+		left := p.recursive.getBase()
+		if p.setOp != nil {
+			left = p.setOp.left
+		}
+		nodes := left.getSubplanFields(c)
+		for _, n := range nodes {
+			n.TableQualifier = p.alias
+		}
+		return nodes
+	}
 	var nodes []*FieldType = make([]*FieldType, len(p.selects))
 	for i, s := range p.selects {
 		_, field, _ := s.getTableField(c, p.subqueries, p.tables)
-		nodes[i] = &FieldType{field, p.alias, UnknownType}
+		nodes[i] = &FieldType{field, p.alias, UnknownType, 0, 0}
 	}
 	return nodes
 }
 
-// Parse a where statement into a list of filters and joins.
-func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, error) {
+// Parse a where statement into a list of filters, joins, and predicates over
+// subqueries.
+//
+// Comparisons other than LIKE between expressions over two different tables
+// are returned as joins, and BETWEEN as a pair of comparisons. All other
+// predicates, including ones over several tables, are returned as filters,
+// which [makePhysicalPlan] places at the lowest operator that covers the
+// tables they reference.
+func parseWhere(c *parseContext, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, []*LogicalSubqueryNode, error) {
 	switch expr := expr.(type) {
 	case *sqlparser.AndExpr:
 		// Parse AND by parsing left and right sides
-		filterListLeft, joinListLeft, _ := parseWhere(c, subqueries, ts, expr.Left)
-		filterListRight, joinListRight, _ := parseWhere(c, subqueries, ts, expr.Right)
+		filterListLeft, joinListLeft, subqueryListLeft, err := parseWhere(c, subqueries, ts, expr.Left)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		filterListRight, joinListRight, subqueryListRight, err := parseWhere(c, subqueries, ts, expr.Right)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		filterExprs := append(filterListLeft, filterListRight...)
 		joinExprs := append(joinListLeft, joinListRight...)
-		return filterExprs, joinExprs, nil
+		subqueryExprs := append(subqueryListLeft, subqueryListRight...)
+		return filterExprs, joinExprs, subqueryExprs, nil
+
+	case *sqlparser.ExistsExpr:
+		sq, err := parseSubqueryPredicate(c, subqueries, ts, SubqueryExists, nil, OpEq, expr.Subquery)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, []*LogicalSubqueryNode{sq}, nil
+
+	case *sqlparser.NotExpr:
+		exists, ok := expr.Expr.(*sqlparser.ExistsExpr)
+		if !ok {
+			return nil, nil, nil, GoDBError{ParseError, "NOT is only supported before EXISTS in where expressions"}
+		}
+		sq, err := parseSubqueryPredicate(c, subqueries, ts, SubqueryNotExists, nil, OpEq, exists.Subquery)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, []*LogicalSubqueryNode{sq}, nil
 
 	case *sqlparser.ComparisonExpr:
+		if subquery, ok := expr.Right.(*sqlparser.Subquery); ok {
+			left, err := parseExpr(c, expr.Left, "")
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			kind := SubqueryScalar
+			switch expr.Operator {
+			case sqlparser.InStr:
+				kind = SubqueryIn
+			case sqlparser.NotInStr:
+				kind = SubqueryNotIn
+			}
+			sq, err := parseSubqueryPredicate(c, subqueries, ts, kind, left, BoolOpMap[expr.Operator], subquery)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return nil, nil, []*LogicalSubqueryNode{sq}, nil
+		}
+		if subquery, ok := expr.Left.(*sqlparser.Subquery); ok {
+			right, err := parseExpr(c, expr.Right, "")
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			sq, err := parseSubqueryPredicate(c, subqueries, ts, SubqueryScalar, right, BoolOpMap[expr.Operator].flip(), subquery)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return nil, nil, []*LogicalSubqueryNode{sq}, nil
+		}
+
 		op := BoolOpMap[expr.Operator]
 		left, err := parseExpr(c, expr.Left, "")
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		right, err := parseExpr(c, expr.Right, "")
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		//here we want to search the catalog for the table id, if it's not specified
-		lTable, _, err := left.getTableField(c, subqueries, ts)
+		lTables, err := left.getTables(c, subqueries, ts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		rTable, _, err := right.getTableField(c, subqueries, ts)
+		rTables, err := right.getTables(c, subqueries, ts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		if lTable != "" && rTable != "" && lTable != rTable { //join
-			if op != OpEq {
-				return nil, nil, GoDBError{IllegalOperationError, "only equality joins are supported"}
-			}
-			return nil, []*LogicalJoinNode{{left, right, op}}, nil
-		} else {
-			return []*LogicalFilterNode{{*left, *right, op}}, nil, nil
+		if op != OpLike && len(lTables) == 1 && len(rTables) == 1 && lTables[0] != "" && rTables[0] != "" && lTables[0] != rTables[0] { //join
+			return nil, []*LogicalJoinNode{{left, right, op}}, nil, nil
+		}
+		return []*LogicalFilterNode{{*left, *right, op}}, nil, nil, nil
+
+	case *sqlparser.RangeCond:
+		if expr.Operator != sqlparser.BetweenStr {
+			return nil, nil, nil, GoDBError{ParseError, "NOT BETWEEN is not supported in where expressions"}
+		}
+		return parseWhere(c, subqueries, ts, &sqlparser.AndExpr{
+			Left:  &sqlparser.ComparisonExpr{Operator: sqlparser.GreaterEqualStr, Left: expr.Left, Right: expr.From},
+			Right: &sqlparser.ComparisonExpr{Operator: sqlparser.LessEqualStr, Left: expr.Left, Right: expr.To},
+		})
+
+	default:
+		return nil, nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
+	}
+}
+
+// Return true if name is the name or alias of one of the tables or subqueries
+// in a FROM clause.
+func inFromScope(name string, subqueries []*LogicalPlan, ts []*LogicalTableNode) bool {
+	for _, t := range ts {
+		if t.alias == name || (t.alias == "" && t.tableName == name) {
+			return true
+		}
+	}
+	for _, q := range subqueries {
+		if q.alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a subquery that appears in a WHERE clause whose FROM clause consists of
+// outerSubqueries and outerTs, and decide how it will be evaluated.
+//
+// Uncorrelated IN and NOT IN subqueries, and EXISTS and NOT EXISTS subqueries
+// whose only correlated predicate is an equality with a field of the enclosing
+// query, are decorrelated into semi and anti joins. All other subqueries are
+// evaluated by nested iteration.
+func parseSubqueryPredicate(c *parseContext, outerSubqueries []*LogicalPlan, outerTs []*LogicalTableNode, kind SubqueryKind, expr *LogicalSelectNode, op BoolOp, subquery *sqlparser.Subquery) (*LogicalSubqueryNode, error) {
+	stmt, ok := subquery.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported subquery %s", sqlparser.String(subquery))}
+	}
+	subplan, err := parseStatement(c, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if kind != SubqueryExists && kind != SubqueryNotExists {
+		if len(subplan.selects) != 1 || subplan.selects[0].exprType == ExprStar {
+			return nil, GoDBError{ParseError, fmt.Sprintf("%s subquery must return exactly one column", kind)}
 		}
+	}
 
+	outer := &outerBinding{}
+	correlated, err := bindOuterReferences(c, subplan, outerSubqueries, outerTs, outer)
+	if err != nil {
+		return nil, err
+	}
+	sq := &LogicalSubqueryNode{kind: kind, expr: expr, predOp: op, subplan: subplan}
+
+	simple := len(subplan.aggs) == 0 && len(subplan.groupByFields) == 0 && subplan.limit == nil
+	switch {
+	case (kind == SubqueryIn || kind == SubqueryNotIn) && len(correlated) == 0:
+		sq.semiJoin = true
+	case (kind == SubqueryExists || kind == SubqueryNotExists) && simple && len(correlated) == 1 && correlated[0].predOp == OpEq:
+		// EXISTS (SELECT ... WHERE inner = outer) becomes outer IN (SELECT inner ...)
+		ref := correlated[0].constExpr
+		outerKey := NewFieldSelectNode(ref.table, ref.field, "")
+		innerKey := correlated[0].fieldExpr
+		sq.expr = &outerKey
+		sq.semiJoin = true
+		subplan.selects = []*LogicalSelectNode{&innerKey}
+		subplan.distinct = false
 	default:
-		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
+		for _, f := range correlated {
+			subplan.filters = append(subplan.filters, f)
+		}
+		if len(correlated) > 0 {
+			sq.outer = outer
+		}
+	}
+	return sq, nil
+}
+
+// Find the predicates of subplan that reference a table of the enclosing
+// query (whose FROM clause consists of outerSubqueries and outerTs), and remove
+// them from subplan's filters and joins. They are returned as filters whose
+// fieldExpr is the subquery's side of the predicate, and whose constExpr is an
+// outer reference bound to outer.
+func bindOuterReferences(c *parseContext, subplan *LogicalPlan, outerSubqueries []*LogicalPlan, outerTs []*LogicalTableNode, outer *outerBinding) ([]*LogicalFilterNode, error) {
+	// resolve the node to a table of the enclosing query, or return nil if it
+	// does not reference one
+	outerRef := func(n *LogicalSelectNode) (*LogicalSelectNode, error) {
+		if n.exprType != ExprField && n.exprType != ExprFunc {
+			return nil, nil
+		}
+		table, _, err := n.getTableField(c, subplan.subqueries, subplan.tables)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" && inFromScope(table, subplan.subqueries, subplan.tables) {
+			return nil, nil
+		}
+		table, field, err := n.getTableField(c, outerSubqueries, outerTs)
+		if err != nil || table == "" || !inFromScope(table, outerSubqueries, outerTs) {
+			return nil, nil
+		}
+		if n.exprType != ExprField {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression over enclosing query in subquery predicate (%s)", n)}
+		}
+		ref := NewOuterRefSelectNode(table, field, outer)
+		return &ref, nil
+	}
+
+	var correlated []*LogicalFilterNode
+	addPredicate := func(left *LogicalSelectNode, right *LogicalSelectNode, op BoolOp) (bool, error) {
+		leftRef, err := outerRef(left)
+		if err != nil {
+			return false, err
+		}
+		rightRef, err := outerRef(right)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case leftRef == nil && rightRef == nil:
+			return false, nil
+		case leftRef != nil && rightRef != nil, leftRef != nil && right.exprType == ExprConst, rightRef != nil && left.exprType == ExprConst:
+			return false, GoDBError{ParseError, "subquery predicates that only reference the enclosing query are not supported"}
+		case rightRef != nil:
+			correlated = append(correlated, &LogicalFilterNode{*left, *rightRef, op})
+		default:
+			correlated = append(correlated, &LogicalFilterNode{*right, *leftRef, op.flip()})
+		}
+		return true, nil
+	}
+
+	var filters []*LogicalFilterNode
+	for _, f := range subplan.filters {
+		isOuter, err := addPredicate(&f.fieldExpr, &f.constExpr, f.predOp)
+		if err != nil {
+			return nil, err
+		}
+		if !isOuter {
+			filters = append(filters, f)
+		}
+	}
+	var joins []*LogicalJoinNode
+	for _, j := range subplan.joins {
+		isOuter, err := addPredicate(j.left, j.right, j.predOp)
+		if err != nil {
+			return nil, err
+		}
+		if !isOuter {
+			joins = append(joins, j)
+		}
 	}
+	subplan.filters = filters
+	subplan.joins = joins
+	return correlated, nil
 }
 
-func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
+func parseFrom(c *parseContext, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
 	switch tableEx := t.(type) {
 	case *sqlparser.AliasedTableExpr:
 		switch tableEx.Expr.(type) {
 		case *sqlparser.Subquery:
 			sq := (tableEx.Expr).(*sqlparser.Subquery)
 			//print("got subquery")
-			switch stmt := sq.Select.(type) {
-			case *sqlparser.Select:
-				subplan, err := parseStatement(c, stmt)
+			subplan, err := parseSelectStatement(c, sq.Select)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
+			return nil, []*LogicalPlan{subplan}, nil, nil
+		case sqlparser.SimpleTableExpr:
+			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
+			//fmt.Printf("got simple table, name %s\n", tableName)
+			if cte, ok := c.ctes[tableName]; ok {
+				alias := strings.ToLower(sqlparser.String(tableEx.As))
+				if cte.working != nil {
+					return []*LogicalTableNode{{tableName, alias, cte.working, nil}}, nil, nil, nil
+				}
+				if alias == "" {
+					alias = tableName
+				}
+				subplan := *cte.plan
+				subplan.alias = alias
+				return nil, []*LogicalPlan{&subplan}, nil, nil
+			}
+			if v, ok := c.views[tableName]; ok {
+				subplan, err := viewPlan(c, v)
 				if err != nil {
 					return nil, nil, nil, err
 				}
 				subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
+				if subplan.alias == "" {
+					subplan.alias = tableName
+				}
 				return nil, []*LogicalPlan{subplan}, nil, nil
 			}
-		case sqlparser.SimpleTableExpr:
-			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
-			//fmt.Printf("got simple table, name %s\n", tableName)
 			dbFile, err := c.GetTable(tableName)
 			if err != nil {
 				return nil, nil, nil, err
 			}
 			table := LogicalTableNode{tableName,
 				strings.ToLower(sqlparser.String(tableEx.As)),
-				&dbFile}
+				&dbFile, nil}
 			table.alias = strings.ToLower(sqlparser.String(tableEx.As))
 			return []*LogicalTableNode{&table}, nil, nil, nil
 		}
@@ -363,7 +738,7 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 		}
 		tabList := append(leftTables, rightTables...)
 		subPlanList := append(leftSubplans, rightSubplans...)
-		_, joins, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
+		_, joins, _, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -377,10 +752,16 @@ func isAgg(f string) bool {
 	return f == "count" || f == "sum" || f == "avg" || f == "min" || f == "max"
 }
 
-func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
+func parseExpr(c *parseContext, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
 	switch expr := expr.(type) {
 	case *sqlparser.FuncExpr:
 		funName := strings.ToLower(sqlparser.String(expr.Name))
+		if funName == "window_over" {
+			return parseWindowExpr(c, expr, alias)
+		}
+		if funName == "cast_as" {
+			return parseCastExpr(c, expr, alias)
+		}
 		if isAgg(funName) {
 			if len(expr.Exprs) != 1 {
 				return nil, GoDBError{ParseError, fmt.Sprintf("expected one argument to aggregate %s in select list", sqlparser.String(expr.Name))}
@@ -445,18 +826,35 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		return &field, nil
 	case *sqlparser.SQLVal:
 		str := sqlparser.String(expr)
-		if str[0] == '\'' {
-			str = str[1 : len(str)-1]
-			//str = str[-1]
+		if expr.Type == sqlparser.ValArg {
+			param, err := strconv.Atoi(strings.TrimPrefix(str, ":v"))
+			if err != nil || param < 1 {
+				return nil, GoDBError{ParseError, fmt.Sprintf("invalid parameter %s", str)}
+			}
+			field := NewParamSelectNode(param, alias)
+			return &field, nil
+		}
+		if expr.Type == sqlparser.FloatVal {
+			field := NewTypedConstSelectNode(str, FloatType, alias)
+			return &field, nil
+		}
+		if expr.Type == sqlparser.StrVal {
+			// quoted literals are strings, even if they look like numbers;
+			// comparisons convert them to the type of the other operand
+			field := NewTypedConstSelectNode(string(expr.Val), StringType, alias)
+			return &field, nil
 		}
 		field := NewConstSelectNode(str, alias)
 		return &field, nil
+	case sqlparser.BoolVal:
+		field := NewTypedConstSelectNode(strconv.FormatBool(bool(expr)), BoolType, alias)
+		return &field, nil
 	default:
 		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
 	}
 
 }
-func parseSelect(c *Catalog, stmt sqlparser.SelectExpr) (*LogicalSelectNode, error) {
+func parseSelect(c *parseContext, stmt sqlparser.SelectExpr) (*LogicalSelectNode, error) {
 	star, ok := stmt.(*sqlparser.StarExpr)
 	if ok {
 		node := NewStarSelectNode(strings.ToLower(sqlparser.String(star.TableName)))
@@ -473,6 +871,119 @@ func parseSelect(c *Catalog, stmt sqlparser.SelectExpr) (*LogicalSelectNode, err
 	}
 }
 
+// Parse a cast, rewritten into a call of cast_as by [rewriteCasts]. The cast
+// is represented as a call of the function cast, whose second argument is a
+// constant naming the type.
+func parseCastExpr(c *parseContext, expr *sqlparser.FuncExpr, alias string) (*LogicalSelectNode, error) {
+	if len(expr.Exprs) != 2 {
+		return nil, GoDBError{ParseError, "malformed CAST"}
+	}
+	arg, err := parseSelect(c, expr.Exprs[0])
+	if err != nil {
+		return nil, err
+	}
+	typeName, err := parseSelect(c, expr.Exprs[1])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := castType(typeName.value); err != nil {
+		return nil, err
+	}
+	node := NewFuncSelectNode("cast", []*LogicalSelectNode{arg, typeName}, alias)
+	return &node, nil
+}
+
+// Parse a window function call, rewritten into a call of window_over by
+// [rewriteWindowFunctions].
+func parseWindowExpr(c *parseContext, expr *sqlparser.FuncExpr, alias string) (*LogicalSelectNode, error) {
+	argExpr := func(e sqlparser.SelectExpr) sqlparser.Expr {
+		if aliased, ok := e.(*sqlparser.AliasedExpr); ok {
+			return aliased.Expr
+		}
+		return nil
+	}
+	var call *sqlparser.FuncExpr
+	if len(expr.Exprs) > 0 {
+		call, _ = argExpr(expr.Exprs[0]).(*sqlparser.FuncExpr)
+	}
+	if call == nil {
+		return nil, GoDBError{ParseError, "OVER must follow a function call"}
+	}
+	funName := strings.ToLower(sqlparser.String(call.Name))
+	args := make([]*LogicalSelectNode, len(call.Exprs))
+	for i, arg := range call.Exprs {
+		if star, ok := arg.(*sqlparser.StarExpr); ok {
+			if funName != "count" {
+				return nil, GoDBError{ParseError, fmt.Sprintf("got * in window function %s", funName)}
+			}
+			field := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
+			args[i] = &field
+			continue
+		}
+		a, err := parseSelect(c, arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = a
+	}
+
+	window := &LogicalWindowNode{}
+	for _, e := range expr.Exprs[1:] {
+		clause, ok := argExpr(e).(*sqlparser.FuncExpr)
+		if !ok {
+			return nil, GoDBError{ParseError, "malformed window specification"}
+		}
+		switch strings.ToLower(sqlparser.String(clause.Name)) {
+		case "window_partition":
+			for _, p := range clause.Exprs {
+				pby, err := parseSelect(c, p)
+				if err != nil {
+					return nil, err
+				}
+				window.partitionBy = append(window.partitionBy, pby)
+			}
+			window.spec += sqlparser.String(clause)
+		case "window_order":
+			for i := 0; i+1 < len(clause.Exprs); i += 2 {
+				oby, err := parseSelect(c, clause.Exprs[i])
+				if err != nil {
+					return nil, err
+				}
+				dir := strings.Trim(sqlparser.String(argExpr(clause.Exprs[i+1])), "'")
+				window.orderBy = append(window.orderBy, &OrderByNode{oby, dir == "asc"})
+			}
+			window.spec += sqlparser.String(clause)
+		case "window_frame":
+			var bounds [2]string
+			for i := 0; i < 2 && i < len(clause.Exprs); i++ {
+				bounds[i] = strings.Trim(sqlparser.String(argExpr(clause.Exprs[i])), "'")
+			}
+			lo, _ := strconv.Atoi(bounds[0])
+			hi, _ := strconv.Atoi(bounds[1])
+			window.frame = NewWindowFrame(lo, bounds[0] == "unbounded", hi, bounds[1] == "unbounded")
+		default:
+			return nil, GoDBError{ParseError, "malformed window specification"}
+		}
+	}
+	node := NewWindowSelectNode(funName, args, window, alias)
+	return &node, nil
+}
+
+// Return the window functions in s.
+func extractWindows(s *LogicalSelectNode) []*LogicalSelectNode {
+	switch s.exprType {
+	case ExprWindow:
+		return []*LogicalSelectNode{s}
+	case ExprFunc:
+		var windows []*LogicalSelectNode
+		for _, subs := range s.args {
+			windows = append(windows, extractWindows(subs)...)
+		}
+		return windows
+	}
+	return nil
+}
+
 func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
 	switch s.exprType {
 	case ExprAggr:
@@ -487,14 +998,16 @@ func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
 	return nil
 }
 
-func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
+func parseStatement(c *parseContext, s *sqlparser.Select) (*LogicalPlan, error) {
 	from := s.From
 	var (
 		tables   []*LogicalTableNode
 		subplans []*LogicalPlan
 		joins    []*LogicalJoinNode
 		filters  []*LogicalFilterNode
+		sqs      []*LogicalSubqueryNode
 		aggs     []*LogicalSelectNode
+		windows  []*LogicalSelectNode
 	)
 
 	for _, t := range from {
@@ -517,12 +1030,13 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 					}
 		*/
 		//}
-		newFilters, newJoins, err := parseWhere(c, subplans, tables, where.Expr)
+		newFilters, newJoins, newSqs, err := parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
 			return nil, err
 		}
 		joins = append(joins, newJoins...)
 		filters = append(filters, newFilters...)
+		sqs = append(sqs, newSqs...)
 	}
 	//extract select list
 
@@ -534,6 +1048,7 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		}
 		selects[i] = sel
 		aggs = append(aggs, extractAggs(sel)...)
+		windows = append(windows, extractWindows(sel)...)
 	}
 
 	var groupBys = make([]*GroupBy, len(s.GroupBy))
@@ -545,45 +1060,991 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		groupBys[i] = &GroupBy{expr}
 	}
 
-	var orderBys = make([]*OrderByNode, len(s.OrderBy))
-	for i, oby := range s.OrderBy {
+	orderBys, limExpr, err := parseOrderByLimit(c, s.OrderBy, s.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	p := LogicalPlan{filters, sqs, joins, selects, aggs, windows, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", "", nil, nil}
+
+	return &p, nil
+}
+
+// Parse the ORDER BY and LIMIT clauses of a SELECT statement.
+func parseOrderByLimit(c *parseContext, orderBy sqlparser.OrderBy, lim *sqlparser.Limit) ([]*OrderByNode, *LogicalSelectNode, error) {
+	var orderBys = make([]*OrderByNode, len(orderBy))
+	for i, oby := range orderBy {
 		expr, err := parseExpr(c, oby.Expr, "")
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		orderBys[i] = &OrderByNode{expr, oby.Direction == sqlparser.AscScr}
 	}
 
-	lim := s.Limit
 	var limExpr *LogicalSelectNode
 	if lim != nil {
 		var err error
 		limExpr, err = parseExpr(c, lim.Rowcount, "")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return orderBys, limExpr, nil
+}
+
+// Parse a SELECT statement, which may combine several SELECTs with UNION, into
+// a logical plan.
+func parseSelectStatement(c *parseContext, stmt sqlparser.SelectStatement) (*LogicalPlan, error) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		return parseStatement(c, stmt)
+	case *sqlparser.ParenSelect:
+		return parseSelectStatement(c, stmt.Select)
+	case *sqlparser.Union:
+		left, err := parseSelectStatement(c, stmt.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseSelectStatement(c, stmt.Right)
+		if err != nil {
+			return nil, err
+		}
+		plan := newSetOpPlan(UnionSetOp, stmt.Type == sqlparser.UnionAllStr, left, right)
+		plan.orderByFields, plan.limit, err = parseOrderByLimit(c, stmt.OrderBy, stmt.Limit)
 		if err != nil {
 			return nil, err
 		}
+		return plan, nil
 	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported select statement %s", sqlparser.String(stmt))}
+}
 
-	p := LogicalPlan{filters, joins, selects, aggs, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", ""}
+func newSetOpPlan(op SetOpType, all bool, left *LogicalPlan, right *LogicalPlan) *LogicalPlan {
+	return &LogicalPlan{setOp: &LogicalSetOpNode{op, all, left, right}}
+}
 
-	return &p, nil
+// A LogicalRecursiveNode is a recursive common table expression named name.
+// Its result is the result of base, and of repeatedly evaluating step, which
+// reads the tuples produced by the previous iteration from the working table,
+// until step produces no new tuples.
+type LogicalRecursiveNode struct {
+	name    string
+	all     bool
+	base    *LogicalPlan
+	step    *LogicalPlan
+	working *DBFile //the file of the working table read by step, set when the plan is built
 }
 
-// Given a table name tab, a field name, and a map between table names and operators, do one of the following:
-// 1. Return the operator corresponding to tab, if it exists
-// 2. Return the operator corresponding to the table of the field, if it exists
-//
-// Always updates the map to include the field's table if it is not already present
-func fieldToOp(tab string, field string, opMap map[string]*PlanNode) (*PlanNode, error) {
-	node := opMap[tab]
+func (r *LogicalRecursiveNode) getBase() *LogicalPlan {
+	if r == nil {
+		return nil
+	}
+	return r.base
+}
 
-	if node == nil && tab != "" {
-		return nil, GoDBError{ParseError, fmt.Sprintf("no table in catalog matching '%s'", tab)}
+// A cteBinding is a common table expression that is in scope while a query is
+// parsed. References to its name in a FROM clause resolve to plan, or, within
+// the recursive step of a recursive CTE, to the working table.
+type cteBinding struct {
+	plan    *LogicalPlan
+	working *DBFile
+}
+
+// The text of a common table expression, as split off a query by [splitWith].
+type cteText struct {
+	name    string
+	columns []string
+	body    string
+}
+
+// Return the length of the identifier at the start of s.
+func identifierLength(s string) int {
+	n := 0
+	for n < len(s) && isWordByte(s[n]) {
+		n++
 	}
-	if node == nil {
-		for _, candNode := range opMap {
-			if candNode == node {
-				continue
+	return n
+}
+
+// Split the WITH clause off of query. Returns whether the clause is WITH
+// RECURSIVE, the common table expressions it defines, and the remaining
+// query. If query has no WITH clause, returns no common table expressions and
+// the unchanged query.
+func splitWith(query string) (bool, []cteText, string, error) {
+	rest := strings.TrimLeft(query, " \t\r\n")
+	n := matchKeyword(rest, "with")
+	if n == 0 {
+		return false, nil, query, nil
+	}
+	rest = strings.TrimLeft(rest[n:], " \t\r\n")
+	recursive := false
+	if n := matchKeyword(rest, "recursive"); n > 0 {
+		recursive = true
+		rest = rest[n:]
+	}
+
+	var ctes []cteText
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		n := identifierLength(rest)
+		if n == 0 {
+			return false, nil, "", GoDBError{ParseError, "expected name of common table expression after WITH"}
+		}
+		cte := cteText{name: strings.ToLower(rest[:n])}
+		rest = strings.TrimLeft(rest[n:], " \t\r\n")
+		if strings.HasPrefix(rest, "(") {
+			end := matchingParen(rest, 0)
+			if end < 0 {
+				return false, nil, "", GoDBError{ParseError, fmt.Sprintf("unterminated column list of %s", cte.name)}
+			}
+			for _, col := range splitTopLevel(rest[1:end]) {
+				cte.columns = append(cte.columns, strings.ToLower(strings.TrimSpace(col)))
+			}
+			rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+		}
+		n = matchKeyword(rest, "as")
+		rest = strings.TrimLeft(rest[n:], " \t\r\n")
+		if n == 0 || !strings.HasPrefix(rest, "(") {
+			return false, nil, "", GoDBError{ParseError, fmt.Sprintf("expected AS (query) after %s", cte.name)}
+		}
+		end := matchingParen(rest, 0)
+		if end < 0 {
+			return false, nil, "", GoDBError{ParseError, fmt.Sprintf("unterminated query of %s", cte.name)}
+		}
+		cte.body = rest[1:end]
+		ctes = append(ctes, cte)
+		rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+		if !strings.HasPrefix(rest, ",") {
+			return recursive, ctes, rest, nil
+		}
+		rest = rest[1:]
+	}
+}
+
+// Name the output fields of plan after columns, by aliasing its select list.
+func renameColumns(plan *LogicalPlan, name string, columns []string) error {
+	for plan.setOp != nil || plan.recursive != nil {
+		if plan.setOp != nil {
+			plan = plan.setOp.left
+		} else {
+			plan = plan.recursive.base
+		}
+	}
+	if len(plan.selects) != len(columns) {
+		return GoDBError{ParseError, fmt.Sprintf("%s has %d columns, but its query returns %d", name, len(columns), len(plan.selects))}
+	}
+	for i, s := range plan.selects {
+		if s.exprType == ExprStar {
+			return GoDBError{ParseError, fmt.Sprintf("cannot name the columns of %s, whose query selects *", name)}
+		}
+		s.alias = columns[i]
+	}
+	return nil
+}
+
+// Parse the query of a common table expression. Under WITH RECURSIVE, a query
+// that is the UNION of two SELECTs is a recursive CTE, whose right side may
+// refer to the CTE itself.
+func parseCTE(c *parseContext, cte cteText, recursive bool) (*LogicalPlan, error) {
+	if recursive && !hasIntersectOrExcept(cte.body) {
+		stmt, err := sqlparser.Parse(cte.body)
+		if err != nil {
+			return nil, err
+		}
+		if union, ok := stmt.(*sqlparser.Union); ok {
+			base, err := parseSelectStatement(c, union.Left)
+			if err != nil {
+				return nil, err
+			}
+			if cte.columns != nil {
+				if err := renameColumns(base, cte.name, cte.columns); err != nil {
+					return nil, err
+				}
+			}
+			var working DBFile
+			c.ctes[cte.name] = &cteBinding{working: &working}
+			step, err := parseSelectStatement(c, union.Right)
+			delete(c.ctes, cte.name)
+			if err != nil {
+				return nil, err
+			}
+			if len(union.OrderBy) > 0 || union.Limit != nil {
+				return nil, GoDBError{ParseError, fmt.Sprintf("ORDER BY and LIMIT are not supported in recursive query %s", cte.name)}
+			}
+			node := &LogicalRecursiveNode{cte.name, union.Type == sqlparser.UnionAllStr, base, step, &working}
+			return &LogicalPlan{recursive: node}, nil
+		}
+	}
+	plan, err := parseQuery(c, cte.body)
+	if err != nil {
+		return nil, err
+	}
+	if cte.columns != nil {
+		if err := renameColumns(plan, cte.name, cte.columns); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// Parse a SELECT query into a logical plan. The query may start with a WITH
+// clause, and may combine SELECTs with set operations.
+func parseQuery(c *parseContext, query string) (*LogicalPlan, error) {
+	recursive, ctes, query, err := splitWith(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(ctes) > 0 {
+		// common table expressions are only in scope of the query they are
+		// defined for
+		outer := c.ctes
+		c.ctes = make(map[string]*cteBinding)
+		for name, b := range outer {
+			c.ctes[name] = b
+		}
+		defer func() { c.ctes = outer }()
+	}
+	for _, cte := range ctes {
+		plan, err := parseCTE(c, cte, recursive)
+		if err != nil {
+			return nil, err
+		}
+		c.ctes[cte.name] = &cteBinding{plan: plan}
+	}
+
+	query, err = hoistSetOperations(c, query)
+	if err != nil {
+		return nil, err
+	}
+	if hasIntersectOrExcept(query) {
+		return parseSetOperations(c, query)
+	}
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, GoDBError{ParseError, "expected a select statement"}
+	}
+	return parseSelectStatement(c, sel)
+}
+
+// A set operation keyword found by [splitSetOperations].
+type setOpToken struct {
+	op  SetOpType
+	all bool
+}
+
+var setOpKeywords = []struct {
+	word string
+	op   SetOpType
+}{{"union", UnionSetOp}, {"intersect", IntersectSetOp}, {"except", ExceptSetOp}}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// Return the length of the keyword word at the start of s, or 0 if s does not
+// start with it.
+func matchKeyword(s string, word string) int {
+	if len(s) < len(word) || !strings.EqualFold(s[:len(word)], word) {
+		return 0
+	}
+	if len(s) > len(word) && isWordByte(s[len(word)]) {
+		return 0
+	}
+	return len(word)
+}
+
+// Split query at the UNION, INTERSECT and EXCEPT keywords that are not nested
+// in parentheses or quotes. Returns the operands, and the set operations
+// between consecutive operands.
+//
+// sqlparser only understands UNION, so queries that use INTERSECT or EXCEPT
+// are split with this function and their operands are parsed separately.
+func splitSetOperations(query string) ([]string, []setOpToken) {
+	var operands []string
+	var ops []setOpToken
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+			continue
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && isWordByte(query[i-1])) {
+			continue
+		}
+		for _, kw := range setOpKeywords {
+			n := matchKeyword(query[i:], kw.word)
+			if n == 0 {
+				continue
+			}
+			tok := setOpToken{op: kw.op}
+			end := i + n
+			rest := strings.TrimLeft(query[end:], " \t\r\n")
+			if m := matchKeyword(rest, "all"); m > 0 {
+				tok.all = true
+				end = len(query) - len(rest) + m
+			} else if m := matchKeyword(rest, "distinct"); m > 0 {
+				end = len(query) - len(rest) + m
+			}
+			operands = append(operands, query[start:i])
+			ops = append(ops, tok)
+			start = end
+			i = end - 1
+			break
+		}
+	}
+	operands = append(operands, query[start:])
+	return operands, ops
+}
+
+// Parse a query that combines SELECT statements with INTERSECT or EXCEPT.
+// INTERSECT binds more tightly than UNION and EXCEPT, which are evaluated from
+// left to right. An ORDER BY or LIMIT on the last operand applies to the
+// combined result.
+func parseSetOperations(c *parseContext, query string) (*LogicalPlan, error) {
+	operands, ops := splitSetOperations(query)
+	plans := make([]*LogicalPlan, len(operands))
+	var orderBy sqlparser.OrderBy
+	var limit *sqlparser.Limit
+	for i, operand := range operands {
+		stmt, err := sqlparser.Parse(operand)
+		if err != nil {
+			return nil, err
+		}
+		sel, ok := stmt.(sqlparser.SelectStatement)
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("operand of set operation is not a select statement: %s", operand)}
+		}
+		if s, ok := sel.(*sqlparser.Select); ok && i == len(operands)-1 {
+			orderBy, limit = s.OrderBy, s.Limit
+			s.OrderBy, s.Limit = nil, nil
+		}
+		plans[i], err = parseSelectStatement(c, sel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// combine the operands of INTERSECT first
+	combined := []*LogicalPlan{plans[0]}
+	var rest []setOpToken
+	for i, tok := range ops {
+		if tok.op == IntersectSetOp {
+			last := len(combined) - 1
+			combined[last] = newSetOpPlan(tok.op, tok.all, combined[last], plans[i+1])
+		} else {
+			combined = append(combined, plans[i+1])
+			rest = append(rest, tok)
+		}
+	}
+	plan := combined[0]
+	for i, tok := range rest {
+		plan = newSetOpPlan(tok.op, tok.all, plan, combined[i+1])
+	}
+
+	var err error
+	plan.orderByFields, plan.limit, err = parseOrderByLimit(c, orderBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Report whether query uses INTERSECT or EXCEPT outside of a subquery.
+func hasIntersectOrExcept(query string) bool {
+	_, ops := splitSetOperations(query)
+	for _, tok := range ops {
+		if tok.op != UnionSetOp {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace each parenthesized query in query that combines SELECTs with
+// INTERSECT or EXCEPT, such as a subquery in FROM or IN, by a SELECT from a
+// common table expression bound to its plan, since sqlparser cannot parse
+// them. The query of an INSERT ... SELECT that uses them is replaced in the
+// same way.
+func hoistSetOperations(c *parseContext, query string) (string, error) {
+	insert := matchKeyword(strings.TrimLeft(query, " \t\r\n"), "insert") > 0
+	var quote byte
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+			continue
+		case ')':
+			depth--
+			continue
+		case '(':
+			end := matchingParen(query, i)
+			if end < 0 || !hasIntersectOrExcept(query[i+1:end]) {
+				depth++
+				continue
+			}
+			sel, err := bindSetOperation(c, query[i+1:end])
+			if err != nil {
+				return "", err
+			}
+			sel = "(" + sel + ")"
+			query = query[:i] + sel + query[end+1:]
+			i += len(sel) - 1
+			continue
+		}
+		if insert && depth == 0 && (i == 0 || !isWordByte(query[i-1])) && matchKeyword(query[i:], "select") > 0 {
+			if !hasIntersectOrExcept(query[i:]) {
+				insert = false
+				continue
+			}
+			sel, err := bindSetOperation(c, query[i:])
+			if err != nil {
+				return "", err
+			}
+			return query[:i] + sel, nil
+		}
+	}
+	return query, nil
+}
+
+// Parse query as a common table expression of c, under a name that is not
+// otherwise in use, and return a SELECT of its columns from it. The columns
+// are named, rather than selected with *, if the first SELECT of query names
+// them all, so that the SELECT may be an IN subquery.
+func bindSetOperation(c *parseContext, query string) (string, error) {
+	plan, err := parseQuery(c, query)
+	if err != nil {
+		return "", err
+	}
+	if c.ctes == nil {
+		c.ctes = make(map[string]*cteBinding)
+	}
+	name := ""
+	for n := len(c.ctes); name == ""; n++ {
+		name = fmt.Sprintf("_set_op%d", n)
+		if _, ok := c.ctes[name]; ok {
+			name = ""
+		} else if _, err := c.GetTableInfo(name); err == nil {
+			name = ""
+		}
+	}
+	c.ctes[name] = &cteBinding{plan: plan}
+
+	first := plan
+	for first.setOp != nil || first.recursive != nil {
+		if first.setOp != nil {
+			first = first.setOp.left
+		} else {
+			first = first.recursive.base
+		}
+	}
+	columns := make([]string, len(first.selects))
+	for i, s := range first.selects {
+		switch {
+		case s.alias != "":
+			columns[i] = s.alias
+		case s.exprType == ExprField:
+			columns[i] = s.field
+		default:
+			return "select * from " + name, nil
+		}
+	}
+	return fmt.Sprintf("select %s from %s", strings.Join(columns, ", "), name), nil
+}
+
+// Find the first OVER keyword in query that is not quoted and is followed by a
+// parenthesized window specification. Returns the index of the keyword and of
+// the opening parenthesis, or -1, -1 if there is none.
+func findOver(query string) (int, int) {
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		if ch == '\'' || ch == '"' || ch == '`' {
+			quote = ch
+			continue
+		}
+		if i > 0 && isWordByte(query[i-1]) {
+			continue
+		}
+		n := matchKeyword(query[i:], "over")
+		if n == 0 {
+			continue
+		}
+		rest := strings.TrimLeft(query[i+n:], " \t\r\n")
+		if strings.HasPrefix(rest, "(") {
+			return i, len(query) - len(rest)
+		}
+	}
+	return -1, -1
+}
+
+// Return the index of the parenthesis that matches the one at s[paren],
+// scanning forwards from an opening parenthesis or backwards from a closing
+// one, and skipping quoted strings. Returns -1 if there is none.
+func matchingParen(s string, paren int) int {
+	step := 1
+	if s[paren] == ')' {
+		step = -1
+	}
+	depth := 0
+	var quote byte
+	for i := paren; i >= 0 && i < len(s); i += step {
+		ch := s[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+		case '(', ')':
+			if (ch == '(') == (step == 1) {
+				depth++
+			} else {
+				depth--
+			}
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Split s at the commas that are not nested in parentheses or quotes.
+func splitTopLevel(s string) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Rewrite each window function call fn(args) OVER (spec) in query into
+//
+//	window_over(fn(args), window_partition(...), window_order(e, 'desc', ...), window_frame('lo', 'hi'))
+//
+// since sqlparser does not support window functions. The partition, order and
+// frame calls are only present if spec has the corresponding clause.
+// [parseWindowExpr] turns the rewritten calls into window expressions.
+func rewriteWindowFunctions(query string) (string, error) {
+	for {
+		over, open := findOver(query)
+		if over < 0 {
+			return query, nil
+		}
+		call := strings.TrimRight(query[:over], " \t\r\n")
+		if !strings.HasSuffix(call, ")") {
+			return "", GoDBError{ParseError, "OVER must follow a function call"}
+		}
+		argsOpen := matchingParen(query, len(call)-1)
+		nameStart := len(strings.TrimRight(query[:max(argsOpen, 0)], " \t\r\n"))
+		nameEnd := nameStart
+		for nameStart > 0 && isWordByte(query[nameStart-1]) {
+			nameStart--
+		}
+		if argsOpen < 0 || nameStart == nameEnd {
+			return "", GoDBError{ParseError, "OVER must follow a function call"}
+		}
+		specClose := matchingParen(query, open)
+		if specClose < 0 {
+			return "", GoDBError{ParseError, "unterminated window specification"}
+		}
+		spec, err := rewriteWindowSpec(query[open+1 : specClose])
+		if err != nil {
+			return "", err
+		}
+		query = query[:nameStart] + "window_over(" + call[nameStart:] + spec + ")" + query[specClose+1:]
+	}
+}
+
+// Rewrite the body of an OVER clause into the arguments of window_over, see
+// [rewriteWindowFunctions].
+func rewriteWindowSpec(spec string) (string, error) {
+	type clause struct {
+		keyword    string
+		start, end int
+	}
+	var clauses []clause
+	var quote byte
+	depth := 0
+	for i := 0; i < len(spec); i++ {
+		ch := spec[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+			continue
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && isWordByte(spec[i-1])) {
+			continue
+		}
+		for _, kw := range []string{"partition", "order", "rows", "range"} {
+			n := matchKeyword(spec[i:], kw)
+			if n == 0 {
+				continue
+			}
+			end := i + n
+			if kw == "partition" || kw == "order" {
+				rest := strings.TrimLeft(spec[end:], " \t\r\n")
+				m := matchKeyword(rest, "by")
+				if m == 0 {
+					return "", GoDBError{ParseError, fmt.Sprintf("expected BY after %s in window specification", strings.ToUpper(kw))}
+				}
+				end = len(spec) - len(rest) + m
+			}
+			if len(clauses) > 0 {
+				clauses[len(clauses)-1].end = i
+			}
+			clauses = append(clauses, clause{kw, end, len(spec)})
+			i = end - 1
+			break
+		}
+	}
+	if len(clauses) == 0 && strings.TrimSpace(spec) != "" {
+		return "", GoDBError{ParseError, fmt.Sprintf("unsupported window specification (%s)", spec)}
+	}
+
+	var b strings.Builder
+	for _, cl := range clauses {
+		body := strings.TrimSpace(spec[cl.start:cl.end])
+		switch cl.keyword {
+		case "partition":
+			b.WriteString(", window_partition(" + body + ")")
+		case "order":
+			items := splitTopLevel(body)
+			for i, item := range items {
+				item = strings.TrimSpace(item)
+				dir := "asc"
+				words := strings.Fields(item)
+				if last := strings.ToLower(words[len(words)-1]); len(words) > 1 && (last == "asc" || last == "desc") {
+					dir = last
+					item = strings.TrimSpace(item[:len(item)-len(last)])
+				}
+				items[i] = fmt.Sprintf("%s, '%s'", item, dir)
+			}
+			b.WriteString(", window_order(" + strings.Join(items, ", ") + ")")
+		case "rows", "range":
+			lo, hi, err := parseWindowFrameBounds(body)
+			if err != nil {
+				return "", err
+			}
+			if cl.keyword == "range" {
+				// RANGE frames other than the default are not supported
+				if lo != "unbounded" || hi != "0" {
+					return "", GoDBError{ParseError, "only ROWS frames are supported in window specifications"}
+				}
+				continue
+			}
+			b.WriteString(fmt.Sprintf(", window_frame('%s', '%s')", lo, hi))
+		}
+	}
+	return b.String(), nil
+}
+
+// Parse the bounds of a frame clause, e.g. "BETWEEN 2 PRECEDING AND CURRENT
+// ROW", into offsets relative to the current row, or "unbounded".
+func parseWindowFrameBounds(frame string) (string, string, error) {
+	words := strings.Fields(strings.ToLower(frame))
+	bound := func(words []string) (string, error) {
+		if len(words) == 2 {
+			switch {
+			case words[0] == "current" && words[1] == "row":
+				return "0", nil
+			case words[0] == "unbounded" && (words[1] == "preceding" || words[1] == "following"):
+				return "unbounded", nil
+			}
+			if n, err := strconv.Atoi(words[0]); err == nil && n >= 0 {
+				switch words[1] {
+				case "preceding":
+					return strconv.Itoa(-n), nil
+				case "following":
+					return strconv.Itoa(n), nil
+				}
+			}
+		}
+		return "", GoDBError{ParseError, fmt.Sprintf("unsupported frame bound %s", strings.Join(words, " "))}
+	}
+	if len(words) > 0 && words[0] == "between" {
+		for i, w := range words {
+			if w == "and" {
+				lo, err := bound(words[1:i])
+				if err != nil {
+					return "", "", err
+				}
+				hi, err := bound(words[i+1:])
+				return lo, hi, err
+			}
+		}
+		return "", "", GoDBError{ParseError, fmt.Sprintf("expected AND in frame %s", frame)}
+	}
+	lo, err := bound(words)
+	return lo, "0", err
+}
+
+// Find the first CAST keyword or :: operator in query that is not quoted.
+// Returns its index and whether it is a CAST, or -1 if there is none.
+func findCast(query string) (int, bool) {
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == ':' && i+1 < len(query) && query[i+1] == ':':
+			return i, false
+		case (i == 0 || !isWordByte(query[i-1])) && matchKeyword(query[i:], "cast") > 0:
+			if strings.HasPrefix(strings.TrimLeft(query[i+4:], " \t\r\n"), "(") {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// Rewrite each CAST(expr AS type) and expr::type in query into
+//
+//	cast_as(expr, 'type')
+//
+// since sqlparser only supports casts to a few MySQL types, and not the ::
+// operator. The operand of :: is the identifier, literal, function call or
+// parenthesized expression immediately preceding it.
+func rewriteCasts(query string) (string, error) {
+	for {
+		pos, isCast := findCast(query)
+		if pos < 0 {
+			return query, nil
+		}
+		if isCast {
+			open := strings.IndexByte(query[pos:], '(') + pos
+			close := matchingParen(query, open)
+			if close < 0 {
+				return "", GoDBError{ParseError, "unterminated CAST"}
+			}
+			body := query[open+1 : close]
+			as := -1
+			var quote byte
+			depth := 0
+			for i := 0; i < len(body); i++ {
+				ch := body[i]
+				if quote != 0 {
+					if ch == quote {
+						quote = 0
+					}
+					continue
+				}
+				switch ch {
+				case '\'', '"', '`':
+					quote = ch
+				case '(':
+					depth++
+				case ')':
+					depth--
+				default:
+					if depth == 0 && (i == 0 || !isWordByte(body[i-1])) && matchKeyword(body[i:], "as") > 0 {
+						as = i
+					}
+				}
+			}
+			if as < 0 {
+				return "", GoDBError{ParseError, fmt.Sprintf("expected AS in CAST(%s)", body)}
+			}
+			query = query[:pos] + "cast_as(" + body[:as] + ", '" + strings.TrimSpace(body[as+2:]) + "')" + query[close+1:]
+			continue
+		}
+
+		// the type following ::, with an optional parenthesized precision
+		typeStart := pos + 2
+		for typeStart < len(query) && query[typeStart] == ' ' {
+			typeStart++
+		}
+		typeEnd := typeStart
+		for typeEnd < len(query) && isWordByte(query[typeEnd]) {
+			typeEnd++
+		}
+		if typeEnd == typeStart {
+			return "", GoDBError{ParseError, "expected a type after ::"}
+		}
+		if rest := strings.TrimLeft(query[typeEnd:], " "); strings.HasPrefix(rest, "(") {
+			open := len(query) - len(rest)
+			if close := matchingParen(query, open); close > 0 {
+				typeEnd = close + 1
+			}
+		}
+
+		// the operand preceding ::
+		end := len(strings.TrimRight(query[:pos], " \t\r\n"))
+		start := end
+		switch {
+		case end == 0:
+		case query[end-1] == ')':
+			start = matchingParen(query, end-1)
+			for start > 0 && isWordByte(query[start-1]) {
+				start--
+			}
+		case query[end-1] == '\'' || query[end-1] == '"':
+			start = strings.LastIndexByte(query[:end-1], query[end-1])
+		default:
+			for start > 0 && (isWordByte(query[start-1]) || query[start-1] == '.') {
+				start--
+			}
+			if start > 0 && query[start-1] == ':' {
+				// a parameter, see [rewritePlaceholders]
+				start--
+			}
+		}
+		if start < 0 || start == end {
+			return "", GoDBError{ParseError, "expected an expression before ::"}
+		}
+		query = query[:start] + "cast_as(" + query[start:end] + ", '" + query[typeStart:typeEnd] + "')" + query[typeEnd:]
+	}
+}
+
+// Return the type named in a CAST or in a catalog entry, e.g.,
+// DECIMAL(10,2), checking the precision and scale of a DECIMAL as
+// [columnType] does.
+func castType(name string) (FieldType, error) {
+	name, args, hasArgs := strings.Cut(strings.ToLower(name), "(")
+	t, ok := DBTypeNames[strings.Join(strings.Fields(name), " ")]
+	if !ok {
+		return FieldType{}, GoDBError{ParseError, fmt.Sprintf("unknown type %s", name)}
+	}
+	if t != DecimalType || !hasArgs {
+		return defaultFieldType(t), nil
+	}
+	precision, scale, hasScale := strings.Cut(strings.TrimSuffix(strings.TrimSpace(args), ")"), ",")
+	if !hasScale {
+		scale = "0"
+	}
+	return decimalType(strings.TrimSpace(precision), strings.TrimSpace(scale))
+}
+
+// Return the type of a column declared with type ct. DECIMAL(p) has scale 0,
+// and DECIMAL the precision maxDecimalPrecision and scale DecimalScale.
+func columnType(ct sqlparser.ColumnType) (FieldType, error) {
+	t, ok := DBTypeNames[strings.ToLower(ct.Type)]
+	if !ok {
+		return FieldType{}, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", ct.Type)}
+	}
+	if t != DecimalType || ct.Length == nil {
+		return defaultFieldType(t), nil
+	}
+	scale := "0"
+	if ct.Scale != nil {
+		scale = string(ct.Scale.Val)
+	}
+	return decimalType(string(ct.Length.Val), scale)
+}
+
+// Return the type t, declared without a precision or scale.
+func defaultFieldType(t DBType) FieldType {
+	if t == DecimalType {
+		return FieldType{Ftype: t, Precision: maxDecimalPrecision, Scale: DecimalScale}
+	}
+	return FieldType{Ftype: t}
+}
+
+// Return the type DECIMAL(precision, scale), checking that its values fit in
+// an int64 and that the scale is at most the precision.
+func decimalType(precision string, scale string) (FieldType, error) {
+	p, err := strconv.Atoi(precision)
+	if err != nil || p < 1 || p > maxDecimalPrecision {
+		return FieldType{}, GoDBError{ParseError, fmt.Sprintf("unsupported DECIMAL precision %s; it must be between 1 and %d", precision, maxDecimalPrecision)}
+	}
+	s, err := strconv.Atoi(scale)
+	if err != nil || s < 0 || s > p {
+		return FieldType{}, GoDBError{ParseError, fmt.Sprintf("unsupported DECIMAL scale %s; it must be between 0 and the precision %d", scale, p)}
+	}
+	return FieldType{Ftype: DecimalType, Precision: p, Scale: s}, nil
+}
+
+// Given a table name tab, a field name, and a map between table names and operators, do one of the following:
+// 1. Return the operator corresponding to tab, if it exists
+// 2. Return the operator corresponding to the table of the field, if it exists
+//
+// Always updates the map to include the field's table if it is not already present
+func fieldToOp(tab string, field string, opMap map[string]*PlanNode) (*PlanNode, error) {
+	node := opMap[tab]
+
+	if node == nil && tab != "" {
+		return nil, GoDBError{ParseError, fmt.Sprintf("no table in catalog matching '%s'", tab)}
+	}
+	if node == nil {
+		for _, candNode := range opMap {
+			if candNode == node {
+				continue
 			}
 			for _, f := range candNode.desc.Fields {
 				if f.Fname == field || field == "*" {
@@ -627,9 +2088,9 @@ type PlanNode struct {
 	desc *TupleDesc
 }
 
-func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, tableMap map[string]*PlanNode) (Expr, string, error) {
+func (s *LogicalSelectNode) generateExpr(c *parseContext, inputDesc *TupleDesc, tableMap map[string]*PlanNode) (Expr, string, error) {
 	switch s.exprType {
-	case ExprAggr:
+	case ExprAggr, ExprWindow:
 		fallthrough
 	case ExprField:
 		var field FieldType
@@ -642,7 +2103,7 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if s.cachedField != nil {
 			field = *s.cachedField
 		} else {
-			fieldNo, err := findFieldInTd(FieldType{s.field, s.table, UnknownType}, inputDesc)
+			fieldNo, err := findFieldInTd(FieldType{s.field, s.table, UnknownType, 0, 0}, inputDesc)
 			// if it doesn't match a field in the descriptor,
 			// look in the underlying tables
 			if err != nil {
@@ -682,10 +2143,29 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		e := FieldExpr{field}
 		return &e, fieldName, nil
 	case ExprConst:
+		if s.param > 0 {
+			if c.params == nil {
+				return nil, "", GoDBError{ParseError, fmt.Sprintf("parameter %s outside of a prepared statement", s.value)}
+			}
+			ce := &ConstExpr{nil, UnknownType}
+			c.params[s.param] = append(c.params[s.param], ce)
+			fieldName := s.value
+			if s.alias != "" {
+				fieldName = s.alias
+			}
+			return ce, fieldName, nil
+		}
 		var fval DBValue
 		constType := StringType
 		intFval, e := strconv.Atoi(s.value)
-		if e == nil {
+		if s.constType != nil {
+			constType = *s.constType
+			v, err := parseValue(constType, s.value)
+			if err != nil {
+				return nil, "", err
+			}
+			fval = v
+		} else if e == nil {
 			constType = IntType
 			fval = IntField{int64(intFval)}
 		} else {
@@ -702,6 +2182,33 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if s.alias != "" {
 			fieldName = s.alias
 		}
+		if *s.funcOp == "cast" {
+			arg, _, err := s.args[0].generateExpr(c, inputDesc, tableMap)
+			if err != nil {
+				return nil, "", err
+			}
+			to, err := castType(s.args[1].value)
+			if err != nil {
+				return nil, "", err
+			}
+			if inferParamType(arg, to.Ftype) {
+				return arg, fieldName, nil
+			}
+			cast, err := newCastExpr(arg, to, true)
+			if err != nil {
+				return nil, "", err
+			}
+			if ce, ok := arg.(*ConstExpr); ok {
+				// fold casts of constants, so that they are checked when the
+				// query is planned
+				v, err := castField(ce.val, to)
+				if err != nil {
+					return nil, "", GoDBError{TypeMismatchError, fmt.Sprintf("%s: %s", exprToStr(cast), err.(GoDBError).errString)}
+				}
+				return &ConstExpr{v, to.Ftype}, fieldName, nil
+			}
+			return cast, fieldName, nil
+		}
 		exprs := make([]*Expr, len(s.args))
 		for i, lsn := range s.args {
 			newExpr, _, err := lsn.generateExpr(c, inputDesc, tableMap)
@@ -711,15 +2218,44 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 			exprs[i] = &newExpr
 		}
 
+		argTypes := make([]DBType, len(exprs))
+		for i, e := range exprs {
+			argTypes[i] = (*e).GetExprType().Ftype
+		}
+		if fType, ok := lookupFunc(*s.funcOp, argTypes); ok && len(fType.argTypes) == len(exprs) {
+			// convert arguments whose types can be implicitly converted
+			for i, argType := range fType.argTypes {
+				inferParamType(*exprs[i], argType)
+				cast, err := NewCastExpr(*exprs[i], argType, false)
+				if err != nil {
+					return nil, "", GoDBError{TypeMismatchError, fmt.Sprintf("argument %d of %s: %s", i+1, *s.funcOp, err.(GoDBError).errString)}
+				}
+				if cast.to.Ftype != (*exprs[i]).GetExprType().Ftype {
+					var e Expr = cast
+					exprs[i] = &e
+				}
+			}
+		}
 		fe := FuncExpr{*s.funcOp, exprs}
 		return &fe, fieldName, nil
+	case ExprOuterRef:
+		if s.outer == nil || s.outer.desc == nil {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("outer reference %s.%s is not bound to an enclosing query", s.table, s.field)}
+		}
+		fieldNo, err := findFieldInTd(FieldType{s.field, s.table, UnknownType, 0, 0}, s.outer.desc)
+		if err != nil {
+			return nil, "", err
+		}
+		fieldName := s.field
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return &OuterRefExpr{s.outer.desc.Fields[fieldNo], s.outer}, fieldName, nil
 	}
 	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
 
 }
 
-const JoinBufferSize int = 10000000
-
 func exprToStr(e Expr) string {
 	switch ex := e.(type) {
 	case *FieldExpr:
@@ -728,8 +2264,26 @@ func exprToStr(e Expr) string {
 			tbl = ex.selectField.TableQualifier + "."
 		}
 		return fmt.Sprintf("%s%s", tbl, ex.selectField.Fname)
+	case *OuterRefExpr:
+		tbl := ""
+		if ex.selectField.TableQualifier != "" {
+			tbl = ex.selectField.TableQualifier + "."
+		}
+		return fmt.Sprintf("outer(%s%s)", tbl, ex.selectField.Fname)
 	case *ConstExpr:
-		return fmt.Sprintf("%v", ex.val)
+		if ex.val == nil {
+			return "?"
+		}
+		if s, ok := ex.val.(StringField); ok {
+			return fmt.Sprintf("'%s'", s.Value)
+		}
+		return valueString(ex.val)
+	case *CastExpr:
+		to := ex.to.Ftype.String()
+		if ex.to.Precision > 0 {
+			to = ex.to.typeName()
+		}
+		return fmt.Sprintf("CAST(%s AS %s)", exprToStr(ex.expr), to)
 	case *FuncExpr:
 		argStr := ""
 		for _, arg := range ex.args {
@@ -769,29 +2323,103 @@ func GetUnexportedField(field reflect.Value) interface{} {
 }
 
 func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent string) {
+	outputPlan(func(_ *OperatorCard, format string, a ...any) { printf(format, a...) }, o, indent)
+}
+
+// Output the plan rooted at o, one operator per line, with printf, which is
+// also passed the operator each line describes.
+func outputPlan(printf func(oc *OperatorCard, format string, a ...any), o Operator, indent string) {
 	oc := o.(*OperatorCard)
 	switch op := oc.Op.(type) {
 	case *EqualityJoin:
-		printf("%sJoin, %+v == %+v, card:%d\n", indent, exprToStr(op.leftField), exprToStr(op.rightField), oc.Cardinality)
+		printf(oc, "%s%s, %s, card:%d, cost:%.0f\n", indent, op.method, op.condition(), oc.Cardinality, oc.Cost)
+		indent = indent + "\t"
+		outputPlan(printf, *op.left, indent)
+		outputPlan(printf, *op.right, indent)
+	case *ThetaJoin:
+		printf(oc, "%s%s, %s, card:%d, cost:%.0f\n", indent, op.method(), op.condition(), oc.Cardinality, oc.Cost)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, *op.left, indent)
-		OutputPhysicalPlan(printf, *op.right, indent)
+		outputPlan(printf, op.left, indent)
+		outputPlan(printf, op.right, indent)
 	case *Project:
 		selectStr := ""
 		for _, ex := range op.selectFields {
 			selectStr += exprToStr(ex) + ","
 		}
-		printf("%sProject %+v -> %+v, card:%d\n", indent, selectStr, op.outputNames, oc.Cardinality)
+		printf(oc, "%sProject %+v -> %+v, card:%d\n", indent, selectStr, op.outputNames, oc.Cardinality)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
+		outputPlan(printf, op.child, indent)
 
 	case *Filter:
-		printf("%sFilter %s %s %s, card:%d", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right), oc.Cardinality)
+		printf(oc, "%sFilter %s %s %s, card:%d, cost:%.0f\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right), oc.Cardinality, oc.Cost)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
+		outputPlan(printf, op.child, indent)
 
 	case *HeapFile:
-		printf("%sHeap Scan %s, card:%d\n", indent, op.BackingFile(), oc.Cardinality)
+		printf(oc, "%sHeap Scan %s, card:%d, cost:%.0f\n", indent, op.BackingFile(), oc.Cardinality, oc.Cost)
+
+	case *AliasOp:
+		printf(oc, "%sSubquery %s, card:%d, cost:%.0f\n", indent, op.alias, oc.Cardinality, oc.Cost)
+		outputPlan(printf, op.child, indent+"\t")
+
+	case *SemiJoin:
+		joinType := "Semi Join"
+		if op.anti {
+			joinType = "Anti Join"
+		}
+		printf(oc, "%s%s, %s, card:%d\n", indent, joinType, op.join.condition(), oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, *op.join.left, indent)
+		outputPlan(printf, *op.join.right, indent)
+
+	case *SubqueryFilter:
+		leftStr := ""
+		if op.left != nil {
+			leftStr = exprToStr(op.left) + " "
+		}
+		if op.kind == SubqueryScalar {
+			leftStr += opToStr(op.op) + " "
+		}
+		correlated := ""
+		if op.outer != nil {
+			correlated = " (correlated)"
+		}
+		printf(oc, "%sSubquery Filter %s%s%s, card:%d\n", indent, leftStr, op.kind, correlated, oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, op.child, indent)
+		outputPlan(printf, op.subquery, indent)
+
+	case *SetOp:
+		all := ""
+		if op.all {
+			all = " ALL"
+		}
+		printf(oc, "%s%s%s, card:%d\n", indent, op.op, all, oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, op.left, indent)
+		outputPlan(printf, op.right, indent)
+
+	case *WindowOp:
+		specStr := ""
+		for _, ex := range op.partitionBy {
+			specStr += exprToStr(ex) + ","
+		}
+		funcStr := ""
+		for _, f := range op.funcs {
+			funcStr += f.alias + ","
+		}
+		printf(oc, "%sWindow %s partition by %s, card:%d\n", indent, funcStr, specStr, oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, op.child, indent)
+
+	case *RecursiveCTE:
+		printf(oc, "%sRecursive CTE, card:%d\n", indent, oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, op.base, indent)
+		outputPlan(printf, op.step, indent)
+
+	case *MemFile:
+		printf(oc, "%sWorking Table Scan, card:%d\n", indent, oc.Cardinality)
 
 	case *OrderBy:
 		orderStr := ""
@@ -801,14 +2429,26 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 				orderStr += ", " + exprToStr(op.orderBy[i])
 			}
 		}
-		printf("%sOrder By %s, card:%d\n", indent, orderStr, oc.Cardinality)
+		printf(oc, "%sOrder By %s, card:%d\n", indent, orderStr, oc.Cardinality)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
+		outputPlan(printf, op.child, indent)
 
 	case *LimitOp:
-		printf("%sLimit %s, card:%d\n", indent, exprToStr(op.limitTups), oc.Cardinality)
+		printf(oc, "%sLimit %s, card:%d\n", indent, exprToStr(op.limitTups), oc.Cardinality)
+		indent = indent + "\t"
+		outputPlan(printf, op.child, indent)
+
+	case *TopN:
+		orderStr := ""
+		for i, e := range op.orderBy {
+			if i > 0 {
+				orderStr += ", "
+			}
+			orderStr += exprToStr(e)
+		}
+		printf(oc, "%sTop-N %s by %s, card:%d\n", indent, exprToStr(op.limitTups), orderStr, oc.Cardinality)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
+		outputPlan(printf, op.child, indent)
 
 	case *Aggregator:
 		gbyStr := ""
@@ -824,12 +2464,12 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 			aggStr += fmt.Sprintf("%s(%s),", reflect.TypeOf(ex), ex.GetTupleDesc().HeaderString(false))
 		}
 
-		printf("%sAggregate, %s %s, card:%d\n", indent, aggStr, gbyStr, oc.Cardinality)
+		printf(oc, "%sAggregate, %s %s, card:%d\n", indent, aggStr, gbyStr, oc.Cardinality)
 		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
+		outputPlan(printf, op.child, indent)
 
 	default:
-		printf("%sUnknown op, %s\n", indent, reflect.TypeOf(op))
+		printf(oc, "%sUnknown op, %s\n", indent, reflect.TypeOf(op))
 	}
 }
 
@@ -841,6 +2481,8 @@ func PrintPhysicalPlan(o Operator, indent string) {
 type OperatorCard struct {
 	Cardinality int
 	Op          Operator
+	Cost        float64          // estimated cost of the operator and its inputs, if known
+	Metrics     *OperatorMetrics // what the operator did when run, if the plan is analyzed
 }
 
 func (o *OperatorCard) Descriptor() *TupleDesc {
@@ -848,6 +2490,9 @@ func (o *OperatorCard) Descriptor() *TupleDesc {
 }
 
 func (o *OperatorCard) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	if o.Metrics != nil {
+		return o.Metrics.iterator(o.Op, tid)
+	}
 	return o.Op.Iterator(tid)
 }
 
@@ -856,7 +2501,7 @@ func NewOperatorCard(op Operator, card int) *OperatorCard {
 	if ok {
 		panic("cannot wrap an operator card in another operator card")
 	}
-	return &OperatorCard{card, op}
+	return &OperatorCard{Cardinality: card, Op: op}
 }
 
 var EnableJoinOptimization = true
@@ -876,12 +2521,32 @@ func (s *DummyStats) EstimateSelectivity(field string, op BoolOp, val DBValue) (
 	return 1.0, nil
 }
 
-type TableAndField struct {
-	table string
-	field string
+// The statistics of the result of a subquery in the FROM clause: the
+// estimated cost and cardinality of its plan.
+type subqueryStats struct {
+	cost float64
+	card int
+}
+
+func (s *subqueryStats) EstimateScanCost() float64 {
+	return s.cost
+}
+
+func (s *subqueryStats) EstimateCardinality(sel float64) int {
+	return int(float64(s.card)*sel + 0.5)
 }
 
-func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
+func (s *subqueryStats) EstimateSelectivity(field string, op BoolOp, val DBValue) (float64, error) {
+	return defaultSelectivity(op), nil
+}
+
+func makePhysicalPlan(c *parseContext, plan *LogicalPlan) (*OperatorCard, error) {
+	if plan.setOp != nil {
+		return makeSetOpPlan(c, plan)
+	}
+	if plan.recursive != nil {
+		return makeRecursivePlan(c, plan)
+	}
 	tableMap := make(map[string]*PlanNode) // mapping from table aliases to operators
 	tableStats := make(map[string]Stats)   // mapping from table aliases to table stats
 	sel := make(map[string]float64)        // mapping from table aliases to selectivities
@@ -891,18 +2556,19 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		cost := subPhysP.Cost
+		subPhysP = NewOperatorCard(NewAliasOp(p.alias, subPhysP), subPhysP.Cardinality)
+		subPhysP.Cost = cost
 		td := subPhysP.Descriptor()
-		td.setTableAlias(p.alias)
 		tableMap[p.alias] = &PlanNode{subPhysP, td}
-		tableStats[p.alias] = &DummyStats{}
+		tableStats[p.alias] = &subqueryStats{cost, subPhysP.Cardinality}
 		sel[p.alias] = 1.0
 	}
 
 	for _, t := range plan.tables {
-		var stats Stats
-		stats = c.GetTableStats(t.tableName)
-		if stats == nil {
-			stats = &DummyStats{}
+		var stats Stats = &DummyStats{}
+		if ts := c.GetTableStats(t.tableName); ts != nil {
+			stats = ts
 		}
 
 		name := t.tableName
@@ -914,63 +2580,96 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		td := (*t.file).Descriptor()
 		td.setTableAlias(name)
 
-		card := 0
-		if stats != nil {
-			card = stats.EstimateCardinality(1.0)
-		}
-		tableMap[name] = &PlanNode{NewOperatorCard(*t.file, card), td}
+		scan := NewOperatorCard(*t.file, stats.EstimateCardinality(1.0))
+		scan.Cost = stats.EstimateScanCost()
+		tableMap[name] = &PlanNode{scan, td}
 		sel[name] = 1.0
 	}
 
-	//now apply each filter to appropriate table
+	//now apply each filter that references a single table to that table, and
+	//defer the others until the tables they reference have been joined
+	var deferred []*LogicalFilterNode
 	for _, f := range plan.filters {
-		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
+		node, err := coveringNode(c, f, tableMap)
 		if err != nil {
 			return nil, err
 		}
-		node, err := fieldToOp(tabName, fieldName, tableMap)
-		if err != nil {
-			return nil, err
+		if node == nil {
+			deferred = append(deferred, f)
+			continue
 		}
-		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
-		if err != nil {
+		if _, err := applyFilter(c, f, node, tableMap, tableStats, sel); err != nil {
 			return nil, err
 		}
-		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
+	}
+
+	//then project the tables whose unused columns the optimizer pruned onto
+	//the columns the query uses
+	for _, t := range plan.tables {
+		if t.columns == nil {
+			continue
+		}
+		name := t.tableName
+		if t.alias != "" {
+			name = t.alias
+		}
+		node := tableMap[name]
+		exprs := make([]Expr, len(t.columns))
+		for i, col := range t.columns {
+			field, err := fieldNameToField(name, col, node)
+			if err != nil {
+				return nil, err
+			}
+			exprs[i] = &FieldExpr{field}
+		}
+		proj, err := NewProjectOp(exprs, t.columns, false, node.op)
 		if err != nil {
 			return nil, err
 		}
+		aliased := NewAliasOp(name, NewOperatorCard(proj, node.op.Cardinality))
+		tableMap[name] = &PlanNode{NewOperatorCard(aliased, node.op.Cardinality), aliased.Descriptor()}
+		tableMap[name].op.Cost = node.op.Cost
+	}
 
-		op := node.op
-		desc := *op.Descriptor()
-		desc.setTableAlias(tabName)
-
-		fieldType := leftExpr.GetExprType()
-		table := fieldType.TableQualifier
-		field := fieldType.Fname
-		table_stats := tableStats[table]
-
-		filterSel := 1.0
-		constExpr, ok := rightExpr.(*ConstExpr)
-		if ok && table_stats != nil {
-			filterSel, err = table_stats.EstimateSelectivity(field, f.predOp, constExpr.val)
+	//group the join predicates by the pair of tables they compare, so that
+	//each group is applied by one join, equalities first
+	type tablePair [2]string
+	pairOf := func(t1, t2 string) tablePair {
+		if t1 > t2 {
+			t1, t2 = t2, t1
 		}
+		return tablePair{t1, t2}
+	}
+	groups := make(map[tablePair][]*LogicalJoinNode)
+	var pairs []tablePair
+	for _, j := range plan.joins {
+		leftName, _, err := j.left.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
 		}
-		sel[table] *= filterSel
-
-		newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, op)
+		rightName, _, err := j.right.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
 		}
-
-		tableMap[table] = &PlanNode{NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel)), &desc}
+		pair := pairOf(leftName, rightName)
+		if groups[pair] == nil {
+			pairs = append(pairs, pair)
+		}
+		groups[pair] = append(groups[pair], j)
 	}
-
-	selects := make(map[TableAndField]*LogicalSelectNode)
-	join_order := make([]*JoinNode, len(plan.joins))
-	for i, j := range plan.joins {
+	join_order := make([]*JoinNode, len(pairs))
+	for i, pair := range pairs {
+		var group, others []*LogicalJoinNode
+		for _, j := range groups[pair] {
+			if j.predOp == OpEq {
+				group = append(group, j)
+			} else {
+				others = append(others, j)
+			}
+		}
+		group = append(group, others...)
+		groups[pair] = group
+		j := group[0]
 		leftName, leftField, err := j.left.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
@@ -991,14 +2690,23 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			return nil, GoDBError{ParseError, fmt.Sprintf("no stats for rhs table %s, join %v, tables %v", rightName, j, tableMap)}
 		}
 
+		var ops []BoolOp
+		if len(group) > 1 || j.predOp != OpEq {
+			for _, pred := range group {
+				op := pred.predOp
+				if table, _, _ := pred.left.getTableField(c, plan.subqueries, plan.tables); table != leftName {
+					op = op.flip()
+				}
+				ops = append(ops, op)
+			}
+		}
 		join_order[i] = &JoinNode{
 			leftTable:  TableInfo{leftName, leftStats, sel[leftName]},
 			leftField:  leftField,
 			rightTable: TableInfo{rightName, rightStats, sel[rightName]},
 			rightField: rightField,
+			ops:        ops,
 		}
-		selects[TableAndField{leftName, leftField}] = j.left
-		selects[TableAndField{rightName, rightField}] = j.right
 	}
 
 	if EnableJoinOptimization {
@@ -1011,56 +2719,85 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 	//finally apply joins
 	for _, j := range join_order {
-		left := selects[TableAndField{j.leftTable.name, j.leftField}]
-		right := selects[TableAndField{j.rightTable.name, j.rightField}]
-
-		lTabName, lFieldName, err := left.getTableField(c, plan.subqueries, plan.tables)
-		if err != nil {
-			return nil, err
-		}
-
-		node1, err := fieldToOp(lTabName, lFieldName, tableMap)
-		if err != nil {
-			return nil, err
-		}
-
-		rTabName, rFieldName, err := right.getTableField(c, plan.subqueries, plan.tables)
+		lTabName, rTabName := j.leftTable.name, j.rightTable.name
+		node1, err := fieldToOp(lTabName, j.leftField, tableMap)
 		if err != nil {
 			return nil, err
 		}
-
-		node2, err := fieldToOp(rTabName, rFieldName, tableMap)
+		node2, err := fieldToOp(rTabName, j.rightField, tableMap)
 		if err != nil {
 			return nil, err
 		}
-
-		/*desc1 := *op1.Descriptor()
-		desc1.setTableAlias(j.t1)
-		desc2 := *op2.Descriptor()
-		desc2.setTableAlias(j.t2)
-		*/
 		op1 := node1.op
 		op2 := node2.op
 
-		/*
-			leftField, _ := fieldNameToField(j.t1, j.f1, node1)
-			rightField, _ := fieldNameToField(j.t2, j.f2, node2)
-		*/
-		leftExpr, _, err := left.generateExpr(c, node1.desc, tableMap)
-		if err != nil {
-			return nil, err
-		}
-		rightExpr, _, err := right.generateExpr(c, node2.desc, tableMap)
-		if err != nil {
-			return nil, err
+		//the expressions of the predicates of the join over each side, and
+		//the comparisons between them
+		var leftExprs, rightExprs, eqLeft, eqRight []Expr
+		var ops []BoolOp
+		for _, pred := range groups[pairOf(lTabName, rTabName)] {
+			left, right, op := pred.left, pred.right, pred.predOp
+			if table, _, _ := left.getTableField(c, plan.subqueries, plan.tables); table != lTabName {
+				left, right, op = right, left, op.flip()
+			}
+			leftExpr, _, err := left.generateExpr(c, node1.desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			rightExpr, _, err := right.generateExpr(c, node2.desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			leftExpr, rightExpr, err = coerceComparison(leftExpr, rightExpr)
+			if err != nil {
+				return nil, err
+			}
+			if op == OpEq && op1 != op2 {
+				eqLeft, eqRight = append(eqLeft, leftExpr), append(eqRight, rightExpr)
+				continue
+			}
+			leftExprs, rightExprs, ops = append(leftExprs, leftExpr), append(rightExprs, rightExpr), append(ops, op)
 		}
 
-		newOp, err := NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
-		if err != nil {
-			return nil, err
+		var newNode *PlanNode
+		bufferSize := joinBufferSize(op1.Descriptor(), op2.Descriptor())
+		switch {
+		case op1 == op2:
+			// both tables are already joined, so the join is a filter on
+			// their join
+			newNode = &PlanNode{op1, node1.desc}
+		case len(eqLeft) > 0:
+			newOp, err := NewCompositeJoin(op1, eqLeft, op2, eqRight, bufferSize)
+			if err != nil {
+				return nil, err
+			}
+			method, cost := chooseJoinMethod(op1.Cardinality, op2.Cardinality, bufferSize)
+			newOp.SetMethod(method)
+			newNode = &PlanNode{NewOperatorCard(newOp, j.estimateCardinality(op1.Cardinality, op2.Cardinality)), newOp.Descriptor()}
+			newNode.op.Cost = op1.Cost + op2.Cost + cost
+		default:
+			newOp, err := NewThetaJoin(op1, leftExprs, ops, op2, rightExprs, bufferSize)
+			if err != nil {
+				return nil, err
+			}
+			newNode = &PlanNode{NewOperatorCard(newOp, j.estimateCardinality(op1.Cardinality, op2.Cardinality)), newOp.Descriptor()}
+			newNode.op.Cost = j.estimateCost(op1.Cardinality, op2.Cardinality, op1.Cost, op2.Cost, bufferSize)
+			leftExprs, rightExprs, ops = nil, nil, nil
+		}
+		// the other comparisons are filters on the join
+		card := newNode.op.Cardinality
+		if op1 == op2 {
+			card = j.estimateFilterCardinality(op1.Cardinality)
+		}
+		for i, op := range ops {
+			newOp, err := NewFilter(rightExprs[i], op, leftExprs[i], newNode.op)
+			if err != nil {
+				return nil, err
+			}
+			cost := newNode.op.Cost + float64(newNode.op.Cardinality)
+			newNode = &PlanNode{NewOperatorCard(newOp, card), newNode.desc}
+			newNode.op.Cost = cost
 		}
-
-		newNode := &PlanNode{NewOperatorCard(newOp, EstimateJoinCardinality(node1.op.Cardinality, node2.op.Cardinality)), newOp.Descriptor()}
 		for key, node := range tableMap {
 			if node.op == op1 {
 				tableMap[key] = newNode
@@ -1071,6 +2808,12 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 		tableMap[lTabName] = newNode
 		tableMap[rTabName] = newNode
+
+		var err2 error
+		deferred, err2 = applyCoveredFilters(c, deferred, tableMap, tableStats, sel)
+		if err2 != nil {
+			return nil, err2
+		}
 	}
 
 	//check that all tables have the same op (all tables are joined)
@@ -1089,6 +2832,25 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 	topOp := curOp
 
+	//filters that reference no table at all are applied to the result of the
+	//joins
+	for _, f := range deferred {
+		node, err := applyFilter(c, f, &PlanNode{topOp, topOp.Descriptor()}, tableMap, tableStats, sel)
+		if err != nil {
+			return nil, err
+		}
+		topOp = node.op
+	}
+	joinCost := topOp.Cost
+
+	for _, sq := range plan.subqueryFilters {
+		op, err := planSubqueryFilter(c, sq, topOp, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(op, topOp.Cardinality)
+	}
+
 	//var fieldList []FieldType
 	var fieldNames []string
 	hasAgg := len(plan.aggs) > 0
@@ -1121,8 +2883,6 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			*/
 
 			if s.exprType == ExprAggr {
-				var as AggState
-
 				tabName, fieldName, err := s.args[0].getTableField(c, plan.subqueries, plan.tables)
 				if err != nil {
 					return nil, err
@@ -1135,21 +2895,11 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 				if err != nil {
 					return nil, err
 				}
+				var as AggState
 
-				switch *s.funcOp {
-				case "max":
-					as = &MaxAggState{}
-
-				case "min":
-					as = &MinAggState{}
-				case "avg":
-					as = &AvgAggState{}
-				case "sum":
-					as = &SumAggState{}
-				case "count":
-					as = &CountAggState{}
-				default:
-					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
+				as, err = newAggState(*s.funcOp)
+				if err != nil {
+					return nil, err
 				}
 
 				//make sure name has unique id
@@ -1187,6 +2937,14 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 	}
 
+	if len(plan.windows) > 0 {
+		var err error
+		topOp, err = planWindows(c, plan, topOp, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	exprList := make([]Expr, len(plan.selects))
 	for i, s := range plan.selects {
 		switch s.exprType {
@@ -1203,66 +2961,460 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			fieldNames = append(fieldNames, field)
 		}
 	}
-	if !selectAll {
-		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
-		if err != nil {
-			return nil, err
-		}
-		topOp = NewOperatorCard(projOp, topOp.Cardinality)
+	if !selectAll {
+		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(projOp, topOp.Cardinality)
+	}
+
+	topOp, err := planOrderByLimit(c, plan, topOp, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	// the operators above the joins and filters are not costed, so the cost
+	// of the plan is that of its joins and filters
+	if topOp.Cost == 0 {
+		topOp.Cost = joinCost
+	}
+	return topOp, nil
+}
+
+// Return the plan node that covers all the fields referenced by filter f, or
+// nil if they are in different nodes, or if f references no fields at all.
+func coveringNode(c *parseContext, f *LogicalFilterNode, tableMap map[string]*PlanNode) (*PlanNode, error) {
+	var node *PlanNode
+	for _, ref := range append(f.fieldExpr.fieldRefs(), f.constExpr.fieldRefs()...) {
+		refNode, err := fieldToOp(ref.table, ref.field, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil && node.op != refNode.op {
+			return nil, nil
+		}
+		node = refNode
+	}
+	return node, nil
+}
+
+// Apply filter f on top of node, replacing node in tableMap, and update the
+// selectivity of the table it filters. Returns the new node.
+//
+// The selectivity is estimated from the table's stats for filters that compare
+// a field with a constant, and assumed to be 1 otherwise.
+func applyFilter(c *parseContext, f *LogicalFilterNode, node *PlanNode, tableMap map[string]*PlanNode, tableStats map[string]Stats, sel map[string]float64) (*PlanNode, error) {
+	leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	leftExpr, rightExpr, err = coerceComparison(leftExpr, rightExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	op := node.op
+	filterSel := 1.0
+	fieldExpr, constExpr, predOp := leftExpr, rightExpr, f.predOp
+	if _, ok := leftExpr.(*ConstExpr); ok {
+		fieldExpr, constExpr, predOp = rightExpr, leftExpr, f.predOp.flip()
+	}
+	field, isField := fieldExpr.(*FieldExpr)
+	val, isConst := constExpr.(*ConstExpr)
+	if isField && isConst && val.val != nil {
+		table := field.GetExprType().TableQualifier
+		if stats := tableStats[table]; stats != nil {
+			filterSel, err = stats.EstimateSelectivity(field.GetExprType().Fname, predOp, val.val)
+			if err != nil {
+				return nil, err
+			}
+			sel[table] *= filterSel
+		}
+	}
+
+	newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, op)
+	if err != nil {
+		return nil, err
+	}
+	newNode := &PlanNode{NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel)), node.desc}
+	newNode.op.Cost = op.Cost + float64(op.Cardinality)
+	for key, n := range tableMap {
+		if n.op == op {
+			tableMap[key] = newNode
+		}
+	}
+	return newNode, nil
+}
+
+// Apply the filters that are covered by a single node of tableMap, returning
+// the remaining ones.
+func applyCoveredFilters(c *parseContext, filters []*LogicalFilterNode, tableMap map[string]*PlanNode, tableStats map[string]Stats, sel map[string]float64) ([]*LogicalFilterNode, error) {
+	var remaining []*LogicalFilterNode
+	for _, f := range filters {
+		node, err := coveringNode(c, f, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			remaining = append(remaining, f)
+			continue
+		}
+		if _, err := applyFilter(c, f, node, tableMap, tableStats, sel); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// Return an empty aggregation state for the aggregate function funcOp.
+func newAggState(funcOp string) (AggState, error) {
+	switch funcOp {
+	case "max":
+		return &MaxAggState{}, nil
+	case "min":
+		return &MinAggState{}, nil
+	case "avg":
+		return &AvgAggState{}, nil
+	case "sum":
+		return &SumAggState{}, nil
+	case "count":
+		return &CountAggState{}, nil
+	}
+	return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", funcOp)}
+}
+
+// Add a window operator on top of topOp for each distinct window of the window
+// functions of plan, sorting its input on the window's PARTITION BY and ORDER
+// BY clauses.
+func planWindows(c *parseContext, plan *LogicalPlan, topOp *OperatorCard, tableMap map[string]*PlanNode) (*OperatorCard, error) {
+	var specs []string
+	bySpec := make(map[string][]*LogicalSelectNode)
+	for _, w := range plan.windows {
+		if _, ok := bySpec[w.window.spec]; !ok {
+			specs = append(specs, w.window.spec)
+		}
+		bySpec[w.window.spec] = append(bySpec[w.window.spec], w)
+	}
+
+	winCnt := 0
+	for _, spec := range specs {
+		nodes := bySpec[spec]
+		window := nodes[0].window
+		desc := topOp.Descriptor()
+
+		var partitionBy, orderBy, sortExprs []Expr
+		var ascs []bool
+		for _, p := range window.partitionBy {
+			expr, _, err := p.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			partitionBy = append(partitionBy, expr)
+			sortExprs = append(sortExprs, expr)
+			ascs = append(ascs, true)
+		}
+		for _, oby := range window.orderBy {
+			expr, _, err := oby.expr.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			orderBy = append(orderBy, expr)
+			sortExprs = append(sortExprs, expr)
+			ascs = append(ascs, oby.ascending)
+		}
+
+		funcs := make([]*WindowFunc, len(nodes))
+		for i, w := range nodes {
+			args := make([]Expr, len(w.args))
+			for j, arg := range w.args {
+				if arg.field == "*" {
+					// count(*) counts rows, so any expression will do
+					args[j] = &ConstExpr{IntField{1}, IntType}
+					continue
+				}
+				expr, _, err := arg.generateExpr(c, desc, tableMap)
+				if err != nil {
+					return nil, err
+				}
+				args[j] = expr
+			}
+
+			//make sure name has unique id
+			name := fmt.Sprintf("%s()%d", *w.funcOp, winCnt)
+			winCnt++
+			if w.alias != "" {
+				name = w.alias
+			}
+			f, err := newWindowFunc(*w.funcOp, name, args, w.window.frame)
+			if err != nil {
+				return nil, err
+			}
+			funcs[i] = f
+			ft := f.fieldType()
+			w.cachedField = &ft
+		}
+
+		if len(sortExprs) > 0 {
+			orderOp, err := NewOrderBy(sortExprs, topOp, ascs)
+			if err != nil {
+				return nil, err
+			}
+			topOp = NewOperatorCard(orderOp, topOp.Cardinality)
+		}
+		topOp = NewOperatorCard(NewWindowOp(partitionBy, orderBy, funcs, topOp), topOp.Cardinality)
+	}
+	return topOp, nil
+}
+
+// Construct the window function funcOp, named name, over args.
+func newWindowFunc(funcOp string, name string, args []Expr, frame *WindowFrame) (*WindowFunc, error) {
+	wrongArgs := GoDBError{ParseError, fmt.Sprintf("wrong number of arguments to window function %s", funcOp)}
+	switch funcOp {
+	case "row_number", "rank", "dense_rank":
+		if len(args) != 0 {
+			return nil, wrongArgs
+		}
+		fn := map[string]WindowFuncType{"row_number": RowNumberWindow, "rank": RankWindow, "dense_rank": DenseRankWindow}[funcOp]
+		return NewRankingWindowFunc(fn, name)
+	case "lag", "lead":
+		if len(args) == 0 || len(args) > 3 {
+			return nil, wrongArgs
+		}
+		fn := LagWindow
+		if funcOp == "lead" {
+			fn = LeadWindow
+		}
+		offset := int64(1)
+		if len(args) > 1 {
+			v, err := args[1].EvalExpr(&Tuple{})
+			iv, ok := v.(IntField)
+			if err != nil || !ok {
+				return nil, GoDBError{ParseError, fmt.Sprintf("offset of %s must be an integer constant", funcOp)}
+			}
+			offset = iv.Value
+		}
+		// GoDB has no NULLs, so the default defaults to the zero value
+		argType := args[0].GetExprType().Ftype
+		var dflt Expr = &ConstExpr{zeroValue(argType), argType}
+		if len(args) > 2 {
+			dflt = args[2]
+		}
+		return NewOffsetWindowFunc(fn, name, args[0], int(offset), dflt)
+	}
+	if !isAgg(funcOp) {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown window function %s", funcOp)}
+	}
+	if len(args) != 1 {
+		return nil, wrongArgs
+	}
+	as, err := newAggState(funcOp)
+	if err != nil {
+		return nil, err
+	}
+	if err := as.Init(name, args[0]); err != nil {
+		return nil, err
+	}
+	return NewAggWindowFunc(as, frame), nil
+}
+
+// Add the ORDER BY and LIMIT of plan on top of topOp. A LIMIT over an ORDER
+// BY is planned as a [TopN] if the limit is a constant and that many tuples
+// fit in [SortWorkMem]; otherwise it is a [LimitOp] over an [OrderBy], which
+// may sort on disk.
+func planOrderByLimit(c *parseContext, plan *LogicalPlan, topOp *OperatorCard, tableMap map[string]*PlanNode) (*OperatorCard, error) {
+	var exprs []Expr
+	var ascs []bool
+	if len(plan.orderByFields) > 0 {
+
+		exprs = make([]Expr, len(plan.orderByFields))
+		for i, oby := range plan.orderByFields {
+			expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			exprs[i] = expr
+			ascs = append(ascs, oby.ascending)
+
+		}
+	}
+
+	var limit Expr
+	numTups := -1 // not known until the statement is executed
+	if plan.limit != nil {
+		expr, _, err := plan.limit.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		limit = expr
+		if !inferParamType(expr, IntType) {
+			numTupsExpr, err := expr.EvalExpr(&Tuple{})
+			if err != nil {
+				return nil, err
+			}
+			numTups = int(numTupsExpr.(IntField).Value)
+		}
+	}
+
+	if exprs != nil {
+		if limit != nil && numTups >= 0 && numTups <= SortWorkMem/max(bytesPerTuple(topOp.Descriptor()), 1) {
+			return NewOperatorCard(NewTopN(exprs, topOp, ascs, limit), min(numTups, topOp.Cardinality)), nil
+		}
+		orderOp, err := NewOrderBy(exprs, topOp, ascs)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(orderOp, topOp.Cardinality)
+	}
+	if limit != nil {
+		card := topOp.Cardinality
+		if numTups >= 0 {
+			card = min(numTups, card)
+		}
+		topOp = NewOperatorCard(NewLimitOp(limit, topOp), card)
+	}
+	return topOp, nil
+}
+
+// Build the physical plan for a set operation over the plans of its inputs.
+func makeSetOpPlan(c *parseContext, plan *LogicalPlan) (*OperatorCard, error) {
+	left, err := makePhysicalPlan(c, plan.setOp.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := makePhysicalPlan(c, plan.setOp.right)
+	if err != nil {
+		return nil, err
+	}
+	setOp, err := NewSetOp(plan.setOp.op, plan.setOp.all, left, right)
+	if err != nil {
+		return nil, err
+	}
+	var card int
+	switch plan.setOp.op {
+	case UnionSetOp:
+		card = left.Cardinality + right.Cardinality
+	case IntersectSetOp:
+		card = min(left.Cardinality, right.Cardinality)
+	case ExceptSetOp:
+		card = left.Cardinality
+	}
+	return planOrderByLimit(c, plan, NewOperatorCard(setOp, card), make(map[string]*PlanNode))
+}
+
+// Build the physical plan for a recursive CTE. Each plan gets its own working
+// table, so that a CTE that is referenced several times can be evaluated by
+// several operators at once.
+func makeRecursivePlan(c *parseContext, plan *LogicalPlan) (*OperatorCard, error) {
+	r := plan.recursive
+	base, err := makePhysicalPlan(c, r.base)
+	if err != nil {
+		return nil, err
+	}
+	working := &MemFile{desc: base.Descriptor().copy()}
+	working.desc.setTableAlias(r.name)
+	*r.working = working
+	step, err := makePhysicalPlan(c, r.step)
+	if err != nil {
+		return nil, err
+	}
+	recOp, err := NewRecursiveCTE(base, step, working, r.all)
+	if err != nil {
+		return nil, err
 	}
+	// assume the recursion doubles the base case
+	return planOrderByLimit(c, plan, NewOperatorCard(recOp, 2*base.Cardinality), make(map[string]*PlanNode))
+}
 
-	if len(plan.orderByFields) > 0 {
-		var ascs []bool
-
-		exprs := make([]Expr, len(plan.orderByFields))
-		for i, oby := range plan.orderByFields {
-			expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
-			if err != nil {
-				return nil, err
-			}
-			exprs[i] = expr
-			ascs = append(ascs, oby.ascending)
-
-		}
-		orderOp, err := NewOrderBy(exprs, topOp, ascs)
+// Build the operator that evaluates the subquery predicate sq over the tuples
+// of child.
+func planSubqueryFilter(c *parseContext, sq *LogicalSubqueryNode, child Operator, tableMap map[string]*PlanNode) (Operator, error) {
+	var leftExpr Expr
+	if sq.expr != nil {
+		var err error
+		leftExpr, _, err = sq.expr.generateExpr(c, child.Descriptor(), tableMap)
 		if err != nil {
 			return nil, err
 		}
-		topOp = NewOperatorCard(orderOp, topOp.Cardinality)
+	}
+	if sq.outer != nil {
+		sq.outer.desc = child.Descriptor()
+	}
+	subOp, err := makePhysicalPlan(c, sq.subplan)
+	if err != nil {
+		return nil, err
 	}
 
-	if plan.limit != nil {
-		expr, _, err := plan.limit.generateExpr(c, topOp.Descriptor(), tableMap)
-		if err != nil {
-			return nil, err
-		}
-		numTupsExpr, err := expr.EvalExpr(&Tuple{})
-		if err != nil {
-			return nil, err
-		}
-		numTups := numTupsExpr.(IntField).Value
-		topOp = NewOperatorCard(NewLimitOp(expr, topOp), min(int(numTups), topOp.Cardinality))
+	if leftExpr == nil {
+		return NewSubqueryFilter(sq.kind, leftExpr, sq.predOp, subOp, sq.outer, child)
 	}
-	return topOp, nil
+	// compare the values as a filter or a join would, after converting them
+	// to a common type
+	leftExpr, rightExpr, err := coerceComparison(leftExpr, &FieldExpr{subOp.Descriptor().Fields[0]})
+	if err != nil {
+		return nil, err
+	}
+	if sq.semiJoin {
+		anti := sq.kind == SubqueryNotIn || sq.kind == SubqueryNotExists
+		return NewSemiJoin(child, leftExpr, subOp, rightExpr, anti)
+	}
+	return NewSubqueryFilter(sq.kind, leftExpr, sq.predOp, subOp, sq.outer, child)
 }
 
-func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
-	if insStmt.Columns != nil {
-		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
+// Build the plan for an INSERT statement. The inserted values are matched with
+// the columns named in the statement, or with all columns of the table, in
+// order, if it names none; the other columns are filled with their defaults.
+func parseInsert(c *parseContext, insStmt *sqlparser.Insert) (Operator, error) {
+	table, err := c.GetTableInfo(sqlparser.String(insStmt.Table.Name))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkNotMaterialized(table.name, "insert into"); err != nil {
+		return nil, err
 	}
-	tab := insStmt.Table.Name
-	file, err := c.GetTable(sqlparser.String(tab))
+	file := table.file
+	fields := file.Descriptor().Fields
+	positions, numValues, err := insertPositions(table, insStmt.Columns)
 	if err != nil {
 		return nil, err
 	}
+	defaultExpr := func(i int) (Expr, error) {
+		v := table.defaultValue(i)
+		if v == nil && table.notNull(i) != nil {
+			return nil, table.notNull(i).violation(table, fmt.Sprintf("missing value for column %s", fields[i].Fname))
+		}
+		if v == nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("no value for column %s, which has no default", fields[i].Fname)}
+		}
+		return &ConstExpr{v, fields[i].Ftype}, nil
+	}
 
 	switch stmt := insStmt.Rows.(type) {
 	case sqlparser.Values:
 		var exprAr []([]Expr)
 		for _, t := range stmt {
-			var tupAr []Expr
-			for _, e := range t {
-				expr, err := parseExpr(c, e, "")
+			if len(t) != numValues {
+				return nil, GoDBError{ParseError, fmt.Sprintf("INSERT has %d columns but %d values", numValues, len(t))}
+			}
+			tupAr := make([]Expr, len(fields))
+			for i, field := range fields {
+				pos := positions[i]
+				if pos < 0 {
+					if tupAr[i], err = defaultExpr(i); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				if _, ok := t[pos].(*sqlparser.Default); ok {
+					if tupAr[i], err = defaultExpr(i); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				expr, err := parseExpr(c, t[pos], "")
 				if err != nil {
 					return nil, err
 				}
@@ -1270,12 +3422,14 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 				if err != nil {
 					return nil, err
 				}
-				tupAr = append(tupAr, exprOp)
+				if tupAr[i], err = coerceInsertValue(exprOp, field); err != nil {
+					return nil, err
+				}
 			}
 			exprAr = append(exprAr, tupAr)
 		}
 		iterOp := NewValueOp(exprAr)
-		insertOp := NewInsertOp(file, iterOp)
+		insertOp := newTableInsertOp(c.Catalog, table, iterOp)
 		return insertOp, nil
 
 	case *sqlparser.Select:
@@ -1283,18 +3437,80 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
+		plan, err = optimizePlan(c, plan)
+		if err != nil {
+			return nil, err
+		}
 		op, err := makePhysicalPlan(c, plan)
 		if err != nil {
 			return nil, err
 		}
+		selected := op.Descriptor().Fields
+		if len(selected) != numValues {
+			return nil, GoDBError{ParseError, fmt.Sprintf("INSERT has %d columns but SELECT returns %d", numValues, len(selected))}
+		}
+		exprs := make([]Expr, len(fields))
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.Fname
+			if positions[i] < 0 {
+				if exprs[i], err = defaultExpr(i); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if exprs[i], err = coerceInsertValue(&FieldExpr{selected[positions[i]]}, field); err != nil {
+				return nil, err
+			}
+		}
+		projOp, err := NewProjectOp(exprs, names, false, op)
+		if err != nil {
+			return nil, err
+		}
 
-		insertOp := NewInsertOp(file, op)
+		insertOp := newTableInsertOp(c.Catalog, table, projOp)
 		return insertOp, nil
 	}
-	return nil, nil
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported INSERT source %s", sqlparser.String(insStmt.Rows))}
+}
+
+// Return, for each column of table, the position of its value among the
+// values inserted into columns, or -1 if it is not among them, and the number
+// of inserted values. If columns is empty, values are inserted into all
+// columns, in order.
+func insertPositions(table *Table, columns sqlparser.Columns) ([]int, int, error) {
+	fields := table.desc.Fields
+	positions := make([]int, len(fields))
+	if len(columns) == 0 {
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions, len(fields), nil
+	}
+	for i := range positions {
+		positions[i] = -1
+	}
+	for pos, col := range columns {
+		found := false
+		for i, field := range fields {
+			if !strings.EqualFold(field.Fname, col.String()) {
+				continue
+			}
+			if positions[i] >= 0 {
+				return nil, 0, GoDBError{ParseError, fmt.Sprintf("column %s is inserted into more than once", col.String())}
+			}
+			positions[i] = pos
+			found = true
+			break
+		}
+		if !found {
+			return nil, 0, GoDBError{ParseError, fmt.Sprintf("table %s has no column %s", table.name, col.String())}
+		}
+	}
+	return positions, len(columns), nil
 }
 
-func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
+func parseDelete(c *parseContext, delStmt *sqlparser.Delete) (Operator, error) {
 	if len(delStmt.TableExprs) > 1 {
 		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
 	}
@@ -1308,13 +3524,17 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 	if subplans != nil || joins != nil {
 		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
 	}
+	if err := c.checkNotMaterialized(tables[0].tableName, "delete from"); err != nil {
+		return nil, err
+	}
 
 	tableMap := make(map[string]*PlanNode)
 	tableMap[tables[0].tableName] = &PlanNode{&OperatorCard{Op: *tables[0].file, Cardinality: 0}, (*tables[0].file).Descriptor()}
 
 	var filters []*LogicalFilterNode = make([]*LogicalFilterNode, 0)
+	var sqs []*LogicalSubqueryNode
 	if delStmt.Where != nil {
-		filters, joins, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
+		filters, joins, sqs, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
 		if err != nil {
 			return nil, err
 		}
@@ -1341,6 +3561,10 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
+		leftExpr, rightExpr, err = coerceComparison(leftExpr, rightExpr)
+		if err != nil {
+			return nil, err
+		}
 
 		//op := node.op
 		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
@@ -1351,8 +3575,18 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 			return nil, err
 		}
 	}
+	for _, sq := range sqs {
+		newOp, err = planSubqueryFilter(c, sq, newOp, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return NewDeleteOp(*tables[0].file, newOp), nil
+	table, err := c.GetTableInfo(tables[0].tableName)
+	if err != nil {
+		return nil, err
+	}
+	return newTableDeleteOp(c.Catalog, table, newOp), nil
 }
 
 type QueryType int
@@ -1365,45 +3599,459 @@ const (
 	CreateTableQueryType QueryType = iota
 	DropTableQueryType   QueryType = iota
 	UnknownQueryType     QueryType = iota
+	AlterTableQueryType  QueryType = iota
+	CreateViewQueryType  QueryType = iota
+	DropViewQueryType    QueryType = iota
+	RefreshViewQueryType QueryType = iota
+	AnalyzeQueryType     QueryType = iota
 )
 
-func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
+// sqlparser does not know the BOOL and BOOLEAN column types, so rewrite them
+// to BIT in CREATE TABLE statements.
+func rewriteBooleanColumns(query string) string {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if matchKeyword(trimmed, "create") == 0 {
+		return query
+	}
+	var out strings.Builder
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case i == 0 || !isWordByte(query[i-1]):
+			if n := max(matchKeyword(query[i:], "boolean"), matchKeyword(query[i:], "bool")); n > 0 {
+				out.WriteString("bit")
+				i += n - 1
+				continue
+			}
+		}
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
+
+// sqlparser does not support CHECK constraints, so remove the [CONSTRAINT
+// name] CHECK (expr) clauses from a CREATE TABLE statement, returning them
+// separately.
+func extractChecks(query string) (string, []checkClause, error) {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if matchKeyword(trimmed, "create") == 0 {
+		return query, nil, nil
+	}
+	var out strings.Builder
+	var checks []checkClause
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case i == 0 || !isWordByte(query[i-1]):
+			n := matchKeyword(query[i:], "check")
+			if n == 0 {
+				break
+			}
+			open := i + n
+			for open < len(query) && strings.ContainsRune(" \t\r\n", rune(query[open])) {
+				open++
+			}
+			if open == len(query) || query[open] != '(' {
+				break
+			}
+			close := matchingParen(query, open)
+			if close < 0 {
+				return "", nil, GoDBError{ParseError, fmt.Sprintf("unbalanced parentheses in CHECK at position %d", i)}
+			}
+			clause := checkClause{text: strings.TrimSpace(query[open+1 : close])}
+			prefix := out.String()
+			if words := strings.Fields(prefix); len(words) >= 2 && strings.EqualFold(words[len(words)-2], "constraint") {
+				clause.name = words[len(words)-1]
+				prefix = prefix[:strings.LastIndex(strings.ToLower(prefix), "constraint")]
+			}
+			prefix, close = dropElementSeparator(prefix, query, close)
+			out.Reset()
+			out.WriteString(prefix)
+			out.WriteByte(' ')
+			checks = append(checks, clause)
+			i = close
+			continue
+		}
+		out.WriteByte(ch)
+	}
+	return out.String(), checks, nil
+}
+
+// sqlparser only supports UNIQUE table constraints of the form UNIQUE KEY name
+// (column, ...), so rewrite the constraints UNIQUE [KEY | INDEX] (column, ...)
+// of a CREATE TABLE statement into that form, naming them
+// table_column_..._key, and [CONSTRAINT name] UNIQUE ... into UNIQUE KEY name.
+func nameUniqueConstraints(query string) string {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	words := strings.Fields(trimmed)
+	if matchKeyword(trimmed, "create") == 0 || len(words) < 3 || !strings.EqualFold(words[1], "table") {
+		return query
+	}
+	table, _, _ := strings.Cut(strings.ToLower(words[2]), "(")
+	skipSpace := func(i int) int {
+		for i < len(query) && strings.ContainsRune(" \t\r\n", rune(query[i])) {
+			i++
+		}
+		return i
+	}
+	var out strings.Builder
+	used := make(map[string]bool)
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case i == 0 || !isWordByte(query[i-1]):
+			n := matchKeyword(query[i:], "unique")
+			if n == 0 {
+				break
+			}
+			open := skipSpace(i + n)
+			if k := max(matchKeyword(query[open:], "key"), matchKeyword(query[open:], "index")); k > 0 {
+				open = skipSpace(open + k)
+			}
+			if open == len(query) || query[open] != '(' {
+				// a column constraint, or already named
+				break
+			}
+			close := matchingParen(query, open)
+			if close < 0 {
+				break
+			}
+			prefix := out.String()
+			name := ""
+			if words := strings.Fields(prefix); len(words) >= 2 && strings.EqualFold(words[len(words)-2], "constraint") {
+				name = words[len(words)-1]
+				prefix = prefix[:strings.LastIndex(strings.ToLower(prefix), "constraint")]
+			} else {
+				var columns []string
+				for _, col := range strings.Split(query[open+1:close], ",") {
+					columns = append(columns, strings.ToLower(strings.Trim(strings.TrimSpace(col), "`\"")))
+				}
+				base := table + "_" + strings.Join(columns, "_") + "_key"
+				name = base
+				for j := 1; used[name]; j++ {
+					name = fmt.Sprintf("%s%d", base, j)
+				}
+			}
+			used[name] = true
+			out.Reset()
+			out.WriteString(prefix)
+			out.WriteString("unique key " + name + " ")
+			i = open - 1
+			continue
+		}
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
+
+// Drop the comma that separates a table constraint, which is being removed
+// from a CREATE TABLE statement, from the other elements of the table
+// definition. prefix is the statement before the constraint, and end the
+// position of its last character in query. Returns the new prefix and end.
+func dropElementSeparator(prefix string, query string, end int) (string, int) {
+	prefix = strings.TrimRight(prefix, " \t\r\n")
+	if strings.HasSuffix(prefix, ",") {
+		return prefix[:len(prefix)-1], end
+	}
+	if strings.HasSuffix(prefix, "(") {
+		next := end + 1
+		for next < len(query) && strings.ContainsRune(" \t\r\n", rune(query[next])) {
+			next++
+		}
+		if next < len(query) && query[next] == ',' {
+			end = next
+		}
+	}
+	return prefix, end
+}
+
+// A FOREIGN KEY constraint of a CREATE TABLE statement, see
+// [extractForeignKeys].
+type foreignKeyClause struct {
+	name       string
+	columns    []string
+	table      string
+	refColumns []string // empty to reference the primary key of table
+	onDelete   foreignKeyAction
+}
+
+// sqlparser does not support foreign keys, so remove the column constraints
+// REFERENCES table [(column, ...)] [ON DELETE action] and the table
+// constraints [CONSTRAINT name] FOREIGN KEY (column, ...) REFERENCES ... from
+// a CREATE TABLE statement, returning them separately.
+func extractForeignKeys(query string) (string, []foreignKeyClause, error) {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if matchKeyword(trimmed, "create") == 0 {
+		return query, nil, nil
+	}
+	var out strings.Builder
+	var fks []foreignKeyClause
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case i == 0 || !isWordByte(query[i-1]):
+			n := matchKeyword(query[i:], "references")
+			if n == 0 {
+				break
+			}
+			fk, end, err := parseReferences(query, i+n)
+			if err != nil {
+				return "", nil, err
+			}
+			prefix := strings.TrimRight(out.String(), " \t\r\n")
+			if open := strings.LastIndex(prefix, "("); strings.HasSuffix(prefix, ")") && open >= 0 && strings.HasSuffix(strings.ToLower(strings.TrimRight(prefix[:open], " \t\r\n")), "foreign key") {
+				// a table constraint
+				for _, col := range strings.Split(prefix[open+1:len(prefix)-1], ",") {
+					fk.columns = append(fk.columns, strings.TrimSpace(col))
+				}
+				prefix = strings.TrimRight(prefix[:open], " \t\r\n")
+				prefix = strings.TrimRight(prefix[:len(prefix)-len("foreign key")], " \t\r\n")
+				prefix, fk.name = cutConstraintName(prefix)
+				prefix, end = dropElementSeparator(prefix, query, end)
+			} else {
+				// a column constraint, on the column whose definition it
+				// ends
+				prefix, fk.name = cutConstraintName(prefix)
+				def := strings.Fields(prefix[tableElementStart(prefix):])
+				if len(def) < 2 {
+					return "", nil, GoDBError{ParseError, fmt.Sprintf("REFERENCES at position %d does not follow a column definition", i)}
+				}
+				fk.columns = []string{def[0]}
+			}
+			out.Reset()
+			out.WriteString(prefix)
+			out.WriteByte(' ')
+			fks = append(fks, fk)
+			i = end
+			continue
+		}
+		out.WriteByte(ch)
+	}
+	return out.String(), fks, nil
+}
+
+// Parse the table [(column, ...)] [ON DELETE action] that follows REFERENCES
+// at position pos of query. Returns the clause and the position of its last
+// character.
+func parseReferences(query string, pos int) (foreignKeyClause, int, error) {
+	var fk foreignKeyClause
+	skipSpace := func() {
+		for pos < len(query) && strings.ContainsRune(" \t\r\n", rune(query[pos])) {
+			pos++
+		}
+	}
+	skipSpace()
+	start := pos
+	for pos < len(query) && isWordByte(query[pos]) {
+		pos++
+	}
+	if pos == start {
+		return fk, 0, GoDBError{ParseError, fmt.Sprintf("expected a table name after REFERENCES at position %d", start)}
+	}
+	fk.table = strings.ToLower(query[start:pos])
+	end := pos - 1
+	skipSpace()
+	if pos < len(query) && query[pos] == '(' {
+		close := matchingParen(query, pos)
+		if close < 0 {
+			return fk, 0, GoDBError{ParseError, fmt.Sprintf("unbalanced parentheses in REFERENCES at position %d", pos)}
+		}
+		for _, col := range strings.Split(query[pos+1:close], ",") {
+			fk.refColumns = append(fk.refColumns, strings.TrimSpace(col))
+		}
+		end = close
+		pos = close + 1
+		skipSpace()
+	}
+	for _, a := range []struct {
+		words  []string
+		action foreignKeyAction
+	}{
+		{[]string{"on", "delete", "cascade"}, cascadeOnDelete},
+		{[]string{"on", "delete", "restrict"}, restrictOnDelete},
+		{[]string{"on", "delete", "no", "action"}, restrictOnDelete},
+	} {
+		if n := matchKeywords(query[pos:], a.words); n > 0 {
+			fk.onDelete = a.action
+			return fk, pos + n - 1, nil
+		}
+	}
+	if matchKeyword(query[pos:], "on") > 0 {
+		words := strings.Fields(query[pos:])
+		return fk, 0, GoDBError{ParseError, fmt.Sprintf("unsupported foreign key action %s; only ON DELETE CASCADE, RESTRICT and NO ACTION are supported", strings.Join(words[:min(len(words), 3)], " "))}
+	}
+	return fk, end, nil
+}
+
+// Return the length of the prefix of s that is the sequence of keywords
+// words, separated by white space, or 0 if s does not start with them.
+func matchKeywords(s string, words []string) int {
+	pos := 0
+	for i, word := range words {
+		if i > 0 {
+			start := pos
+			for pos < len(s) && strings.ContainsRune(" \t\r\n", rune(s[pos])) {
+				pos++
+			}
+			if pos == start {
+				return 0
+			}
+		}
+		n := matchKeyword(s[pos:], word)
+		if n == 0 {
+			return 0
+		}
+		pos += n
+	}
+	return pos
+}
+
+// If s ends with CONSTRAINT name, remove it, returning the rest of s and the
+// name.
+func cutConstraintName(s string) (string, string) {
+	words := strings.Fields(s)
+	if len(words) < 2 || !strings.EqualFold(words[len(words)-2], "constraint") {
+		return s, ""
+	}
+	name := words[len(words)-1]
+	s = strings.TrimRight(s, " \t\r\n")
+	s = strings.TrimRight(s[:len(s)-len(name)], " \t\r\n")
+	return s[:len(s)-len("constraint")], name
+}
+
+// Return the position in prefix, a CREATE TABLE statement up to some point in
+// its table definition, at which the element of the definition containing
+// that point starts: after the last comma or opening parenthesis that is not
+// nested in parentheses or quotes.
+func tableElementStart(prefix string) int {
+	start, depth := 0, 0
+	var quote byte
+	for i := 0; i < len(prefix); i++ {
+		ch := prefix[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '(':
+			depth++
+			if depth == 1 {
+				start = i + 1
+			}
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 1:
+			start = i + 1
+		}
+	}
+	return start
+}
+
+func processDDL(c *Catalog, tid *TransactionID, ddl *sqlparser.DDL, checks []checkClause, fks []foreignKeyClause) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
+		if ddl.TableSpec == nil {
+			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("malformed create table statement for %s", sqlparser.String(ddl.NewName))}
+		}
 		fields := make([]FieldType, len(ddl.TableSpec.Columns))
 		tabName := sqlparser.String(ddl.NewName.Name)
 		t, _ := c.GetTable(tabName)
-		if t != nil {
+		if t != nil || c.views[tabName] != nil {
 			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already exists", tabName)}
 		}
+		defaults := make([]DBValue, len(ddl.TableSpec.Columns))
 		for i, col := range ddl.TableSpec.Columns {
-			var colType DBType
 			colName := sqlparser.String(col.Name)
-			switch col.Type.Type {
-			case "int":
-				colType = IntType
-			case "string":
-				fallthrough
-			case "text":
-				fallthrough
-			case "varchar":
-				colType = StringType
-			default:
-				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
-
+			colType, err := columnType(col.Type)
+			if err != nil {
+				return UnknownQueryType, err
+			}
+			colType.Fname = colName
+			fields[i] = colType
+			if def := col.Type.Default; def != nil {
+				if def.Type == sqlparser.ValArg {
+					return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported default %s for column %s", string(def.Val), colName)}
+				}
+				v, err := parseValue(colType.Ftype, string(def.Val))
+				if err == nil {
+					v, err = castField(v, colType)
+				}
+				if err != nil {
+					return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("invalid default for column %s: %s", colName, err.Error())}
+				}
+				defaults[i] = v
 			}
-			fields[i] = FieldType{colName, "", colType}
 		}
 
-		_, err := c.addTable(tabName, TupleDesc{fields})
+		cons, err := declaredConstraints(ddl.TableSpec, fields, checks, fks)
+		if err != nil {
+			return UnknownQueryType, err
+		}
+
+		_, err = c.addTable(tabName, TupleDesc{fields})
 		if err != nil {
 			return UnknownQueryType, err
 		}
+		table := c.tableMap[tabName]
+		table.setDefaults(defaults)
+		for _, con := range cons {
+			if err := table.addConstraint(c, con); err != nil {
+				c.removeTable(tabName)
+				return UnknownQueryType, err
+			}
+		}
 		return CreateTableQueryType, nil
 
 	case "drop":
 		tabName := sqlparser.String(ddl.Table.Name)
-		err := c.dropTable(tabName)
+		if t, ok := c.tableMap[tabName]; ok && c.isReferenced(t) {
+			return UnknownQueryType, GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop table %s because a foreign key of another table references it", tabName)}
+		}
+		if c.matViews[tabName] != nil {
+			return UnknownQueryType, GoDBError{IllegalOperationError, fmt.Sprintf("%s is a materialized view; use DROP MATERIALIZED VIEW", tabName)}
+		}
+		if err := c.checkNotMaintainedFrom(tabName, "drop table"); err != nil {
+			return UnknownQueryType, err
+		}
+		if err := c.checkNotReadByView(tabName, "drop table"); err != nil {
+			return UnknownQueryType, err
+		}
+		var err error
+		if tid != nil {
+			err = c.dropTableInTransaction(tabName, *tid)
+		} else {
+			err = c.removeTable(tabName)
+		}
 		if err != nil {
 			return UnknownQueryType, err
 		}
@@ -1413,18 +4061,112 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 	}
 }
 
+// The state of parsing and planning one statement against a catalog. Each
+// call of [Parse] or [Prepare] has its own, so that statements may be parsed
+// against the same catalog concurrently.
+type parseContext struct {
+	*Catalog
+
+	// the common table expressions in scope of the query being parsed
+	ctes map[string]*cteBinding
+
+	// the constants standing for the parameters of the statement being
+	// prepared, by position; nil if no statement is being prepared
+	params map[int][]*ConstExpr
+
+	// the views whose queries are being parsed, innermost last
+	expanding []*View
+
+	// the transaction the statement runs in; nil if DDL statements should
+	// run in transactions of their own
+	tid *TransactionID
+}
+
+// Return a context for parsing a statement against c.
+func newParseContext(c *Catalog) *parseContext {
+	return &parseContext{Catalog: c}
+}
+
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
-	stmt, err := sqlparser.Parse(query)
+	return parseIn(newParseContext(c), query)
+}
+
+// Parse query like [Parse], but run any DDL statement in it in transaction
+// tid, so that aborting tid undoes it.
+func ParseInTransaction(c *Catalog, tid TransactionID, query string) (QueryType, Operator, error) {
+	pc := newParseContext(c)
+	pc.tid = &tid
+	return parseIn(pc, query)
+}
+
+// Parse query in the context c.
+func parseIn(c *parseContext, query string) (QueryType, Operator, error) {
+	if qtype, ok, err := processViewStatement(c.Catalog, query); ok {
+		return qtype, nil, err
+	}
+	query, err := rewritePlaceholders(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query, err = rewriteWindowFunctions(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query, err = rewriteCasts(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if matchKeyword(trimmed, "with") > 0 || (hasIntersectOrExcept(query) && matchKeyword(trimmed, "insert") == 0) {
+		plan, err := parseQuery(c, query)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		plan, err = optimizePlan(c, plan)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		op, err := makePhysicalPlan(c, plan)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	}
+	if matchKeyword(strings.TrimLeft(query, " \t\r\n"), "alter") > 0 {
+		qtype, err := processAlterTable(c.Catalog, c.tid, strings.TrimSpace(query))
+		return qtype, nil, err
+	}
+	if n := matchKeyword(strings.TrimLeft(query, " \t\r\n"), "analyze"); n > 0 {
+		qtype, err := processAnalyze(c.Catalog, strings.TrimLeft(query, " \t\r\n")[n:])
+		return qtype, nil, err
+	}
+	query, checks, err := extractChecks(nameUniqueConstraints(query))
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query, fks, err := extractForeignKeys(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query, err = hoistSetOperations(c, query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	stmt, err := sqlparser.Parse(rewriteBooleanColumns(query))
 	if err != nil {
 		return UnknownQueryType, nil, err
 	}
 	switch stmt := stmt.(type) {
-	case *sqlparser.Select:
-		plan, err := parseStatement(c, stmt)
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+		plan, err := parseSelectStatement(c, stmt.(sqlparser.SelectStatement))
 		if err != nil {
 			//fmt.Printf("Err: %s\n", err.Error())
 			return UnknownQueryType, nil, err
 		}
+		plan, err = optimizePlan(c, plan)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
 		op, err := makePhysicalPlan(c, plan)
 		if err != nil {
 			//fmt.Printf("Err: %s\n", err.Error())
@@ -1450,7 +4192,7 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 	case *sqlparser.Rollback:
 		return AbortXactionType, nil, nil
 	case *sqlparser.DDL:
-		qtype, err := processDDL(c, stmt)
+		qtype, err := processDDL(c.Catalog, c.tid, stmt, checks, fks)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		} else {
@@ -0,0 +1,266 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A PreparedStatement is a query that is parsed and planned once, and may then
+// be executed many times with different values for its parameters.
+//
+// Parameters are written either as ? (numbered in the order they appear) or
+// as $1, $2, ...; the two styles may not be mixed within a statement. Each
+// parameter is planned as a [ConstExpr] whose value is filled in by [Bind].
+// The type of a parameter is inferred from where it is used, e.g., from the
+// other operand of a comparison, or from the column it is inserted into.
+//
+// Binding updates the shared plan, so a statement must not be executed by
+// several transactions concurrently. If a table has been dropped or altered
+// since the statement was planned, binding plans it again, so that it never
+// reads the file a table had before.
+type PreparedStatement struct {
+	qtype  QueryType
+	plan   Operator
+	params [][]*ConstExpr // the constants that stand for each parameter, by position
+	types  []DBType       // the inferred type of each parameter, or UnknownType
+
+	c       *Catalog
+	sql     string
+	version int // the schema version of c the statement was planned against
+}
+
+// Parse and plan sql, which may contain parameters, for later execution.
+func Prepare(c *Catalog, sql string) (*PreparedStatement, error) {
+	version := c.schemaVersion
+	pc := newParseContext(c)
+	pc.params = make(map[int][]*ConstExpr)
+	qtype, plan, err := parseIn(pc, sql)
+	if err != nil {
+		return nil, err
+	}
+	if qtype != IteratorType && len(pc.params) > 0 {
+		return nil, GoDBError{ParseError, "parameters are only supported in queries and inserts"}
+	}
+	n := 0
+	for pos := range pc.params {
+		n = max(n, pos)
+	}
+	ps := &PreparedStatement{qtype, plan, make([][]*ConstExpr, n), make([]DBType, n), c, sql, version}
+	for i := range ps.params {
+		ps.params[i] = pc.params[i+1]
+		if len(ps.params[i]) == 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("parameter $%d is not used", i+1)}
+		}
+		ps.types[i] = UnknownType
+		for _, ce := range ps.params[i] {
+			if ce.constType == UnknownType {
+				continue
+			}
+			if ps.types[i] != UnknownType && ps.types[i] != ce.constType {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("parameter $%d is used both as %s and as %s", i+1, ps.types[i], ce.constType)}
+			}
+			ps.types[i] = ce.constType
+		}
+	}
+	return ps, nil
+}
+
+// The number of parameters of the statement.
+func (ps *PreparedStatement) NumParams() int {
+	return len(ps.params)
+}
+
+// The inferred types of the parameters of the statement; UnknownType for
+// parameters whose type is taken from the value bound to them.
+func (ps *PreparedStatement) ParamTypes() []DBType {
+	return ps.types
+}
+
+// The type of the statement, as returned by [Parse].
+func (ps *PreparedStatement) Type() QueryType {
+	return ps.qtype
+}
+
+// The plan of the statement. It may only be iterated over once values have
+// been bound to all parameters.
+func (ps *PreparedStatement) Plan() Operator {
+	return ps.plan
+}
+
+// Bind values to the parameters of the statement, in order. A value may be a
+// [DBValue] or a Go int, float, string or bool; it is converted to the type of
+// the parameter if it may be cast to it.
+func (ps *PreparedStatement) Bind(params ...any) error {
+	if ps.version != ps.c.schemaVersion {
+		nps, err := Prepare(ps.c, ps.sql)
+		if err != nil {
+			return err
+		}
+		*ps = *nps
+	}
+	if len(params) != len(ps.params) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("statement expects %d parameters, got %d", len(ps.params), len(params))}
+	}
+	for i, p := range params {
+		v, err := toDBValue(p)
+		if err != nil {
+			return err
+		}
+		if ps.types[i] != UnknownType {
+			if v, err = castValue(v, ps.types[i]); err != nil {
+				return GoDBError{TypeMismatchError, fmt.Sprintf("parameter $%d: %s", i+1, err.(GoDBError).errString)}
+			}
+		}
+		for _, ce := range ps.params[i] {
+			ce.val = v
+			ce.constType = valueType(v)
+		}
+	}
+	return nil
+}
+
+// Bind params to the parameters of the statement and return an iterator over
+// its results in transaction tid.
+func (ps *PreparedStatement) Execute(tid TransactionID, params ...any) (func() (*Tuple, error), error) {
+	if ps.qtype != IteratorType {
+		return nil, GoDBError{IllegalOperationError, "only queries and inserts may be executed"}
+	}
+	if err := ps.Bind(params...); err != nil {
+		return nil, err
+	}
+	return ps.plan.Iterator(tid)
+}
+
+// Convert a Go value to a DBValue.
+func toDBValue(p any) (DBValue, error) {
+	switch p := p.(type) {
+	case DBValue:
+		return p, nil
+	case int:
+		return IntField{int64(p)}, nil
+	case int32:
+		return IntField{int64(p)}, nil
+	case int64:
+		return IntField{p}, nil
+	case float32:
+		return FloatField{float64(p)}, nil
+	case float64:
+		return FloatField{p}, nil
+	case string:
+		return StringField{p}, nil
+	case bool:
+		return BoolField{p}, nil
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("unsupported parameter value %v of type %T", p, p)}
+}
+
+// If e is a parameter whose type is not yet known, give it type t and return
+// true.
+func inferParamType(e Expr, t DBType) bool {
+	ce, ok := e.(*ConstExpr)
+	if !ok || ce.val != nil || ce.constType != UnknownType || t == UnknownType {
+		return false
+	}
+	ce.constType = t
+	return true
+}
+
+// Rewrite the parameters of query, outside of quoted strings, into the :vN
+// form the sql parser understands. Parameters are either all ? or all $N.
+func rewritePlaceholders(query string) (string, error) {
+	var out strings.Builder
+	var quote byte
+	next, positional, numbered := 1, false, false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?':
+			positional = true
+			fmt.Fprintf(&out, ":v%d", next)
+			next++
+			continue
+		case ch == '$' && (i == 0 || !isWordByte(query[i-1])):
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if j == i+1 {
+				break
+			}
+			n, err := strconv.Atoi(query[i+1 : j])
+			if err != nil || n < 1 {
+				return "", GoDBError{ParseError, fmt.Sprintf("invalid parameter %s", query[i:j])}
+			}
+			numbered = true
+			fmt.Fprintf(&out, ":v%d", n)
+			i = j - 1
+			continue
+		}
+		out.WriteByte(ch)
+	}
+	if positional && numbered {
+		return "", GoDBError{ParseError, "cannot mix ? and $N parameters"}
+	}
+	return out.String(), nil
+}
+
+// Split a PREPARE statement of the form "PREPARE name AS query" into the name
+// and query. Returns false if stmt is not a PREPARE statement.
+func ParsePrepare(stmt string) (name string, query string, ok bool) {
+	if matchKeyword(stmt, "prepare") == 0 {
+		return "", "", false
+	}
+	fields := strings.Fields(stmt)
+	if len(fields) < 4 || !strings.EqualFold(fields[2], "as") {
+		return "", "", false
+	}
+	return fields[1], afterWords(stmt, 3), true
+}
+
+// Split an EXECUTE statement of the form "EXECUTE name(arg, ...)" into the
+// name and the literal arguments. Quoted arguments are strings, true and
+// false are booleans, and other arguments are integers or floats. Returns
+// false if stmt is not an EXECUTE statement.
+func ParseExecute(stmt string) (name string, args []any, ok bool, err error) {
+	if matchKeyword(stmt, "execute") == 0 {
+		return "", nil, false, nil
+	}
+	rest := strings.TrimSpace(stmt[len("execute"):])
+	open := strings.Index(rest, "(")
+	if open < 0 {
+		return rest, nil, true, nil
+	}
+	if !strings.HasSuffix(rest, ")") {
+		return "", nil, true, GoDBError{ParseError, fmt.Sprintf("expected ) at the end of %s", stmt)}
+	}
+	name = strings.TrimSpace(rest[:open])
+	argList := strings.TrimSpace(rest[open+1 : len(rest)-1])
+	if argList == "" {
+		return name, nil, true, nil
+	}
+	for _, arg := range splitTopLevel(argList) {
+		arg = strings.TrimSpace(arg)
+		switch {
+		case len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0]:
+			args = append(args, arg[1:len(arg)-1])
+		case strings.EqualFold(arg, "true") || strings.EqualFold(arg, "false"):
+			args = append(args, strings.EqualFold(arg, "true"))
+		default:
+			if i, err := strconv.ParseInt(arg, 10, 64); err == nil {
+				args = append(args, i)
+			} else if f, err := strconv.ParseFloat(arg, 64); err == nil {
+				args = append(args, f)
+			} else {
+				return "", nil, true, GoDBError{ParseError, fmt.Sprintf("invalid parameter value %s", arg)}
+			}
+		}
+	}
+	return name, args, true, nil
+}
@@ -0,0 +1,144 @@
+package godb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPreparedQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, q := range []struct {
+		sql    string
+		params []any
+		count  int
+	}{
+		{"select name from t where age > ?", []any{40}, 6},
+		{"select name from t where age > ?", []any{98}, 2},
+		{"select name from t where age > $1 and age < $1 + 10", []any{40}, 2},
+		{"select name from t where name = ? and age = ?", []any{"sam", 99}, 1},
+		{"select name from t where age >= ? order by name limit ?", []any{"40", 3}, 3},
+		{"select name from t where age > ?", []any{42.5}, 5},
+		{"select name, count(*) from t where cast(? as int) < age group by name", []any{"30"}, 8},
+		{"select name from t where name in (select name from t2 where age = ?)", []any{22}, 3},
+	} {
+		ps, err := Prepare(c, q.sql)
+		if err != nil {
+			t.Fatalf("preparing %s: %s", q.sql, err.Error())
+		}
+		for run := 0; run < 2; run++ {
+			tid := BeginTransactionForTest(t, bp)
+			iter, err := ps.Execute(tid, q.params...)
+			if err != nil {
+				t.Fatalf("executing %s: %s", q.sql, err.Error())
+			}
+			n := 0
+			for {
+				tup, err := iter()
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				if tup == nil {
+					break
+				}
+				n++
+			}
+			bp.CommitTransaction(tid)
+			if n != q.count {
+				t.Errorf("query %s with %v: expected %d results, got %d", q.sql, q.params, q.count, n)
+			}
+		}
+	}
+}
+
+func TestPreparedInsert(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("people"))
+	defer os.Remove(c.tableNameToFile("people"))
+	if _, _, err := Parse(c, "create table people (name varchar(20), age int)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	ps, err := Prepare(c, "insert into people values (?, ?)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if types := ps.ParamTypes(); types[0] != StringType || types[1] != IntType {
+		t.Errorf("expected parameter types string and int, got %v", types)
+	}
+	for _, p := range [][]any{{"ann", 31}, {"ben", "42"}, {"cy", IntField{53}}} {
+		tid := BeginTransactionForTest(t, bp)
+		iter, err := ps.Execute(tid, p...)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := iter(); err != nil {
+			t.Fatalf(err.Error())
+		}
+		bp.CommitTransaction(tid)
+	}
+	_, n := countQueryResults(t, bp, c, "select name from people where age > 40")
+	if n != 2 {
+		t.Errorf("expected 2 results, got %d", n)
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if _, err := ps.Execute(tid, "dan"); err == nil {
+		t.Errorf("expected an error executing with too few parameters")
+	}
+	if _, err := ps.Execute(tid, "dan", "old"); err == nil {
+		t.Errorf("expected an error binding a string that is not an int")
+	}
+}
+
+func TestPreparedErrors(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, q := range []struct {
+		sql  string
+		want string
+	}{
+		{"select name from t where age > ? and age < $2", "cannot mix"},
+		{"select name from t where age > $2", "$1 is not used"},
+		{"select name from t where age > $1 and name = $1", "used both as"},
+	} {
+		if _, err := Prepare(c, q.sql); err == nil || !strings.Contains(err.Error(), q.want) {
+			t.Errorf("preparing %s: expected error containing %q, got %v", q.sql, q.want, err)
+		}
+	}
+	if _, _, err := Parse(c, "select name from t where age > ?"); err == nil {
+		t.Errorf("expected an error parsing a parameter outside of a prepared statement")
+	}
+}
+
+func TestParsePrepareAndExecute(t *testing.T) {
+	name, query, ok := ParsePrepare("PREPARE older AS select name from t where age > $1")
+	if !ok || name != "older" || query != "select name from t where age > $1" {
+		t.Errorf("unexpected PREPARE parse: %v %q %q", ok, name, query)
+	}
+	name, query, ok = ParsePrepare("PREPARE p\tAS select name as n from t")
+	if !ok || name != "p" || query != "select name as n from t" {
+		t.Errorf("unexpected PREPARE parse: %v %q %q", ok, name, query)
+	}
+	if _, _, ok := ParsePrepare("prepared_table"); ok {
+		t.Errorf("expected prepared_table not to parse as PREPARE")
+	}
+	name, args, ok, err := ParseExecute("execute older(40, 'a, b', true, 1.5)")
+	if err != nil || !ok || name != "older" || len(args) != 4 {
+		t.Fatalf("unexpected EXECUTE parse: %v %v %q %v", err, ok, name, args)
+	}
+	if args[0] != int64(40) || args[1] != "a, b" || args[2] != true || args[3] != 1.5 {
+		t.Errorf("unexpected EXECUTE arguments %v", args)
+	}
+	if _, _, _, err := ParseExecute("execute older(40, abc)"); err == nil {
+		t.Errorf("expected an error parsing an invalid argument")
+	}
+}
@@ -41,12 +41,15 @@ func (p *Project) Descriptor() *TupleDesc {
 	// return &TupleDesc{} // replace me
 	fields := make([]FieldType, len(p.selectFields))
 	for i := range p.selectFields{
-		fieldType := p.selectFields[i].GetExprType().Ftype
+		exprType := p.selectFields[i].GetExprType()
+		fieldType := exprType.Ftype
 		fieldName := p.outputNames[i]
 		// p.selectFields[i] = NewFieldExpr(fieldName, fieldType)
 		fields[i] = FieldType{
-			Fname: fieldName,
-			Ftype: fieldType,
+			Fname:     fieldName,
+			Ftype:     fieldType,
+			Precision: exprType.Precision,
+			Scale:     exprType.Scale,
 		}
 
 	}
@@ -108,8 +108,8 @@ func TestProjectOrdering(t *testing.T) {
 
 func TestProjectExtra(t *testing.T) {
 	_, _, t1, _, _ := makeJoinOrderingVars(t)
-	ft1 := FieldType{"a", "", StringType}
-	ft2 := FieldType{"b", "", IntType}
+	ft1 := FieldType{"a", "", StringType, 0, 0}
+	ft2 := FieldType{"b", "", IntType, 0, 0}
 	outTup, _ := t1.project([]FieldType{ft1})
 	if (len(outTup.Fields)) != 1 {
 		t.Fatalf("project returned %d fields, expected 1", len(outTup.Fields))
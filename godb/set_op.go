@@ -0,0 +1,137 @@
+package godb
+
+import "fmt"
+
+type SetOpType int
+
+const (
+	UnionSetOp     SetOpType = iota
+	IntersectSetOp SetOpType = iota
+	ExceptSetOp    SetOpType = iota
+)
+
+func (t SetOpType) String() string {
+	switch t {
+	case UnionSetOp:
+		return "UNION"
+	case IntersectSetOp:
+		return "INTERSECT"
+	case ExceptSetOp:
+		return "EXCEPT"
+	}
+	return "??"
+}
+
+// SetOp combines the tuples of two inputs with the same number and types of
+// fields using UNION, INTERSECT or EXCEPT. Unless all is set, duplicate tuples
+// are removed from the result.
+type SetOp struct {
+	op          SetOpType
+	all         bool
+	left, right Operator
+}
+
+// Construct a set operation over left and right.
+//
+// Returns an error if the inputs do not have the same number of fields, or if
+// the types of their fields differ.
+func NewSetOp(op SetOpType, all bool, left Operator, right Operator) (*SetOp, error) {
+	if !left.Descriptor().compatible(right.Descriptor()) {
+		return nil, GoDBError{IncompatibleTypesError, fmt.Sprintf("%s inputs have incompatible fields (%s) and (%s)", op, left.Descriptor().HeaderString(false), right.Descriptor().HeaderString(false))}
+	}
+	return &SetOp{op, all, left, right}, nil
+}
+
+// Return the TupleDesc of the result, which takes its field names from the
+// left input.
+func (s *SetOp) Descriptor() *TupleDesc {
+	return s.left.Descriptor().copy()
+}
+
+// Count the tuples of the right input by [Tuple.tupleKey].
+func (s *SetOp) rightCounts(tid TransactionID, desc *TupleDesc) (map[any]int, error) {
+	iter, err := s.right.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[any]int)
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			return counts, nil
+		}
+		counts[(&Tuple{*desc, tup.Fields, nil}).tupleKey()]++
+	}
+}
+
+// Set operation implementation. UNION streams through the left input and then
+// the right one. INTERSECT and EXCEPT first count the tuples of the right input,
+// and then stream through the left input, returning the tuples that do (or do
+// not) appear in the right input.
+//
+// Returned tuples are relabeled with [SetOp.Descriptor], so that tuples from
+// the right input can be referenced by the field names of the left input.
+func (s *SetOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	desc := s.Descriptor()
+	leftIter, err := s.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts map[any]int
+	var rightIter func() (*Tuple, error)
+	if s.op == UnionSetOp {
+		rightIter, err = s.right.Iterator(tid)
+	} else {
+		counts, err = s.rightCounts(tid, desc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[any]bool)
+
+	return func() (*Tuple, error) {
+		for {
+			tup, err := leftIter()
+			if err != nil {
+				return nil, err
+			}
+			if tup == nil && rightIter != nil {
+				leftIter, rightIter = rightIter, nil
+				continue
+			}
+			if tup == nil {
+				return nil, nil
+			}
+			out := &Tuple{*desc, tup.Fields, nil}
+			key := out.tupleKey()
+
+			switch s.op {
+			case IntersectSetOp:
+				if counts[key] == 0 {
+					continue
+				}
+				if s.all {
+					counts[key]--
+				}
+			case ExceptSetOp:
+				if counts[key] > 0 {
+					if s.all {
+						counts[key]--
+					}
+					continue
+				}
+			}
+			if !s.all {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			return out, nil
+		}
+	}, nil
+}
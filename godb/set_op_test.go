@@ -0,0 +1,132 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetOp(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	vals := NewValueOp([][]Expr{
+		{&ConstExpr{t1.Fields[0], StringType}, &ConstExpr{t1.Fields[1], IntType}},
+		{&ConstExpr{StringField{"nobody"}, StringType}, &ConstExpr{IntField{0}, IntType}},
+	})
+
+	cases := []struct {
+		op       SetOpType
+		all      bool
+		expected int
+	}{
+		{UnionSetOp, false, 3},
+		{UnionSetOp, true, 5},
+		{IntersectSetOp, false, 1},
+		{IntersectSetOp, true, 1},
+		{ExceptSetOp, false, 1},
+		{ExceptSetOp, true, 2},
+	}
+	for _, c := range cases {
+		so, err := NewSetOp(c.op, c.all, hf, vals)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := so.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if !tup.Desc.equals(hf.Descriptor()) {
+				t.Errorf("%s returned tuple with unexpected desc %v", c.op, tup.Desc)
+			}
+			cnt++
+		}
+		if cnt != c.expected {
+			t.Errorf("%s (all=%v) returned %d tuples, expected %d", c.op, c.all, cnt, c.expected)
+		}
+	}
+}
+
+func TestSetOpIncompatible(t *testing.T) {
+	_, _, _, hf, _, _ := makeTestVars(t)
+	vals := NewValueOp([][]Expr{{&ConstExpr{IntField{0}, IntType}, &ConstExpr{StringField{"x"}, StringType}}})
+	if _, err := NewSetOp(UnionSetOp, false, hf, vals); err == nil {
+		t.Errorf("expected error for set operation over incompatible inputs")
+	}
+}
+
+func TestSetOpQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name from t union select name from t2", 10},
+		{"select name from t union all select name from t2", 24},
+		{"select name from t where age < 40 intersect select name from t2 where age > 40", 2},
+		{"select name from t where age < 40 intersect all select name from t2 where age > 40", 2},
+		{"select name from t except select name from t2 where age > 40", 4},
+		{"select name from t except all select name from t2 where age > 40", 6},
+		{"select name from t except select name from t2 where age > 40 union select name from t2 where age = 99", 6},
+		{"select name from t union select name from t2 where age > 40 intersect select name from t where age < 40", 10},
+		{"select name, age from t union select name, age from t2 order by age desc limit 3", 3},
+		{"select x.name from (select name from t where age < 30 union select name from t2 where age > 90) x", 4},
+		{"select x.name from (select name from t except select name from t2 where age > 40) x", 4},
+		{"select name from t where name in (select name from t except select name from t2 where age > 40)", 4},
+		{"with w as (select name from t except select name from t2 where age > 40) select name from w", 4},
+		{"with w as (select x.name from (select name from t except select name from t2 where age > 40) x) select name from w", 4},
+	}
+	for _, q := range queries {
+		_, cnt := countQueryResults(t, bp, c, q.sql)
+		if cnt != q.expected {
+			t.Errorf("query '%s' returned %d tuples, expected %d", q.sql, cnt, q.expected)
+		}
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if _, _, err := Parse(c, "select name, age from t union select name from t2"); err == nil {
+		t.Errorf("expected error for union of inputs with different numbers of fields")
+	}
+}
+
+func TestSetOpInsertSelect(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("picked"))
+	defer os.Remove(c.tableNameToFile("picked"))
+	if _, _, err := Parse(c, "create table picked (name varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for i, q := range []string{
+		"select name from t except select name from t2 where age > 40",
+		"select name from t intersect select name from t2 where age > 40",
+	} {
+		_, before := countQueryResults(t, bp, c, "select name from picked")
+		_, expected := countQueryResults(t, bp, c, q)
+		insert := "insert into picked " + q
+		if i == 1 {
+			insert = "insert into picked (" + q + ")"
+		}
+		countQueryResults(t, bp, c, insert)
+		if _, after := countQueryResults(t, bp, c, "select name from picked"); after-before != expected {
+			t.Errorf("%s: expected %d tuples to be inserted, got %d", insert, expected, after-before)
+		}
+	}
+}
@@ -32,12 +32,12 @@ func TestSimpleQuery(t *testing.T) {
 		t.Fatalf("no table t2, %s", err.Error())
 	}
 
-	f_name := FieldExpr{FieldType{"name", "", StringType}}
+	f_name := FieldExpr{FieldType{"name", "", StringType, 0, 0}}
 	joinOp, err := NewJoin(hf1, &f_name, hf2, &f_name, 1000)
 	if err != nil {
 		t.Fatalf("failed to construct join, %s", err.Error())
 	}
-	f_age := FieldExpr{FieldType{"age", "t", IntType}}
+	f_age := FieldExpr{FieldType{"age", "t", IntType, 0, 0}}
 	e_const := ConstExpr{IntField{30}, IntType}
 	filterOp, err := NewFilter(&e_const, OpGt, &f_age, joinOp)
 	if err != nil {
@@ -0,0 +1,282 @@
+package godb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+)
+
+// A spillFile is a temporary heap file that an operator whose state does not
+// fit in its memory budget writes tuples to, and then reads back, possibly
+// several times. Its pages are written and read directly rather than through
+// the buffer pool: they are private to the operator, so they need no locks,
+// and must not take the place of the pages of tables in the buffer pool.
+//
+// The file is removed as soon as it is created, so that it does not outlive
+// the operator even if the operator's iterator is abandoned; its space is
+// freed when it is closed, or when it is garbage collected.
+//
+// Strings longer than StringLength, which a page cannot hold, are written to
+// a second file. Each string field of the tuples is followed in the pages by
+// an integer field with the offset of its value in that file, or -1 if the
+// value is in the page.
+type spillFile struct {
+	file   *HeapFile
+	desc   TupleDesc // the descriptor of the tuples added
+	slots  int       // tuples per page
+	page   []*Tuple  // the tuples of the page being filled
+	pages  int       // the pages written
+	fields int       // the fields of the tuples added
+	long   *os.File  // the strings longer than StringLength; nil until one is added
+	size   int64     // the bytes written to long
+}
+
+// Create a spill file for tuples like t. The types of its fields, and the
+// scales of its decimals, are those of the values of t, which are those of
+// the tuples an operator computes even if its descriptor does not say so;
+// the tuples read back have the descriptor of t.
+func newSpillFile(t *Tuple) (*spillFile, error) {
+	desc := &TupleDesc{}
+	for i, v := range t.Fields {
+		field := t.Desc.Fields[i]
+		if ftype := valueType(v); ftype != UnknownType {
+			field.Ftype = ftype
+		}
+		if d, ok := v.(DecimalField); ok {
+			field.Precision, field.Scale = 0, d.Scale
+		}
+		desc.Fields = append(desc.Fields, field)
+		if field.Ftype == StringType {
+			desc.Fields = append(desc.Fields, FieldType{Fname: field.Fname + ".offset", Ftype: IntType})
+		}
+	}
+	hf, err := NewHeapFile("", desc, nil)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(hf.FileName)
+	return &spillFile{file: hf, desc: t.Desc, slots: slotsPerPage(desc), fields: len(t.Fields)}, nil
+}
+
+// Append t to the file.
+func (s *spillFile) add(t *Tuple) error {
+	desc := s.file.Desc
+	if len(t.Fields) != s.fields {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("cannot spill a tuple of %d fields to a file of %d", len(t.Fields), s.fields)}
+	}
+	fields := make([]DBValue, 0, len(desc.Fields))
+	for _, v := range t.Fields {
+		field := desc.Fields[len(fields)]
+		if valueType(v) != field.Ftype {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("cannot spill value %v of field %s as %s", v, field.Fname, field.Ftype)}
+		}
+		if d, ok := v.(DecimalField); ok && d.Scale != field.Scale {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("cannot spill value %s of field %s with %d digits after the point", valueString(d), field.Fname, field.Scale)}
+		}
+		str, ok := v.(StringField)
+		if !ok {
+			fields = append(fields, v)
+			continue
+		}
+		if len(str.Value) <= StringLength {
+			fields = append(fields, v, IntField{-1})
+			continue
+		}
+		offset, err := s.writeLong(str.Value)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, StringField{}, IntField{offset})
+	}
+	s.page = append(s.page, &Tuple{Desc: *desc, Fields: fields})
+	if len(s.page) == s.slots {
+		return s.flush()
+	}
+	return nil
+}
+
+// Write str to the file of long strings, returning its offset.
+func (s *spillFile) writeLong(str string) (int64, error) {
+	if s.long == nil {
+		f, err := os.CreateTemp("", "godb_spill_*.dat")
+		if err != nil {
+			return 0, err
+		}
+		os.Remove(f.Name())
+		s.long = f
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(str)))
+	buf = append(buf, str...)
+	if _, err := s.long.WriteAt(buf, s.size); err != nil {
+		return 0, err
+	}
+	offset := s.size
+	s.size += int64(len(buf))
+	return offset, nil
+}
+
+// Read the string at offset of the file of long strings.
+func (s *spillFile) readLong(offset int64) (string, error) {
+	r := bufio.NewReader(io.NewSectionReader(s.long, offset, s.size-offset))
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	str := make([]byte, n)
+	if _, err := io.ReadFull(r, str); err != nil {
+		return "", err
+	}
+	return string(str), nil
+}
+
+// Write the page being filled to the file.
+func (s *spillFile) flush() error {
+	if len(s.page) == 0 {
+		return nil
+	}
+	page := &heapPage{PageSize: PageSize, SlotNum: s.slots, UsedSlotsNum: len(s.page), Tuples: s.page, Desc: s.file.Desc, PageNo: s.pages}
+	buf, err := page.toBuffer()
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.file.WriteAt(buf.Bytes(), int64(s.pages)*int64(PageSize)); err != nil {
+		return err
+	}
+	s.pages++
+	s.page = nil
+	return nil
+}
+
+// Return an iterator over the tuples of the file, in the order they were
+// added. No tuples may be added once the file is read.
+func (s *spillFile) iterator() (func() (*Tuple, error), error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	pageNo, i := 0, 0
+	var tuples []*Tuple
+	return func() (*Tuple, error) {
+		for i == len(tuples) {
+			if pageNo == s.pages {
+				return nil, nil
+			}
+			data := make([]byte, PageSize)
+			if _, err := s.file.file.ReadAt(data, int64(pageNo)*int64(PageSize)); err != nil {
+				return nil, err
+			}
+			page := &heapPage{Desc: s.file.Desc, PageNo: pageNo}
+			if err := page.initFromBuffer(bytes.NewBuffer(data)); err != nil {
+				return nil, err
+			}
+			tuples, i = page.Tuples[:page.UsedSlotsNum], 0
+			pageNo++
+		}
+		i++
+		stored := tuples[i-1]
+		fields := make([]DBValue, 0, s.fields)
+		for j := 0; j < len(stored.Fields); j++ {
+			v := stored.Fields[j]
+			if _, ok := v.(StringField); ok {
+				j++
+				if offset := stored.Fields[j].(IntField).Value; offset >= 0 {
+					str, err := s.readLong(offset)
+					if err != nil {
+						return nil, err
+					}
+					v = StringField{str}
+				}
+			}
+			fields = append(fields, v)
+		}
+		// the record ids of the tuples added are not kept
+		return &Tuple{Desc: s.desc, Fields: fields}, nil
+	}, nil
+}
+
+// Close the file, freeing its space.
+func (s *spillFile) close() {
+	s.file.file.Close()
+	if s.long != nil {
+		s.long.Close()
+	}
+}
+
+// Hash the values of key with seed, consistently with comparing their
+// [mapKey]s with ==, e.g., to partition tuples by their join keys.
+func hashKey(seed maphash.Seed, key []DBValue) uint64 {
+	var h maphash.Hash
+	h.SetSeed(seed)
+	for _, v := range key {
+		if f, ok := v.(FloatField); ok && f.Value == 0 {
+			// -0 == 0
+			v = FloatField{0}
+		}
+		v = keyValue(v)
+		fmt.Fprintf(&h, "%T:%v;", v, v)
+	}
+	return h.Sum64()
+}
+
+// A tupleBuffer holds tuples in memory while there are at most maxTuples of
+// them, or any number if maxTuples is not positive, and in a [spillFile]
+// beyond.
+type tupleBuffer struct {
+	maxTuples int
+	tuples    []*Tuple
+	file      *spillFile
+}
+
+// Append t to the buffer.
+func (b *tupleBuffer) add(t *Tuple) error {
+	if b.file == nil && (b.maxTuples <= 0 || len(b.tuples) < b.maxTuples) {
+		b.tuples = append(b.tuples, t)
+		return nil
+	}
+	if b.file == nil {
+		f, err := newSpillFile(b.tuples[0])
+		if err != nil {
+			return err
+		}
+		b.file = f
+		for _, t := range b.tuples {
+			if err := f.add(t); err != nil {
+				return err
+			}
+		}
+		b.tuples = nil
+	}
+	return b.file.add(t)
+}
+
+// Return an iterator over the tuples of the buffer, in the order they were
+// added.
+func (b *tupleBuffer) iterator() (func() (*Tuple, error), error) {
+	if b.file != nil {
+		return b.file.iterator()
+	}
+	return sliceIterator(b.tuples), nil
+}
+
+// Discard the tuples of the buffer.
+func (b *tupleBuffer) close() {
+	if b.file != nil {
+		b.file.close()
+	}
+	b.tuples, b.file = nil, nil
+}
+
+// Return an iterator over tuples.
+func sliceIterator(tuples []*Tuple) func() (*Tuple, error) {
+	i := 0
+	return func() (*Tuple, error) {
+		if i == len(tuples) {
+			return nil, nil
+		}
+		i++
+		return tuples[i-1], nil
+	}
+}
@@ -0,0 +1,47 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+// test that strings longer than StringLength are read back from a spill file
+// whole
+func TestSpillFileLongStrings(t *testing.T) {
+	desc := TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "key", Ftype: IntType},
+		{Fname: "note", Ftype: StringType},
+	}}
+	var tuples []*Tuple
+	for i := 0; i < 300; i++ {
+		name := strings.Repeat("x", StringLength) + strings.Repeat("y", i%50)
+		tuples = append(tuples, &Tuple{Desc: desc, Fields: []DBValue{StringField{name}, IntField{int64(i)}, StringField{"short"}}})
+	}
+	f, err := newSpillFile(tuples[0])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.close()
+	for _, tup := range tuples {
+		if err := f.add(tup); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	iter, err := f.iterator()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, want := range tuples {
+		got, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if got == nil || !got.equals(want) {
+			t.Fatalf("tuple %d: expected %v, got %v", i, want.Fields, got)
+		}
+	}
+	if got, _ := iter(); got != nil {
+		t.Fatalf("expected %d tuples, got more", len(tuples))
+	}
+}
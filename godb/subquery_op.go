@@ -0,0 +1,243 @@
+package godb
+
+import "fmt"
+
+// SubqueryKind identifies how the result of a subquery in a WHERE clause is
+// used by the predicate that contains it.
+type SubqueryKind int
+
+const (
+	SubqueryIn        SubqueryKind = iota // expr IN (SELECT ...)
+	SubqueryNotIn     SubqueryKind = iota // expr NOT IN (SELECT ...)
+	SubqueryExists    SubqueryKind = iota // EXISTS (SELECT ...)
+	SubqueryNotExists SubqueryKind = iota // NOT EXISTS (SELECT ...)
+	SubqueryScalar    SubqueryKind = iota // expr op (SELECT ...)
+)
+
+func (k SubqueryKind) String() string {
+	switch k {
+	case SubqueryIn:
+		return "IN"
+	case SubqueryNotIn:
+		return "NOT IN"
+	case SubqueryExists:
+		return "EXISTS"
+	case SubqueryNotExists:
+		return "NOT EXISTS"
+	case SubqueryScalar:
+		return "SCALAR"
+	}
+	return "??"
+}
+
+// SemiJoin returns the tuples of its left input that have (or, for an anti
+// join, do not have) a match in its right input under the equality predicate
+// of the underlying [EqualityJoin]. Each left tuple is returned at most once,
+// and only the fields of the left input are returned.
+type SemiJoin struct {
+	join *EqualityJoin
+	anti bool
+}
+
+// Construct a semi join (or an anti join, if anti is true) of left and right on
+// leftField = rightField, which holds as many tuples as fit in [JoinWorkMem].
+func NewSemiJoin(left Operator, leftField Expr, right Operator, rightField Expr, anti bool) (*SemiJoin, error) {
+	join, err := NewJoin(left, leftField, right, rightField, joinBufferSize(left.Descriptor(), right.Descriptor()))
+	if err != nil {
+		return nil, err
+	}
+	return &SemiJoin{join, anti}, nil
+}
+
+// Return the TupleDesc of the left input; the right input is only used to
+// decide which left tuples to return.
+func (sj *SemiJoin) Descriptor() *TupleDesc {
+	return (*sj.join.left).Descriptor()
+}
+
+// Semi join implementation. Builds the set of right join keys, and then
+// streams through the left input, returning the tuples whose key is (or is
+// not) in the set.
+func (sj *SemiJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	rightIter, err := (*sj.join.right).Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[any]bool)
+	for {
+		tup, err := rightIter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			break
+		}
+		key, err := evalJoinKey(sj.join.rightFields, tup)
+		if err != nil {
+			return nil, err
+		}
+		keys[mapKey(key)] = true
+	}
+
+	leftIter, err := (*sj.join.left).Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			tup, err := leftIter()
+			if err != nil {
+				return nil, err
+			}
+			if tup == nil {
+				return nil, nil
+			}
+			key, err := evalJoinKey(sj.join.leftFields, tup)
+			if err != nil {
+				return nil, err
+			}
+			if keys[mapKey(key)] != sj.anti {
+				return tup, nil
+			}
+		}
+	}, nil
+}
+
+// SubqueryFilter returns the tuples of its child for which a predicate over a
+// subquery holds. If the subquery is correlated, it is re-evaluated for every
+// child tuple, with the child tuple bound as the outer tuple of the subquery's
+// [OuterRefExpr]s. Otherwise, its result is computed once and reused.
+type SubqueryFilter struct {
+	kind     SubqueryKind
+	left     Expr   // compared with the subquery result; nil for EXISTS
+	op       BoolOp // comparison for scalar subqueries
+	subquery Operator
+	outer    *outerBinding // nil if the subquery is not correlated
+	child    Operator
+}
+
+// Construct a subquery filter. outer should be the binding referenced by the
+// OuterRefExprs of subquery, or nil if subquery is not correlated.
+func NewSubqueryFilter(kind SubqueryKind, left Expr, op BoolOp, subquery Operator, outer *outerBinding, child Operator) (*SubqueryFilter, error) {
+	if left == nil && kind != SubqueryExists && kind != SubqueryNotExists {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("%s subquery requires an expression to compare with", kind)}
+	}
+	return &SubqueryFilter{kind, left, op, subquery, outer, child}, nil
+}
+
+// Return the TupleDesc of the child; the subquery only filters its tuples.
+func (f *SubqueryFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+// Return the values of the first field of the subquery, stopping early once
+// limit values have been read (limit < 0 means no limit).
+func (f *SubqueryFilter) subqueryValues(tid TransactionID, limit int) ([]DBValue, error) {
+	iter, err := f.subquery.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var vals []DBValue
+	for limit < 0 || len(vals) < limit {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			break
+		}
+		if len(tup.Fields) == 0 {
+			return nil, GoDBError{MalformedDataError, "subquery returned a tuple with no fields"}
+		}
+		vals = append(vals, tup.Fields[0])
+	}
+	return vals, nil
+}
+
+// Evaluate the predicate for tuple t given the subquery result vals.
+func (f *SubqueryFilter) matches(t *Tuple, vals []DBValue) (bool, error) {
+	switch f.kind {
+	case SubqueryExists:
+		return len(vals) > 0, nil
+	case SubqueryNotExists:
+		return len(vals) == 0, nil
+	}
+
+	leftVal, err := f.left.EvalExpr(t)
+	if err != nil {
+		return false, err
+	}
+	switch f.kind {
+	case SubqueryIn, SubqueryNotIn:
+		found := false
+		for _, v := range vals {
+			if leftVal.EvalPred(v, OpEq) {
+				found = true
+				break
+			}
+		}
+		return found == (f.kind == SubqueryIn), nil
+	case SubqueryScalar:
+		if len(vals) > 1 {
+			return false, GoDBError{IllegalOperationError, "scalar subquery returned more than one row"}
+		}
+		if len(vals) == 0 {
+			return false, nil
+		}
+		return leftVal.EvalPred(vals[0], f.op), nil
+	}
+	return false, GoDBError{IllegalOperationError, fmt.Sprintf("unknown subquery kind %d", f.kind)}
+}
+
+// Subquery filter implementation. EXISTS subqueries are only read until their
+// first tuple, and scalar subqueries until their second (to detect subqueries
+// that return more than one row).
+func (f *SubqueryFilter) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := f.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	limit := -1
+	switch f.kind {
+	case SubqueryExists, SubqueryNotExists:
+		limit = 1
+	case SubqueryScalar:
+		limit = 2
+	}
+
+	var cached []DBValue
+	if f.outer == nil {
+		cached, err = f.subqueryValues(tid, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() (*Tuple, error) {
+		for {
+			tup, err := childIter()
+			if err != nil {
+				return nil, err
+			}
+			if tup == nil {
+				return nil, nil
+			}
+			vals := cached
+			if f.outer != nil {
+				f.outer.tuple = tup
+				vals, err = f.subqueryValues(tid, limit)
+				f.outer.tuple = nil
+				if err != nil {
+					return nil, err
+				}
+			}
+			match, err := f.matches(tup, vals)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				return tup, nil
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,159 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+// Run query against the parser test database and return the number of result
+// tuples, failing the test if planning or execution fails.
+func countQueryResults(t *testing.T, bp *BufferPool, c *Catalog, query string) (Operator, int) {
+	t.Helper()
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, query)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", query, err.Error())
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf("failed to run, q=%s, %s", query, err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("failed to run, q=%s, %s", query, err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+	}
+	return plan, cnt
+}
+
+func TestSubqueryWhere(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name, age from t where age in (select age from t2 where name = 'sam')", 3},
+		{"select name, age from t where age not in (select age from t2 where name = 'sam')", 9},
+		{"select name from t where exists (select name from t2 where t2.age = t.age and t2.name = 'riza')", 3},
+		{"select name from t where not exists (select name from t2 where t2.age = t.age and t2.name = 'riza')", 9},
+		{"select name from t where exists (select name from t2 where t2.age = t.age and t2.name <> t.name)", 4},
+		{"select name from t where age > (select avg(age) from t2)", 4},
+		{"select name from t where (select min(age) from t2) = age", 2},
+		{"select name, age from t where age = (select max(age) from t2 where t2.name = t.name)", 10},
+		{"select name from t where name in (select name from t2 where t2.age > t.age)", 2},
+	}
+	for _, q := range queries {
+		_, cnt := countQueryResults(t, bp, c, q.sql)
+		if cnt != q.expected {
+			t.Errorf("query '%s' returned %d tuples, expected %d", q.sql, cnt, q.expected)
+		}
+	}
+}
+
+func TestSubqueryDecorrelated(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan, _ := countQueryResults(t, bp, c, "select name from t where exists (select name from t2 where t2.age = t.age)")
+	var found *SemiJoin
+	var walk func(o Operator)
+	walk = func(o Operator) {
+		switch op := o.(*OperatorCard).Op.(type) {
+		case *SemiJoin:
+			found = op
+		case *Project:
+			walk(op.child)
+		}
+	}
+	walk(plan)
+	if found == nil {
+		t.Fatalf("expected correlated EXISTS to be planned as a semi join")
+	}
+	if found.anti {
+		t.Errorf("expected EXISTS to be planned as a semi join, not an anti join")
+	}
+}
+
+func TestSemiJoin(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	ages := NewValueOp([][]Expr{{&ConstExpr{IntField{t2.Fields[1].(IntField).Value}, IntType}}})
+	left := &FieldExpr{t1.Desc.Fields[1]}
+	right := &FieldExpr{ages.Descriptor().Fields[0]}
+
+	for _, anti := range []bool{false, true} {
+		sj, err := NewSemiJoin(hf, left, ages, right, anti)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := sj.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if anti != tup.equals(&t1) {
+				t.Errorf("unexpected tuple %v (anti=%v)", tup, anti)
+			}
+			cnt++
+		}
+		expected := 2
+		if anti {
+			expected = 1
+		}
+		if cnt != expected {
+			t.Errorf("unexpected number of results %d, expected %d (anti=%v)", cnt, expected, anti)
+		}
+	}
+}
+
+// test that the values compared by IN are converted to a common type, as
+// they are by a comparison
+func TestSubqueryInCoercion(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("ty"))
+	defer os.Remove(c.tableNameToFile("ty"))
+	if _, _, err := Parse(c, "create table ty (id int, f float)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	countQueryResults(t, bp, c, "insert into ty values (1, 2.0), (2, 2.5), (3, 0.5)")
+
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select id from ty where id in (select f from ty)", 1},
+		{"select id from ty where id not in (select f from ty)", 2},
+		{"select id from ty where f in (select id from ty)", 1},
+		{"select id from ty where exists (select id from ty t where t.id = ty.f)", 1},
+	} {
+		_, n := countQueryResults(t, bp, c, q.sql)
+		if n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+}
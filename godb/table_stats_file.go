@@ -0,0 +1,158 @@
+package godb
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The statistics of the tables of a catalog are saved as JSON in a file next
+// to the catalog file, see [statsFileName]. The types below mirror those of
+// [TableStats] and its histograms.
+
+type savedTableStats struct {
+	Pages        int                        `json:"pages"`
+	Tuples       int                        `json:"tuples"`
+	AnalyzedTups int                        `json:"analyzed_tuples"`
+	Modified     int                        `json:"modified"`
+	Columns      map[string]*savedHistogram `json:"columns"`
+}
+
+// A saved histogram: the bins of an [IntHistogram], the most common values
+// and bins of a [StringHistogram], or the values of a [distinctCount], as
+// SQL literals.
+type savedHistogram struct {
+	Total      int                `json:"total"`
+	IntBins    []savedBin[int64]  `json:"int_bins,omitempty"`
+	StringBins []savedBin[string] `json:"string_bins,omitempty"`
+	MCVs       map[string]int     `json:"mcvs,omitempty"`
+	Values     map[string]int     `json:"values,omitempty"`
+}
+
+type savedBin[T cmp.Ordered] struct {
+	Lo       T   `json:"lo"`
+	Hi       T   `json:"hi"`
+	Count    int `json:"count"`
+	Distinct int `json:"distinct"`
+}
+
+func saveBins[T cmp.Ordered](bins equiDepthBins[T]) []savedBin[T] {
+	saved := make([]savedBin[T], len(bins))
+	for i, b := range bins {
+		saved[i] = savedBin[T]{b.lo, b.hi, b.count, b.distinct}
+	}
+	return saved
+}
+
+func loadBins[T cmp.Ordered](saved []savedBin[T]) equiDepthBins[T] {
+	bins := make(equiDepthBins[T], len(saved))
+	for i, b := range saved {
+		bins[i] = histogramBin[T]{b.Lo, b.Hi, b.Count, b.Distinct}
+	}
+	return bins
+}
+
+// Return the name of the file the statistics of the catalog in catalogFile
+// are saved in: the name of the catalog file with the extension .stats.
+func statsFileName(catalogFile string) string {
+	return strings.TrimSuffix(catalogFile, filepath.Ext(catalogFile)) + ".stats"
+}
+
+func saveHistogram(h Histogram) *savedHistogram {
+	switch h := h.(type) {
+	case *IntHistogram:
+		return &savedHistogram{Total: h.total, IntBins: saveBins(h.bins)}
+	case *StringHistogram:
+		return &savedHistogram{Total: h.total, StringBins: saveBins(h.bins), MCVs: h.mcvs}
+	case *distinctCount:
+		values := make(map[string]int)
+		for v, n := range h.counts {
+			values[sqlLiteral(v.(DBValue))] = n
+		}
+		return &savedHistogram{Total: h.total, Values: values}
+	}
+	return nil
+}
+
+// Return the histogram saved as h of a column of type t.
+func loadHistogram(h *savedHistogram, t DBType) (Histogram, error) {
+	switch t {
+	case IntType, DateType, TimestampType, DecimalType:
+		return &IntHistogram{loadBins(h.IntBins), h.Total}, nil
+	case StringType:
+		mcvs := h.MCVs
+		if mcvs == nil {
+			mcvs = make(map[string]int)
+		}
+		return &StringHistogram{mcvs, loadBins(h.StringBins), h.Total}, nil
+	}
+	d := &distinctCount{counts: make(map[any]int), total: h.Total}
+	for lit, n := range h.Values {
+		v, err := parseLiteral(t, lit)
+		if err != nil {
+			return nil, err
+		}
+		d.counts[v] = n
+	}
+	return d, nil
+}
+
+// Save the statistics of the tables of c next to the catalog file
+// catalogFile in rootPath, see [statsFileName].
+func (c *Catalog) SaveStatsToFile(catalogFile string, rootPath string) error {
+	saved := make(map[string]*savedTableStats)
+	for name, t := range c.tableMap {
+		if t.stats == nil {
+			continue
+		}
+		ts := &savedTableStats{t.stats.basePages, t.stats.baseTups, t.stats.analyzedTups, t.stats.modified, make(map[string]*savedHistogram)}
+		for field, h := range t.stats.histograms {
+			ts.Columns[field] = saveHistogram(h)
+		}
+		saved[name] = ts
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(rootPath+"/"+statsFileName(catalogFile), data, 0644)
+}
+
+// Load the statistics of the tables of c saved next to its catalog file, if
+// any. Statistics of tables and columns that no longer exist are ignored.
+func (c *Catalog) loadStats() error {
+	data, err := os.ReadFile(c.rootPath + "/" + statsFileName(c.filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved map[string]*savedTableStats
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return GoDBError{ParseError, fmt.Sprintf("malformed statistics file %s: %s", statsFileName(c.filePath), err.Error())}
+	}
+	for name, s := range saved {
+		t, ok := c.tableMap[name]
+		if !ok {
+			continue
+		}
+		ts := &TableStats{basePages: s.Pages, baseTups: s.Tuples, histograms: make(map[string]Histogram), tupleDesc: t.desc.copy(), analyzedTups: s.AnalyzedTups, modified: s.Modified}
+		for _, f := range t.desc.Fields {
+			h, ok := s.Columns[f.Fname]
+			if !ok || h == nil {
+				continue
+			}
+			if ts.histograms[f.Fname], err = loadHistogram(h, f.Ftype); err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("malformed statistics of %s.%s: %s", name, f.Fname, err.Error())}
+			}
+		}
+		t.stats = ts
+	}
+	return nil
+}
@@ -15,25 +15,144 @@ type Stats interface {
 type TableStats struct {
 	basePages  int
 	baseTups   int
-	histograms map[string]any
+	histograms map[string]Histogram // by field name
 	tupleDesc  *TupleDesc
+
+	// the number of tuples when the table was analyzed, and the number of
+	// tuples inserted and deleted since
+	analyzedTups int
+	modified     int
 }
 
 // The default cost to read a page from disk. This value can be adjusted to
 // accommodate different storage devices.
 const CostPerPage = 1000
 
+// The fraction of the tuples of a table that must be inserted or deleted
+// after the table is analyzed for it to be analyzed again; 0 disables
+// analyzing tables automatically.
+var AutoAnalyzeFraction = 0.2
+
 // Number of bins for histograms. Feel free to increase this value over 100,
 // though our tests assume that you have at least 100 bins in your histograms.
 const NumHistBins = 100
 
-// Dummy Implementations to implement the interface
+// Compute the statistics of the tuples of file, read in transaction tid: the
+// number of pages and tuples, and a histogram of the values of each field.
+// Pages are read one by one rather than with [HeapFile.Iterator], so that a
+// page locked by another transaction is an error rather than a wait.
+func computeTableStats(file *HeapFile, tid TransactionID) (*TableStats, error) {
+	desc := file.Descriptor()
+	ts := &TableStats{basePages: file.NumPages(), tupleDesc: desc.copy(), histograms: make(map[string]Histogram)}
+	ints := make([][]int64, len(desc.Fields))
+	strs := make([][]string, len(desc.Fields))
+	others := make([]*distinctCount, len(desc.Fields))
+	for i := range others {
+		others[i] = &distinctCount{counts: make(map[any]int)}
+	}
+	for pageNo := 0; pageNo < file.NumPages(); pageNo++ {
+		page, err := file.bufPool.GetPage(file, pageNo, tid, ReadPerm)
+		if err != nil {
+			return nil, err
+		}
+		iter := page.(*heapPage).tupleIter()
+		for {
+			tup, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if tup == nil {
+				break
+			}
+			ts.baseTups++
+			for i, v := range tup.Fields {
+				if n, ok := intHistogramValue(v); ok {
+					ints[i] = append(ints[i], n)
+				} else if s, ok := v.(StringField); ok {
+					strs[i] = append(strs[i], s.Value)
+				} else {
+					others[i].counts[v]++
+					others[i].total++
+				}
+			}
+		}
+	}
+	for i, f := range desc.Fields {
+		switch f.Ftype {
+		case IntType, DateType, TimestampType, DecimalType:
+			ts.histograms[f.Fname] = NewIntHistogram(ints[i], NumHistBins)
+		case StringType:
+			ts.histograms[f.Fname] = NewStringHistogram(strs[i], NumHistBins, NumMCVs)
+		default:
+			ts.histograms[f.Fname] = others[i]
+		}
+	}
+	ts.analyzedTups = ts.baseTups
+	return ts, nil
+}
+
+// Update the statistics for the tuples inserted into and deleted from the
+// table, which now has pages pages.
+func (ts *TableStats) applyChanges(inserted []*Tuple, deleted []*Tuple, pages int) {
+	ts.basePages = pages
+	ts.baseTups = max(ts.baseTups+len(inserted)-len(deleted), 0)
+	ts.modified += len(inserted) + len(deleted)
+	for _, change := range []struct {
+		tuples []*Tuple
+		n      int
+	}{{inserted, 1}, {deleted, -1}} {
+		for _, tup := range change.tuples {
+			for i, f := range tup.Desc.Fields {
+				if h, ok := ts.histograms[f.Fname]; ok {
+					h.add(tup.Fields[i], change.n)
+				}
+			}
+		}
+	}
+}
+
+// Report whether enough tuples were inserted and deleted since the table
+// was analyzed for it to be analyzed again, see [AutoAnalyzeFraction].
+func (ts *TableStats) stale() bool {
+	return AutoAnalyzeFraction > 0 && float64(ts.modified) > AutoAnalyzeFraction*float64(ts.analyzedTups)
+}
+
+// The cost of scanning the table, as the cost of reading its pages.
 func (ts *TableStats) EstimateScanCost() float64 {
-	return 0
+	return float64(ts.basePages) * CostPerPage
 }
+
+// The number of tuples of the table that satisfy predicates of the given
+// selectivity.
 func (ts *TableStats) EstimateCardinality(selectivity float64) int {
-	return 0
+	return int(float64(ts.baseTups)*selectivity + 0.5)
 }
+
+// Estimate the fraction of the tuples of the table for which
+// "field op value" holds, from the histogram of field.
 func (ts *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error) {
-	return 0.5, nil
-}
\ No newline at end of file
+	h, ok := ts.histograms[field]
+	if !ok {
+		return defaultSelectivity(op), nil
+	}
+	if d, ok := value.(DecimalField); ok && ts.tupleDesc != nil {
+		// the histogram of a DECIMAL column holds the Values of decimals of
+		// the scale of the column
+		if i := columnIndex(ts.tupleDesc.Fields, field); i >= 0 {
+			if d, err := d.rescale(ts.tupleDesc.Fields[i].Scale); err == nil {
+				value = d
+			}
+		}
+	}
+	return h.EstimateSelectivity(op, value), nil
+}
+
+// Estimate the number of distinct values of field, or return false if the
+// table has no such field.
+func (ts *TableStats) DistinctValues(field string) (int, bool) {
+	h, ok := ts.histograms[field]
+	if !ok {
+		return 0, false
+	}
+	return h.DistinctValues(), true
+}
@@ -0,0 +1,276 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"testing"
+)
+
+func expectSelectivity(t *testing.T, what string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 0.01 {
+		t.Errorf("%s: expected selectivity %.3f, got %.3f", what, want, got)
+	}
+}
+
+func TestIntHistogram(t *testing.T) {
+	var values []int64
+	for i := 1; i <= 1000; i++ {
+		values = append(values, int64(i))
+	}
+	h := NewIntHistogram(values, NumHistBins)
+	for _, c := range []struct {
+		op    BoolOp
+		value int64
+		want  float64
+	}{
+		{OpEq, 500, 0.001},
+		{OpNeq, 500, 0.999},
+		{OpLt, 250, 0.249},
+		{OpLe, 250, 0.25},
+		{OpGt, 750, 0.25},
+		{OpGe, 1, 1},
+		{OpLt, 1, 0},
+		{OpGt, 2000, 0},
+		{OpEq, -5, 0},
+	} {
+		expectSelectivity(t, fmt.Sprintf("v %s %d", c.op, c.value), h.EstimateSelectivity(c.op, IntField{c.value}), c.want)
+	}
+	if h.DistinctValues() != 1000 {
+		t.Errorf("expected 1000 distinct values, got %d", h.DistinctValues())
+	}
+
+	// a value more common than a bin is in a bin of its own
+	values = values[:100]
+	for i := 0; i < 900; i++ {
+		values = append(values, 5)
+	}
+	h = NewIntHistogram(values, NumHistBins)
+	expectSelectivity(t, "skewed v = 5", h.EstimateSelectivity(OpEq, IntField{5}), 0.901)
+	expectSelectivity(t, "skewed v > 5", h.EstimateSelectivity(OpGt, IntField{5}), 0.095)
+	if h.DistinctValues() != 100 {
+		t.Errorf("expected 100 distinct values, got %d", h.DistinctValues())
+	}
+}
+
+func TestStringHistogram(t *testing.T) {
+	var values []string
+	for i := 0; i < 50; i++ {
+		values = append(values, "apple")
+	}
+	for i := 0; i < 30; i++ {
+		values = append(values, "banana")
+	}
+	for i := 1; i <= 20; i++ {
+		values = append(values, fmt.Sprintf("cherry%02d", i))
+	}
+	h := NewStringHistogram(values, NumHistBins, NumMCVs)
+	for _, c := range []struct {
+		op    BoolOp
+		value string
+		want  float64
+	}{
+		{OpEq, "apple", 0.5},
+		{OpNeq, "apple", 0.5},
+		{OpEq, "cherry05", 0.01},
+		{OpEq, "date", 0},
+		{OpLt, "b", 0.5},
+		{OpGe, "cherry", 0.2},
+		{OpLike, "ban%", 0.3},
+		{OpLike, "cherry%", 0.2},
+		{OpLike, "%e%", 0.7},
+		{OpLike, "apple", 0.5},
+		{OpLike, "%zz%", 0.01},
+	} {
+		expectSelectivity(t, fmt.Sprintf("v %s %q", c.op, c.value), h.EstimateSelectivity(c.op, StringField{c.value}), c.want)
+	}
+	if h.DistinctValues() != 22 {
+		t.Errorf("expected 22 distinct values, got %d", h.DistinctValues())
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	for _, c := range []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"banana", "ban%", true},
+		{"banana", "%ana", true},
+		{"banana", "%n_n%", true},
+		{"banana", "b_n", false},
+		{"banana", "banana", true},
+		{"banana", "%", true},
+		{"", "%", true},
+		{"banana", "%x%", false},
+		{"a.b", "a.b", true},
+		{"axb", "a.b", false},
+	} {
+		if got := likeMatch(c.s, c.pattern); got != c.want {
+			t.Errorf("%q LIKE %q: expected %v, got %v", c.s, c.pattern, c.want, got)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	stats := c.GetTableStats("t")
+	if stats == nil {
+		t.Fatalf("expected the test database to be analyzed")
+	}
+	if stats.EstimateCardinality(1) != 12 || stats.EstimateScanCost() != CostPerPage {
+		t.Errorf("expected 12 tuples on one page, got %d tuples at cost %f", stats.EstimateCardinality(1), stats.EstimateScanCost())
+	}
+	for _, c := range []struct {
+		field string
+		op    BoolOp
+		value DBValue
+		want  float64
+	}{
+		{"age", OpGt, IntField{40}, 0.5},
+		{"age", OpEq, IntField{99}, 2.0 / 12},
+		{"name", OpEq, StringField{"sam"}, 2.0 / 12},
+		{"name", OpLike, StringField{"%a%"}, 9.0 / 12},
+	} {
+		sel, err := stats.EstimateSelectivity(c.field, c.op, c.value)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		expectSelectivity(t, fmt.Sprintf("%s %s %v", c.field, c.op, c.value), sel, c.want)
+	}
+	if n, _ := stats.DistinctValues("name"); n != 10 {
+		t.Errorf("expected 10 distinct names, got %d", n)
+	}
+
+	if err := execStatement(t, bp, c, "insert into t values ('zed', 55), ('amy', 10), ('sam', 70)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	qtype, _, err := Parse(c, "analyze t")
+	if err != nil || qtype != AnalyzeQueryType {
+		t.Fatalf("expected ANALYZE to succeed, got %v %v", qtype, err)
+	}
+	stats = c.GetTableStats("t")
+	if stats.EstimateCardinality(1) != 15 {
+		t.Errorf("expected 15 tuples after analyzing again, got %d", stats.EstimateCardinality(1))
+	}
+	if c.GetTableStats("t2").EstimateCardinality(1) != 12 {
+		t.Errorf("expected ANALYZE t to leave the statistics of t2 alone")
+	}
+	for _, sql := range []string{"analyze nosuch", "analyze t t2"} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error for %s", sql)
+		}
+	}
+}
+
+func TestStatsMaintenance(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	defer func(fraction float64) { AutoAnalyzeFraction = fraction }(AutoAnalyzeFraction)
+	AutoAnalyzeFraction = 0
+
+	// committed inserts and deletes update the statistics
+	for _, sql := range []string{
+		"insert into t values ('zed', 55), ('amy', 10), ('sam', 70)",
+		"delete from t where name = 'riza'",
+	} {
+		if err := execStatement(t, bp, c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	stats := c.GetTableStats("t")
+	if stats.EstimateCardinality(1) != 13 {
+		t.Errorf("expected 13 tuples after inserting 3 and deleting 2, got %d", stats.EstimateCardinality(1))
+	}
+	for _, c := range []struct {
+		field string
+		op    BoolOp
+		value DBValue
+		want  float64
+	}{
+		{"name", OpEq, StringField{"sam"}, 3.0 / 13},
+		{"name", OpEq, StringField{"riza"}, 0},
+		{"name", OpEq, StringField{"zed"}, 1.0 / 13},
+		{"age", OpEq, IntField{10}, 1.0 / 13},
+	} {
+		sel, err := stats.EstimateSelectivity(c.field, c.op, c.value)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		expectSelectivity(t, fmt.Sprintf("%s %s %v", c.field, c.op, c.value), sel, c.want)
+	}
+
+	// aborted changes are not
+	tid := BeginTransactionForTest(t, bp)
+	_, op, err := Parse(c, "insert into t values ('x', 1)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.AbortTransaction(tid)
+	if stats.EstimateCardinality(1) != 13 {
+		t.Errorf("expected an aborted insert to leave the statistics alone, got %d tuples", stats.EstimateCardinality(1))
+	}
+
+	// a table that changed by more than AutoAnalyzeFraction is analyzed
+	// again after the next change
+	AutoAnalyzeFraction = 0.2
+	if err := execStatement(t, bp, c, "delete from t where name = 'zed'"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c.GetTableStats("t") == stats {
+		t.Fatalf("expected t to be analyzed again")
+	}
+	if stats = c.GetTableStats("t"); stats.modified != 0 || stats.analyzedTups != 12 {
+		t.Errorf("expected a fresh analysis of 12 tuples, got %d tuples and %d changes", stats.analyzedTups, stats.modified)
+	}
+	if err := execStatement(t, bp, c, "insert into t values ('zed', 55)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c.GetTableStats("t") != stats {
+		t.Errorf("expected a small change not to analyze t again")
+	}
+
+	// the statistics are saved with the catalog
+	catFile := "stats_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	loaded := c2.GetTableStats("t")
+	if loaded == nil {
+		t.Fatalf("expected the statistics of t to be loaded with the catalog")
+	}
+	if loaded.EstimateCardinality(1) != 13 || loaded.modified != 1 || loaded.analyzedTups != 12 {
+		t.Errorf("expected 13 tuples and 1 change since 12 were analyzed, got %d, %d and %d", loaded.EstimateCardinality(1), loaded.modified, loaded.analyzedTups)
+	}
+	for _, field := range []string{"name", "age"} {
+		for _, v := range []DBValue{StringField{"sam"}, IntField{40}} {
+			want, _ := stats.EstimateSelectivity(field, OpLe, v)
+			got, _ := loaded.EstimateSelectivity(field, OpLe, v)
+			expectSelectivity(t, fmt.Sprintf("loaded %s <= %v", field, v), got, want)
+		}
+	}
+	if n, _ := loaded.DistinctValues("name"); n != 11 {
+		t.Errorf("expected 11 distinct names, got %d", n)
+	}
+	if c2.GetTableStats("t2").EstimateCardinality(1) != 12 {
+		t.Errorf("expected the statistics of t2 to be loaded with the catalog")
+	}
+}
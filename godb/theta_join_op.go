@@ -0,0 +1,264 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ThetaJoin joins the tuples of its inputs that satisfy a conjunction of
+// comparisons between them other than equalities, e.g., "a.t < b.t" or
+// "a.t BETWEEN b.start AND b.end".
+//
+// The right input is read a buffer of at most maxBufferSize tuples at a time,
+// and each tuple of the left input is compared with the tuples of each buffer
+// (a block nested loops join); if the right input takes more than one buffer,
+// the left input is spilled so that it can be read once per buffer. If some of
+// the comparisons are ranges on the same expression over the right input,
+// each buffer is sorted by it, and each left tuple is only compared with the
+// tuples in its range (a band join).
+type ThetaJoin struct {
+	// Expressions over the tuples of the left and right inputs, compared
+	// pairwise by ops
+	leftExprs, rightExprs []Expr
+	ops                   []BoolOp
+
+	left, right Operator
+
+	maxBufferSize int
+
+	band []int // the comparisons that are ranges on the expression the buffers are sorted by
+}
+
+// Construct a join of left and right on the conjunction of the comparisons of
+// each of leftExprs with the corresponding one of rightExprs by the
+// corresponding one of ops, holding at most maxBufferSize tuples of right in
+// memory at a time, or all of them if maxBufferSize is not positive.
+func NewThetaJoin(left Operator, leftExprs []Expr, ops []BoolOp, right Operator, rightExprs []Expr, maxBufferSize int) (*ThetaJoin, error) {
+	if len(ops) == 0 || len(leftExprs) != len(ops) || len(rightExprs) != len(ops) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("cannot join with %d comparisons of %d and %d expressions", len(ops), len(leftExprs), len(rightExprs))}
+	}
+	var band []int
+	for i, op := range ops {
+		switch op {
+		case OpEq, OpNeq, OpLike:
+			continue
+		}
+		if len(band) == 0 || exprToStr(rightExprs[i]) == exprToStr(rightExprs[band[0]]) {
+			band = append(band, i)
+		}
+	}
+	return &ThetaJoin{leftExprs, rightExprs, ops, left, right, maxBufferSize, band}, nil
+}
+
+// Return the name of the algorithm the join uses.
+func (tj *ThetaJoin) method() string {
+	if len(tj.band) > 0 {
+		return "Band Join"
+	}
+	return "Block Nested Loop Join"
+}
+
+// Return the join predicate, e.g., "a.t >= b.start AND a.t <= b.end".
+func (tj *ThetaJoin) condition() string {
+	conds := make([]string, len(tj.ops))
+	for i, op := range tj.ops {
+		conds[i] = fmt.Sprintf("%s %s %s", exprToStr(tj.leftExprs[i]), opToStr(op), exprToStr(tj.rightExprs[i]))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// Return the union of the fields of the left and right inputs.
+func (tj *ThetaJoin) Descriptor() *TupleDesc {
+	return tj.left.Descriptor().merge(tj.right.Descriptor())
+}
+
+// A tuple of a buffer of the right input, with the value of the expression
+// the buffer is sorted by.
+type bandEntry struct {
+	tuple *Tuple
+	key   DBValue
+}
+
+// Read a buffer of tuples from iter, sorted by the band expression if there is
+// one. If iter has more tuples, the last one read, which is not in the buffer,
+// is returned too.
+func (tj *ThetaJoin) readBuffer(iter func() (*Tuple, error)) ([]bandEntry, *Tuple, error) {
+	var buffer []bandEntry
+	for {
+		t, err := iter()
+		if err != nil {
+			return nil, nil, err
+		}
+		if t == nil {
+			break
+		}
+		if tj.maxBufferSize > 0 && len(buffer) == tj.maxBufferSize {
+			return tj.sortBuffer(buffer), t, nil
+		}
+		e := bandEntry{tuple: t}
+		if len(tj.band) > 0 {
+			if e.key, err = tj.rightExprs[tj.band[0]].EvalExpr(t); err != nil {
+				return nil, nil, err
+			}
+		}
+		buffer = append(buffer, e)
+	}
+	return tj.sortBuffer(buffer), nil, nil
+}
+
+// Sort buffer by the band expression, if there is one.
+func (tj *ThetaJoin) sortBuffer(buffer []bandEntry) []bandEntry {
+	if len(tj.band) > 0 {
+		slices.SortStableFunc(buffer, func(a, b bandEntry) int {
+			c, _ := compareValues(a.key, b.key)
+			return c
+		})
+	}
+	return buffer
+}
+
+// Return the range of the entries of buffer that may join with t: all of
+// them, unless they are sorted by the band expression, in which case those
+// whose key is within the bounds of the band comparisons for t.
+func (tj *ThetaJoin) candidates(buffer []bandEntry, t *Tuple) (int, int, error) {
+	lo, hi := 0, len(buffer)
+	// the first entry whose key is not less than (or, if after is true,
+	// greater than) v
+	search := func(v DBValue, after bool) int {
+		return sort.Search(len(buffer), func(i int) bool {
+			c, _ := compareValues(buffer[i].key, v)
+			return c > 0 || (c == 0 && !after)
+		})
+	}
+	for _, i := range tj.band {
+		v, err := tj.leftExprs[i].EvalExpr(t)
+		if err != nil {
+			return 0, 0, err
+		}
+		// the comparison is v op key
+		switch tj.ops[i] {
+		case OpLt:
+			lo = max(lo, search(v, true))
+		case OpLe:
+			lo = max(lo, search(v, false))
+		case OpGt:
+			hi = min(hi, search(v, false))
+		case OpGe:
+			hi = min(hi, search(v, true))
+		}
+	}
+	return lo, max(lo, hi), nil
+}
+
+// Return whether left and right satisfy all the comparisons of the join.
+func (tj *ThetaJoin) matches(left, right *Tuple) (bool, error) {
+	for i, op := range tj.ops {
+		lv, err := tj.leftExprs[i].EvalExpr(left)
+		if err != nil {
+			return false, err
+		}
+		rv, err := tj.rightExprs[i].EvalExpr(right)
+		if err != nil {
+			return false, err
+		}
+		if !lv.EvalPred(rv, op) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Theta join implementation. Returns the joined tuples of each buffer of the
+// right input in turn, in the order of the tuples of the left input.
+func (tj *ThetaJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	rightIter, err := tj.right.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	leftIter, err := tj.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	buffer, next, err := tj.readBuffer(rightIter)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer) == 0 {
+		return func() (*Tuple, error) { return nil, nil }, nil
+	}
+
+	// if the right input does not fit in the buffer, spill the left input
+	var spilled *spillFile
+	if next != nil {
+		for {
+			t, err := leftIter()
+			if err != nil {
+				closeSpillFiles([]*spillFile{spilled})
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+			if spilled == nil {
+				if spilled, err = newSpillFile(t); err != nil {
+					return nil, err
+				}
+			}
+			if err := spilled.add(t); err != nil {
+				spilled.close()
+				return nil, err
+			}
+		}
+		if spilled == nil {
+			return func() (*Tuple, error) { return nil, nil }, nil
+		}
+		if leftIter, err = spilled.iterator(); err != nil {
+			spilled.close()
+			return nil, err
+		}
+	}
+
+	desc := tj.Descriptor()
+	var leftTuple *Tuple
+	i, hi := 0, 0
+	return func() (*Tuple, error) {
+		for {
+			for ; i < hi; i++ {
+				ok, err := tj.matches(leftTuple, buffer[i].tuple)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					i++
+					t := joinTuples(leftTuple, buffer[i-1].tuple)
+					t.Desc = *desc
+					return t, nil
+				}
+			}
+			var err error
+			if leftTuple, err = leftIter(); err != nil {
+				return nil, err
+			}
+			if leftTuple == nil {
+				if next == nil {
+					closeSpillFiles([]*spillFile{spilled})
+					return nil, nil
+				}
+				// join the next buffer of the right input
+				if buffer, next, err = tj.readBuffer(prependTuples([]*Tuple{next}, rightIter)); err != nil {
+					return nil, err
+				}
+				if leftIter, err = spilled.iterator(); err != nil {
+					return nil, err
+				}
+				i, hi = 0, 0
+				continue
+			}
+			if i, hi, err = tj.candidates(buffer, leftTuple); err != nil {
+				return nil, err
+			}
+		}
+	}, nil
+}
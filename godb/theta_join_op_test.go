@@ -0,0 +1,171 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestThetaJoin(t *testing.T) {
+	makeFile := func(table string, n int, key func(i int) int64) *MemFile {
+		desc := TupleDesc{Fields: []FieldType{
+			{Fname: "name", TableQualifier: table, Ftype: StringType},
+			{Fname: "lo", TableQualifier: table, Ftype: IntType},
+			{Fname: "hi", TableQualifier: table, Ftype: IntType},
+		}}
+		file := &MemFile{desc: &desc}
+		for i := 0; i < n; i++ {
+			k := key(i)
+			file.insertTuple(&Tuple{Desc: desc, Fields: []DBValue{StringField{fmt.Sprintf("%s%d", table, i)}, IntField{k}, IntField{k + 3}}}, 0)
+		}
+		return file
+	}
+	left := makeFile("l", 60, func(i int) int64 { return int64(i * 7 % 31) })
+	right := makeFile("r", 50, func(i int) int64 { return int64(i * 5 % 23) })
+	field := func(f *MemFile, i int) Expr { return &FieldExpr{f.desc.Fields[i]} }
+
+	for _, test := range []struct {
+		name string
+		left []Expr
+		ops  []BoolOp
+		band bool
+	}{
+		{"l.lo < r.lo", []Expr{field(left, 1)}, []BoolOp{OpLt}, true},
+		{"r.lo between l.lo and l.hi", []Expr{field(left, 1), field(left, 2)}, []BoolOp{OpLe, OpGe}, true},
+		{"l.hi > r.lo and l.lo >= r.lo", []Expr{field(left, 2), field(left, 1)}, []BoolOp{OpGt, OpGe}, true},
+		{"l.lo <> r.lo", []Expr{field(left, 1)}, []BoolOp{OpNeq}, false},
+	} {
+		rightExprs := make([]Expr, len(test.ops))
+		for i := range rightExprs {
+			rightExprs[i] = field(right, 1)
+		}
+		// the tuples of every pair that satisfies the comparisons
+		var want []string
+		leftIter, _ := left.Iterator(0)
+		for l, _ := leftIter(); l != nil; l, _ = leftIter() {
+			rightIter, _ := right.Iterator(0)
+			for r, _ := rightIter(); r != nil; r, _ = rightIter() {
+				ok := true
+				for i, op := range test.ops {
+					lv, _ := test.left[i].EvalExpr(l)
+					ok = ok && lv.EvalPred(r.Fields[1], op)
+				}
+				if ok {
+					want = append(want, fmt.Sprint(joinTuples(l, r).Fields))
+				}
+			}
+		}
+		sort.Strings(want)
+
+		// a buffer of 7 tuples makes the join spill its left input
+		for _, bufferSize := range []int{0, 7} {
+			join, err := NewThetaJoin(left, test.left, test.ops, right, rightExprs, bufferSize)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if (join.method() == "Band Join") != test.band {
+				t.Errorf("%s: expected a band join to be %v, got a %s", test.name, test.band, join.method())
+			}
+			iter, err := join.Iterator(NewTID())
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			var got []string
+			for {
+				tup, err := iter()
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				if tup == nil {
+					break
+				}
+				got = append(got, fmt.Sprint(tup.Fields))
+			}
+			sort.Strings(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s with a buffer of %d: expected %d results, got %d", test.name, bufferSize, len(want), len(got))
+			}
+		}
+	}
+}
+
+func TestThetaJoinQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	var ages []int64
+	for _, row := range queryResults(t, bp, c, "select age from t") {
+		age, _ := strconv.ParseInt(strings.Trim(row, "[{}]"), 10, 64)
+		ages = append(ages, age)
+	}
+	count := func(pred func(a, b int64) bool) int {
+		n := 0
+		for _, a := range ages {
+			for _, b := range ages {
+				if pred(a, b) {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	for _, q := range []struct {
+		sql  string
+		join string
+		want int
+	}{
+		{"select t.name, t2.name from t, t2 where t.age < t2.age", "Band Join", count(func(a, b int64) bool { return a < b })},
+		{"select t.name, t2.name from t join t2 on t2.age between t.age - 5 and t.age + 5", "Band Join", count(func(a, b int64) bool { return b >= a-5 && b <= a+5 })},
+		{"select t.name, t2.name from t, t2 where t.age <> t2.age", "Block Nested Loop Join", count(func(a, b int64) bool { return a != b })},
+	} {
+		op, n := countQueryResults(t, bp, c, q.sql)
+		if n != q.want {
+			t.Errorf("%s: expected %d results, got %d", q.sql, q.want, n)
+		}
+		var plan strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&plan, format, a...) }, op, "")
+		if !strings.Contains(plan.String(), q.join) {
+			t.Errorf("%s: expected a %s, got\n%s", q.sql, q.join, plan.String())
+		}
+	}
+
+	// the equalities between two tables are the key of one join, and the
+	// other comparisons filter its result
+	counts := make(map[string]int)
+	for _, row := range queryResults(t, bp, c, "select name, age from t") {
+		counts[row]++
+	}
+	want := 0
+	for _, n := range counts {
+		want += n * n
+	}
+	op, n := countQueryResults(t, bp, c, "select t.name from t join t2 on t.name = t2.name and t.age = t2.age where t.age + 10 > t2.age")
+	if n != want {
+		t.Errorf("expected %d results, got %d", want, n)
+	}
+	var joins []*EqualityJoin
+	var find func(o Operator)
+	find = func(o Operator) {
+		switch op := o.(*OperatorCard).Op.(type) {
+		case *EqualityJoin:
+			joins = append(joins, op)
+			find(*op.left)
+			find(*op.right)
+		case *Filter:
+			find(op.child)
+		case *Project:
+			find(op.child)
+		case *AliasOp:
+			find(op.child)
+		}
+	}
+	find(op)
+	if len(joins) != 1 || len(joins[0].leftFields) != 2 {
+		t.Errorf("expected one join on two keys, got %d joins", len(joins))
+	}
+}
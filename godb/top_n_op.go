@@ -0,0 +1,116 @@
+package godb
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+)
+
+// TopN returns the first limitTups tuples of its child in the order of the
+// orderBy expressions, as a [LimitOp] over an [OrderBy] would, but keeps only
+// that many tuples in memory while it reads the child.
+type TopN struct {
+	orderBy   []Expr
+	ascending []bool
+	limitTups Expr
+	child     Operator
+}
+
+// Construct a top-N operator over child, which returns the first lim tuples
+// in the order of orderByFields, in ascending or descending order as given by
+// the corresponding entry of ascending.
+func NewTopN(orderByFields []Expr, child Operator, ascending []bool, lim Expr) *TopN {
+	return &TopN{orderByFields, ascending, lim, child}
+}
+
+// Return the tuple descriptor of the child.
+func (tn *TopN) Descriptor() *TupleDesc {
+	return tn.child.Descriptor()
+}
+
+// A tuple of the child being kept, with the position at which the child
+// returned it, which orders tuples with equal keys.
+type topNEntry struct {
+	sortEntry
+	seq int
+}
+
+// The tuples being kept, with the one that comes last in the output at the
+// top.
+type topNHeap struct {
+	sorter  *tupleSorter
+	entries []topNEntry
+}
+
+// Return whether a comes before b in the output.
+func (h *topNHeap) before(a, b topNEntry) bool {
+	if c := h.sorter.compare(a.key, b.key); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int           { return len(h.entries) }
+func (h *topNHeap) Less(i, j int) bool { return h.before(h.entries[j], h.entries[i]) }
+func (h *topNHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *topNHeap) Push(x any)         { h.entries = append(h.entries, x.(topNEntry)) }
+func (h *topNHeap) Pop() any {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
+
+// Top-N implementation. Reads all the tuples of the child, keeping the first
+// lim of them in order in a heap, and then returns those in order. Tuples with
+// equal values of the ORDER BY expressions are returned in the order of the
+// child.
+func (tn *TopN) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	num, err := tn.limitTups.EvalExpr(nil)
+	if err != nil {
+		return nil, err
+	}
+	lim, ok := num.(IntField)
+	if !ok {
+		return nil, fmt.Errorf("limit is not IntField")
+	}
+	iter, err := tn.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	h := &topNHeap{sorter: &tupleSorter{keys: tn.orderBy, ascending: tn.ascending}}
+	for seq := 0; lim.Value > 0; seq++ {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		e, err := h.sorter.entry(t)
+		if err != nil {
+			return nil, err
+		}
+		entry := topNEntry{e, seq}
+		if int64(h.Len()) < lim.Value {
+			heap.Push(h, entry)
+		} else if h.before(entry, h.entries[0]) {
+			h.entries[0] = entry
+			heap.Fix(h, 0)
+		}
+	}
+
+	slices.SortFunc(h.entries, func(a, b topNEntry) int {
+		if h.before(a, b) {
+			return -1
+		}
+		return 1
+	})
+	i := 0
+	return func() (*Tuple, error) {
+		if i == len(h.entries) {
+			return nil, nil
+		}
+		i++
+		return h.entries[i-1].tuple, nil
+	}, nil
+}
@@ -0,0 +1,118 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// test that a top-n returns the same tuples, in the same order, as a limit
+// over an order by, including among tuples with equal keys
+func TestTopN(t *testing.T) {
+	desc := TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "key", Ftype: IntType},
+		{Fname: "seq", Ftype: IntType},
+	}}
+	file := &MemFile{desc: &desc}
+	for i := 0; i < 200; i++ {
+		file.insertTuple(&Tuple{Desc: desc, Fields: []DBValue{StringField{fmt.Sprintf("n%d", i%5)}, IntField{int64(i * 13 % 17)}, IntField{int64(i)}}}, 0)
+	}
+	keys := []Expr{&FieldExpr{desc.Fields[0]}, &FieldExpr{desc.Fields[1]}}
+	ascending := []bool{false, true}
+
+	results := func(op Operator) []string {
+		iter, err := op.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var res []string
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return res
+			}
+			res = append(res, fmt.Sprint(tup.Fields))
+		}
+	}
+	for _, n := range []int{0, 1, 7, 40, 200, 500} {
+		lim := &ConstExpr{IntField{int64(n)}, IntType}
+		oby, err := NewOrderBy(keys, file, ascending)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		want := results(NewLimitOp(lim, oby))
+		got := results(NewTopN(keys, file, ascending, lim))
+		if len(want) != min(n, 200) {
+			t.Fatalf("limit %d: expected %d tuples from the limit, got %d", n, min(n, 200), len(want))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("limit %d: expected %v, got %v", n, want, got)
+		}
+	}
+}
+
+func TestTopNQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, q := range []struct {
+		sql  string
+		topN bool
+	}{
+		{"select name, age from t order by age desc, name limit 4", true},
+		{"select name, age from t order by name limit 1 + 2", true},
+		{"select name, age from t order by age", false},
+		{"select name, age from t limit 4", false},
+	} {
+		_, plan, err := Parse(c, q.sql)
+		if err != nil {
+			t.Fatalf("failed to parse, q=%s, %s", q.sql, err.Error())
+		}
+		var text strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&text, format, a...) }, plan, "")
+		if strings.Contains(text.String(), "Top-N") != q.topN {
+			t.Errorf("%s: expected a top-n to be %v, got\n%s", q.sql, q.topN, text.String())
+		}
+		if !q.topN {
+			continue
+		}
+		// the same query, sorting all the results, has them first
+		all := queryResults(t, bp, c, q.sql[:strings.Index(q.sql, " limit")])
+		got := queryResults(t, bp, c, q.sql)
+		if len(got) == 0 || !slices.Equal(got, all[:len(got)]) {
+			t.Errorf("%s: expected the first results of %v, got %v", q.sql, all, got)
+		}
+	}
+}
+
+// test that a limit whose tuples do not fit in SortWorkMem is planned as a
+// limit over an order by, which can sort on disk
+func TestTopNLargeLimit(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	all := queryResults(t, bp, c, "select name, age from t order by age, name")
+
+	defer func(old int) { SortWorkMem = old }(SortWorkMem)
+	SortWorkMem = PageSize
+	sql := "select name, age from t order by age, name limit 1000000"
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	var text strings.Builder
+	OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&text, format, a...) }, plan, "")
+	if strings.Contains(text.String(), "Top-N") || !strings.Contains(text.String(), "Limit") {
+		t.Errorf("%s: expected a limit over an order by, got\n%s", sql, text.String())
+	}
+	if got := queryResults(t, bp, c, sql); !slices.Equal(got, all) {
+		t.Errorf("%s: expected %v, got %v", sql, all, got)
+	}
+}
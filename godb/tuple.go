@@ -7,17 +7,25 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // DBType is the type of a tuple field, in GoDB, e.g., IntType or StringType
 type DBType int
 
 const (
-	IntType     DBType = iota
-	StringType  DBType = iota
-	UnknownType DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	IntType       DBType = iota
+	StringType    DBType = iota
+	UnknownType   DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	FloatType     DBType = iota
+	BoolType      DBType = iota
+	DateType      DBType = iota
+	TimestampType DBType = iota
+	DecimalType   DBType = iota
 )
 
 func (t DBType) String() string {
@@ -26,10 +34,63 @@ func (t DBType) String() string {
 		return "int"
 	case StringType:
 		return "string"
+	case FloatType:
+		return "float"
+	case BoolType:
+		return "bool"
+	case DateType:
+		return "date"
+	case TimestampType:
+		return "timestamp"
+	case DecimalType:
+		return "decimal"
 	}
 	return "unknown"
 }
 
+// Map from the type names accepted in CREATE TABLE statements and catalog
+// files to types.
+var DBTypeNames = map[string]DBType{
+	"int":              IntType,
+	"integer":          IntType,
+	"bigint":           IntType,
+	"string":           StringType,
+	"varchar":          StringType,
+	"text":             StringType,
+	"char":             StringType,
+	"float":            FloatType,
+	"double":           FloatType,
+	"double precision": FloatType,
+	"real":             FloatType,
+	"bool":             BoolType,
+	"boolean":          BoolType,
+	"bit":              BoolType,
+	"date":             DateType,
+	"timestamp":        TimestampType,
+	"datetime":         TimestampType,
+	"decimal":          DecimalType,
+	"numeric":          DecimalType,
+}
+
+// Return the number of bytes a field of this type occupies on disk.
+func (t DBType) size() int {
+	switch t {
+	case StringType:
+		return StringLength
+	case BoolType:
+		return 1
+	case UnknownType:
+		return 0
+	}
+	return 8
+}
+
+// Return true iff values of this type are numbers, which may be compared with
+// each other regardless of their types.
+func (t DBType) isNumeric() bool {
+	return t == IntType || t == FloatType || t == DecimalType
+}
+
 // FieldType is the type of a field in a tuple, e.g., its name, table, and [godb.DBType].
 // TableQualifier may or may not be an emtpy string, depending on whether the table
 // was specified in the query
@@ -37,6 +98,23 @@ type FieldType struct {
 	Fname          string
 	TableQualifier string //限定名，例如student.name中的student
 	Ftype          DBType
+	// The declared precision (number of digits) and scale (number of digits
+	// after the point) of DECIMAL values. A precision of 0 means any number of
+	// digits, as for computed values.
+	Precision, Scale int
+}
+
+// Return the name of the type of f, as it is declared in CREATE TABLE and in
+// the catalog, e.g., decimal(10,2).
+func (f FieldType) typeName() string {
+	if f.Ftype != DecimalType {
+		return f.Ftype.String()
+	}
+	precision := f.Precision
+	if precision == 0 {
+		precision = maxDecimalPrecision
+	}
+	return fmt.Sprintf("decimal(%d,%d)", precision, f.Scale)
 }
 
 // TupleDesc is "type" of the tuple, e.g., the field names and types
@@ -60,6 +138,21 @@ func (d1 *TupleDesc) equals(d2 *TupleDesc) bool {
 	return true
 }
 
+// Compare two tuple descs, and return true iff they are the same length and
+// their fields have the same types, regardless of the names of the fields.
+// Tuples of compatible descs can be combined by set operations.
+func (d1 *TupleDesc) compatible(d2 *TupleDesc) bool {
+	if len(d1.Fields) != len(d2.Fields) {
+		return false
+	}
+	for i, f1 := range d1.Fields {
+		if f1.Ftype != d2.Fields[i].Ftype {
+			return false
+		}
+	}
+	return true
+}
+
 // Given a FieldType f and a TupleDesc desc, find the best
 // matching field in desc for f.  A match is defined as
 // having the same Ftype and the same name, preferring a match
@@ -100,6 +193,8 @@ func (td *TupleDesc) copy() *TupleDesc {
 			Fname:          field.Fname,
 			TableQualifier: field.TableQualifier,
 			Ftype:          field.Ftype,
+			Precision:      field.Precision,
+			Scale:          field.Scale,
 		}
 	}
 	return newTd
@@ -117,6 +212,31 @@ func (td *TupleDesc) setTableAlias(alias string) {
 	td.Fields = fields
 }
 
+// Round the decimals of t to the scales of the fields of desc, replacing the
+// fields of t if they change. Returns an error if a decimal has more digits
+// than the precision of its field.
+func (desc *TupleDesc) fitDecimals(t *Tuple) error {
+	cloned := false
+	for i, f := range desc.Fields {
+		d, ok := t.Fields[i].(DecimalField)
+		if !ok || f.Ftype != DecimalType {
+			continue
+		}
+		fitted, err := d.fit(f.Precision, f.Scale)
+		if err != nil {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("column %s: %s", f.Fname, err.(GoDBError).errString)}
+		}
+		if fitted != d {
+			if !cloned {
+				t.Fields = slices.Clone(t.Fields)
+				cloned = true
+			}
+			t.Fields[i] = fitted
+		}
+	}
+	return nil
+}
+
 // Merge two TupleDescs together.  The resulting TupleDesc
 // should consist of the fields of desc2
 // appended onto the fields of desc.
@@ -146,6 +266,246 @@ type StringField struct {
 	Value string
 }
 
+// Double precision floating point field value
+type FloatField struct {
+	Value float64
+}
+
+// Boolean field value
+type BoolField struct {
+	Value bool
+}
+
+// Date field value, as the number of days since 1970-01-01
+type DateField struct {
+	Value int64
+}
+
+// Timestamp field value, as the number of microseconds since 1970-01-01
+// 00:00:00 UTC
+type TimestampField struct {
+	Value int64
+}
+
+// Fixed point decimal field value. The number is Value / 10^Scale, so that,
+// e.g., 12.5 is {125, 1}, or {12500, 3} in a DECIMAL(10,3) column.
+type DecimalField struct {
+	Value int64
+	Scale int
+}
+
+const (
+	dateLayout      = "2006-01-02"
+	timestampLayout = "2006-01-02 15:04:05.999999"
+	microsPerSecond = 1000000
+	microsPerDay    = 24 * 60 * 60 * microsPerSecond
+)
+
+// Return the date of t, which is interpreted in UTC.
+func NewDateField(t time.Time) DateField {
+	return DateField{int64(math.Floor(float64(t.Unix()) / (24 * 60 * 60)))}
+}
+
+// Return the timestamp of t.
+func NewTimestampField(t time.Time) TimestampField {
+	return TimestampField{t.UnixMicro()}
+}
+
+// Return the decimal closest to f with DecimalScale digits after the point.
+func NewDecimalField(f float64) DecimalField {
+	return DecimalField{int64(math.Round(f * float64(pow10[DecimalScale]))), DecimalScale}
+}
+
+func (d DateField) Time() time.Time {
+	return time.UnixMicro(d.Value * microsPerDay).UTC()
+}
+
+func (ts TimestampField) Time() time.Time {
+	return time.UnixMicro(ts.Value).UTC()
+}
+
+func (d DecimalField) Float() float64 {
+	return float64(d.Value) / float64(pow10[d.Scale])
+}
+
+// Return the zero value of the type, which is used for empty slots on pages
+// and for results that are undefined, as GoDB has no NULLs.
+func zeroValue(t DBType) DBValue {
+	switch t {
+	case StringType:
+		return StringField{""}
+	case FloatType:
+		return FloatField{0}
+	case BoolType:
+		return BoolField{false}
+	case DateType:
+		return DateField{0}
+	case TimestampType:
+		return TimestampField{0}
+	case DecimalType:
+		return DecimalField{0, 0}
+	}
+	return IntField{0}
+}
+
+// Return the value of a number as a float64, and false if v is not a number.
+func numericValue(v DBValue) (float64, bool) {
+	switch v := v.(type) {
+	case IntField:
+		return float64(v.Value), true
+	case FloatField:
+		return v.Value, true
+	case DecimalField:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// Return the string representation of v, as used when printing tuples and
+// when writing them to CSV files.
+func valueString(v DBValue) string {
+	switch v := v.(type) {
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	case StringField:
+		return v.Value
+	case FloatField:
+		return strconv.FormatFloat(v.Value, 'f', -1, 64)
+	case BoolField:
+		return strconv.FormatBool(v.Value)
+	case DateField:
+		return v.Time().Format(dateLayout)
+	case TimestampField:
+		return v.Time().Format(timestampLayout)
+	case DecimalField:
+		sign := ""
+		n := v.Value
+		if n < 0 {
+			sign = "-"
+			n = -n
+		}
+		if v.Scale == 0 {
+			return fmt.Sprintf("%s%d", sign, n)
+		}
+		return fmt.Sprintf("%s%d.%0*d", sign, n/pow10[v.Scale], v.Scale, n%pow10[v.Scale])
+	}
+	return ""
+}
+
+// Format v as a SQL literal, quoting it unless it is a number or a boolean.
+func sqlLiteral(v DBValue) string {
+	switch v.(type) {
+	case IntField, FloatField, BoolField, DecimalField:
+		return valueString(v)
+	}
+	return "'" + strings.ReplaceAll(valueString(v), "'", "''") + "'"
+}
+
+// Parse a SQL literal of type t, as formatted by [sqlLiteral].
+func parseLiteral(t DBType, lit string) (DBValue, error) {
+	if len(lit) >= 2 && lit[0] == '\'' && lit[len(lit)-1] == '\'' {
+		lit = strings.ReplaceAll(lit[1:len(lit)-1], "''", "'")
+	}
+	return parseValue(t, lit)
+}
+
+// Parse the string representation of a value of type t. Strings longer than
+// StringLength are truncated.
+func parseValue(t DBType, str string) (DBValue, error) {
+	if t != StringType {
+		str = strings.TrimSpace(str)
+	}
+	switch t {
+	case IntType:
+		i, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid int value %q", str)}
+		}
+		return IntField{i}, nil
+	case StringType:
+		if len(str) > StringLength {
+			str = str[0:StringLength]
+		}
+		return StringField{str}, nil
+	case FloatType:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid float value %q", str)}
+		}
+		return FloatField{f}, nil
+	case BoolType:
+		switch strings.ToLower(str) {
+		case "t", "true", "yes", "y", "on", "1":
+			return BoolField{true}, nil
+		case "f", "false", "no", "n", "off", "0":
+			return BoolField{false}, nil
+		}
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid bool value %q", str)}
+	case DateType:
+		d, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid date value %q, expected YYYY-MM-DD", str)}
+		}
+		return NewDateField(d), nil
+	case TimestampType:
+		for _, layout := range []string{timestampLayout, "2006-01-02T15:04:05.999999", time.RFC3339Nano, dateLayout} {
+			if ts, err := time.Parse(layout, str); err == nil {
+				return NewTimestampField(ts), nil
+			}
+		}
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid timestamp value %q, expected YYYY-MM-DD HH:MM:SS", str)}
+	case DecimalType:
+		return parseDecimal(str)
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot parse a value of type %s", t)}
+}
+
+// Parse a decimal number exactly, with as many digits after the point as
+// it is written with, rounding those that do not fit in an int64 half away
+// from zero.
+func parseDecimal(str string) (DBValue, error) {
+	bad := GoDBError{TypeMismatchError, fmt.Sprintf("invalid decimal value %q", str)}
+	digits := str
+	neg := false
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		neg = digits[0] == '-'
+		digits = digits[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" {
+		return nil, bad
+	}
+	var n int64
+	scale := 0
+	rounded := false
+	for i, part := range []string{intPart, fracPart} {
+		for _, ch := range part {
+			if ch < '0' || ch > '9' {
+				return nil, bad
+			}
+			if rounded {
+				continue
+			}
+			if n > (math.MaxInt64-9)/10 || scale == maxDecimalPrecision {
+				if i == 0 {
+					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("decimal value %s is out of range", str)}
+				}
+				if ch >= '5' {
+					n++
+				}
+				rounded = true
+				continue
+			}
+			n = n*10 + int64(ch-'0')
+			scale += i
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return DecimalField{n, scale}, nil
+}
+
 func compareStringFields(s1 StringField, s2 StringField) int64 {
 	if s1.Value < s2.Value {
 		return -1
@@ -160,7 +520,64 @@ func compareIntFields(i1 IntField, i2 IntField) int64 {
 	return i1.Value - i2.Value
 }
 
+// Compare two values, returning a negative number, zero or a positive number
+// if v1 is less than, equal to or greater than v2. The values must have the
+// same type, except that numbers may be compared with numbers, and dates with
+// timestamps; otherwise false is returned.
+func compareValues(v1 DBValue, v2 DBValue) (int, bool) {
+	switch x1 := v1.(type) {
+	case IntField:
+		if x2, ok := v2.(IntField); ok {
+			return cmpOrdered(x1.Value, x2.Value), true
+		}
+	case StringField:
+		if x2, ok := v2.(StringField); ok {
+			return cmpOrdered(x1.Value, x2.Value), true
+		}
+	case DecimalField:
+		if x2, ok := v2.(DecimalField); ok {
+			return compareDecimals(x1, x2), true
+		}
+	case BoolField:
+		if x2, ok := v2.(BoolField); ok {
+			if x1.Value == x2.Value {
+				return 0, true
+			} else if x2.Value {
+				return -1, true
+			}
+			return 1, true
+		}
+	case DateField:
+		switch x2 := v2.(type) {
+		case DateField:
+			return cmpOrdered(x1.Value, x2.Value), true
+		case TimestampField:
+			return cmpOrdered(x1.Value*microsPerDay, x2.Value), true
+		}
+	case TimestampField:
+		switch x2 := v2.(type) {
+		case TimestampField:
+			return cmpOrdered(x1.Value, x2.Value), true
+		case DateField:
+			return cmpOrdered(x1.Value, x2.Value*microsPerDay), true
+		}
+	}
+	f1, ok1 := numericValue(v1)
+	f2, ok2 := numericValue(v2)
+	if ok1 && ok2 {
+		return cmpOrdered(f1, f2), true
+	}
+	return 0, false
+}
 
+func cmpOrdered[T int64 | float64 | string](x1 T, x2 T) int {
+	if x1 < x2 {
+		return -1
+	} else if x1 > x2 {
+		return 1
+	}
+	return 0
+}
 
 // Tuple represents the contents of a tuple read from a database
 // It includes the tuple descriptor, and the value of the fields
@@ -185,6 +602,10 @@ type recordID interface {
 // example if StringLength is set to 5, the string 'mit' should be written as
 // 'm', 'i', 't', 0, 0
 //
+// Floats are written as their IEEE 754 bits, booleans as a single byte, and
+// dates, timestamps and decimals as the int64 of their Value. Decimals are
+// first rescaled to the scale of their field.
+//
 // May return an error if the buffer has insufficient capacity to store the
 // tuple.
 func (t *Tuple) writeTo(b *bytes.Buffer) error {
@@ -208,11 +629,56 @@ func (t *Tuple) writeTo(b *bytes.Buffer) error {
 			if err := binary.Write(b, binary.LittleEndian, []byte(str)); err != nil {
 				return fmt.Errorf("failed to write field %d: %w", i, err)
 			}
+		case FloatType, BoolType, DateType, TimestampType, DecimalType:
+			var v any
+			switch f := t.Fields[i].(type) {
+			case FloatField:
+				v = math.Float64bits(f.Value)
+			case BoolField:
+				v = f.Value
+			case DateField:
+				v = f.Value
+			case TimestampField:
+				v = f.Value
+			case DecimalField:
+				d, err := f.fit(field.Precision, field.Scale)
+				if err != nil {
+					return fmt.Errorf("failed to write field %d: %w", i, err)
+				}
+				v = d.Value
+			}
+			if v == nil || field.Ftype != valueType(t.Fields[i]) {
+				return fmt.Errorf("failed to write field %d: value %v is not of type %s", i, t.Fields[i], field.Ftype)
+			}
+			if err := binary.Write(b, binary.LittleEndian, v); err != nil {
+				return fmt.Errorf("failed to write field %d: %w", i, err)
+			}
 		}
 	}
 	return nil
 }
 
+// Return the type of a value.
+func valueType(v DBValue) DBType {
+	switch v.(type) {
+	case IntField:
+		return IntType
+	case StringField:
+		return StringType
+	case FloatField:
+		return FloatType
+	case BoolField:
+		return BoolType
+	case DateField:
+		return DateType
+	case TimestampField:
+		return TimestampType
+	case DecimalField:
+		return DecimalType
+	}
+	return UnknownType
+}
+
 // Read the contents of a tuple with the specified [TupleDesc] from the
 // specified buffer, returning a Tuple.
 //
@@ -247,6 +713,31 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 			// Remove trailing zeros
 			strValue := string(bytes.TrimRight(strBytes, "\x00"))
 			tuple.Fields[i] = StringField{Value: strValue}
+		case FloatType:
+			var bits uint64
+			if err := binary.Read(b, binary.LittleEndian, &bits); err != nil {
+				return nil, fmt.Errorf("failed to read float field %d: %w", i, err)
+			}
+			tuple.Fields[i] = FloatField{math.Float64frombits(bits)}
+		case BoolType:
+			var boolValue bool
+			if err := binary.Read(b, binary.LittleEndian, &boolValue); err != nil {
+				return nil, fmt.Errorf("failed to read bool field %d: %w", i, err)
+			}
+			tuple.Fields[i] = BoolField{boolValue}
+		case DateType, TimestampType, DecimalType:
+			var intValue int64
+			if err := binary.Read(b, binary.LittleEndian, &intValue); err != nil {
+				return nil, fmt.Errorf("failed to read %s field %d: %w", field.Ftype, i, err)
+			}
+			switch field.Ftype {
+			case DateType:
+				tuple.Fields[i] = DateField{intValue}
+			case TimestampType:
+				tuple.Fields[i] = TimestampField{intValue}
+			case DecimalType:
+				tuple.Fields[i] = DecimalField{intValue, field.Scale}
+			}
 		default:
 			return nil, fmt.Errorf("unknown field type for field %d", i)
 		}
@@ -276,6 +767,12 @@ func (t1 *Tuple) equals(t2 *Tuple) bool {
 			if f1[i].(StringField).Value != f2[i].(StringField).Value {
 				return false
 			}
+		} else if d1.Fields[i].Ftype == DecimalType {
+			if cmp, ok := compareValues(f1[i], f2[i]); !ok || cmp != 0 {
+				return false
+			}
+		} else if f1[i] != f2[i] {
+			return false
 		}
 	}
 	return true
@@ -369,7 +866,16 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 			return OrderedEqual, nil
 		}
 	default:
-		return OrderedEqual, GoDBError{IncompatibleTypesError, "unknown field type for comparison"}
+		cmp, ok := compareValues(val1, val2)
+		if !ok {
+			return OrderedEqual, GoDBError{IncompatibleTypesError, "cannot compare different field types"}
+		}
+		if cmp < 0 {
+			return OrderedLessThan, nil
+		} else if cmp > 0 {
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
 	}
 }
 
@@ -394,10 +900,26 @@ func (t *Tuple) project(fields []FieldType) (*Tuple, error) {
 	return newTurple, nil
 }
 
-// Compute a key for the tuple to be used in a map structure
+// Compute a key for the tuple to be used in a map structure. Decimals are
+// written normalized, followed by their scales, so that equal decimals have
+// equal keys whatever their scales.
 func (t *Tuple) tupleKey() any {
 	var buf bytes.Buffer
-	t.writeTo(&buf)
+	var scales []byte
+	key := t
+	for i, v := range t.Fields {
+		if d, ok := v.(DecimalField); ok {
+			if key == t {
+				key = &Tuple{*t.Desc.copy(), slices.Clone(t.Fields), nil}
+			}
+			d = d.normalize()
+			key.Fields[i] = d
+			key.Desc.Fields[i].Precision, key.Desc.Fields[i].Scale = 0, d.Scale
+			scales = append(scales, byte(d.Scale))
+		}
+	}
+	key.writeTo(&buf)
+	buf.Write(scales)
 	return buf.String()
 }
 
@@ -446,13 +968,7 @@ func (d *TupleDesc) HeaderString(aligned bool) string {
 func (t *Tuple) PrettyPrintString(aligned bool) string {
 	outstr := ""
 	for i, f := range t.Fields {
-		str := ""
-		switch f := f.(type) {
-		case IntField:
-			str = strconv.FormatInt(f.Value, 10)
-		case StringField:
-			str = f.Value
-		}
+		str := valueString(f)
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
 		} else {
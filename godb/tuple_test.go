@@ -424,8 +424,8 @@ func TestTupleProject3(t *testing.T) {
 			IntField{25},
 		}}
 
-	ft1 := FieldType{"a", "", StringType}
-	ft2 := FieldType{"b", "", IntType}
+	ft1 := FieldType{"a", "", StringType, 0, 0}
+	ft2 := FieldType{"b", "", IntType, 0, 0}
 	outTup, err := t1.project([]FieldType{ft1})
 	if err != nil {
 		t.Fatalf(err.Error())
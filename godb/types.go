@@ -2,26 +2,25 @@ package godb
 
 import (
 	"fmt"
-	"regexp"
-	"strings"
 )
 
 type GoDBErrorCode int
 
 const (
-	TupleNotFoundError      GoDBErrorCode = iota
-	PageFullError           GoDBErrorCode = iota
-	IncompatibleTypesError  GoDBErrorCode = iota
-	TypeMismatchError       GoDBErrorCode = iota
-	MalformedDataError      GoDBErrorCode = iota
-	BufferPoolFullError     GoDBErrorCode = iota
-	ParseError              GoDBErrorCode = iota
-	DuplicateTableError     GoDBErrorCode = iota
-	NoSuchTableError        GoDBErrorCode = iota
-	AmbiguousNameError      GoDBErrorCode = iota
-	IllegalOperationError   GoDBErrorCode = iota
-	DeadlockError           GoDBErrorCode = iota
-	IllegalTransactionError GoDBErrorCode = iota
+	TupleNotFoundError       GoDBErrorCode = iota
+	PageFullError            GoDBErrorCode = iota
+	IncompatibleTypesError   GoDBErrorCode = iota
+	TypeMismatchError        GoDBErrorCode = iota
+	MalformedDataError       GoDBErrorCode = iota
+	BufferPoolFullError      GoDBErrorCode = iota
+	ParseError               GoDBErrorCode = iota
+	DuplicateTableError      GoDBErrorCode = iota
+	NoSuchTableError         GoDBErrorCode = iota
+	AmbiguousNameError       GoDBErrorCode = iota
+	IllegalOperationError    GoDBErrorCode = iota
+	DeadlockError            GoDBErrorCode = iota
+	IllegalTransactionError  GoDBErrorCode = iota
+	ConstraintViolationError GoDBErrorCode = iota
 )
 
 //go:generate stringer -type=GoDBErrorCode
@@ -38,6 +37,7 @@ func (e GoDBError) Error() string {
 const (
 	PageSize     int = 4096
 	StringLength int = 32
+	DecimalScale int = 4 // digits after the decimal point of DECIMAL columns declared without a scale
 )
 
 type Page interface {
@@ -89,10 +89,48 @@ var BoolOpMap = map[string]BoolOp{
 	"like": OpLike,
 }
 
+// Return the operator that gives the same result when the operands of a
+// predicate are swapped, e.g., a < b is equivalent to b > a.
+func (op BoolOp) flip() BoolOp {
+	switch op {
+	case OpGt:
+		return OpLt
+	case OpLt:
+		return OpGt
+	case OpGe:
+		return OpLe
+	case OpLe:
+		return OpGe
+	}
+	return op
+}
+
+// Return the result of a comparison of two values, given the result cmp of
+// [compareValues] on them.
+func evalCmp(cmp int, op BoolOp) bool {
+	switch op {
+	case OpEq:
+		return cmp == 0
+	case OpNeq:
+		return cmp != 0
+	case OpGt:
+		return cmp > 0
+	case OpGe:
+		return cmp >= 0
+	case OpLt:
+		return cmp < 0
+	case OpLe:
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
 func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
 	i2, ok := v2.(IntField)
 	if !ok {
-		return false
+		cmp, ok := compareValues(i1, v2)
+		return ok && evalCmp(cmp, op)
 	}
 	x1 := i1.Value
 	x2 := i2.Value
@@ -135,19 +173,60 @@ func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
 	case OpLe:
 		return x1 <= x2
 	case OpLike:
-		s1, ok := any(i1).(string)
-		if !ok {
-			return false
-		}
-		regex, ok := any(i2).(string)
-		if !ok {
-			return false
-		}
-		regex = "^" + regex + "$"
-		regex = strings.Replace(regex, "%", ".*?", -1)
-		match, _ := regexp.MatchString(regex, s1)
-		return match
+		return likeMatch(x1, x2)
 	default:
 		return false
 	}
 }
+
+// Return whether s matches the LIKE pattern, in which % matches any sequence
+// of characters and _ any single character.
+func likeMatch(s string, pattern string) bool {
+	// the positions to resume from when the last % seen has to match more
+	star, resume := -1, 0
+	i, j := 0, 0
+	for i < len(s) {
+		switch {
+		case j < len(pattern) && pattern[j] == '%':
+			star, resume = j, i
+			j++
+		case j < len(pattern) && (pattern[j] == '_' || pattern[j] == s[i]):
+			i++
+			j++
+		case star >= 0:
+			resume++
+			i, j = resume, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pattern) && pattern[j] == '%' {
+		j++
+	}
+	return j == len(pattern)
+}
+
+func (f1 FloatField) EvalPred(v2 DBValue, op BoolOp) bool {
+	cmp, ok := compareValues(f1, v2)
+	return ok && evalCmp(cmp, op)
+}
+
+func (b1 BoolField) EvalPred(v2 DBValue, op BoolOp) bool {
+	cmp, ok := compareValues(b1, v2)
+	return ok && evalCmp(cmp, op)
+}
+
+func (d1 DateField) EvalPred(v2 DBValue, op BoolOp) bool {
+	cmp, ok := compareValues(d1, v2)
+	return ok && evalCmp(cmp, op)
+}
+
+func (t1 TimestampField) EvalPred(v2 DBValue, op BoolOp) bool {
+	cmp, ok := compareValues(t1, v2)
+	return ok && evalCmp(cmp, op)
+}
+
+func (d1 DecimalField) EvalPred(v2 DBValue, op BoolOp) bool {
+	cmp, ok := compareValues(d1, v2)
+	return ok && evalCmp(cmp, op)
+}
@@ -0,0 +1,274 @@
+package godb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTypedTupleSerialization(t *testing.T) {
+	desc := TupleDesc{[]FieldType{
+		{"f", "", FloatType, 0, 0},
+		{"b", "", BoolType, 0, 0},
+		{"d", "", DateType, 0, 0},
+		{"ts", "", TimestampType, 0, 0},
+		{"dec", "", DecimalType, 18, 4},
+		{"name", "", StringType, 0, 0},
+	}}
+	tup := Tuple{desc, []DBValue{
+		FloatField{-2.25},
+		BoolField{true},
+		NewDateField(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)),
+		NewTimestampField(time.Date(1969, 7, 20, 20, 17, 40, 500, time.UTC)),
+		DecimalField{-1234567, 4},
+		StringField{"x"},
+	}, nil}
+	var buf bytes.Buffer
+	if err := tup.writeTo(&buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	size := 0
+	for _, f := range desc.Fields {
+		size += f.Ftype.size()
+	}
+	if buf.Len() != size {
+		t.Errorf("expected %d bytes, got %d", size, buf.Len())
+	}
+	tup2, err := readTupleFrom(&buf, &desc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !tup.equals(tup2) {
+		t.Errorf("serialization roundtrip failed, expected %v, got %v", tup, tup2)
+	}
+}
+
+func TestParseAndFormatValues(t *testing.T) {
+	for _, c := range []struct {
+		ftype DBType
+		in    string
+		out   string
+	}{
+		{FloatType, "3.5", "3.5"},
+		{FloatType, " -1e3", "-1000"},
+		{BoolType, "TRUE", "true"},
+		{BoolType, "f", "false"},
+		{DateType, "1969-12-31", "1969-12-31"},
+		{DateType, "2024-02-29", "2024-02-29"},
+		{TimestampType, "2024-02-29 13:01:02", "2024-02-29 13:01:02"},
+		{TimestampType, "2024-02-29T13:01:02.25", "2024-02-29 13:01:02.25"},
+		{TimestampType, "2024-02-29", "2024-02-29 00:00:00"},
+		{DecimalType, "12.5", "12.5"},
+		{DecimalType, "-0.00015", "-0.00015"},
+		{DecimalType, ".75", "0.75"},
+		{DecimalType, "1234567890123", "1234567890123"},
+		{DecimalType, "1.1234567890123456785", "1.123456789012345679"},
+		{DecimalType, "12.1234567890123456785", "12.12345678901234568"},
+	} {
+		v, err := parseValue(c.ftype, c.in)
+		if err != nil {
+			t.Errorf("parsing %q as %s: %s", c.in, c.ftype, err.Error())
+			continue
+		}
+		if s := valueString(v); s != c.out {
+			t.Errorf("parsing %q as %s, expected %s, got %s", c.in, c.ftype, c.out, s)
+		}
+	}
+
+	for _, c := range []struct {
+		ftype DBType
+		in    string
+	}{
+		{FloatType, "abc"},
+		{BoolType, "maybe"},
+		{DateType, "2024-02-30"},
+		{TimestampType, "noon"},
+		{DecimalType, "1.2.3"},
+		{DecimalType, "-"},
+	} {
+		if _, err := parseValue(c.ftype, c.in); err == nil {
+			t.Errorf("expected an error parsing %q as %s", c.in, c.ftype)
+		}
+	}
+}
+
+func TestEvalPredTypes(t *testing.T) {
+	d1, _ := parseValue(DateType, "2024-01-01")
+	ts1, _ := parseValue(TimestampType, "2024-01-01 00:00:01")
+	for _, c := range []struct {
+		v1, v2 DBValue
+		op     BoolOp
+		want   bool
+	}{
+		{FloatField{1.5}, FloatField{2}, OpLt, true},
+		{IntField{2}, FloatField{1.5}, OpGt, true},
+		{FloatField{2}, IntField{2}, OpEq, true},
+		{DecimalField{15000, 4}, FloatField{1.5}, OpEq, true},
+		{DecimalField{15000, 4}, IntField{2}, OpLe, true},
+		{BoolField{false}, BoolField{true}, OpLt, true},
+		{BoolField{true}, BoolField{true}, OpNeq, false},
+		{d1, ts1, OpLt, true},
+		{ts1, d1, OpGe, true},
+		{d1, IntField{0}, OpEq, false},
+		{FloatField{0}, StringField{"0"}, OpEq, false},
+	} {
+		if got := c.v1.EvalPred(c.v2, c.op); got != c.want {
+			t.Errorf("%v %v %v: expected %v, got %v", c.v1, c.op, c.v2, c.want, got)
+		}
+	}
+}
+
+func TestTypedTableQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("acct"))
+	defer os.Remove(c.tableNameToFile("acct"))
+	if _, _, err := Parse(c, "create table acct (id int, balance decimal(10,2), rate double, active boolean, opened date, updated timestamp)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c.GetTable("acct")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	f, err := os.CreateTemp("", "acct*.csv")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("1,100.50,1.5,true,2020-01-15,2020-01-15 10:00:00\n" +
+		"2,20.25,2.5,false,2021-06-01,2021-06-01 08:30:00\n" +
+		"3,0.10,0.25,t,2019-12-31,2022-03-04 23:59:59\n" +
+		"4,1000,4,no,2020-01-15,2020-01-16 00:00:00\n")
+	f.Seek(0, 0)
+	if err := table.(*HeapFile).LoadFromCSV(f, false, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f.Close()
+
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select id from acct where rate > 1.5", 2},
+		{"select id from acct where rate >= 2", 2},
+		{"select id from acct where active = true", 2},
+		{"select id from acct where balance < 21", 2},
+		{"select id from acct where balance > rate", 3},
+		{"select id from acct where opened = opened and updated > opened", 4},
+		{"select opened, count(*) from acct group by opened", 3},
+		{"select id from acct where rate * 2 > 4", 2},
+		{"select id from acct where balance + 1 > 100", 2},
+		{"select id from acct where balance - rate >= id", 3},
+	} {
+		_, n := countQueryResults(t, bp, c, q.sql)
+		if n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+
+	for _, q := range []struct {
+		sql  string
+		want []DBValue
+	}{
+		{"select avg(rate), sum(rate), sum(balance), min(opened), max(updated) from acct", []DBValue{
+			FloatField{2.0625}, FloatField{8.25}, DecimalField{112085, 2},
+			mustParseValue(t, DateType, "2019-12-31"), mustParseValue(t, TimestampType, "2022-03-04 23:59:59")}},
+		{"select id, opened from acct order by opened desc, id limit 1", []DBValue{IntField{2}}},
+		{"select avg(age) from t", []DBValue{FloatField{47.75}}},
+		{"select rate + 1, balance * 2, balance / 4, imax(rate, balance), id + rate, id - balance from acct where id = 1", []DBValue{
+			FloatField{2.5}, DecimalField{20100, 2}, DecimalField{251250, 4}, FloatField{100.5}, FloatField{2.5}, DecimalField{-9950, 2}}},
+	} {
+		_, plan, err := Parse(c, q.sql)
+		if err != nil {
+			t.Fatalf("query %s: %s", q.sql, err.Error())
+		}
+		tid := BeginTransactionForTest(t, bp)
+		iter, err := plan.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tup, err := iter()
+		if err != nil || tup == nil {
+			t.Fatalf("query %s returned no result (%v)", q.sql, err)
+		}
+		for i, v := range q.want {
+			if tup.Fields[i] != v {
+				t.Errorf("query %s: expected %s in field %d, got %s", q.sql, valueString(v), i, valueString(tup.Fields[i]))
+			}
+		}
+		bp.CommitTransaction(tid)
+	}
+}
+
+// test that DECIMAL columns keep the precision and scale they declare: values
+// are rounded to the scale when they are inserted, values with more digits
+// than the precision are rejected, and the types are saved in the catalog
+func TestDecimalPrecisionAndScale(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("amounts"))
+	defer os.Remove(c.tableNameToFile("amounts"))
+	for _, sql := range []string{
+		"create table amounts (a decimal(30,4))",
+		"create table amounts (a decimal(4,5))",
+		"create table amounts (a decimal(0))",
+		"select cast(age as decimal(19,2)) from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an unsupported precision or scale to be rejected", sql)
+		}
+	}
+	if _, _, err := Parse(c, "create table amounts (id int, a decimal(6,2), b decimal(4), c numeric)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c.GetTableInfo("amounts")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := table.String(); !strings.Contains(got, "a decimal(6,2), b decimal(4,0), c decimal(18,4)") {
+		t.Errorf("expected the catalog entry to keep the precisions and scales, got %s", got)
+	}
+
+	countQueryResults(t, bp, c, "insert into amounts values (1, 1.005, 2.5, 1), (2, '-3.14159', 1234, 0.00005)")
+	for _, sql := range []string{
+		"insert into amounts values (3, 10000, 1, 1)",
+		"insert into amounts values (3, 1, 10000, 1)",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected a value with too many digits to be rejected", sql)
+		}
+	}
+	for _, q := range []struct {
+		sql  string
+		want []DBValue
+	}{
+		{"select a, b, c from amounts where id = 1", []DBValue{DecimalField{101, 2}, DecimalField{3, 0}, DecimalField{10000, 4}}},
+		{"select a, b, c from amounts where id = 2", []DBValue{DecimalField{-314, 2}, DecimalField{1234, 0}, DecimalField{1, 4}}},
+		{"select a + b, a * b, a / b, imax(a, c) from amounts where id = 1", []DBValue{DecimalField{401, 2}, DecimalField{303, 2}, DecimalField{3367, 4}, DecimalField{10100, 4}}},
+		{"select cast(a as decimal(3,1)), cast(a as decimal) from amounts where id = 2", []DBValue{DecimalField{-31, 1}, DecimalField{-31400, 4}}},
+		{"select id from amounts where a = cast('-3.140' as decimal(5,3))", []DBValue{IntField{2}}},
+		{"select id from amounts where b + c > 1234", []DBValue{IntField{2}}},
+	} {
+		got := queryResults(t, bp, c, q.sql)
+		if want := fmt.Sprint(q.want); len(got) != 1 || got[0] != want {
+			t.Errorf("query %s: expected %s, got %v", q.sql, want, got)
+		}
+	}
+}
+
+func mustParseValue(t *testing.T, ftype DBType, s string) DBValue {
+	t.Helper()
+	v, err := parseValue(ftype, s)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return v
+}
@@ -0,0 +1,202 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A View is a named query, stored in the catalog, that may be used in the
+// FROM clause of other queries like a table. Each use of a view plans its
+// query anew, as a subquery, so views see the current schema of the tables
+// they use.
+type View struct {
+	name  string
+	query string
+}
+
+// sqlparser discards the query of a CREATE VIEW statement, so CREATE VIEW
+// and DROP VIEW are parsed here. The supported forms are
+//
+//	CREATE VIEW name AS query
+//	DROP VIEW [IF EXISTS] name
+//
+// along with the statements on materialized views, see
+// [processMaterializedViewStatement]. Returns false if query is none of them.
+func processViewStatement(c *Catalog, query string) (QueryType, bool, error) {
+	query = strings.TrimSpace(query)
+	if qtype, ok, err := processMaterializedViewStatement(c, query); ok {
+		return qtype, true, err
+	}
+	if n := matchKeywords(query, []string{"create", "view"}); n > 0 {
+		v, _, err := parseViewDefinition(c, query, n)
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		c.views[v.name] = v
+		return CreateViewQueryType, true, nil
+	}
+	if n := matchKeywords(query, []string{"drop", "view"}); n > 0 {
+		name, ifExists, err := parseDropView(query, n)
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		if c.views[name] == nil && !ifExists {
+			return UnknownQueryType, true, GoDBError{NoSuchTableError, fmt.Sprintf("no view '%s' found", name)}
+		}
+		delete(c.views, name)
+		return DropViewQueryType, true, nil
+	}
+	return UnknownQueryType, false, nil
+}
+
+// Parse the "name AS query" that follows the first n bytes of a CREATE VIEW
+// statement, and check that the query is valid. Returns the view and the
+// physical plan of its query.
+func parseViewDefinition(c *Catalog, query string, n int) (*View, *OperatorCard, error) {
+	words := strings.Fields(query[n:])
+	if len(words) < 3 || !strings.EqualFold(words[1], "as") {
+		return nil, nil, GoDBError{ParseError, fmt.Sprintf("expected CREATE %s name AS query, got %s", strings.ToUpper(strings.Join(strings.Fields(query[:n])[1:], " ")), query)}
+	}
+	name := strings.ToLower(words[0])
+	if _, err := c.GetTableInfo(name); err == nil || c.views[name] != nil {
+		return nil, nil, GoDBError{DuplicateTableError, fmt.Sprintf("a table or view named '%s' already exists", name)}
+	}
+	v := &View{name: name, query: viewQueryReplacer.Replace(afterWords(query[n:], 2))}
+	pc := newParseContext(c)
+	plan, err := viewPlan(pc, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	op, err := makePhysicalPlan(pc, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, op, nil
+}
+
+// Parse the "[IF EXISTS] name" that follows the first n bytes of a DROP VIEW
+// statement.
+func parseDropView(query string, n int) (string, bool, error) {
+	words := strings.Fields(query[n:])
+	ifExists := len(words) == 3 && strings.EqualFold(words[0], "if") && strings.EqualFold(words[1], "exists")
+	if ifExists {
+		words = words[2:]
+	}
+	if len(words) != 1 {
+		return "", false, GoDBError{ParseError, fmt.Sprintf("expected DROP %s [IF EXISTS] name, got %s", strings.ToUpper(strings.Join(strings.Fields(query[:n])[1:], " ")), query)}
+	}
+	return strings.ToLower(words[0]), ifExists, nil
+}
+
+// Views are recorded in the catalog on a single line.
+var viewQueryReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// Plan the query of view v, in the context c of the query that uses it. Common
+// table expressions of that query are not in scope of the view.
+func viewPlan(c *parseContext, v *View) (*LogicalPlan, error) {
+	return viewPlanWith(c, v, nil)
+}
+
+// Plan the query of view v, in the context c of the query that uses it, with
+// ctes as the common table expressions in scope of it.
+func viewPlanWith(c *parseContext, v *View, ctes map[string]*cteBinding) (*LogicalPlan, error) {
+	if slices.Contains(c.expanding, v) {
+		return nil, GoDBError{ParseError, fmt.Sprintf("view %s refers to itself", v.name)}
+	}
+	vc := &parseContext{c.Catalog, ctes, c.params, append(slices.Clip(c.expanding), v), c.tid}
+	query, err := rewriteWindowFunctions(v.query)
+	if err != nil {
+		return nil, err
+	}
+	if query, err = rewriteCasts(query); err != nil {
+		return nil, err
+	}
+	return parseQuery(vc, query)
+}
+
+// Return an error if a view reads from the table named name, which would be
+// changed by action. Views that can no longer be planned are skipped.
+func (c *Catalog) checkNotReadByView(name string, action string) error {
+	for _, vname := range c.viewNames() {
+		plan, err := viewPlan(newParseContext(c), c.views[vname])
+		if err == nil && planReadsTable(plan, name) {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s %s, because view %s reads from it", action, name, vname)}
+		}
+	}
+	return nil
+}
+
+// Report whether plan, or a plan nested in it, reads from the table named
+// name.
+func planReadsTable(plan *LogicalPlan, name string) bool {
+	if plan == nil {
+		return false
+	}
+	for _, t := range plan.tables {
+		if t.tableName == name {
+			return true
+		}
+	}
+	nested := slices.Clone(plan.subqueries)
+	if plan.setOp != nil {
+		nested = append(nested, plan.setOp.left, plan.setOp.right)
+	}
+	if plan.recursive != nil {
+		nested = append(nested, plan.recursive.base, plan.recursive.step)
+	}
+	for _, sq := range plan.subqueryFilters {
+		nested = append(nested, sq.subplan)
+	}
+	return slices.ContainsFunc(nested, func(p *LogicalPlan) bool { return planReadsTable(p, name) })
+}
+
+// Format v as it is recorded in the catalog.
+func (v *View) String() string {
+	return fmt.Sprintf("view %s as %s\n", v.name, v.query)
+}
+
+// Parse a view as formatted by [View.String] in the catalog. Returns false if
+// line is not a view.
+func parseViewDeclaration(line string) (*View, bool) {
+	words := strings.Fields(line)
+	if len(words) < 4 || !strings.EqualFold(words[0], "view") || !strings.EqualFold(words[2], "as") {
+		return nil, false
+	}
+	return &View{name: strings.ToLower(words[1]), query: afterWords(line, 3)}, true
+}
+
+// Return the names of the views of c, in order.
+func (c *Catalog) viewNames() []string {
+	names := make([]string, 0, len(c.views))
+	for name := range c.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe the views of c, with the columns of each, for display.
+func (c *Catalog) viewsString() string {
+	var buf strings.Builder
+	for _, name := range c.viewNames() {
+		v := c.views[name]
+		buf.WriteString(name)
+		pc := newParseContext(c)
+		if plan, err := viewPlan(pc, v); err == nil {
+			if op, err := makePhysicalPlan(pc, plan); err == nil {
+				buf.WriteByte('(')
+				for i, f := range op.Descriptor().Fields {
+					if i != 0 {
+						buf.WriteString(", ")
+					}
+					buf.WriteString(f.Fname + " " + f.typeName())
+				}
+				buf.WriteByte(')')
+			}
+		}
+		buf.WriteString(" as " + v.query + "\n")
+	}
+	return buf.String()
+}
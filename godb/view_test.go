@@ -0,0 +1,112 @@
+package godb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestViews(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, sql := range []string{
+		"create view older as select name, age from t where age > 40",
+		"create view oldest as select name from older where age > 90",
+		"CREATE VIEW byname AS\nselect name, count(*) as n from t group by name",
+	} {
+		qtype, _, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+		if qtype != CreateViewQueryType {
+			t.Errorf("%s: expected a CREATE VIEW query, got %v", sql, qtype)
+		}
+	}
+
+	for _, q := range []struct {
+		sql   string
+		count int
+	}{
+		{"select * from older", 6},
+		{"select older.name from older join t2 on older.name = t2.name", 8},
+		{"select o.name from older o where o.age < 50", 2},
+		{"select name from oldest", 2},
+		{"select name from byname where n > 1", 2},
+		{"select name from t where name in (select name from oldest)", 3},
+		{"with older as (select name from t where age < 30) select name from older", 3},
+	} {
+		if _, n := countQueryResults(t, bp, c, q.sql); n != q.count {
+			t.Errorf("query %s: expected %d results, got %d", q.sql, q.count, n)
+		}
+	}
+
+	for _, sql := range []string{
+		"create view older as select name from t",
+		"create view t as select name from t2",
+		"create view bad as select nosuch from t",
+		"create view bad select name from t",
+		"create table older (a int)",
+		"drop view nosuch",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error for %s", sql)
+		}
+	}
+	if _, _, err := Parse(c, "drop view if exists nosuch"); err != nil {
+		t.Errorf("drop view if exists: %s", err.Error())
+	}
+
+	// views are saved with the catalog, and listed after the tables
+	catFile := "view_test_catalog.txt"
+	defer os.Remove(catFile)
+	defer os.Remove(statsFileName(catFile))
+	if err := c.SaveToFile(catFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile(catFile, bp, ".")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, n := countQueryResults(t, bp, c2, "select name from oldest"); n != 2 {
+		t.Errorf("expected 2 results from a view after reloading the catalog, got %d", n)
+	}
+	s := c2.CatalogString()
+	views := strings.Index(s, "Views:\n")
+	if views < 0 || !strings.Contains(s[views:], "byname(name string, n int) as select name, count(*) as n from t group by name\n") ||
+		!strings.Contains(s[views:], "older(name string, age int) as select name, age from t where age > 40\n") {
+		t.Errorf("unexpected catalog description\n%s", s)
+	}
+
+	qtype, _, err := Parse(c, "drop view oldest")
+	if err != nil || qtype != DropViewQueryType {
+		t.Fatalf("expected DROP VIEW to succeed, got %v %v", qtype, err)
+	}
+	if _, _, err := Parse(c, "select name from oldest"); err == nil {
+		t.Errorf("expected an error querying a dropped view")
+	}
+
+	// a table that a view reads from cannot be dropped until the view is
+	os.Remove(c.tableNameToFile("staff"))
+	defer os.Remove(c.tableNameToFile("staff"))
+	for _, sql := range []string{
+		"create table staff (name varchar(20))",
+		"create view busy as select name from t where name in (select name from staff)",
+	} {
+		if _, _, err := Parse(c, sql); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	if _, _, err := Parse(c, "drop table staff"); err == nil || !strings.Contains(err.Error(), "view busy reads from it") {
+		t.Errorf("expected dropping a table a view reads from to fail, got %v", err)
+	}
+	if _, err := c.GetTableInfo("staff"); err != nil {
+		t.Errorf("expected the table to be kept: %s", err.Error())
+	}
+	for _, sql := range []string{"drop view busy", "drop table staff"} {
+		if _, _, err := Parse(c, sql); err != nil {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestWhereExpressions(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name from t where age + 5 > 50", 4},
+		{"select name from t where 10 < age - 40", 3},
+		{"select name from t where getsubstr(name, 0, 2) = 'sa'", 3},
+		{"select name from t where imax(age, 50) = age", 4},
+		{"select name from t where 1 = 1", 12},
+		{"select t.name from t join t2 on t.name = t2.name where t.age + t2.age > 100", 5},
+		{"select t.name from t join t2 on t.name = t2.name where t.age < t2.age", 2},
+	}
+	for _, q := range queries {
+		_, cnt := countQueryResults(t, bp, c, q.sql)
+		if cnt != q.expected {
+			t.Errorf("query '%s' returned %d tuples, expected %d", q.sql, cnt, q.expected)
+		}
+	}
+}
+
+func TestFilterPlacement(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	plan, _ := countQueryResults(t, bp, c, "select t.name from t join t2 on t.name = t2.name where t.age * 2 > 100 and t.age + t2.age > 100")
+
+	// expect Filter(t.age + t2.age) -> Join -> Filter(t.age * 2) -> scan
+	var join *EqualityJoin
+	var above *Filter
+	var walk func(o Operator, parent Operator)
+	walk = func(o Operator, parent Operator) {
+		switch op := o.(*OperatorCard).Op.(type) {
+		case *Project:
+			walk(op.child, op)
+		case *Filter:
+			walk(op.child, op)
+		case *EqualityJoin:
+			join = op
+			above, _ = parent.(*Filter)
+		}
+	}
+	walk(plan, nil)
+	if join == nil {
+		t.Fatalf("expected the plan to have a join")
+	}
+	if above == nil {
+		t.Errorf("expected the filter over both tables to be placed directly above the join")
+	}
+	below := 0
+	for _, child := range []*Operator{join.left, join.right} {
+		if _, ok := (*child).(*OperatorCard).Op.(*Filter); ok {
+			below++
+		}
+	}
+	if below != 1 {
+		t.Errorf("expected the filter over t to be placed below the join")
+	}
+}
@@ -0,0 +1,338 @@
+package godb
+
+import (
+	"fmt"
+)
+
+type WindowFuncType int
+
+const (
+	RowNumberWindow WindowFuncType = iota
+	RankWindow      WindowFuncType = iota
+	DenseRankWindow WindowFuncType = iota
+	LagWindow       WindowFuncType = iota
+	LeadWindow      WindowFuncType = iota
+	AggWindow       WindowFuncType = iota
+)
+
+func (f WindowFuncType) String() string {
+	switch f {
+	case RowNumberWindow:
+		return "row_number"
+	case RankWindow:
+		return "rank"
+	case DenseRankWindow:
+		return "dense_rank"
+	case LagWindow:
+		return "lag"
+	case LeadWindow:
+		return "lead"
+	case AggWindow:
+		return "aggregate"
+	}
+	return "??"
+}
+
+// A WindowFrame is the range of rows of a partition, relative to the current
+// row, that a windowed aggregate is computed over. Negative offsets are rows
+// preceding the current row, and positive offsets rows following it.
+type WindowFrame struct {
+	start, end                   int
+	unboundedStart, unboundedEnd bool
+}
+
+// Construct the frame ROWS BETWEEN start AND end. If unboundedStart or
+// unboundedEnd is set, the corresponding offset is ignored and the frame
+// extends to the start or end of the partition.
+func NewWindowFrame(start int, unboundedStart bool, end int, unboundedEnd bool) *WindowFrame {
+	return &WindowFrame{start, end, unboundedStart, unboundedEnd}
+}
+
+// A WindowFunc is a function evaluated by [WindowOp] for every row of its
+// input.
+type WindowFunc struct {
+	fn    WindowFuncType
+	alias string
+
+	// for LAG and LEAD, the expression to read from the row offset rows before
+	// (or after) the current one, and the value to return if there is no such
+	// row
+	arg    Expr
+	offset int
+	dflt   Expr
+
+	// for aggregates, the (initialized) state to copy for each frame, and the
+	// frame; nil means the default frame, see [WindowOp]
+	agg   AggState
+	frame *WindowFrame
+}
+
+// Construct ROW_NUMBER, RANK or DENSE_RANK.
+func NewRankingWindowFunc(fn WindowFuncType, alias string) (*WindowFunc, error) {
+	if fn != RowNumberWindow && fn != RankWindow && fn != DenseRankWindow {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("%s is not a ranking window function", fn)}
+	}
+	return &WindowFunc{fn: fn, alias: alias}, nil
+}
+
+// Construct LAG or LEAD, returning arg evaluated on the row offset rows before
+// (or after) the current row in its partition, or dflt if there is no such
+// row. dflt must have the same type as arg.
+func NewOffsetWindowFunc(fn WindowFuncType, alias string, arg Expr, offset int, dflt Expr) (*WindowFunc, error) {
+	if fn != LagWindow && fn != LeadWindow {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("%s is not an offset window function", fn)}
+	}
+	if dflt.GetExprType().Ftype != arg.GetExprType().Ftype {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("default value of %s has a different type than its argument", fn)}
+	}
+	return &WindowFunc{fn: fn, alias: alias, arg: arg, offset: offset, dflt: dflt}, nil
+}
+
+// Construct an aggregate over frame. agg must be initialized with
+// [AggState.Init], and is copied for each frame; its alias names the output
+// field.
+func NewAggWindowFunc(agg AggState, frame *WindowFrame) *WindowFunc {
+	return &WindowFunc{fn: AggWindow, alias: agg.GetTupleDesc().Fields[0].Fname, agg: agg, frame: frame}
+}
+
+func (w *WindowFunc) fieldType() FieldType {
+	switch w.fn {
+	case LagWindow, LeadWindow:
+		ft := w.arg.GetExprType()
+		return FieldType{w.alias, "", ft.Ftype, ft.Precision, ft.Scale}
+	case AggWindow:
+		ft := w.agg.GetTupleDesc().Fields[0]
+		return FieldType{w.alias, "", ft.Ftype, ft.Precision, ft.Scale}
+	}
+	return FieldType{w.alias, "", IntType, 0, 0}
+}
+
+// WindowOp evaluates window functions over partitions of its input.
+//
+// The child must be sorted on the partitionBy expressions, and then on the
+// orderBy expressions, e.g., by an [OrderBy] operator. Rows with equal orderBy
+// values are peers, and are ranked equally by RANK and DENSE_RANK. Aggregates
+// without an explicit frame are computed from the start of the partition
+// through the last peer of the current row, or over the whole partition if
+// there is no orderBy.
+type WindowOp struct {
+	partitionBy []Expr
+	orderBy     []Expr
+	funcs       []*WindowFunc
+	child       Operator
+}
+
+// Construct a window operator that evaluates funcs over child.
+func NewWindowOp(partitionBy []Expr, orderBy []Expr, funcs []*WindowFunc, child Operator) *WindowOp {
+	return &WindowOp{partitionBy, orderBy, funcs, child}
+}
+
+// Return the TupleDesc of the result, which is the child's descriptor followed
+// by a field for each window function.
+func (w *WindowOp) Descriptor() *TupleDesc {
+	fields := make([]FieldType, len(w.funcs))
+	for i, f := range w.funcs {
+		fields[i] = f.fieldType()
+	}
+	return w.child.Descriptor().merge(&TupleDesc{fields})
+}
+
+// Compute a key of the values of exprs on t.
+func evalKey(exprs []Expr, t *Tuple) (any, error) {
+	vals := make([]DBValue, len(exprs))
+	fields := make([]FieldType, len(exprs))
+	for i, e := range exprs {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+		fields[i] = e.GetExprType()
+	}
+	return (&Tuple{TupleDesc{fields}, vals, nil}).tupleKey(), nil
+}
+
+// Window operator implementation. Reads the rows of one partition at a time,
+// and returns them with the values of the window functions appended.
+func (w *WindowOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := w.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := w.Descriptor()
+
+	var next *Tuple // first tuple of the next partition
+	var nextKey any
+	var out []*Tuple
+	done := false
+
+	return func() (*Tuple, error) {
+		for len(out) == 0 {
+			if done {
+				return nil, nil
+			}
+			var rows []*Tuple
+			if next != nil {
+				rows = append(rows, next)
+			}
+			for {
+				t, err := childIter()
+				if err != nil {
+					return nil, err
+				}
+				if t == nil {
+					done = true
+					break
+				}
+				key, err := evalKey(w.partitionBy, t)
+				if err != nil {
+					return nil, err
+				}
+				if len(rows) > 0 && key != nextKey {
+					next, nextKey = t, key
+					break
+				}
+				rows = append(rows, t)
+				nextKey = key
+			}
+			out, err = w.evalPartition(rows, desc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		t := out[0]
+		out = out[1:]
+		return t, nil
+	}, nil
+}
+
+// Evaluate the window functions over the rows of a partition, returning the
+// output tuples.
+func (w *WindowOp) evalPartition(rows []*Tuple, desc *TupleDesc) ([]*Tuple, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	// peerEnd[i] is the index after the last peer of row i
+	peerEnd := make([]int, len(rows))
+	peerGroup := make([]int, len(rows))
+	groupStart := make([]int, len(rows))
+	start, group := 0, 0
+	prevKey, err := evalKey(w.orderBy, rows[0])
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= len(rows); i++ {
+		var key any
+		if i < len(rows) {
+			key, err = evalKey(w.orderBy, rows[i])
+			if err != nil {
+				return nil, err
+			}
+			if key == prevKey {
+				continue
+			}
+		}
+		for j := start; j < i; j++ {
+			peerEnd[j] = i
+			peerGroup[j] = group
+			groupStart[j] = start
+		}
+		start, prevKey = i, key
+		group++
+	}
+
+	vals := make([][]DBValue, len(rows))
+	for i, t := range rows {
+		vals[i] = make([]DBValue, len(t.Fields), len(t.Fields)+len(w.funcs))
+		copy(vals[i], t.Fields)
+	}
+	for _, f := range w.funcs {
+		switch f.fn {
+		case RowNumberWindow:
+			for i := range rows {
+				vals[i] = append(vals[i], IntField{int64(i + 1)})
+			}
+		case RankWindow:
+			for i := range rows {
+				vals[i] = append(vals[i], IntField{int64(groupStart[i] + 1)})
+			}
+		case DenseRankWindow:
+			for i := range rows {
+				vals[i] = append(vals[i], IntField{int64(peerGroup[i] + 1)})
+			}
+		case LagWindow, LeadWindow:
+			for i := range rows {
+				j := i - f.offset
+				if f.fn == LeadWindow {
+					j = i + f.offset
+				}
+				var v DBValue
+				if j >= 0 && j < len(rows) {
+					v, err = f.arg.EvalExpr(rows[j])
+				} else {
+					v, err = f.dflt.EvalExpr(rows[i])
+				}
+				if err != nil {
+					return nil, err
+				}
+				vals[i] = append(vals[i], v)
+			}
+		case AggWindow:
+			w.evalAggregate(f, rows, peerEnd, vals)
+		}
+	}
+
+	out := make([]*Tuple, len(rows))
+	for i, t := range rows {
+		out[i] = &Tuple{*desc, vals[i], t.Rid}
+	}
+	return out, nil
+}
+
+// Evaluate the aggregate f over the frame of each row, appending the results
+// to vals.
+//
+// Frames that start at the start of the partition only grow from row to row,
+// so a single aggregation state is used for all of them; other frames are
+// aggregated from scratch. An empty frame has the zero value of the result
+// type, as GoDB has no NULLs.
+func (w *WindowOp) evalAggregate(f *WindowFunc, rows []*Tuple, peerEnd []int, vals [][]DBValue) {
+	var running AggState
+	added := 0
+	for i := range rows {
+		lo, hi := 0, len(rows) // frame is rows[lo:hi]
+		if f.frame == nil {
+			if len(w.orderBy) > 0 {
+				hi = peerEnd[i]
+			}
+		} else {
+			if !f.frame.unboundedStart {
+				lo = max(i+f.frame.start, 0)
+			}
+			if !f.frame.unboundedEnd {
+				hi = min(i+f.frame.end+1, len(rows))
+			}
+		}
+		if lo >= hi {
+			vals[i] = append(vals[i], zeroValue(f.fieldType().Ftype))
+			continue
+		}
+
+		var state AggState
+		if lo == 0 {
+			if running == nil {
+				running = f.agg.Copy()
+			}
+			for ; added < hi; added++ {
+				running.AddTuple(rows[added])
+			}
+			state = running
+		} else {
+			state = f.agg.Copy()
+			for _, t := range rows[lo:hi] {
+				state.AddTuple(t)
+			}
+		}
+		vals[i] = append(vals[i], state.Finalize().Fields[0])
+	}
+}
@@ -0,0 +1,134 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWindowOp(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &t1, tid)
+
+	name := &FieldExpr{t1.Desc.Fields[0]}
+	age := &FieldExpr{t1.Desc.Fields[1]}
+	sorted, err := NewOrderBy([]Expr{age}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	rowNumber, _ := NewRankingWindowFunc(RowNumberWindow, "rn")
+	rank, _ := NewRankingWindowFunc(RankWindow, "rank")
+	denseRank, _ := NewRankingWindowFunc(DenseRankWindow, "dense_rank")
+	lag, err := NewOffsetWindowFunc(LagWindow, "lag", name, 1, &ConstExpr{StringField{"none"}, StringType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	running := &SumAggState{}
+	running.Init("running", age)
+	framed := &SumAggState{}
+	framed.Init("framed", age)
+
+	funcs := []*WindowFunc{rowNumber, rank, denseRank, lag,
+		NewAggWindowFunc(running, nil),
+		NewAggWindowFunc(framed, NewWindowFrame(0, false, 1, false)),
+	}
+	w := NewWindowOp(nil, []Expr{age}, funcs, sorted)
+	if len(w.Descriptor().Fields) != len(t1.Desc.Fields)+len(funcs) {
+		t.Fatalf("unexpected descriptor %v", w.Descriptor())
+	}
+
+	a1, a2 := t1.Fields[1].(IntField).Value, t2.Fields[1].(IntField).Value
+	if a1 > a2 {
+		t.Fatalf("test expects t1 to be younger than t2")
+	}
+	expected := [][]DBValue{
+		{IntField{1}, IntField{1}, IntField{1}, StringField{"none"}, IntField{2 * a1}, IntField{2 * a1}},
+		{IntField{2}, IntField{1}, IntField{1}, t1.Fields[0], IntField{2 * a1}, IntField{a1 + a2}},
+		{IntField{3}, IntField{3}, IntField{2}, t1.Fields[0], IntField{2*a1 + 2*a2}, IntField{2 * a2}},
+		{IntField{4}, IntField{3}, IntField{2}, t2.Fields[0], IntField{2*a1 + 2*a2}, IntField{a2}},
+	}
+
+	iter, err := w.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; ; i++ {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			if i != len(expected) {
+				t.Fatalf("got %d tuples, expected %d", i, len(expected))
+			}
+			break
+		}
+		if i >= len(expected) {
+			t.Fatalf("too many tuples")
+		}
+		for j, v := range expected[i] {
+			if got := tup.Fields[len(t1.Fields)+j]; got != v {
+				t.Errorf("row %d: %s is %v, expected %v", i, funcs[j].alias, got, v)
+			}
+		}
+	}
+}
+
+func TestWindowQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected map[string][]int64 // name,age -> window values
+	}{
+		{"select name, age, row_number() over (partition by name order by age desc) as rn from t",
+			map[string][]int64{"riza,22": {2}, "riza,43": {1}, "sam,25": {2}, "sam,99": {1}, "bo,99": {1}}},
+		{"select name, age, rank() over (order by age) as r, dense_rank() over (order by age) dr from t",
+			map[string][]int64{"ang,22": {1, 1}, "riza,22": {1, 1}, "sam,25": {3, 2}, "bo,99": {11, 10}}},
+		{"select name, age, sum(age) over (order by age rows between 1 preceding and 1 following) as s, lag(age) over (order by age) l from t",
+			map[string][]int64{"sam,25": {77, 22}, "sarah,60": {209, 50}}},
+		{"select name, age, sum(age) over (partition by name) as total, count(*) over () as n, max(age) over (order by age rows 1 preceding) as m from t",
+			map[string][]int64{"sam,25": {124, 12, 25}, "riza,43": {65, 12, 43}, "mark,50": {50, 12, 50}}},
+	}
+	for _, q := range queries {
+		tid := BeginTransactionForTest(t, bp)
+		_, plan, err := Parse(c, q.sql)
+		if err != nil {
+			t.Fatalf("failed to parse, q=%s, %s", q.sql, err.Error())
+		}
+		iter, err := plan.Iterator(tid)
+		if err != nil {
+			t.Fatalf("failed to run, q=%s, %s", q.sql, err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf("failed to run, q=%s, %s", q.sql, err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			cnt++
+			key := fmt.Sprintf("%s,%d", tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value)
+			expected, ok := q.expected[key]
+			if !ok {
+				continue
+			}
+			for i, v := range expected {
+				if got := tup.Fields[2+i].(IntField).Value; got != v {
+					t.Errorf("query '%s': %s has %s = %d, expected %d", q.sql, key, tup.Desc.Fields[2+i].Fname, got, v)
+				}
+			}
+		}
+		if cnt != 12 {
+			t.Errorf("query '%s' returned %d tuples, expected 12", q.sql, cnt)
+		}
+		bp.CommitTransaction(tid)
+	}
+}
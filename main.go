@@ -19,12 +19,19 @@ var helpText = `Enter a SQL query terminated by a ; to process it.  Commands pre
 Available shell commands:
 	\h : This help
 	\c path/to/catalog : Change the current database to a specified catalog file
-	\d : List tables and fields in the current database
+	\d : List tables and fields, and then views and materialized views, in the current database
 	\f : List available functions for use in queries
 	\a : Toggle aligned vs csv output
     \o : Toggle query optimization
 	\l table path/to/file [sep] [hasHeader]: Append csv file to end of table.  Default to sep = ',', hasHeader = 'true'
-	\z : Compute statistics for the database`
+	\z : Compute statistics for the database
+	\w [bytes] : Show or set the memory an ORDER BY may use before sorting on disk
+	\j [bytes] : Show or set the memory a join may use before spilling to disk
+
+Prepared statements:
+	PREPARE name AS query; : Plan a query with ? or $1, $2, ... parameters
+	EXECUTE name(value, ...); : Run a prepared query with the given parameter values
+	DEALLOCATE name; : Discard a prepared query`
 
 func printCatalog(c *godb.Catalog) {
 	s := c.CatalogString()
@@ -67,6 +74,14 @@ func main() {
 	}
 	defer rl.Close()
 
+	// statistics change as transactions commit, so they are saved after
+	// each commit
+	saveStats := func() {
+		if err := c.SaveStatsToFile(catName, catPath); err != nil {
+			fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+		}
+	}
+
 	fmt.Printf("\033[35;1m")
 	fmt.Println(`Welcome to
 
@@ -88,6 +103,7 @@ func main() {
 	var autocommit bool = true
 	var tid godb.TransactionID
 	aligned := true
+	prepared := make(map[string]*godb.PreparedStatement)
 	for {
 		text, err := rl.Readline()
 		if err != nil { // io.EOF
@@ -135,8 +151,35 @@ func main() {
 					fmt.Println("\033[32;1mOptimization disabled\033[0m\n\n")
 				}
 			case 'z':
-				c.ComputeTableStats()
-				fmt.Printf("\033[32;1mAnalysis Complete\033[0m\n\n")
+				if err := c.ComputeTableStats(); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				} else if err := c.SaveStatsToFile(catName, catPath); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				} else {
+					fmt.Printf("\033[32;1mAnalysis Complete\033[0m\n\n")
+				}
+			case 'w':
+				splits := strings.Fields(text)
+				if len(splits) > 1 {
+					n, err := strconv.Atoi(splits[1])
+					if err != nil || n <= 0 {
+						fmt.Printf("\033[31;1mInvalid work memory size %s\033[0m\n", splits[1])
+						continue
+					}
+					godb.SortWorkMem = n
+				}
+				fmt.Printf("\033[32;1mSort work memory is %d bytes\033[0m\n\n", godb.SortWorkMem)
+			case 'j':
+				splits := strings.Fields(text)
+				if len(splits) > 1 {
+					n, err := strconv.Atoi(splits[1])
+					if err != nil || n <= 0 {
+						fmt.Printf("\033[31;1mInvalid work memory size %s\033[0m\n", splits[1])
+						continue
+					}
+					godb.JoinWorkMem = n
+				}
+				fmt.Printf("\033[32;1mJoin work memory is %d bytes\033[0m\n\n", godb.JoinWorkMem)
 			case '?':
 				fallthrough
 			case 'h':
@@ -184,14 +227,57 @@ func main() {
 		}
 		query = strings.TrimSpace(query + " " + text[0:len(text)-1])
 
-		explain := false
-		if strings.HasPrefix(strings.ToLower(query), "explain") {
-			queryParts := strings.Split(query, " ")
-			query = strings.Join(queryParts[1:], " ")
-			explain = true
+		explainOpts, explained, explain, err := godb.ParseExplain(query)
+		if err != nil {
+			query = ""
+			fmt.Printf("\033[31;1mInvalid query (%s)\033[0m\n", err.Error())
+			continue
+		}
+		if explain {
+			query = explained
+		}
+		printPlan := func(plan godb.Operator) {
+			fmt.Printf("\033[32m")
+			if err := godb.OutputExplain(func(format string, a ...any) { fmt.Printf(format, a...) }, plan, explainOpts); err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+			fmt.Printf("\033[0m")
 		}
 
-		queryType, plan, err := godb.Parse(c, query)
+		var queryType godb.QueryType
+		var plan godb.Operator
+		if name, body, ok := godb.ParsePrepare(query); ok {
+			query = ""
+			ps, err := godb.Prepare(c, body)
+			if err != nil {
+				fmt.Printf("\033[31;1mInvalid query (%s)\033[0m\n", err.Error())
+				continue
+			}
+			prepared[name] = ps
+			fmt.Printf("\033[32;1mPREPARE\033[0m\n\n")
+			continue
+		} else if fields := strings.Fields(query); len(fields) == 2 && strings.EqualFold(fields[0], "deallocate") {
+			query = ""
+			if _, ok := prepared[fields[1]]; !ok {
+				fmt.Printf("\033[31;1mNo prepared statement named %s\033[0m\n", fields[1])
+				continue
+			}
+			delete(prepared, fields[1])
+			fmt.Printf("\033[32;1mDEALLOCATE\033[0m\n\n")
+			continue
+		} else if name, args, ok, perr := godb.ParseExecute(query); ok {
+			err = perr
+			if ps, found := prepared[name]; err == nil && !found {
+				err = fmt.Errorf("no prepared statement named %s", name)
+			} else if err == nil {
+				err = ps.Bind(args...)
+				queryType, plan = ps.Type(), ps.Plan()
+			}
+		} else if autocommit {
+			queryType, plan, err = godb.Parse(c, query)
+		} else {
+			queryType, plan, err = godb.ParseInTransaction(c, tid, query)
+		}
 		query = ""
 		nresults := 0
 
@@ -223,10 +309,9 @@ func main() {
 			continue
 
 		case godb.IteratorType:
-			if explain {
-				fmt.Printf("\033[32m")
-				godb.PrintPhysicalPlan(plan, "")
-				fmt.Printf("\033[0m\n")
+			if explain && !explainOpts.Analyze {
+				printPlan(plan)
+				fmt.Println()
 				break
 			}
 			if autocommit {
@@ -239,6 +324,21 @@ func main() {
 			}
 			start := time.Now()
 
+			if explain {
+				nresults, err := godb.ExplainAnalyze(plan, bp, tid)
+				if err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				}
+				if autocommit {
+					bp.CommitTransaction(tid)
+					saveStats()
+				}
+				printPlan(plan)
+				fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
+				fmt.Printf("\033[32;1m%v\033[0m\n\n", time.Since(start))
+				break
+			}
+
 			iter, err := plan.Iterator(tid)
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
@@ -268,6 +368,7 @@ func main() {
 			}
 			if autocommit {
 				bp.CommitTransaction(tid)
+				saveStats()
 			}
 		outer:
 			fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
@@ -296,12 +397,17 @@ func main() {
 			bp.AbortTransaction(tid)
 			autocommit = true
 			fmt.Printf("\033[32;1mABORT\033[0m\n\n")
+			// the transaction may have dropped tables that are now back
+			if err := c.SaveToFile(catName, catPath); err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		case godb.CommitXactionType:
 			if autocommit {
 				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot commit transaction unless in transaction")
 				continue
 			}
 			bp.CommitTransaction(tid)
+			saveStats()
 			autocommit = true
 			fmt.Printf("\033[32;1mCOMMIT\033[0m\n\n")
 		case godb.CreateTableQueryType:
@@ -316,6 +422,29 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.AlterTableQueryType:
+			fmt.Printf("\033[32;1mALTER\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.CreateViewQueryType:
+			fmt.Printf("\033[32;1mCREATE VIEW\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropViewQueryType:
+			fmt.Printf("\033[32;1mDROP VIEW\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.RefreshViewQueryType:
+			fmt.Printf("\033[32;1mREFRESH\033[0m\n\n")
+		case godb.AnalyzeQueryType:
+			fmt.Printf("\033[32;1mANALYZE\033[0m\n\n")
+			saveStats()
 		}
 	}
 }